@@ -24,6 +24,15 @@ func main() {
 	// Inicializa storage de mídia
 	service.InitMediaStorage()
 
+	// Inicia a fila durável de processamento de webhooks
+	service.StartWebhookQueue()
+
+	// Inicia o outbox: envio assíncrono das mensagens de saída, com retries
+	service.StartOutbox()
+
+	// Inicia a leitura periódica das caixas IMAP das inboxes de email
+	service.StartEmailPoller()
+
 	r := gin.Default()
 
 	// Configurar trusted proxies de forma segura
@@ -45,7 +54,7 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, api_access_token")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, api_access_token, X-Widget-Session")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, DELETE, PATCH")
 		c.Writer.Header().Set("Access-Control-Expose-Headers", "Content-Length, Content-Type")
 		c.Writer.Header().Set("Access-Control-Max-Age", "86400") // 24 horas
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"mensager-go/internal/db"
+	"mensager-go/internal/repository"
+
+	"github.com/joho/godotenv"
+)
+
+// Correção única de contatos e conversas duplicados criados antes dos índices únicos.
+// Uso: go run ./cmd/repair-duplicates [-dry-run]
+func main() {
+	dryRun := flag.Bool("dry-run", false, "apenas conta os duplicados, sem gravar")
+	flag.Parse()
+
+	if os.Getenv("DOCKER_ENV") == "" {
+		godotenv.Load()
+	}
+
+	db.Init()
+
+	report, err := repository.RepairDuplicates(*dryRun)
+	if err != nil {
+		log.Fatalf("❌ Failed to repair duplicates: %v", err)
+	}
+
+	if *dryRun {
+		log.Printf("🔎 Dry run: %d duplicate contacts and %d duplicate conversations would be merged",
+			report.ContactsMerged, report.ConversationsMerged)
+		return
+	}
+
+	log.Printf("✅ Merged %d duplicate contacts and %d duplicate conversations", report.ContactsMerged, report.ConversationsMerged)
+
+	if err := db.EnsureUniqueIndexes(db.Instance); err != nil {
+		log.Fatalf("❌ Failed to create unique indexes: %v", err)
+	}
+	log.Printf("✅ Unique indexes created")
+}
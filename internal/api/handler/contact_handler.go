@@ -118,6 +118,8 @@ func CreateContact(c *gin.Context) {
 		PhoneNumber: req.PhoneNumber,
 		Identifier:  req.Identifier,
 		AvatarURL:   req.AvatarURL,
+		// Nome informado por um agente não é sobrescrito pela sincronização do WhatsApp
+		NameManuallySet: req.Name != "",
 	}
 
 	// Convert additional_attributes to JSON
@@ -179,6 +181,9 @@ func UpdateContact(c *gin.Context) {
 
 	// Atualizar apenas campos enviados
 	if req.Name != nil {
+		if *req.Name != existingContact.Name {
+			existingContact.NameManuallySet = true
+		}
 		existingContact.Name = *req.Name
 	}
 	if req.Email != nil {
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"log"
+	"mensager-go/internal/models"
 	"mensager-go/internal/repository"
+	"mensager-go/internal/service"
 	"net/http"
 	"strconv"
 
@@ -310,3 +312,47 @@ func GetUnreadCounts(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"unread_counts": unreadCounts})
 }
+
+// ToggleTypingStatus - POST /api/v1/conversations/:id/toggle_typing_status
+// Chamado pelo cliente do agente enquanto digita; repassa a presença ao WhatsApp
+func ToggleTypingStatus(c *gin.Context) {
+	accountVal, _ := c.Get("account_id")
+	accountID := accountVal.(uint)
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return
+	}
+
+	var input struct {
+		TypingStatus string `json:"typing_status" binding:"required"` // on, off
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.TypingStatus != "on" && input.TypingStatus != "off" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "typing_status must be 'on' or 'off'"})
+		return
+	}
+
+	conversation, err := repository.GetConversationByID(uint(conversationID))
+	if err != nil || uint(conversation.AccountID) != accountID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return
+	}
+
+	var user *models.User
+	if userVal, ok := c.Get("user"); ok {
+		if u, ok := userVal.(models.User); ok {
+			user = &u
+		}
+	}
+
+	if err := service.SetAgentTyping(uint(conversationID), user, input.TypingStatus == "on"); err != nil {
+		log.Printf("[ToggleTypingStatus] Error relaying typing status for conversation %d: %v", conversationID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"typing_status": input.TypingStatus})
+}
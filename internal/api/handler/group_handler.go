@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"mensager-go/internal/service"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetConversationGroup retorna os metadados do grupo do WhatsApp de uma conversa
+func GetConversationGroup(c *gin.Context) {
+	group, ok := loadConversationGroup(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, group)
+}
+
+// SyncConversationGroup força a sincronização de assunto, avatar e participantes com a Evolution
+func SyncConversationGroup(c *gin.Context) {
+	group, ok := loadConversationGroup(c)
+	if !ok {
+		return
+	}
+
+	if _, err := service.SyncGroup(group.InboxID, group.JID); err != nil {
+		log.Printf("[SyncConversationGroup] Error syncing group %s: %v", group.JID, err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	synced, err := repository.GetGroupByContact(group.InboxID, group.ContactID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, synced)
+}
+
+// loadConversationGroup busca o grupo da conversa verificando se pertence à conta do usuário
+func loadConversationGroup(c *gin.Context) (*models.Group, bool) {
+	accountVal, _ := c.Get("account_id")
+	accountID := accountVal.(uint)
+
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid conversation ID"})
+		return nil, false
+	}
+
+	conversation, err := repository.GetConversationByID(uint(conversationID))
+	if err != nil || uint(conversation.AccountID) != accountID {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation not found"})
+		return nil, false
+	}
+
+	group, err := repository.GetGroupByContact(uint(conversation.InboxID), uint(conversation.ContactID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Conversation is not a group"})
+		return nil, false
+	}
+
+	return group, true
+}
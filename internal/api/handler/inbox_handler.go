@@ -1,8 +1,10 @@
 package handler
 
 import (
+	"log"
 	"mensager-go/internal/db"
 	"mensager-go/internal/models"
+	"mensager-go/internal/service"
 	"net/http"
 	"strconv"
 
@@ -117,9 +119,134 @@ func CreateInbox(c *gin.Context) {
 		return
 	}
 
+	// Gerar segredo do webhook de entrada da inbox
+	if err := assignWebhookSecret(&inbox); err != nil {
+		log.Printf("[CreateInbox] Warning: Failed to generate webhook secret for inbox %d: %v", inbox.ID, err)
+	}
+
 	c.JSON(http.StatusCreated, inbox)
 }
 
+// RotateInboxWebhookSecret gera um novo segredo de webhook para a inbox (o anterior deixa de valer)
+func RotateInboxWebhookSecret(c *gin.Context) {
+	accountIDVal, exists := c.Get("account_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account ID not found"})
+		return
+	}
+
+	// O segredo autentica os webhooks recebidos: apenas administradores
+	if !isAdministrator(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can rotate the webhook secret"})
+		return
+	}
+
+	accountID := accountIDVal.(uint)
+	inboxID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inbox ID"})
+		return
+	}
+
+	var inbox models.Inbox
+	if err := db.Instance.Where("id = ? AND account_id = ?", inboxID, accountID).First(&inbox).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbox not found"})
+		return
+	}
+
+	if err := assignWebhookSecret(&inbox); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rotate webhook secret", "details": err.Error()})
+		return
+	}
+
+	log.Printf("[RotateInboxWebhookSecret] Webhook secret rotated for inbox %d", inbox.ID)
+	c.JSON(http.StatusOK, gin.H{
+		"inbox_id":       inbox.ID,
+		"webhook_secret": inbox.WebhookSecret,
+		"webhook_url":    inbox.WebhookURL,
+	})
+}
+
+// GetInboxConnection retorna o status de conexão da instância que atende a inbox,
+// usado na tela de conversa para avisar o agente quando o WhatsApp está desconectado
+func GetInboxConnection(c *gin.Context) {
+	accountIDVal, exists := c.Get("account_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account ID not found"})
+		return
+	}
+
+	accountID := accountIDVal.(uint)
+	inboxID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inbox ID"})
+		return
+	}
+
+	var inbox models.Inbox
+	if err := db.Instance.Where("id = ? AND account_id = ?", inboxID, accountID).First(&inbox).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbox not found"})
+		return
+	}
+
+	integration, err := service.GetInboxConnectionStatus(&inbox)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"inbox_id":          inbox.ID,
+		"integration_id":    integration.ID,
+		"status":            integration.Status,
+		"status_reason":     integration.StatusReason,
+		"status_changed_at": integration.StatusChangedAt,
+		"disconnected":      service.IsIntegrationDisconnected(integration.Status),
+	})
+}
+
+// GetInboxHistoryImport - GET /api/v1/inboxes/:id/history-import
+// Retorna o progresso da importação do histórico do WhatsApp da inbox
+func GetInboxHistoryImport(c *gin.Context) {
+	accountIDVal, exists := c.Get("account_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Account ID not found"})
+		return
+	}
+
+	accountID := accountIDVal.(uint)
+	inboxID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid inbox ID"})
+		return
+	}
+
+	var inbox models.Inbox
+	if err := db.Instance.Where("id = ? AND account_id = ?", inboxID, accountID).First(&inbox).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Inbox not found"})
+		return
+	}
+
+	historyImport, err := service.GetHistoryImport(uint(inbox.ID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No history import for this inbox"})
+		return
+	}
+
+	c.JSON(http.StatusOK, historyImport)
+}
+
+// assignWebhookSecret gera e grava um novo segredo de webhook, preenchendo-o na inbox para a resposta
+func assignWebhookSecret(inbox *models.Inbox) error {
+	secret, err := service.RotateInboxWebhookSecret(inbox)
+	if err != nil {
+		return err
+	}
+	inbox.WebhookSecret = secret
+	inbox.WebhookURL = service.InboxWebhookURL(inbox, secret)
+	return nil
+}
+
 // UpdateInbox atualiza uma inbox existente
 func UpdateInbox(c *gin.Context) {
 	accountIDVal, exists := c.Get("account_id")
@@ -225,13 +352,23 @@ func DeleteInbox(c *gin.Context) {
 		return
 	}
 
-	// 2. Deletar MessageReadStatus se houver conversas
+	// 2. Deletar MessageReadStatus, MessageRevision e MessageReaction se houver conversas
 	if len(conversationIDs) > 0 {
 		if err := tx.Where("conversation_id IN ?", conversationIDs).Delete(&models.MessageReadStatus{}).Error; err != nil {
 			tx.Rollback()
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message read statuses"})
 			return
 		}
+		if err := tx.Where("conversation_id IN ?", conversationIDs).Delete(&models.MessageRevision{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message revisions"})
+			return
+		}
+		if err := tx.Where("conversation_id IN ?", conversationIDs).Delete(&models.MessageReaction{}).Error; err != nil {
+			tx.Rollback()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message reactions"})
+			return
+		}
 	}
 
 	// 3. Deletar mensagens associadas à inbox
@@ -248,6 +385,51 @@ func DeleteInbox(c *gin.Context) {
 		return
 	}
 
+	// Deletar webhooks registrados da inbox
+	if err := tx.Where("inbox_id = ?", inboxID).Delete(&models.WebhookLog{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox webhook logs"})
+		return
+	}
+
+	// Deletar o progresso de importação de histórico da inbox
+	if err := tx.Where("inbox_id = ?", inboxID).Delete(&models.HistoryImport{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox history import"})
+		return
+	}
+	if err := tx.Where("inbox_id = ?", inboxID).Delete(&models.HistoryImportBatch{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox history import"})
+		return
+	}
+
+	// Deletar a posição da leitura IMAP da inbox (canal de email)
+	if err := tx.Where("inbox_id = ?", inboxID).Delete(&models.EmailPollState{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox email poll state"})
+		return
+	}
+
+	// Deletar as sessões de visitantes do widget (canal website)
+	if err := tx.Where("inbox_id = ?", inboxID).Delete(&models.WidgetSession{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox widget sessions"})
+		return
+	}
+
+	// Deletar grupos do WhatsApp sincronizados na inbox (e seus participantes)
+	if err := tx.Where("group_id IN (?)", tx.Model(&models.Group{}).Select("id").Where("inbox_id = ?", inboxID)).Delete(&models.GroupParticipant{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox groups"})
+		return
+	}
+	if err := tx.Where("inbox_id = ?", inboxID).Delete(&models.Group{}).Error; err != nil {
+		tx.Rollback()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete inbox groups"})
+		return
+	}
+
 	// 5. Deletar a inbox
 	if err := tx.Delete(&inbox).Error; err != nil {
 		tx.Rollback()
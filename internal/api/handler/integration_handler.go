@@ -6,8 +6,12 @@ import (
 	"log"
 	"mensager-go/internal/db"
 	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"mensager-go/internal/service"
 	"net/http"
 	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -102,10 +106,27 @@ func CreateChatwootInbox(c *gin.Context) {
 	// 1. Buscar ou criar Integration (acts as Channel)
 	var integration models.Integration
 
-	// Tentar encontrar integração existente do mesmo tipo para esta conta
-	err := db.Instance.Where("account_id = ? AND provider = ?", accountID, input.Channel.Type).First(&integration).Error
+	if isGenericAPIInbox(input.Channel.Type, input.Channel.WebhookURL, evolutionAPIKey, evolutionInstance) {
+		// Canal api genérico: integração própria por inbox, com o webhook_url que recebe as respostas dos agentes
+		configMap := map[string]interface{}{}
+		_ = json.Unmarshal(input.Channel.Config, &configMap)
+		configMap["webhook_url"] = input.Channel.WebhookURL
 
-	if err != nil {
+		configBytes, _ := json.Marshal(configMap)
+		integration = models.Integration{
+			AccountID: accountID,
+			Provider:  service.APIChannelIntegrationProvider,
+			Config:    datatypes.JSON(configBytes),
+			Status:    "active",
+		}
+		if err := db.Instance.Create(&integration).Error; err != nil {
+			log.Printf("[Integration] Error creating api channel integration: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create channel/integration", "details": err.Error()})
+			return
+		}
+		log.Printf("[Integration] New api channel integration created: ID=%d, WebhookURL=%s", integration.ID, input.Channel.WebhookURL)
+	} else if err := db.Instance.Where("account_id = ? AND provider = ?", accountID, input.Channel.Type).First(&integration).Error; err != nil {
+		// Tentar encontrar integração existente do mesmo tipo para esta conta
 		// Se não existir, criar nova integração
 		log.Printf("[Integration] No existing integration found, creating new one")
 		integration = models.Integration{
@@ -146,7 +167,7 @@ func CreateChatwootInbox(c *gin.Context) {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create channel/integration", "details": err.Error()})
 			return
 		}
-		log.Printf("[Integration] New integration created: ID=%d, Provider=%s, Config=%s", integration.ID, integration.Provider, string(configBytes))
+		log.Printf("[Integration] New integration created: ID=%d, Provider=%s", integration.ID, integration.Provider)
 	} else {
 		// Integração existente encontrada, atualizar config se necessário
 		log.Printf("[Integration] Using existing integration: ID=%d, Provider=%s", integration.ID, integration.Provider)
@@ -175,7 +196,7 @@ func CreateChatwootInbox(c *gin.Context) {
 		configBytes, _ := json.Marshal(configMap)
 		integration.Config = datatypes.JSON(configBytes)
 		db.Instance.Model(&integration).Update("config", integration.Config)
-		log.Printf("[Integration] Integration config updated: ID=%d, Config=%s", integration.ID, string(configBytes))
+		log.Printf("[Integration] Integration config updated: ID=%d", integration.ID)
 	}
 
 	// 2. Create Inbox linked to this Integration
@@ -199,11 +220,61 @@ func CreateChatwootInbox(c *gin.Context) {
 		// Não retornar erro, inbox foi criada com sucesso
 	}
 
+	// 4. Gerar segredo do webhook de entrada da inbox
+	if err := assignWebhookSecret(&inbox); err != nil {
+		log.Printf("[Integration] Warning: Failed to generate webhook secret for inbox %d: %v", inbox.ID, err)
+	}
+
 	log.Printf("[Integration] Inbox created successfully: ID=%d, Name=%s, IntegrationID=%d (status updated to 'connected')", inbox.ID, inbox.Name, integration.ID)
 
 	c.JSON(http.StatusOK, inbox)
 }
 
+// redactIntegration remove do config as credenciais (tokens, senhas, chaves de API) e os segredos de webhook
+// das inboxes antes de devolver a integração; elas só são alteradas, nunca lidas pela API
+func redactIntegration(integration models.Integration) models.Integration {
+	configMap := map[string]interface{}{}
+	if len(integration.Config) == 0 || json.Unmarshal(integration.Config, &configMap) != nil {
+		integration.Config = nil
+		return integration
+	}
+	for key := range configMap {
+		if isSecretConfigKey(key) {
+			delete(configMap, key)
+		}
+	}
+	configBytes, _ := json.Marshal(configMap)
+	integration.Config = datatypes.JSON(configBytes)
+	return integration
+}
+
+// isSecretConfigKey identifica chaves do config com credenciais (api_key, EvolutionAPIToken, app_secret, smtp_password, webhook_secrets...)
+func isSecretConfigKey(key string) bool {
+	name := strings.ToLower(strings.ReplaceAll(key, "_", ""))
+	for _, marker := range []string{"token", "secret", "password", "apikey"} {
+		if strings.Contains(name, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// isAdministrator indica se o usuário autenticado é administrador da conta
+func isAdministrator(c *gin.Context) bool {
+	role, _ := c.Get("user_role")
+	return role == "administrator" || role == "admin"
+}
+
+// isGenericAPIInbox identifica a criação de uma inbox do canal api genérico: tipo "api" sem as credenciais
+// da Evolution e com um webhook_url que não é o da integração Chatwoot da Evolution (/chatwoot/webhook/<instância>)
+func isGenericAPIInbox(channelType, webhookURL, evolutionAPIKey, evolutionInstance string) bool {
+	return channelType == "api" &&
+		webhookURL != "" &&
+		evolutionAPIKey == "" &&
+		evolutionInstance == "" &&
+		!strings.Contains(webhookURL, "/chatwoot/webhook")
+}
+
 // ListIntegrations - GET /api/v1/integrations
 func ListIntegrations(c *gin.Context) {
 	accountID, exists := c.Get("account_id")
@@ -218,6 +289,9 @@ func ListIntegrations(c *gin.Context) {
 		return
 	}
 
+	for i := range integrations {
+		integrations[i] = redactIntegration(integrations[i])
+	}
 	c.JSON(http.StatusOK, integrations)
 }
 
@@ -247,7 +321,7 @@ func CreateIntegration(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusCreated, integration)
+	c.JSON(http.StatusCreated, redactIntegration(integration))
 }
 
 // UpdateIntegration - PUT /api/v1/integrations/:id
@@ -273,6 +347,12 @@ func UpdateIntegration(c *gin.Context) {
 		APIKey       string `json:"api_key"`
 		InstanceName string `json:"instance_name"`
 		WebhookURL   string `json:"webhook_url"`
+
+		// Limites de envio (0 = sem limite)
+		RateLimitPerSecond *int `json:"rate_limit_per_second"`
+		RateLimitPerMinute *int `json:"rate_limit_per_minute"`
+		TypingDelayMinMs   *int `json:"typing_delay_min_ms"`
+		TypingDelayMaxMs   *int `json:"typing_delay_max_ms"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -299,6 +379,21 @@ func UpdateIntegration(c *gin.Context) {
 	if input.WebhookURL != "" {
 		configMap["webhook_url"] = input.WebhookURL
 	}
+	for key, value := range map[string]*int{
+		"rate_limit_per_second": input.RateLimitPerSecond,
+		"rate_limit_per_minute": input.RateLimitPerMinute,
+		"typing_delay_min_ms":   input.TypingDelayMinMs,
+		"typing_delay_max_ms":   input.TypingDelayMaxMs,
+	} {
+		if value == nil {
+			continue
+		}
+		if *value < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + " must not be negative"})
+			return
+		}
+		configMap[key] = *value
+	}
 
 	configBytes, _ := json.Marshal(configMap)
 	integration.Config = datatypes.JSON(configBytes)
@@ -308,8 +403,8 @@ func UpdateIntegration(c *gin.Context) {
 		return
 	}
 
-	log.Printf("[Integration] Integration updated: ID=%d, Config=%s", integration.ID, string(configBytes))
-	c.JSON(http.StatusOK, integration)
+	log.Printf("[Integration] Integration updated: ID=%d", integration.ID)
+	c.JSON(http.StatusOK, redactIntegration(integration))
 }
 
 // DeleteIntegration - DELETE /api/v1/integrations/:id
@@ -321,6 +416,10 @@ func DeleteIntegration(c *gin.Context) {
 	}
 
 	id := c.Param("id")
+	if err := db.Instance.Where("integration_id = ? AND account_id = ?", id, accountID.(uint)).Delete(&models.IntegrationStatusEvent{}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete integration"})
+		return
+	}
 	if err := db.Instance.Where("id = ? AND account_id = ?", id, accountID.(uint)).Delete(&models.Integration{}).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete integration"})
 		return
@@ -328,3 +427,104 @@ func DeleteIntegration(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Integration deleted"})
 }
+
+// GetIntegrationQRCode - GET /api/v1/integrations/:id/qrcode
+// Retorna o QR code atual para que um administrador possa parear a instância novamente
+func GetIntegrationQRCode(c *gin.Context) {
+	accountID, exists := c.Get("account_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	// O QR code dá acesso à conta do WhatsApp: apenas administradores
+	if !isAdministrator(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can access the QR code"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid integration ID"})
+		return
+	}
+
+	integration, err := repository.GetIntegration(uint(id), accountID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return
+	}
+
+	if integration.QRCode == "" && integration.QRCodeText == "" && integration.PairingCode == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No QR code available", "status": integration.Status})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"integration_id": integration.ID,
+		"status":         integration.Status,
+		"qrcode":         integration.QRCode,
+		"code":           integration.QRCodeText,
+		"pairing_code":   integration.PairingCode,
+		"updated_at":     integration.QRCodeUpdatedAt,
+	})
+}
+
+// ListIntegrationStatusEvents - GET /api/v1/integrations/:id/status-events
+func ListIntegrationStatusEvents(c *gin.Context) {
+	accountID, exists := c.Get("account_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid integration ID"})
+		return
+	}
+
+	integration, err := repository.GetIntegration(uint(id), accountID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return
+	}
+
+	events, err := repository.ListIntegrationStatusEvents(integration.ID, 100)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch status events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, events)
+}
+
+// GetIntegrationSendQueue - GET /api/v1/integrations/:id/send-queue
+// Retorna a profundidade da fila de envio (outbox), os limites de taxa e o estado do limitador da integração
+func GetIntegrationSendQueue(c *gin.Context) {
+	accountID, exists := c.Get("account_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid integration ID"})
+		return
+	}
+
+	integration, err := repository.GetIntegration(uint(id), accountID.(uint))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Integration not found"})
+		return
+	}
+
+	status, err := service.GetSendQueueStatus(integration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch send queue"})
+		return
+	}
+
+	c.JSON(http.StatusOK, status)
+}
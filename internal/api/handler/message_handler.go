@@ -38,6 +38,11 @@ func ListMessages(c *gin.Context) {
 		return
 	}
 
+	attachReactions(messages)
+	if err := service.AttachQuotedPreviews(messages); err != nil {
+		log.Printf("[ListMessages] Error loading quoted previews: %v", err)
+	}
+
 	// Contar total para paginação
 	total, _ := repository.CountMessagesByConversation(uint(conversationID))
 
@@ -51,13 +56,90 @@ func ListMessages(c *gin.Context) {
 	})
 }
 
+// attachReactions carrega as reações das mensagens listadas
+func attachReactions(messages []models.Message) {
+	messageIDs := make([]uint, len(messages))
+	for i, msg := range messages {
+		messageIDs[i] = msg.ID
+	}
+
+	reactions, err := repository.ListReactionsByMessageIDs(messageIDs)
+	if err != nil {
+		log.Printf("[attachReactions] Error loading reactions: %v", err)
+		return
+	}
+
+	for i := range messages {
+		messages[i].Reactions = reactions[messages[i].ID]
+	}
+}
+
+// ReactToMessage adiciona, troca ou remove (DELETE ou emoji vazio) a reação do agente a uma mensagem
+func ReactToMessage(c *gin.Context) {
+	conversationID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid conversation_id"})
+		return
+	}
+
+	messageID, err := strconv.ParseUint(c.Param("message_id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	var input struct {
+		Emoji string `json:"emoji"`
+	}
+	if c.Request.Method != http.MethodDelete {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	accountIDVal, _ := c.Get("account_id")
+	accountID, _ := accountIDVal.(uint)
+	conversation, err := repository.GetConversationByID(uint(conversationID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "conversation not found"})
+		return
+	}
+	if uint(conversation.AccountID) != accountID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "user not found"})
+		return
+	}
+
+	reactions, err := service.ReactToMessage(uint(conversationID), uint(messageID), userIDVal.(uint), input.Emoji)
+	if err != nil {
+		log.Printf("[ReactToMessage] Error reacting to message %d: %v", messageID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id": messageID,
+		"reactions":  reactions,
+	})
+}
+
 // SendMessageInput input para enviar mensagem
 type SendMessageInput struct {
-	ConversationID uint   `json:"conversation_id" binding:"required"`
-	Content        string `json:"content" binding:"required"`
-	ContentType    string `json:"content_type"` // text, image, video, audio, document
-	MediaURL       string `json:"media_url"`
-	Private        bool   `json:"private"`
+	ConversationID uint                     `json:"conversation_id" binding:"required"`
+	Content        string                   `json:"content"`
+	ContentType    string                   `json:"content_type"` // text, image, video, audio, document
+	MediaURL       string                   `json:"media_url"`
+	Private        bool                     `json:"private"`
+	InReplyTo      *uint                    `json:"in_reply_to"` // ID da mensagem respondida (citação)
+	Mentions       []uint                   `json:"mentions"`    // IDs dos contatos mencionados (grupos)
+	MentionAll     bool                     `json:"mention_all"` // Mencionar todos do grupo
+	Template       *service.MessageTemplate `json:"template"`    // Template aprovado (WhatsApp Cloud API)
 }
 
 // SendMessage envia uma nova mensagem
@@ -67,6 +149,10 @@ func SendMessage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Content == "" && input.Template == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
 
 	// Obter user_id do contexto
 	userIDVal, exists := c.Get("user_id")
@@ -82,7 +168,12 @@ func SendMessage(c *gin.Context) {
 	}
 
 	// Usar o serviço para enviar
-	message, err := service.SendMessage(input.ConversationID, input.Content, input.ContentType, input.MediaURL, userID)
+	message, err := service.SendMessage(input.ConversationID, input.Content, input.ContentType, input.MediaURL, userID, service.SendMessageOptions{
+		InReplyTo:  input.InReplyTo,
+		Mentions:   input.Mentions,
+		MentionAll: input.MentionAll,
+		Template:   input.Template,
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -102,10 +193,14 @@ func SendMessageToConversation(c *gin.Context) {
 	}
 
 	var input struct {
-		Content     string `json:"content" binding:"required"`
-		ContentType string `json:"content_type"`
-		MediaURL    string `json:"media_url"`
-		Private     bool   `json:"private"`
+		Content     string                   `json:"content"`
+		ContentType string                   `json:"content_type"`
+		MediaURL    string                   `json:"media_url"`
+		Private     bool                     `json:"private"`
+		InReplyTo   *uint                    `json:"in_reply_to"`
+		Mentions    []uint                   `json:"mentions"`
+		MentionAll  bool                     `json:"mention_all"`
+		Template    *service.MessageTemplate `json:"template"`
 	}
 
 	if err := c.ShouldBindJSON(&input); err != nil {
@@ -113,6 +208,10 @@ func SendMessageToConversation(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if input.Content == "" && input.Template == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "content is required"})
+		return
+	}
 
 	log.Printf("[SendMessageToConversation] Processing message for conversation %d: content=%s, contentType=%s",
 		conversationID, input.Content, input.ContentType)
@@ -130,7 +229,12 @@ func SendMessageToConversation(c *gin.Context) {
 		input.ContentType = "text"
 	}
 
-	message, err := service.SendMessage(uint(conversationID), input.Content, input.ContentType, input.MediaURL, userID)
+	message, err := service.SendMessage(uint(conversationID), input.Content, input.ContentType, input.MediaURL, userID, service.SendMessageOptions{
+		InReplyTo:  input.InReplyTo,
+		Mentions:   input.Mentions,
+		MentionAll: input.MentionAll,
+		Template:   input.Template,
+	})
 	if err != nil {
 		log.Printf("[SendMessageToConversation] Error sending message: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -175,6 +279,48 @@ func GetMessage(c *gin.Context) {
 	c.JSON(http.StatusOK, message)
 }
 
+// ListMessageRevisions retorna o histórico de edições/remoções de uma mensagem
+func ListMessageRevisions(c *gin.Context) {
+	// O texto original de mensagens apagadas é para auditoria: apenas administradores
+	// (os agentes veem só as flags revoked/edited da mensagem)
+	if !isAdministrator(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can view message revisions"})
+		return
+	}
+
+	messageIDStr := c.Param("id")
+	messageID, err := strconv.ParseUint(messageIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid message id"})
+		return
+	}
+
+	message, err := repository.GetMessageByID(uint(messageID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "message not found"})
+		return
+	}
+
+	accountIDVal, _ := c.Get("account_id")
+	if accountID, ok := accountIDVal.(uint); !ok || message.AccountID != accountID {
+		c.JSON(http.StatusForbidden, gin.H{"error": "access denied"})
+		return
+	}
+
+	revisions, err := repository.ListMessageRevisions(message.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch message revisions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message_id": message.ID,
+		"revoked":    message.Revoked,
+		"edited":     message.Edited,
+		"revisions":  revisions,
+	})
+}
+
 // MarkConversationAsRead marca todas as mensagens de uma conversa como lidas
 func MarkConversationAsRead(c *gin.Context) {
 	conversationIDStr := c.Param("id")
@@ -315,6 +461,11 @@ func ListConversationMessages(c *gin.Context) {
 		return
 	}
 
+	attachReactions(messages)
+	if err := service.AttachQuotedPreviews(messages); err != nil {
+		log.Printf("[ListConversationMessages] Error loading quoted previews: %v", err)
+	}
+
 	c.JSON(http.StatusOK, messages)
 }
 
@@ -549,36 +700,23 @@ func CreateChatwootMessage(c *gin.Context) {
 		message.FileSize = nil
 	}
 
-	if err := repository.CreateMessage(message); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
-		return
-	}
-
-	log.Printf("[CreateChatwootMessage] Message created: ID=%d, Type=%s, HasMedia=%v", message.ID, contentType, mediaURL != "")
-
-	// Se for mensagem outgoing, enviar para WhatsApp via Evolution API
-	// MAS NÃO enviar se a mensagem veio do WhatsApp (source_id começa com "WAID:")
-	if messageType == 1 { // outgoing
-		// Verificar se a mensagem originou do WhatsApp (fromMe)
+	// Mensagens outgoing criadas pelo agente ou sistema vão para o outbox e são enviadas pelo canal da inbox.
+	// Notas privadas e mensagens que vieram do próprio WhatsApp (source_id começa com "WAID:") são apenas gravadas.
+	if messageType == models.MessageTypeOutgoing && !private && !strings.HasPrefix(sourceID, "WAID:") {
+		err = service.QueueOutgoingMessage(message, service.SendMessageOptions{})
+	} else {
 		if strings.HasPrefix(sourceID, "WAID:") {
 			log.Printf("[CreateChatwootMessage] Skipping WhatsApp send - message originated from WhatsApp (fromMe): source_id=%s", sourceID)
-		} else {
-			// Mensagem criada pelo agente ou sistema - enviar para WhatsApp
-			go func() {
-				// Enviar via Evolution API (async)
-				_, err := service.SendMessage(uint(conversationID), content, contentType, mediaURL, 0)
-				if err != nil {
-					log.Printf("[CreateChatwootMessage] ERROR sending to WhatsApp: %v", err)
-					// Atualizar status da mensagem para failed
-					message.Status = "failed"
-					db.Instance.Save(message)
-				} else {
-					log.Printf("[CreateChatwootMessage] Successfully sent to WhatsApp: ID=%d", message.ID)
-				}
-			}()
 		}
+		err = repository.CreateMessage(message)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
+	log.Printf("[CreateChatwootMessage] Message created: ID=%d, Type=%s, Status=%s, HasMedia=%v", message.ID, contentType, message.Status, mediaURL != "")
+
 	// Broadcast em tempo real para clientes conectados
 	log.Printf("[CreateChatwootMessage] Broadcasting message.new to conversation %d", conversationID)
 	BroadcastToConversation(uint(conversationID), RealtimeEvent{
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/service"
 	"net/http"
 	"sync"
 	"time"
@@ -23,6 +25,10 @@ type Client struct {
 	AccountID      uint
 	ConversationID *uint
 	Channel        chan RealtimeEvent
+
+	// Visitante do widget (canal website): recebe apenas os eventos públicos da própria conversa
+	Visitor   bool
+	SessionID uint
 }
 
 // Hub gerencia todas as conexões SSE
@@ -68,6 +74,9 @@ func (h *Hub) run() {
 		case event := <-h.broadcast:
 			h.mu.RLock()
 			for _, client := range h.clients {
+				if client.Visitor {
+					continue
+				}
 				select {
 				case client.Channel <- event:
 				default:
@@ -91,7 +100,7 @@ func BroadcastToAccount(accountID uint, event RealtimeEvent) {
 	defer hub.mu.RUnlock()
 
 	for _, client := range hub.clients {
-		if client.AccountID == accountID {
+		if client.AccountID == accountID && !client.Visitor {
 			select {
 			case client.Channel <- event:
 			default:
@@ -109,6 +118,9 @@ func BroadcastToConversation(conversationID uint, event RealtimeEvent) {
 	sentCount := 0
 	for _, client := range hub.clients {
 		if client.ConversationID != nil && *client.ConversationID == conversationID {
+			if client.Visitor && !visibleToVisitor(event) {
+				continue
+			}
 			select {
 			case client.Channel <- event:
 				sentCount++
@@ -120,6 +132,41 @@ func BroadcastToConversation(conversationID uint, event RealtimeEvent) {
 	log.Printf("[BroadcastToConversation] Sent event %s to %d clients for conversation %d", event.Type, sentCount, conversationID)
 }
 
+// SetVisitorConversation inscreve os clientes de uma sessão do widget na conversa do visitante
+// (a conversa é criada na primeira mensagem, depois de o stream já estar aberto)
+func SetVisitorConversation(sessionID uint, conversationID uint) {
+	hub.mu.Lock()
+	defer hub.mu.Unlock()
+
+	for _, client := range hub.clients {
+		if client.Visitor && client.SessionID == sessionID {
+			id := conversationID
+			client.ConversationID = &id
+		}
+	}
+}
+
+// visibleToVisitor filtra os eventos da conversa repassados ao visitante: mensagens públicas, reações e
+// "digitando" dos agentes. Notas privadas e eventos internos ficam restritos aos agentes.
+func visibleToVisitor(event RealtimeEvent) bool {
+	switch event.Type {
+	case string(service.EventMessageNew), string(service.EventMessageUpdated):
+		switch message := event.Payload.(type) {
+		case *models.Message:
+			return message != nil && !message.Private
+		case models.Message:
+			return !message.Private
+		}
+	case string(service.EventMessageReaction):
+		return true
+	case string(service.EventTypingOn), string(service.EventTypingOff):
+		if typing, ok := event.Payload.(service.TypingPayload); ok {
+			return typing.SenderType == "User"
+		}
+	}
+	return false
+}
+
 // RealtimeHandler gerencia conexões SSE (Server-Sent Events)
 func RealtimeHandler(c *gin.Context) {
 	// Verificar autenticação
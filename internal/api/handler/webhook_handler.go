@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"errors"
 	"io"
 	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
 	"mensager-go/internal/service"
 	"net/http"
 	"strconv"
@@ -10,17 +13,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// EvolutionWebhookHandler processa webhooks da Evolution API
-func EvolutionWebhookHandler(c *gin.Context) {
-	inboxIDStr := c.Query("inbox_id")
-	if inboxIDStr == "" {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "inbox_id is required"})
-		return
-	}
+// ChannelWebhookHandler recebe webhooks dos canais (POST /webhooks/:provider?inbox_id=)
+// O canal autentica a requisição; o payload é gravado na fila e processado de forma assíncrona.
+func ChannelWebhookHandler(c *gin.Context) {
+	provider := c.Param("provider")
 
-	inboxID, err := strconv.ParseUint(inboxIDStr, 10, 32)
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inbox_id"})
+	inbox, channel, ok := resolveWebhookInbox(c, provider)
+	if !ok {
 		return
 	}
 
@@ -31,16 +30,114 @@ func EvolutionWebhookHandler(c *gin.Context) {
 		return
 	}
 
-	// Log do webhook recebido (opcional - pode ser removido em produção)
-	log.Printf("Received Evolution webhook for inbox %d: %s", inboxID, string(body))
+	req := inboundRequest(c, body)
+	if err := channel.VerifyWebhook(inbox, req); err != nil {
+		log.Printf("[ChannelWebhook] Rejected %s webhook for inbox %d from %s: %v", provider, inbox.ID, c.ClientIP(), err)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
+		return
+	}
 
-	// Processar webhook
-	err = service.ProcessEvolutionWebhook(uint(inboxID), body)
+	// Canais com webhooks em outro formato (ex.: formulário) são convertidos para JSON
+	payload, err := service.DecodeWebhookPayload(channel, req)
 	if err != nil {
-		log.Printf("Error processing Evolution webhook: %v", err)
+		log.Printf("[ChannelWebhook] Invalid %s webhook for inbox %d: %v", provider, inbox.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid payload"})
+		return
+	}
+
+	if err := service.ValidateWebhookPayload(channel, payload); err != nil {
+		log.Printf("[ChannelWebhook] Rejected invalid %s webhook for inbox %d: %v", provider, inbox.ID, err)
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Só o tamanho: o corpo tem dados pessoais e mídia em base64
+	log.Printf("Received %s webhook for inbox %d (%d bytes)", provider, inbox.ID, len(payload))
+
+	// Gravar o payload bruto e responder imediatamente; o processamento é feito pela fila
+	webhookLog, err := service.EnqueueWebhook(uint(inbox.ID), channel.Provider(), payload)
+	if err != nil {
+		log.Printf("Error queueing %s webhook: %v", provider, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhook processed successfully"})
+	if contentType, ack, ok := service.WebhookAck(channel); ok {
+		c.Data(http.StatusOK, contentType, ack)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": "success", "message": "webhook queued", "id": webhookLog.ID})
+}
+
+// ChannelWebhookChallenge responde à verificação da URL de webhook (GET /webhooks/:provider?inbox_id=)
+// usada por canais como a WhatsApp Cloud API: o desafio é devolvido em texto puro.
+func ChannelWebhookChallenge(c *gin.Context) {
+	provider := c.Param("provider")
+
+	inbox, channel, ok := resolveWebhookInbox(c, provider)
+	if !ok {
+		return
+	}
+
+	challenge, err := service.VerifyWebhookChallenge(channel, inbox, c.Request.URL.Query())
+	if err != nil {
+		log.Printf("[ChannelWebhook] Rejected %s webhook challenge for inbox %d from %s: %v", provider, inbox.ID, c.ClientIP(), err)
+		c.JSON(http.StatusForbidden, gin.H{"error": "verification failed"})
+		return
+	}
+
+	c.String(http.StatusOK, challenge)
+}
+
+// resolveWebhookInbox busca a inbox do webhook e confere se ela é atendida pelo canal da URL
+func resolveWebhookInbox(c *gin.Context, provider string) (*models.Inbox, service.Channel, bool) {
+	inboxIDStr := c.Query("inbox_id")
+	if inboxIDStr == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "inbox_id is required"})
+		return nil, nil, false
+	}
+
+	inboxID, err := strconv.ParseUint(inboxIDStr, 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inbox_id"})
+		return nil, nil, false
+	}
+
+	inbox, err := repository.GetInboxByID(uint(inboxID))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "inbox not found"})
+		return nil, nil, false
+	}
+
+	channel, err := service.ChannelForInbox(inbox)
+	if err != nil && !errors.Is(err, service.ErrChannelNotFound) {
+		log.Printf("[ChannelWebhook] Error resolving channel of inbox %d: %v", inbox.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to resolve inbox channel"})
+		return nil, nil, false
+	}
+	if err != nil || channel.Provider() != provider {
+		log.Printf("[ChannelWebhook] Inbox %d (%s) is not served by channel %s", inbox.ID, inbox.ChannelType, provider)
+		c.JSON(http.StatusNotFound, gin.H{"error": "inbox not found for this channel"})
+		return nil, nil, false
+	}
+
+	return inbox, channel, true
+}
+
+// inboundRequest converte a requisição do gin nos dados repassados ao canal
+func inboundRequest(c *gin.Context, body []byte) *service.InboundRequest {
+	scheme := "http"
+	if c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+
+	return &service.InboundRequest{
+		Method:   c.Request.Method,
+		Header:   c.Request.Header,
+		Query:    c.Request.URL.Query(),
+		Body:     body,
+		URL:      scheme + "://" + c.Request.Host + c.Request.URL.RequestURI(),
+		ClientIP: c.ClientIP(),
+	}
 }
@@ -0,0 +1,205 @@
+package handler
+
+import (
+	"errors"
+	"log"
+	"mensager-go/internal/repository"
+	"mensager-go/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListWebhookLogs - GET /api/v1/webhook-logs?inbox_id=&event=&status=&from=&to=&page=
+func ListWebhookLogs(c *gin.Context) {
+	accountIDVal, _ := c.Get("account_id")
+	accountID := accountIDVal.(uint)
+
+	filter := repository.WebhookLogFilter{
+		AccountID: accountID,
+		Event:     c.Query("event"),
+		Status:    c.Query("status"),
+	}
+
+	if inboxIDStr := c.Query("inbox_id"); inboxIDStr != "" {
+		id, err := strconv.ParseUint(inboxIDStr, 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inbox_id"})
+			return
+		}
+		inboxID := uint(id)
+		filter.InboxID = &inboxID
+	}
+
+	var err error
+	if filter.From, err = parseTimeQuery(c.Query("from")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from (expected RFC3339)"})
+		return
+	}
+	if filter.To, err = parseTimeQuery(c.Query("to")); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to (expected RFC3339)"})
+		return
+	}
+
+	// Paginação
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+	if perPage < 1 || perPage > 200 {
+		perPage = 50
+	}
+
+	logs, total, err := repository.ListWebhookLogs(filter, page, perPage)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"webhook_logs": logs,
+		"meta": gin.H{
+			"count":        len(logs),
+			"total_count":  total,
+			"current_page": page,
+			"per_page":     perPage,
+		},
+	})
+}
+
+// GetWebhookLog - GET /api/v1/webhook-logs/:id (inclui o payload bruto)
+func GetWebhookLog(c *gin.Context) {
+	accountIDVal, _ := c.Get("account_id")
+	accountID := accountIDVal.(uint)
+
+	// O payload bruto tem dados pessoais e credenciais do provedor: apenas administradores
+	if !isAdministrator(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can view webhook payloads"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook log ID"})
+		return
+	}
+
+	webhookLog, err := repository.GetWebhookLog(uint(id), accountID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook log not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, webhookLog)
+}
+
+// ReplayWebhookLog - POST /api/v1/webhook-logs/:id/replay
+// Reprocessa o webhook imediatamente e retorna o registro atualizado
+func ReplayWebhookLog(c *gin.Context) {
+	accountIDVal, _ := c.Get("account_id")
+	accountID := accountIDVal.(uint)
+
+	// Reprocessar altera conversas e mensagens: apenas administradores
+	if !isAdministrator(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can replay webhooks"})
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhook log ID"})
+		return
+	}
+
+	webhookLog, err := repository.GetWebhookLog(uint(id), accountID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Webhook log not found"})
+		return
+	}
+
+	replayErr := service.ReplayWebhookLog(webhookLog)
+	if errors.Is(replayErr, service.ErrWebhookNotReplayable) {
+		c.JSON(http.StatusConflict, gin.H{"error": replayErr.Error()})
+		return
+	}
+	if replayErr != nil {
+		log.Printf("[ReplayWebhookLog] Replay of webhook %d failed: %v", webhookLog.ID, replayErr)
+	}
+
+	updated, err := repository.GetWebhookLog(webhookLog.ID, accountID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	if replayErr != nil {
+		status = http.StatusUnprocessableEntity
+	}
+	c.JSON(status, updated)
+}
+
+// ReplayWebhookLogs - POST /api/v1/webhook-logs/replay
+// Devolve um intervalo de webhooks à fila; exige ao menos um limite de ID ou de data
+func ReplayWebhookLogs(c *gin.Context) {
+	accountIDVal, _ := c.Get("account_id")
+	accountID := accountIDVal.(uint)
+
+	// Reprocessar altera conversas e mensagens: apenas administradores
+	if !isAdministrator(c) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Only administrators can replay webhooks"})
+		return
+	}
+
+	var input struct {
+		InboxID *uint      `json:"inbox_id"`
+		Event   string     `json:"event"`
+		Status  string     `json:"status"`
+		From    *time.Time `json:"from"`
+		To      *time.Time `json:"to"`
+		FromID  uint       `json:"from_id"`
+		ToID    uint       `json:"to_id"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.From == nil && input.To == nil && input.FromID == 0 && input.ToID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "a range is required (from/to or from_id/to_id)"})
+		return
+	}
+
+	count, err := service.RequeueWebhookLogs(repository.WebhookLogFilter{
+		AccountID: accountID,
+		InboxID:   input.InboxID,
+		Event:     input.Event,
+		Status:    input.Status,
+		From:      input.From,
+		To:        input.To,
+		FromID:    input.FromID,
+		ToID:      input.ToID,
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	log.Printf("[ReplayWebhookLogs] %d webhooks requeued for account %d", count, accountID)
+	c.JSON(http.StatusAccepted, gin.H{"requeued": count})
+}
+
+// parseTimeQuery converte um parâmetro RFC3339 opcional
+func parseTimeQuery(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
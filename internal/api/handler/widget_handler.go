@@ -0,0 +1,342 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"mensager-go/internal/service"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// widgetMaxAttachmentSize limite dos anexos enviados por visitantes
+const widgetMaxAttachmentSize = 20 * 1024 * 1024
+
+// widgetContext inbox e sessão do visitante resolvidas pelos middlewares do widget
+func widgetContext(c *gin.Context) (*models.Inbox, *models.WidgetSession) {
+	inbox := c.MustGet("widget_inbox").(*models.Inbox)
+	session, _ := c.Get("widget_session")
+	if session == nil {
+		return inbox, nil
+	}
+	return inbox, session.(*models.WidgetSession)
+}
+
+// widgetErrorStatus status HTTP para os erros de sessão/identidade do widget
+func widgetErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, service.ErrWidgetUnauthorized):
+		return http.StatusUnauthorized
+	case errors.Is(err, service.ErrWidgetIdentityInvalid):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrWidgetRateLimited):
+		return http.StatusTooManyRequests
+	}
+	return http.StatusInternalServerError
+}
+
+// widgetContactResponse dados do contato expostos ao próprio visitante
+func widgetContactResponse(contact *models.Contact) gin.H {
+	return gin.H{
+		"id":           contact.ID,
+		"name":         contact.Name,
+		"email":        contact.Email,
+		"phone_number": contact.PhoneNumber,
+	}
+}
+
+// GetWidgetInbox retorna os dados públicos da inbox para o widget (nome, avatar, saudação)
+func GetWidgetInbox(c *gin.Context) {
+	inbox, _ := widgetContext(c)
+
+	response := gin.H{
+		"id":         inbox.ID,
+		"name":       inbox.Name,
+		"avatar_url": inbox.AvatarURL,
+	}
+	if inbox.GreetingEnabled {
+		response["greeting_message"] = inbox.GreetingMessage
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateWidgetSession cria a sessão de um visitante (anônima ou com identidade verificada por HMAC).
+// O session_token só é retornado aqui. Limitado por IP e por inbox (429).
+func CreateWidgetSession(c *gin.Context) {
+	inbox, _ := widgetContext(c)
+
+	var input service.WidgetIdentity
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	session, contact, token, err := service.CreateWidgetSession(inbox, input, c.ClientIP())
+	if err != nil {
+		log.Printf("[CreateWidgetSession] Error creating session for inbox %d: %v", inbox.ID, err)
+		c.JSON(widgetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"session_token":     token,
+		"contact":           widgetContactResponse(contact),
+		"identity_verified": session.IdentityVerified,
+	}
+	if conversation := service.WidgetConversation(session); conversation != nil {
+		response["conversation_id"] = conversation.ID
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// GetWidgetSession retorna o contato e a conversa atual da sessão do visitante
+func GetWidgetSession(c *gin.Context) {
+	_, session := widgetContext(c)
+
+	contact, err := repository.GetContact(session.ContactID, session.AccountID)
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "contact not found"})
+		return
+	}
+
+	response := gin.H{
+		"contact":           widgetContactResponse(contact),
+		"identity_verified": session.IdentityVerified,
+	}
+	if conversation := service.WidgetConversation(session); conversation != nil {
+		response["conversation_id"] = conversation.ID
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// IdentifyWidgetSession atualiza nome/email do visitante ou o vincula a um usuário do produto (identifier + identifier_hash)
+func IdentifyWidgetSession(c *gin.Context) {
+	inbox, session := widgetContext(c)
+
+	var input service.WidgetIdentity
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	contact, err := service.IdentifyWidgetSession(inbox, session, input)
+	if err != nil {
+		log.Printf("[IdentifyWidgetSession] Error identifying session %d: %v", session.ID, err)
+		c.JSON(widgetErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	response := gin.H{
+		"contact":           widgetContactResponse(contact),
+		"identity_verified": session.IdentityVerified,
+	}
+	if conversation := service.WidgetConversation(session); conversation != nil {
+		response["conversation_id"] = conversation.ID
+		SetVisitorConversation(session.ID, uint(conversation.ID))
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ListWidgetMessages lista as mensagens públicas da conversa atual do visitante
+func ListWidgetMessages(c *gin.Context) {
+	_, session := widgetContext(c)
+
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	conversation := service.WidgetConversation(session)
+	if conversation == nil {
+		c.JSON(http.StatusOK, gin.H{"messages": []models.Message{}})
+		return
+	}
+
+	messages, err := repository.ListMessagesByConversation(uint(conversation.ID), limit, offset)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "failed to fetch messages"})
+		return
+	}
+
+	// Notas privadas dos agentes não são exibidas ao visitante
+	public := make([]models.Message, 0, len(messages))
+	for _, message := range messages {
+		if !message.Private {
+			public = append(public, message)
+		}
+	}
+	attachReactions(public)
+	if err := service.AttachQuotedPreviews(public); err != nil {
+		log.Printf("[ListWidgetMessages] Error loading quoted previews: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"conversation_id": conversation.ID,
+		"messages":        public,
+	})
+}
+
+// CreateWidgetMessage recebe uma mensagem de texto do visitante
+func CreateWidgetMessage(c *gin.Context) {
+	inbox, session := widgetContext(c)
+
+	var input struct {
+		Content string `json:"content" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	message, conversation, err := service.CreateWidgetMessage(inbox, session, input.Content, nil)
+	if err != nil {
+		log.Printf("[CreateWidgetMessage] Error saving message for session %d: %v", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	SetVisitorConversation(session.ID, uint(conversation.ID))
+
+	c.JSON(http.StatusCreated, message)
+}
+
+// CreateWidgetAttachment recebe um arquivo do visitante (multipart "file", legenda opcional em "content")
+func CreateWidgetAttachment(c *gin.Context) {
+	inbox, session := widgetContext(c)
+
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+	defer file.Close()
+
+	if header.Size > widgetMaxAttachmentSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File too large (max %dMB)", widgetMaxAttachmentSize/1024/1024)})
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(file, widgetMaxAttachmentSize+1))
+	if err != nil || len(data) > widgetMaxAttachmentSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	// Mesma lista de tipos aceitos no upload dos agentes
+	mimeType := service.DetectMimeType(data)
+	if !isAllowedMimeType(mimeType) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("File type not allowed: %s", mimeType)})
+		return
+	}
+
+	attachment := &service.WidgetAttachment{FileName: header.Filename, Data: data}
+	message, conversation, err := service.CreateWidgetMessage(inbox, session, c.PostForm("content"), attachment)
+	if err != nil {
+		log.Printf("[CreateWidgetAttachment] Error saving attachment for session %d: %v", session.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	SetVisitorConversation(session.ID, uint(conversation.ID))
+
+	c.JSON(http.StatusCreated, message)
+}
+
+// ToggleWidgetTyping repassa aos agentes o "digitando" do visitante
+func ToggleWidgetTyping(c *gin.Context) {
+	_, session := widgetContext(c)
+
+	var input struct {
+		TypingStatus string `json:"typing_status" binding:"required"` // on, off
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.TypingStatus != "on" && input.TypingStatus != "off" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "typing_status must be on or off"})
+		return
+	}
+
+	service.SetVisitorTyping(session, input.TypingStatus == "on")
+	c.JSON(http.StatusOK, gin.H{"typing_status": input.TypingStatus})
+}
+
+// WidgetRealtimeHandler stream SSE do visitante: respostas públicas dos agentes, reações e "digitando"
+func WidgetRealtimeHandler(c *gin.Context) {
+	_, session := widgetContext(c)
+
+	var conversationID *uint
+	if conversation := service.WidgetConversation(session); conversation != nil {
+		id := uint(conversation.ID)
+		conversationID = &id
+	}
+
+	c.Header("Content-Type", "text/event-stream")
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	c.Header("Access-Control-Allow-Origin", "*")
+
+	client := &Client{
+		ID:             fmt.Sprintf("visitor-%d-%d", session.ID, time.Now().UnixNano()),
+		ConversationID: conversationID,
+		Channel:        make(chan RealtimeEvent, 10),
+		Visitor:        true,
+		SessionID:      session.ID,
+	}
+
+	hub.register <- client
+	defer func() {
+		hub.unregister <- client
+	}()
+
+	flusher, ok := c.Writer.(http.Flusher)
+	if !ok {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "streaming not supported"})
+		return
+	}
+
+	sendSSE(c.Writer, flusher, RealtimeEvent{
+		Type: string(service.EventConnectionEstablished),
+		Payload: map[string]interface{}{
+			"client_id":       client.ID,
+			"conversation_id": conversationID,
+			"timestamp":       time.Now(),
+		},
+	})
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+
+		case event := <-client.Channel:
+			if err := sendSSE(c.Writer, flusher, event); err != nil {
+				log.Printf("Error sending SSE to visitor: %v", err)
+				return
+			}
+
+		case <-ticker.C:
+			heartbeat := RealtimeEvent{
+				Type: string(service.EventHeartbeat),
+				Payload: map[string]interface{}{
+					"timestamp": time.Now(),
+				},
+			}
+			if err := sendSSE(c.Writer, flusher, heartbeat); err != nil {
+				log.Printf("Error sending heartbeat to visitor: %v", err)
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"mensager-go/internal/models"
+	"mensager-go/internal/service"
+
+	"github.com/gin-gonic/gin"
+)
+
+// WidgetInboxMiddleware resolve a inbox website do path (:inbox_id) da API pública do widget
+func WidgetInboxMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		inboxID, err := strconv.ParseUint(c.Param("inbox_id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid inbox_id"})
+			c.Abort()
+			return
+		}
+
+		inbox, err := service.GetWebsiteInbox(uint(inboxID))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "inbox not found"})
+			c.Abort()
+			return
+		}
+
+		c.Set("widget_inbox", inbox)
+		c.Next()
+	}
+}
+
+// WidgetSessionMiddleware autentica o visitante pelo token da sessão (header X-Widget-Session;
+// query session_token para EventSource/SSE). Deve vir depois de WidgetInboxMiddleware.
+func WidgetSessionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.GetHeader("X-Widget-Session")
+		if token == "" {
+			token = c.Query("session_token")
+		}
+
+		inbox := c.MustGet("widget_inbox").(*models.Inbox)
+		session, err := service.AuthenticateWidgetSession(inbox, token)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			c.Abort()
+			return
+		}
+
+		c.Set("widget_session", session)
+		c.Next()
+	}
+}
@@ -20,7 +20,8 @@ func SetupRoutes(r *gin.Engine) {
 	v1 := r.Group("/api/v1")
 	{
 		// Public routes (Authentication & Onboarding)
-		v1.POST("/webhooks/evolution", handler.EvolutionWebhookHandler)
+		v1.POST("/webhooks/:provider", handler.ChannelWebhookHandler)
+		v1.GET("/webhooks/:provider", handler.ChannelWebhookChallenge)
 		v1.GET("/health", handler.HealthCheck)
 		v1.GET("/debug/token", handler.GenerateDebugToken) // Temp debug
 
@@ -31,6 +32,26 @@ func SetupRoutes(r *gin.Engine) {
 		v1.POST("/auth/logout", handler.Logout)
 		v1.GET("/server/info", handler.GetServerInfo) // Informações do servidor para integração
 
+		// Widget de chat do site (canal website): API pública por inbox, autenticada pela sessão do visitante
+		widget := v1.Group("/widget/inboxes/:inbox_id")
+		widget.Use(middleware.WidgetInboxMiddleware())
+		{
+			widget.GET("", handler.GetWidgetInbox)
+			widget.POST("/sessions", handler.CreateWidgetSession)
+
+			visitor := widget.Group("/")
+			visitor.Use(middleware.WidgetSessionMiddleware())
+			{
+				visitor.GET("/session", handler.GetWidgetSession)
+				visitor.POST("/session/identify", handler.IdentifyWidgetSession)
+				visitor.GET("/messages", handler.ListWidgetMessages)
+				visitor.POST("/messages", handler.CreateWidgetMessage)
+				visitor.POST("/attachments", handler.CreateWidgetAttachment)
+				visitor.POST("/typing", handler.ToggleWidgetTyping)
+				visitor.GET("/events", handler.WidgetRealtimeHandler)
+			}
+		}
+
 		protected := v1.Group("/")
 		protected.Use(middleware.AuthMiddleware())
 		{
@@ -44,8 +65,11 @@ func SetupRoutes(r *gin.Engine) {
 			protected.GET("/conversations", handler.ListConversations)
 			protected.POST("/conversations", handler.CreateConversation)
 			protected.GET("/conversations/:id/activities", handler.ListConversationActivities)
+			protected.GET("/conversations/:id/group", handler.GetConversationGroup)
+			protected.POST("/conversations/:id/group/sync", handler.SyncConversationGroup)
 
 			protected.POST("/conversations/:id/assign", handler.AssignHandler)
+			protected.POST("/conversations/:id/toggle_typing_status", handler.ToggleTypingStatus)
 			protected.DELETE("/conversations/:id", handler.DeleteConversation)
 
 			// Inboxes
@@ -55,6 +79,15 @@ func SetupRoutes(r *gin.Engine) {
 			protected.GET("/inboxes/:id", handler.GetInbox)
 			protected.PUT("/inboxes/:id", handler.UpdateInbox)
 			protected.DELETE("/inboxes/:id", handler.DeleteInbox)
+			protected.POST("/inboxes/:id/webhook-secret", handler.RotateInboxWebhookSecret)
+			protected.GET("/inboxes/:id/connection", handler.GetInboxConnection)
+			protected.GET("/inboxes/:id/history-import", handler.GetInboxHistoryImport)
+
+			// Webhooks recebidos (inspeção e replay)
+			protected.GET("/webhook-logs", handler.ListWebhookLogs)
+			protected.POST("/webhook-logs/replay", handler.ReplayWebhookLogs)
+			protected.GET("/webhook-logs/:id", handler.GetWebhookLog)
+			protected.POST("/webhook-logs/:id/replay", handler.ReplayWebhookLog)
 
 			// Contacts
 			protected.GET("/contacts", handler.ListContacts)
@@ -68,6 +101,7 @@ func SetupRoutes(r *gin.Engine) {
 			// Messages
 			protected.POST("/messages", handler.SendMessage)
 			protected.GET("/messages/:id", handler.GetMessage)
+			protected.GET("/messages/:id/revisions", handler.ListMessageRevisions)
 			protected.DELETE("/messages/:id", handler.DeleteMessage)
 
 			// Equipes
@@ -82,6 +116,9 @@ func SetupRoutes(r *gin.Engine) {
 			protected.POST("/integrations", handler.CreateIntegration)
 			protected.PUT("/integrations/:id", handler.UpdateIntegration)
 			protected.DELETE("/integrations/:id", handler.DeleteIntegration)
+			protected.GET("/integrations/:id/qrcode", handler.GetIntegrationQRCode)
+			protected.GET("/integrations/:id/status-events", handler.ListIntegrationStatusEvents)
+			protected.GET("/integrations/:id/send-queue", handler.GetIntegrationSendQueue)
 
 			// API Keys / Tokens
 			protected.GET("/api-keys", handler.GetAPIKeys)
@@ -103,6 +140,8 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			convMessages.GET("/:id/messages", handler.ListMessages)
 			convMessages.POST("/:id/messages", handler.SendMessageToConversation)
+			convMessages.POST("/:id/messages/:message_id/reactions", handler.ReactToMessage)
+			convMessages.DELETE("/:id/messages/:message_id/reactions", handler.ReactToMessage)
 			convMessages.POST("/:id/read", handler.MarkAsReadHandler)
 			convMessages.GET("/:id/stats", handler.GetConversationStats)
 		}
@@ -113,6 +152,8 @@ func SetupRoutes(r *gin.Engine) {
 		{
 			convMessagesPlural.GET("/:id/messages", handler.ListMessages)
 			convMessagesPlural.POST("/:id/messages", handler.SendMessageToConversation)
+			convMessagesPlural.POST("/:id/messages/:message_id/reactions", handler.ReactToMessage)
+			convMessagesPlural.DELETE("/:id/messages/:message_id/reactions", handler.ReactToMessage)
 			convMessagesPlural.POST("/:id/read", handler.MarkAsReadHandler)
 			convMessagesPlural.POST("/mark-all-read", handler.MarkAllAsRead)
 			convMessagesPlural.GET("/:id/stats", handler.GetConversationStats)
@@ -32,7 +32,23 @@ func Init() {
 	}
 
 	// Automigrate para sincronizar models com o banco do Supabase
-	err = db.AutoMigrate(
+	err = Migrate(db)
+	if err != nil {
+		log.Printf("⚠️ Migration warning: %v", err)
+	}
+
+	// Índices únicos que impedem contatos e conversas duplicados; falham enquanto houver duplicados antigos
+	if err := EnsureUniqueIndexes(db); err != nil {
+		log.Printf("⚠️ Unique index warning: %v (run: go run ./cmd/repair-duplicates)", err)
+	}
+
+	Instance = db
+	fmt.Println("✅ GORM initialized and models synced")
+}
+
+// Migrate cria e atualiza as tabelas dos models
+func Migrate(db *gorm.DB) error {
+	return db.AutoMigrate(
 		&models.Account{},
 		&models.User{},
 		&models.AccountUser{},
@@ -43,12 +59,37 @@ func Init() {
 		&models.Contact{},
 		&models.Message{},
 		&models.MessageReadStatus{},
+		&models.MessageRevision{},
+		&models.MessageReaction{},
+		&models.Group{},
+		&models.GroupParticipant{},
+		&models.WebhookLog{},
+		&models.IntegrationStatusEvent{},
+		&models.HistoryImport{},
+		&models.HistoryImportBatch{},
+		&models.EmailPollState{},
+		&models.WidgetSession{},
 		&models.APIToken{},
+		&models.OutboxMessage{},
 	)
-	if err != nil {
-		log.Printf("⚠️ Migration warning: %v", err)
-	}
+}
 
-	Instance = db
-	fmt.Println("✅ GORM initialized and models synced")
+// uniqueIndexes índices parciais que garantem um contato por telefone/identifier/email na conta
+// e uma única conversa ativa (aberta ou pendente) por contato na inbox
+var uniqueIndexes = []string{
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_account_phone_unique ON contacts (account_id, phone_number) WHERE phone_number <> ''`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_account_identifier_unique ON contacts (account_id, identifier) WHERE identifier <> ''`,
+	fmt.Sprintf(`CREATE UNIQUE INDEX IF NOT EXISTS idx_conversations_active_contact_unique ON conversations (inbox_id, contact_id) WHERE status IN (%d, %d)`,
+		models.ConversationStatusOpen, models.ConversationStatusPending),
+	`CREATE UNIQUE INDEX IF NOT EXISTS idx_contacts_account_email_unique ON contacts (account_id, LOWER(email)) WHERE email <> ''`,
+}
+
+// EnsureUniqueIndexes cria os índices únicos de contatos e conversas
+func EnsureUniqueIndexes(db *gorm.DB) error {
+	for _, statement := range uniqueIndexes {
+		if err := db.Exec(statement).Error; err != nil {
+			return err
+		}
+	}
+	return nil
 }
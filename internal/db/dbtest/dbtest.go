@@ -0,0 +1,75 @@
+// Package dbtest prepara o banco Postgres dos testes que dependem do banco.
+package dbtest
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"mensager-go/internal/db"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// testLockKey serializa os testes de pacotes diferentes que usam o mesmo banco
+const testLockKey = 724173
+
+// Open conecta ao banco de TEST_DATABASE_URL, aplica as migrations, esvazia todas as tabelas e
+// aponta db.Instance para ele. Sem TEST_DATABASE_URL o teste é pulado. Use um banco descartável.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+
+	conn, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("failed to connect to test database: %v", err)
+	}
+	sqlDB, err := conn.DB()
+	if err != nil {
+		t.Fatalf("failed to get test database handle: %v", err)
+	}
+
+	// go test roda os pacotes em paralelo: um pacote por vez no banco
+	lock, err := sqlDB.Conn(context.Background())
+	if err != nil {
+		t.Fatalf("failed to reserve test database connection: %v", err)
+	}
+	if _, err := lock.ExecContext(context.Background(), "SELECT pg_advisory_lock($1)", testLockKey); err != nil {
+		t.Fatalf("failed to lock test database: %v", err)
+	}
+
+	previous := db.Instance
+	t.Cleanup(func() {
+		db.Instance = previous
+		_, _ = lock.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", testLockKey)
+		_ = lock.Close()
+		_ = sqlDB.Close()
+	})
+
+	if err := db.Migrate(conn); err != nil {
+		t.Fatalf("failed to migrate test database: %v", err)
+	}
+
+	var tables []string
+	if err := conn.Raw("SELECT tablename FROM pg_tables WHERE schemaname = current_schema()").Scan(&tables).Error; err != nil {
+		t.Fatalf("failed to list tables: %v", err)
+	}
+	for _, table := range tables {
+		if err := conn.Exec(`TRUNCATE TABLE "` + table + `" RESTART IDENTITY CASCADE`).Error; err != nil {
+			t.Fatalf("failed to truncate %s: %v", table, err)
+		}
+	}
+
+	if err := db.EnsureUniqueIndexes(conn); err != nil {
+		t.Fatalf("failed to create unique indexes: %v", err)
+	}
+
+	db.Instance = conn
+	return conn
+}
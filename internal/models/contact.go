@@ -14,6 +14,7 @@ type Contact struct {
 	PhoneNumber          string         `gorm:"index" json:"phone_number"`
 	Identifier           string         `gorm:"index" json:"identifier"` // WhatsApp JID ou identificador único
 	AvatarURL            string         `json:"avatar_url"`
+	NameManuallySet      bool           `gorm:"default:false" json:"name_manually_set"` // Nome editado por agente: não é sobrescrito pelo WhatsApp
 	AdditionalAttributes datatypes.JSON `json:"additional_attributes"`
 	CreatedAt            time.Time      `json:"created_at"`
 	UpdatedAt            time.Time      `json:"updated_at"`
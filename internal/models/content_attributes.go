@@ -0,0 +1,141 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// ContentAttributes guarda os dados estruturados de mensagens que não são texto simples
+// (localização, cartões de contato, enquetes, figurinhas e prévias de link).
+// Apenas o bloco correspondente ao ContentType da mensagem é preenchido.
+type ContentAttributes struct {
+	Location    *LocationAttributes     `json:"location,omitempty"`
+	Contacts    []ContactCardAttributes `json:"contacts,omitempty"`
+	Poll        *PollAttributes         `json:"poll,omitempty"`
+	Sticker     *StickerAttributes      `json:"sticker,omitempty"`
+	LinkPreview *LinkPreviewAttributes  `json:"link_preview,omitempty"`
+	Mentions    []string                `json:"mentions,omitempty"` // JIDs mencionados (@) em mensagens de grupo
+	Template    *TemplateAttributes     `json:"template,omitempty"`
+	Email       *EmailAttributes        `json:"email,omitempty"`
+	Story       *StoryAttributes        `json:"story,omitempty"` // Resposta ou menção a um story (Instagram)
+}
+
+// LocationAttributes coordenadas de uma mensagem de localização
+type LocationAttributes struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	URL       string  `json:"url,omitempty"`
+	Live      bool    `json:"live,omitempty"` // Localização em tempo real
+}
+
+// ContactCardAttributes cartão de contato (vCard) compartilhado na conversa
+type ContactCardAttributes struct {
+	DisplayName  string             `json:"display_name"`
+	FullName     string             `json:"full_name,omitempty"`
+	Organization string             `json:"organization,omitempty"`
+	Phones       []ContactCardPhone `json:"phones,omitempty"`
+	Emails       []string           `json:"emails,omitempty"`
+	VCard        string             `json:"vcard"` // vCard original
+}
+
+// ContactCardPhone telefone de um cartão de contato
+type ContactCardPhone struct {
+	Number string `json:"number"`
+	WaID   string `json:"wa_id,omitempty"` // Número no WhatsApp (parâmetro waid do vCard)
+	Type   string `json:"type,omitempty"`
+}
+
+// PollAttributes enquete com opções e apuração atual
+type PollAttributes struct {
+	Name            string       `json:"name"`
+	SelectableCount int          `json:"selectable_count"` // 0 = múltipla escolha ilimitada
+	Options         []PollOption `json:"options"`
+	Votes           []PollVote   `json:"votes,omitempty"` // Último voto de cada participante
+}
+
+// PollOption opção de enquete com total de votos
+type PollOption struct {
+	Name  string `json:"name"`
+	Votes int    `json:"votes"`
+}
+
+// PollVote voto de um participante (substitui votos anteriores do mesmo participante)
+type PollVote struct {
+	Voter   string    `json:"voter"` // JID de quem votou
+	Options []string  `json:"options"`
+	VotedAt time.Time `json:"voted_at"`
+}
+
+// StickerAttributes metadados de figurinha
+type StickerAttributes struct {
+	Animated bool `json:"animated,omitempty"`
+	Width    int  `json:"width,omitempty"`
+	Height   int  `json:"height,omitempty"`
+}
+
+// LinkPreviewAttributes prévia de link de um extendedTextMessage
+type LinkPreviewAttributes struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// TemplateAttributes template aprovado usado no envio
+type TemplateAttributes struct {
+	Name     string `json:"name"`
+	Language string `json:"language"`
+}
+
+// EmailAttributes cabeçalhos de uma mensagem do canal de email (usados para manter o thread nas respostas)
+type EmailAttributes struct {
+	Subject    string   `json:"subject"`
+	From       string   `json:"from"`
+	To         []string `json:"to,omitempty"`
+	Cc         []string `json:"cc,omitempty"`
+	MessageID  string   `json:"message_id"`
+	InReplyTo  string   `json:"in_reply_to,omitempty"`
+	References []string `json:"references,omitempty"`
+}
+
+// StoryAttributes story do Instagram respondido ou em que a conta foi mencionada
+type StoryAttributes struct {
+	ID      string `json:"id,omitempty"`
+	URL     string `json:"url,omitempty"` // URL temporária do CDN da Meta (expira)
+	Mention bool   `json:"mention,omitempty"`
+}
+
+// IsEmpty indica se nenhum atributo estruturado foi preenchido
+func (a ContentAttributes) IsEmpty() bool {
+	return a.Location == nil && len(a.Contacts) == 0 && a.Poll == nil && a.Sticker == nil && a.LinkPreview == nil && len(a.Mentions) == 0 && a.Template == nil && a.Email == nil && a.Story == nil
+}
+
+// Value implementa driver.Valuer (atributos vazios são gravados como NULL)
+func (a ContentAttributes) Value() (driver.Value, error) {
+	if a.IsEmpty() {
+		return nil, nil
+	}
+	data, err := json.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// Scan implementa sql.Scanner (aceita NULL de mensagens antigas)
+func (a *ContentAttributes) Scan(value interface{}) error {
+	*a = ContentAttributes{}
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case []byte:
+		return json.Unmarshal(v, a)
+	case string:
+		return json.Unmarshal([]byte(v), a)
+	default:
+		return fmt.Errorf("failed to scan content_attributes: unsupported type %T", value)
+	}
+}
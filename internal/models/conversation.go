@@ -29,6 +29,9 @@ type Conversation struct {
 	Inbox    Inbox   `gorm:"foreignKey:InboxID" json:"-"`
 	Contact  Contact `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
 	Assignee *User   `gorm:"foreignKey:AssigneeID" json:"assignee,omitempty"`
+
+	// Metadados do grupo do WhatsApp (preenchido na listagem de grupos, não persistido)
+	Group *Group `gorm:"-" json:"group,omitempty"`
 }
 
 // ConversationStatus representa os status possíveis de uma conversa
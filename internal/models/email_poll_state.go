@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// EmailPollState posição da leitura IMAP de uma inbox de email (último UID já enfileirado)
+type EmailPollState struct {
+	ID           uint       `gorm:"primaryKey" json:"id"`
+	InboxID      uint       `gorm:"uniqueIndex;not null" json:"inbox_id"`
+	Mailbox      string     `gorm:"type:varchar(255);not null" json:"mailbox"`
+	UIDValidity  uint32     `json:"uid_validity"` // Se mudar, os UIDs antigos deixam de valer e a leitura recomeça
+	LastUID      uint32     `json:"last_uid"`
+	LastPolledAt *time.Time `json:"last_polled_at"`
+	LastError    string     `gorm:"type:text" json:"last_error,omitempty"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func (EmailPollState) TableName() string {
+	return "email_poll_states"
+}
@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// Group representa um grupo do WhatsApp vinculado a uma inbox.
+// A conversa do grupo pertence ao contato "guarda-chuva" (ContactID), cujo identifier é o JID do grupo;
+// o autor de cada mensagem é o contato do participante.
+type Group struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	AccountID   uint       `gorm:"index;not null" json:"account_id"`
+	InboxID     uint       `gorm:"uniqueIndex:idx_group_inbox_jid;not null" json:"inbox_id"`
+	JID         string     `gorm:"column:jid;uniqueIndex:idx_group_inbox_jid;not null" json:"jid"` // 120363...@g.us
+	ContactID   uint       `gorm:"index;not null" json:"contact_id"`
+	Subject     string     `json:"subject"`
+	Description string     `gorm:"type:text" json:"description"`
+	AvatarURL   string     `json:"avatar_url"`
+	OwnerJID    string     `gorm:"column:owner_jid" json:"owner_jid"`
+	SyncedAt    *time.Time `json:"synced_at"` // Última sincronização dos metadados com a Evolution
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+
+	Participants []GroupParticipant `gorm:"foreignKey:GroupID" json:"participants,omitempty"`
+}
+
+func (Group) TableName() string {
+	return "whatsapp_groups"
+}
+
+// GroupParticipant representa um participante de um grupo do WhatsApp
+type GroupParticipant struct {
+	ID           uint      `gorm:"primaryKey" json:"id"`
+	GroupID      uint      `gorm:"uniqueIndex:idx_group_participant;not null" json:"group_id"`
+	ContactID    uint      `gorm:"uniqueIndex:idx_group_participant;not null" json:"contact_id"`
+	JID          string    `gorm:"column:jid;not null" json:"jid"`
+	IsAdmin      bool      `gorm:"default:false" json:"is_admin"`
+	IsSuperAdmin bool      `gorm:"default:false" json:"is_super_admin"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+
+	Contact *Contact `gorm:"foreignKey:ContactID" json:"contact,omitempty"`
+}
+
+func (GroupParticipant) TableName() string {
+	return "whatsapp_group_participants"
+}
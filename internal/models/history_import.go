@@ -0,0 +1,45 @@
+package models
+
+import "time"
+
+// HistoryImport acompanha a importação do histórico do WhatsApp (messages.set / chats.set / HistorySync) de uma inbox
+type HistoryImport struct {
+	ID                   uint       `gorm:"primaryKey" json:"id"`
+	AccountID            uint       `gorm:"index;not null" json:"account_id"`
+	InboxID              uint       `gorm:"uniqueIndex;not null" json:"inbox_id"`
+	Status               string     `gorm:"type:varchar(20);not null" json:"status"` // running, completed
+	Progress             int        `json:"progress"`                                // Percentual informado pelo WhatsApp, quando disponível
+	Batches              int        `json:"batches"`
+	ChatsReceived        int        `json:"chats_received"`
+	MessagesReceived     int        `json:"messages_received"`
+	MessagesImported     int        `json:"messages_imported"`
+	MessagesSkipped      int        `json:"messages_skipped"` // Já existentes (whatsapp_message_id) ou não suportadas; falhas não contam (o lote é refeito)
+	ConversationsTouched int        `json:"conversations_touched"`
+	LastError            string     `gorm:"type:text" json:"last_error,omitempty"`
+	StartedAt            time.Time  `json:"started_at"`
+	CompletedAt          *time.Time `json:"completed_at"`
+	UpdatedAt            time.Time  `json:"updated_at"`
+}
+
+func (HistoryImport) TableName() string {
+	return "history_imports"
+}
+
+// HistoryImportBatch registra os lotes de histórico já contabilizados; o retry de um lote pela fila de webhooks
+// não soma de novo os seus contadores
+type HistoryImportBatch struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	InboxID   uint      `gorm:"uniqueIndex:idx_history_import_batch;not null" json:"inbox_id"`
+	BatchKey  string    `gorm:"type:varchar(64);uniqueIndex:idx_history_import_batch;not null" json:"batch_key"` // SHA-256 do conteúdo do lote
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (HistoryImportBatch) TableName() string {
+	return "history_import_batches"
+}
+
+// Status da importação de histórico
+const (
+	HistoryImportStatusRunning   = "running"
+	HistoryImportStatusCompleted = "completed"
+)
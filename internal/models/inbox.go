@@ -24,6 +24,10 @@ type Inbox struct {
 	CSATSurveyEnabled          bool      `gorm:"default:false" json:"csat_survey_enabled"`
 	AllowMessagesAfterResolved bool      `gorm:"default:true" json:"allow_messages_after_resolved"`
 
+	// Segredo do webhook de entrada (retornado apenas na criação e na rotação, não persistido aqui)
+	WebhookSecret string `gorm:"-" json:"webhook_secret,omitempty"`
+	WebhookURL    string `gorm:"-" json:"webhook_url,omitempty"`
+
 	// Relacionamentos
 	Account Account `gorm:"foreignKey:AccountID" json:"-"`
 }
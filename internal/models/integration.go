@@ -12,6 +12,12 @@ AccountID uint           `gorm:"not null" json:"account_id"`
 Provider  string         `gorm:"type:varchar(50);not null" json:"provider"` // 'whatsapp', 'facebook'
 Config    datatypes.JSON `gorm:"type:jsonb" json:"config"`                  // Tokens, secrets
 Status    string         `gorm:"type:varchar(20);default:'active'" json:"status"`
+StatusReason    string     `json:"status_reason"`               // Motivo informado pela Evolution na última transição
+StatusChangedAt *time.Time `json:"status_changed_at"`           // Quando o status mudou pela última vez
+QRCode          string     `gorm:"column:qr_code;type:text" json:"-"` // QR code atual (base64) para parear a instância
+QRCodeText      string     `gorm:"column:qr_code_text;type:text" json:"-"` // Conteúdo bruto do QR code
+PairingCode     string     `json:"-"`                           // Código de pareamento por número
+QRCodeUpdatedAt *time.Time `gorm:"column:qr_code_updated_at" json:"qrcode_updated_at,omitempty"`
 CreatedAt time.Time      `json:"created_at"`
 UpdatedAt time.Time      `json:"updated_at"`
 
@@ -20,4 +26,13 @@ Account Account `gorm:"foreignKey:AccountID" json:"-"`
 
 func (Integration) TableName() string {
 return "integrations"
-}
\ No newline at end of file
+}
+
+// IntegrationStatus representa os estados de conexão de uma instância
+const (
+IntegrationStatusActive       = "active"
+IntegrationStatusConnected    = "connected"
+IntegrationStatusConnecting   = "connecting"
+IntegrationStatusQRCode       = "qrcode" // Aguardando leitura do QR code
+IntegrationStatusDisconnected = "disconnected"
+)
\ No newline at end of file
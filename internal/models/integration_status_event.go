@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// IntegrationStatusEvent registra cada transição de status de conexão de uma integração
+type IntegrationStatusEvent struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	IntegrationID  uint      `gorm:"index;not null" json:"integration_id"`
+	AccountID      uint      `gorm:"index;not null" json:"account_id"`
+	PreviousStatus string    `gorm:"type:varchar(20)" json:"previous_status"`
+	Status         string    `gorm:"type:varchar(20);not null" json:"status"`
+	Reason         string    `json:"reason"`
+	Event          string    `json:"event"` // Evento da Evolution que causou a transição
+	OccurredAt     time.Time `gorm:"index" json:"occurred_at"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func (IntegrationStatusEvent) TableName() string {
+	return "integration_status_events"
+}
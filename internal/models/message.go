@@ -14,7 +14,7 @@ type Message struct {
 	InboxID        uint           `gorm:"index" json:"inbox_id"`
 	ConversationID uint           `gorm:"index" json:"conversation_id"`
 	MessageType    int            `json:"message_type"` // 0=incoming, 1=outgoing, 2=activity, 3=template
-	ContentType    string         `json:"content_type"` // text, image, video, audio, file, location, contact
+	ContentType    string         `json:"content_type"` // text, image, video, audio, file, location, contact, sticker, poll, template
 	Private        bool           `json:"private"`
 	SenderType     string         `json:"sender_type"` // User, Contact
 	SenderID       uint           `json:"sender_id"`
@@ -29,8 +29,10 @@ type Message struct {
 	PushName          *string        `json:"push_name"`                                // Nome do contato
 	IsFromMe          bool           `gorm:"default:false" json:"is_from_me"`          // Se a mensagem é do próprio usuário
 	IsGroup           bool           `gorm:"default:false" json:"is_group"`            // Se é mensagem de grupo
+	Participant       *string        `json:"participant"`                              // JID do autor em mensagens de grupo
 	Timestamp         *time.Time     `json:"timestamp"`                                // Timestamp original do WhatsApp
 	QuotedMessageID   *string        `json:"quoted_message_id"`                        // ID da mensagem citada
+	InReplyTo         *uint          `gorm:"column:in_reply_to;index" json:"in_reply_to"` // ID interno da mensagem citada
 	MediaURL          *string        `json:"media_url"`                                // URL da mídia (imagem, vídeo, etc)
 	MimeType          *string        `json:"mime_type"`                                // Tipo MIME do arquivo
 	FileName          *string        `json:"file_name"`                                // Nome do arquivo
@@ -38,16 +40,57 @@ type Message struct {
 	Caption           *string        `gorm:"type:text" json:"caption"`                 // Legenda para mídia
 	GroupData         datatypes.JSON `json:"group_data"`                               // Dados do grupo em JSON
 	Metadata          datatypes.JSON `json:"metadata"`                                 // Metadados adicionais em JSON
+	ContentAttributes ContentAttributes `gorm:"type:jsonb" json:"content_attributes"` // Dados estruturados (localização, vCard, enquete...)
 	Revoked           bool           `gorm:"default:false" json:"revoked"`             // Se mensagem foi revogada
 	Edited            bool           `gorm:"default:false" json:"edited"`              // Se mensagem foi editada
+	DeliveredAt       *time.Time     `json:"delivered_at"`                             // Quando o WhatsApp confirmou a entrega
+	ReadAt            *time.Time     `json:"read_at"`                                  // Quando o destinatário leu a mensagem
 
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 
 	// Relacionamentos
-	Conversation Conversation `gorm:"foreignKey:ConversationID" json:"-"`
-	Inbox        Inbox        `gorm:"foreignKey:InboxID" json:"-"`
-	Account      Account      `gorm:"foreignKey:AccountID" json:"-"`
+	Conversation Conversation      `gorm:"foreignKey:ConversationID" json:"-"`
+	Inbox        Inbox             `gorm:"foreignKey:InboxID" json:"-"`
+	Account      Account           `gorm:"foreignKey:AccountID" json:"-"`
+	Reactions    []MessageReaction `gorm:"foreignKey:MessageID" json:"reactions,omitempty"`
+
+	// Prévia da mensagem citada (preenchida na listagem, não persistida)
+	QuotedMessage *QuotedMessagePreview `gorm:"-" json:"quoted_message,omitempty"`
+}
+
+// QuotedMessagePreview resumo compacto da mensagem citada para renderizar o balão de resposta
+type QuotedMessagePreview struct {
+	ID          uint    `json:"id"`
+	Content     string  `json:"content"`
+	ContentType string  `json:"content_type"`
+	SenderType  string  `json:"sender_type"`
+	SenderID    uint    `json:"sender_id"`
+	IsFromMe    bool    `json:"is_from_me"`
+	MediaURL    *string `json:"media_url,omitempty"`
+	Revoked     bool    `json:"revoked"`
+}
+
+// quotedPreviewMaxLength tamanho máximo do texto exibido na prévia da citação
+const quotedPreviewMaxLength = 200
+
+// NewQuotedMessagePreview monta a prévia de uma mensagem citada
+func NewQuotedMessagePreview(message *Message) *QuotedMessagePreview {
+	content := message.Content
+	if runes := []rune(content); len(runes) > quotedPreviewMaxLength {
+		content = string(runes[:quotedPreviewMaxLength]) + "…"
+	}
+
+	return &QuotedMessagePreview{
+		ID:          message.ID,
+		Content:     content,
+		ContentType: message.ContentType,
+		SenderType:  message.SenderType,
+		SenderID:    message.SenderID,
+		IsFromMe:    message.IsFromMe,
+		MediaURL:    message.MediaURL,
+		Revoked:     message.Revoked,
+	}
 }
 
 func (Message) TableName() string {
@@ -56,12 +99,28 @@ func (Message) TableName() string {
 
 // MessageStatus representa os status possíveis de uma mensagem
 const (
+	MessageStatusPending   = "pending" // Na fila de envio (outbox)
 	MessageStatusSent      = "sent"
 	MessageStatusDelivered = "delivered"
 	MessageStatusRead      = "read"
 	MessageStatusFailed    = "failed"
 )
 
+// MessageStatusRank retorna a ordem de progressão do status (sent < delivered < read).
+// Status desconhecidos ou "failed" retornam 0 para que qualquer confirmação posterior os substitua.
+func MessageStatusRank(status string) int {
+	switch status {
+	case MessageStatusSent:
+		return 1
+	case MessageStatusDelivered:
+		return 2
+	case MessageStatusRead:
+		return 3
+	default:
+		return 0
+	}
+}
+
 // MessageType representa os tipos de mensagem
 const (
 	MessageTypeIncoming = 0
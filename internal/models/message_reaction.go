@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// MessageReaction representa uma reação (emoji) de um contato ou agente a uma mensagem.
+// Cada reator possui no máximo uma reação por mensagem, como no WhatsApp.
+type MessageReaction struct {
+	ID                uint      `gorm:"primaryKey" json:"id"`
+	MessageID         uint      `gorm:"uniqueIndex:idx_reaction_message_reactor;not null" json:"message_id"`
+	AccountID         uint      `gorm:"index;not null" json:"account_id"`
+	ConversationID    uint      `gorm:"index;not null" json:"conversation_id"`
+	ReactorType       string    `gorm:"uniqueIndex:idx_reaction_message_reactor;type:varchar(20);not null" json:"reactor_type"` // Contact, User, System
+	ReactorID         uint      `gorm:"uniqueIndex:idx_reaction_message_reactor;not null" json:"reactor_id"`
+	Emoji             string    `gorm:"not null" json:"emoji"`
+	WhatsAppMessageID *string   `gorm:"column:whatsapp_message_id" json:"whatsapp_message_id"` // ID da mensagem de reação no WhatsApp
+	ReactedAt         time.Time `json:"reacted_at"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func (MessageReaction) TableName() string {
+	return "message_reactions"
+}
+
+// ReactorType representa quem reagiu à mensagem
+const (
+	ReactorTypeContact = "Contact"
+	ReactorTypeUser    = "User"
+	ReactorTypeSystem  = "System" // Próprio número reagindo fora da plataforma (celular), sem agente associado
+)
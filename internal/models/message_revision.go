@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// MessageRevision guarda o conteúdo anterior de uma mensagem editada ou apagada para todos
+type MessageRevision struct {
+	ID             uint      `gorm:"primaryKey" json:"id"`
+	MessageID      uint      `gorm:"index;not null" json:"message_id"`
+	AccountID      uint      `gorm:"index;not null" json:"account_id"`
+	ConversationID uint      `gorm:"index;not null" json:"conversation_id"`
+	Action         string    `gorm:"type:varchar(20);not null" json:"action"` // edit, revoke
+	Content        string    `gorm:"type:text" json:"content"`                // Conteúdo antes da alteração
+	Caption        *string   `gorm:"type:text" json:"caption"`
+	MediaURL       *string   `json:"media_url"`
+	RevisedAt      time.Time `gorm:"not null" json:"revised_at"` // Quando a alteração ocorreu no WhatsApp
+	CreatedAt      time.Time `json:"created_at"`
+
+	// Relacionamentos
+	Message Message `gorm:"foreignKey:MessageID" json:"-"`
+}
+
+func (MessageRevision) TableName() string {
+	return "message_revisions"
+}
+
+// MessageRevisionAction representa o tipo de alteração registrada
+const (
+	MessageRevisionActionEdit   = "edit"
+	MessageRevisionActionRevoke = "revoke"
+)
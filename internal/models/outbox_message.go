@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// OutboxMessage entrada da fila durável de envio: cada mensagem de saída é gravada como "pending"
+// junto com a sua entrada no outbox e entregue ao provedor pelos workers (service.StartOutbox).
+type OutboxMessage struct {
+	ID             uint           `gorm:"primaryKey" json:"id"`
+	MessageID      uint           `gorm:"uniqueIndex" json:"message_id"`
+	AccountID      uint           `gorm:"index" json:"account_id"`
+	InboxID        uint           `gorm:"index" json:"inbox_id"`
+	ConversationID uint           `gorm:"index" json:"conversation_id"`  // Envios da mesma conversa saem em ordem
+	Options        datatypes.JSON `gorm:"type:jsonb" json:"options"`     // Menções e template do envio
+	Status         string         `gorm:"type:text;index" json:"status"` // pending, processing, retry, sent, dead
+	Attempts       int            `gorm:"default:0" json:"attempts"`
+	NextAttemptAt  *time.Time     `gorm:"index" json:"next_attempt_at"`
+	LockedUntil    *time.Time     `gorm:"index" json:"locked_until"` // Reserva do worker ("processing"); expirada, outra réplica retoma o envio
+	LastError      string         `gorm:"type:text" json:"last_error"`
+	SentAt         *time.Time     `json:"sent_at"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+func (OutboxMessage) TableName() string {
+	return "outbox_messages"
+}
+
+// OutboxStatus representa os estados de um envio no outbox
+const (
+	OutboxStatusPending    = "pending"
+	OutboxStatusProcessing = "processing"
+	OutboxStatusRetry      = "retry"
+	OutboxStatusSent       = "sent"
+	OutboxStatusDead       = "dead" // Falha definitiva ou tentativas esgotadas
+)
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+// WebhookLog guarda o payload bruto de cada webhook recebido; serve também de fila durável de processamento.
+// A tabela já existe nas migrations do Supabase (id, inbox_id, provider, payload, status, error_message, created_at);
+// as demais colunas são adicionadas pelo AutoMigrate.
+type WebhookLog struct {
+	ID           uint           `gorm:"primaryKey" json:"id"`
+	InboxID      *uint          `gorm:"index" json:"inbox_id"`
+	Provider     string         `gorm:"type:text;default:'evolution'" json:"provider"`
+	Payload      datatypes.JSON `gorm:"type:jsonb" json:"payload"`
+	Status       string         `gorm:"type:text;index" json:"status"` // pending, processing, retry, success, dead
+	ErrorMessage string         `gorm:"type:text" json:"error_message"`
+	CreatedAt    time.Time      `json:"created_at"`
+
+	// Controle da fila de processamento
+	Event         string     `gorm:"type:text;index" json:"event"`
+	OrderingKey   string     `gorm:"type:text;index" json:"ordering_key"` // Eventos com a mesma chave (inbox + chat) são processados em ordem
+	Attempts      int        `gorm:"default:0" json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"`
+	LockedUntil   *time.Time `gorm:"index" json:"locked_until"` // Reserva do worker ("processing"); expirada, outra réplica retoma o webhook
+	ProcessedAt   *time.Time `gorm:"index" json:"processed_at"` // Base da retenção (service.StartWebhookQueue)
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+func (WebhookLog) TableName() string {
+	return "webhook_logs"
+}
+
+// WebhookLogStatus representa os estados de um webhook na fila
+const (
+	WebhookLogStatusPending    = "pending"
+	WebhookLogStatusProcessing = "processing"
+	WebhookLogStatusRetry      = "retry"
+	WebhookLogStatusSuccess    = "success"
+	WebhookLogStatusDead       = "dead" // Esgotou as tentativas (dead-letter)
+)
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// WidgetSession sessão de um visitante no widget de chat do site (inbox "website").
+// O token da sessão é entregue apenas na criação; aqui fica só o hash.
+type WidgetSession struct {
+	ID               uint       `gorm:"primaryKey" json:"id"`
+	AccountID        uint       `gorm:"index;not null" json:"account_id"`
+	InboxID          uint       `gorm:"index;not null" json:"inbox_id"`
+	ContactID        uint       `gorm:"index;not null" json:"contact_id"`
+	TokenHash        string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Identifier       string     `json:"identifier,omitempty"` // Usuário do produto vinculado (identidade verificada por HMAC)
+	IdentityVerified bool       `gorm:"default:false" json:"identity_verified"`
+	LastSeenAt       *time.Time `json:"last_seen_at"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+}
+
+func (WidgetSession) TableName() string {
+	return "widget_sessions"
+}
@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"fmt"
 	"mensager-go/internal/db"
 	"mensager-go/internal/models"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // ListContacts retorna todos os contatos de uma conta com paginação e busca opcional
@@ -72,6 +77,15 @@ func GetContactByEmail(email string, accountID uint) (*models.Contact, error) {
 	return &contact, nil
 }
 
+// GetContactByIdentifier busca um contato pelo identifier dentro de uma conta
+func GetContactByIdentifier(identifier string, accountID uint) (*models.Contact, error) {
+	var contact models.Contact
+	if err := db.Instance.Where("identifier = ? AND account_id = ?", identifier, accountID).First(&contact).Error; err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
 // GetContactByPhoneNumber busca um contato por telefone dentro de uma conta
 func GetContactByPhoneNumber(phoneNumber string, accountID uint) (*models.Contact, error) {
 	var contact models.Contact
@@ -81,33 +95,60 @@ func GetContactByPhoneNumber(phoneNumber string, accountID uint) (*models.Contac
 	return &contact, nil
 }
 
-// FindOrCreateContactByPhone busca ou cria um contato pelo telefone
+// FindOrCreateContactByPhone busca ou cria um contato pelo telefone.
+// É atômico: um advisory lock por telefone serializa webhooks concorrentes e o índice único
+// idx_contacts_account_phone_unique barra inserts feitos por outros caminhos.
 func FindOrCreateContactByPhone(accountID uint, phoneNumber string, remoteJid string) (*models.Contact, error) {
+	lockKey := fmt.Sprintf("contact:%d:%s", accountID, phoneNumber)
+	if phoneNumber == "" {
+		lockKey = fmt.Sprintf("contact:%d:%s", accountID, remoteJid)
+	}
+
+	var contact *models.Contact
+	find := func(tx *gorm.DB) error {
+		var err error
+		contact, err = findOrCreateContactByPhone(tx, accountID, phoneNumber, remoteJid)
+		return err
+	}
+
+	err := withAdvisoryLock(lockKey, find)
+	if isUniqueViolation(err) {
+		// Criado por outro caminho entre a busca e o insert: a nova tentativa encontra o registro
+		err = withAdvisoryLock(lockKey, find)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+func findOrCreateContactByPhone(tx *gorm.DB, accountID uint, phoneNumber string, remoteJid string) (*models.Contact, error) {
 	// Tentar encontrar contato existente por phone_number
-	contact, err := GetContactByPhoneNumber(phoneNumber, accountID)
-	if err == nil {
-		// Contato encontrado - atualizar identifier e avatar se necessário
-		updated := false
-		if contact.Identifier == "" && remoteJid != "" {
-			contact.Identifier = remoteJid
-			updated = true
-		}
-		if updated {
-			db.Instance.Save(contact)
+	var contact models.Contact
+	if phoneNumber != "" {
+		if err := tx.Where("phone_number = ? AND account_id = ?", phoneNumber, accountID).First(&contact).Error; err == nil {
+			// Contato encontrado - atualizar identifier se necessário
+			if contact.Identifier == "" && remoteJid != "" {
+				contact.Identifier = remoteJid
+				if err := tx.Model(&contact).Update("identifier", remoteJid).Error; err != nil {
+					return nil, err
+				}
+			}
+			return &contact, nil
 		}
-		return contact, nil
 	}
 
 	// Tentar encontrar por identifier (remoteJid) como fallback
 	if remoteJid != "" {
-		var contactByJid models.Contact
-		if err := db.Instance.Where("identifier = ? AND account_id = ?", remoteJid, accountID).First(&contactByJid).Error; err == nil {
+		if err := tx.Where("identifier = ? AND account_id = ?", remoteJid, accountID).First(&contact).Error; err == nil {
 			// Atualizar phone_number se estiver vazio
-			if contactByJid.PhoneNumber == "" && phoneNumber != "" {
-				contactByJid.PhoneNumber = phoneNumber
-				db.Instance.Save(&contactByJid)
+			if contact.PhoneNumber == "" && phoneNumber != "" {
+				contact.PhoneNumber = phoneNumber
+				if err := tx.Model(&contact).Update("phone_number", phoneNumber).Error; err != nil {
+					return nil, err
+				}
 			}
-			return &contactByJid, nil
+			return &contact, nil
 		}
 	}
 
@@ -120,13 +161,84 @@ func FindOrCreateContactByPhone(accountID uint, phoneNumber string, remoteJid st
 		Identifier:  remoteJid,
 	}
 
-	if err := CreateContact(newContact); err != nil {
+	if err := tx.Create(newContact).Error; err != nil {
 		return nil, err
 	}
 
 	return newContact, nil
 }
 
+// FindOrCreateContactByIdentifier busca ou cria um contato pelo identifier (ex: JID de grupo), sem telefone.
+// Atômico como FindOrCreateContactByPhone (advisory lock + idx_contacts_account_identifier_unique).
+func FindOrCreateContactByIdentifier(accountID uint, identifier, name string) (*models.Contact, error) {
+	lockKey := fmt.Sprintf("contact:%d:%s", accountID, identifier)
+
+	var contact *models.Contact
+	find := func(tx *gorm.DB) error {
+		var existing models.Contact
+		if err := tx.Where("identifier = ? AND account_id = ?", identifier, accountID).First(&existing).Error; err == nil {
+			contact = &existing
+			return nil
+		}
+
+		contactName := name
+		if contactName == "" {
+			contactName = identifier
+		}
+		contact = &models.Contact{
+			AccountID:  accountID,
+			Name:       contactName,
+			Identifier: identifier,
+		}
+		return tx.Create(contact).Error
+	}
+
+	err := withAdvisoryLock(lockKey, find)
+	if isUniqueViolation(err) {
+		err = withAdvisoryLock(lockKey, find)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
+// FindOrCreateContactByEmail busca ou cria um contato pelo email (comparação sem diferenciar maiúsculas).
+// Atômico como FindOrCreateContactByIdentifier (advisory lock + idx_contacts_account_email_unique).
+func FindOrCreateContactByEmail(accountID uint, email, name string) (*models.Contact, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	lockKey := fmt.Sprintf("contact:%d:email:%s", accountID, email)
+
+	var contact *models.Contact
+	find := func(tx *gorm.DB) error {
+		var existing models.Contact
+		if err := tx.Where("LOWER(email) = ? AND account_id = ?", email, accountID).Order("id").First(&existing).Error; err == nil {
+			contact = &existing
+			return nil
+		}
+
+		contactName := name
+		if contactName == "" {
+			contactName = email
+		}
+		contact = &models.Contact{
+			AccountID: accountID,
+			Name:      contactName,
+			Email:     email,
+		}
+		return tx.Create(contact).Error
+	}
+
+	err := withAdvisoryLock(lockKey, find)
+	if isUniqueViolation(err) {
+		err = withAdvisoryLock(lockKey, find)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return contact, nil
+}
+
 // FindContactByEmailOrPhone busca um contato por email ou telefone dentro de uma conta
 func FindContactByEmailOrPhone(accountID uint, email, phoneNumber string) (*models.Contact, error) {
 	var contact models.Contact
@@ -203,3 +315,118 @@ func DeleteContacts(contactIDs []uint, accountID uint) error {
 func DeleteAllContacts(accountID uint) error {
 	return db.Instance.Where("account_id = ?", accountID).Delete(&models.Contact{}).Error
 }
+
+// WhatsAppContactSync dados de um contato recebidos da sincronização do WhatsApp
+type WhatsAppContactSync struct {
+	PhoneNumber string
+	Identifier  string // JID
+	Name        string
+	AvatarURL   string
+}
+
+// BulkUpsertWhatsAppContacts cria ou atualiza contatos em lote, com a mesma normalização de
+// FindOrCreateContactByPhone (telefone, com o JID como identifier). Nomes editados manualmente são preservados.
+// Retorna quantos contatos foram criados e atualizados.
+func BulkUpsertWhatsAppContacts(accountID uint, entries []WhatsAppContactSync) (int, int, error) {
+	if len(entries) == 0 {
+		return 0, 0, nil
+	}
+
+	phones := make([]string, 0, len(entries))
+	identifiers := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		phones = append(phones, entry.PhoneNumber)
+		identifiers = append(identifiers, entry.Identifier)
+	}
+
+	var existing []models.Contact
+	if err := db.Instance.
+		Where("account_id = ? AND (phone_number IN ? OR identifier IN ?)", accountID, phones, identifiers).
+		Find(&existing).Error; err != nil {
+		return 0, 0, err
+	}
+
+	byPhone := make(map[string]*models.Contact, len(existing))
+	byIdentifier := make(map[string]*models.Contact, len(existing))
+	for i := range existing {
+		if existing[i].PhoneNumber != "" {
+			byPhone[existing[i].PhoneNumber] = &existing[i]
+		}
+		if existing[i].Identifier != "" {
+			byIdentifier[existing[i].Identifier] = &existing[i]
+		}
+	}
+
+	var toCreate []models.Contact
+	pending := make(map[string]int) // telefone -> índice em toCreate (o lote pode repetir contatos)
+	updated := 0
+
+	for _, entry := range entries {
+		contact := byPhone[entry.PhoneNumber]
+		if contact == nil {
+			contact = byIdentifier[entry.Identifier]
+		}
+
+		if contact == nil {
+			if idx, ok := pending[entry.PhoneNumber]; ok {
+				mergeWhatsAppContact(&toCreate[idx], entry)
+				continue
+			}
+			name := entry.Name
+			if name == "" {
+				name = entry.PhoneNumber
+			}
+			pending[entry.PhoneNumber] = len(toCreate)
+			toCreate = append(toCreate, models.Contact{
+				AccountID:   accountID,
+				Name:        name,
+				PhoneNumber: entry.PhoneNumber,
+				Identifier:  entry.Identifier,
+				AvatarURL:   entry.AvatarURL,
+			})
+			continue
+		}
+
+		updates := mergeWhatsAppContact(contact, entry)
+		if len(updates) == 0 {
+			continue
+		}
+		if err := db.Instance.Model(&models.Contact{}).Where("id = ?", contact.ID).Updates(updates).Error; err != nil {
+			return 0, updated, err
+		}
+		updated++
+	}
+
+	if len(toCreate) > 0 {
+		// Contatos criados em paralelo (ex.: por uma mensagem) são mantidos: o índice único descarta a cópia do lote
+		if err := db.Instance.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&toCreate, 200).Error; err != nil {
+			return 0, updated, err
+		}
+	}
+
+	return len(toCreate), updated, nil
+}
+
+// mergeWhatsAppContact aplica os dados sincronizados ao contato e retorna os campos alterados
+func mergeWhatsAppContact(contact *models.Contact, entry WhatsAppContactSync) map[string]interface{} {
+	updates := map[string]interface{}{}
+
+	if entry.Name != "" && contact.Name != entry.Name && !contact.NameManuallySet {
+		contact.Name = entry.Name
+		updates["name"] = entry.Name
+	}
+	if entry.AvatarURL != "" && contact.AvatarURL != entry.AvatarURL {
+		contact.AvatarURL = entry.AvatarURL
+		updates["avatar_url"] = entry.AvatarURL
+	}
+	if contact.Identifier == "" && entry.Identifier != "" {
+		contact.Identifier = entry.Identifier
+		updates["identifier"] = entry.Identifier
+	}
+	if contact.PhoneNumber == "" && entry.PhoneNumber != "" {
+		contact.PhoneNumber = entry.PhoneNumber
+		updates["phone_number"] = entry.PhoneNumber
+	}
+
+	return updates
+}
@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+func TestFindOrCreateContactByEmailConcurrent(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	accountID := uint(inbox.AccountID)
+
+	addresses := []string{"Cliente@Example.com", "cliente@example.com", " CLIENTE@example.com "}
+
+	var wg sync.WaitGroup
+	ids := make(chan uint, 12)
+	errs := make(chan error, 12)
+	for i := 0; i < 12; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if i%4 == 0 {
+				// Inserção fora do advisory lock (ex: cadastro manual): a busca que perder a corrida
+				// recebe 23505 e deve repetir a busca
+				_ = conn.Create(&models.Contact{AccountID: accountID, Name: "Cliente", Email: "cliente@EXAMPLE.com"}).Error
+				return
+			}
+			contact, err := FindOrCreateContactByEmail(accountID, addresses[i%len(addresses)], "Cliente")
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- contact.ID
+		}(i)
+	}
+	wg.Wait()
+	close(ids)
+	close(errs)
+
+	for err := range errs {
+		t.Errorf("FindOrCreateContactByEmail: %v", err)
+	}
+
+	var count int64
+	conn.Model(&models.Contact{}).Where("account_id = ? AND LOWER(email) = ?", accountID, "cliente@example.com").Count(&count)
+	if count != 1 {
+		t.Fatalf("contacts with the email = %d, want 1", count)
+	}
+
+	var contact models.Contact
+	conn.Where("account_id = ?", accountID).First(&contact)
+	for id := range ids {
+		if id != contact.ID {
+			t.Errorf("FindOrCreateContactByEmail returned contact %d, want %d", id, contact.ID)
+		}
+	}
+	if strings.ToLower(contact.Email) != "cliente@example.com" {
+		t.Errorf("email = %q", contact.Email)
+	}
+}
+
+func TestFindOrCreateContactByEmailRetriesUniqueViolation(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	accountID := uint(inbox.AccountID)
+
+	existing := models.Contact{AccountID: accountID, Name: "Cliente", Email: "cliente@example.com"}
+	mustCreate(t, conn, &existing)
+
+	// A primeira busca não enxerga o contato (como se ele ainda não tivesse sido commitado) e
+	// a criação viola idx_contacts_account_email_unique; a segunda tentativa o encontra
+	calls := 0
+	conn.Callback().Query().Before("gorm:query").Register("test:hide_contact", func(tx *gorm.DB) {
+		if tx.Statement.Table == "contacts" && calls == 0 {
+			calls++
+			tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "1 = 0"}}})
+		}
+	})
+	defer conn.Callback().Query().Remove("test:hide_contact")
+
+	contact, err := FindOrCreateContactByEmail(accountID, "Cliente@Example.com", "Cliente")
+	if err != nil {
+		t.Fatalf("FindOrCreateContactByEmail: %v", err)
+	}
+	if contact.ID != existing.ID {
+		t.Fatalf("contact = %d, want existing %d", contact.ID, existing.ID)
+	}
+	if calls != 1 {
+		t.Fatalf("hidden lookups = %d, want 1", calls)
+	}
+}
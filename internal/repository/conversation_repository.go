@@ -1,8 +1,13 @@
 package repository
 
 import (
+	"fmt"
 	"mensager-go/internal/db"
 	"mensager-go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 func ListConversationsByAccount(accountID uint, inboxID *uint) ([]models.Conversation, error) {
@@ -86,30 +91,55 @@ func GetConversationByID(id uint) (*models.Conversation, error) {
 	return &conversation, nil
 }
 
-// FindOrCreateConversation busca ou cria uma conversa
+// FindOrCreateConversation busca ou cria uma conversa.
+// É atômica: um advisory lock por inbox+contato serializa webhooks concorrentes e o índice único
+// idx_conversations_active_contact_unique garante uma única conversa ativa por contato na inbox.
 func FindOrCreateConversation(accountID uint, inboxID uint, contactID uint) (*models.Conversation, error) {
-	// Tentar encontrar conversa existente (incluindo as resolvidas)
+	var conversation *models.Conversation
+	find := func(tx *gorm.DB) error {
+		var err error
+		conversation, err = findOrCreateConversation(tx, accountID, inboxID, contactID)
+		return err
+	}
+
+	err := withAdvisoryLock(conversationLockKey(inboxID, contactID), find)
+	if isUniqueViolation(err) {
+		err = withAdvisoryLock(conversationLockKey(inboxID, contactID), find)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// Carregar contato manualmente
+	var contact models.Contact
+	if err := db.Instance.First(&contact, contactID).Error; err == nil {
+		conversation.Contact = contact
+	}
+
+	return conversation, nil
+}
+
+func findOrCreateConversation(tx *gorm.DB, accountID uint, inboxID uint, contactID uint) (*models.Conversation, error) {
+	// Preferir a conversa ativa; senão a mais recente (incluindo as resolvidas)
 	var conversation models.Conversation
-	err := db.Instance.
+	err := tx.
 		Where("account_id = ? AND inbox_id = ? AND contact_id = ?", accountID, inboxID, contactID).
-		Order("created_at DESC").
+		Order(clause.OrderBy{Expression: clause.Expr{SQL: "status IN (?, ?) DESC, created_at DESC", Vars: []interface{}{models.ConversationStatusOpen, models.ConversationStatusPending}}}).
 		First(&conversation).Error
 
 	if err == nil {
 		// Conversa encontrada - reabrir se estiver resolvida
 		if conversation.Status == models.ConversationStatusResolved {
 			conversation.Status = models.ConversationStatusOpen
-			db.Instance.Save(&conversation)
-		}
-
-		// Carregar contato manualmente
-		var contact models.Contact
-		if err := db.Instance.First(&contact, contactID).Error; err == nil {
-			conversation.Contact = contact
+			if err := tx.Model(&conversation).Update("status", conversation.Status).Error; err != nil {
+				return nil, err
+			}
 		}
-
 		return &conversation, nil
 	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
 
 	// Se não encontrado, criar nova
 	newConversation := &models.Conversation{
@@ -121,17 +151,77 @@ func FindOrCreateConversation(accountID uint, inboxID uint, contactID uint) (*mo
 		Priority:    "medium",
 	}
 
-	if err := db.Instance.Create(newConversation).Error; err != nil {
+	if err := tx.Create(newConversation).Error; err != nil {
 		return nil, err
 	}
 
-	// Carregar contato manualmente
-	var contact models.Contact
-	if err := db.Instance.First(&contact, contactID).Error; err == nil {
-		newConversation.Contact = contact
+	return newConversation, nil
+}
+
+// conversationLockKey chave do advisory lock de find-or-create de conversas
+func conversationLockKey(inboxID uint, contactID uint) string {
+	return fmt.Sprintf("conversation:%d:%d", inboxID, contactID)
+}
+
+// FindLatestConversation busca a conversa mais recente de um contato na inbox, sem criar
+func FindLatestConversation(inboxID uint, contactID uint) (*models.Conversation, error) {
+	var conversation models.Conversation
+	err := db.Instance.
+		Where("inbox_id = ? AND contact_id = ?", inboxID, contactID).
+		Order("created_at DESC").
+		First(&conversation).Error
+	if err != nil {
+		return nil, err
 	}
+	return &conversation, nil
+}
 
-	return newConversation, nil
+// FindOrCreateHistoryConversation busca ou cria a conversa usada na importação de histórico.
+// Diferente de FindOrCreateConversation, não reabre conversas resolvidas e cria as novas já resolvidas,
+// para que o histórico não encha a lista de conversas abertas dos agentes.
+func FindOrCreateHistoryConversation(accountID uint, inboxID uint, contactID uint, createdAt time.Time) (*models.Conversation, bool, error) {
+	var conversation *models.Conversation
+	created := false
+	find := func(tx *gorm.DB) error {
+		var existing models.Conversation
+		err := tx.
+			Where("account_id = ? AND inbox_id = ? AND contact_id = ?", accountID, inboxID, contactID).
+			Order("created_at DESC").
+			First(&existing).Error
+		if err == nil {
+			conversation = &existing
+			return nil
+		}
+		if err != gorm.ErrRecordNotFound {
+			return err
+		}
+
+		conversation = &models.Conversation{
+			AccountID:      uint64(accountID),
+			InboxID:        uint64(inboxID),
+			ContactID:      uint64(contactID),
+			Status:         models.ConversationStatusResolved,
+			UnreadCount:    0,
+			Priority:       "medium",
+			LastActivityAt: &createdAt,
+			CreatedAt:      createdAt,
+		}
+		created = true
+		return tx.Create(conversation).Error
+	}
+
+	if err := withAdvisoryLock(conversationLockKey(inboxID, contactID), find); err != nil {
+		return nil, false, err
+	}
+
+	return conversation, created, nil
+}
+
+// TouchConversationActivity avança last_activity_at para at, sem nunca retroceder
+func TouchConversationActivity(conversationID uint, at time.Time) error {
+	return db.Instance.Model(&models.Conversation{}).
+		Where("id = ? AND (last_activity_at IS NULL OR last_activity_at < ?)", conversationID, at).
+		Update("last_activity_at", at).Error
 }
 
 // UpdateConversation atualiza uma conversa
@@ -199,6 +289,24 @@ func ListGroupConversations(accountID uint, inboxID *uint) ([]models.Conversatio
 		}
 	}
 
+	// Anexar metadados dos grupos (assunto, avatar e participantes)
+	contactIDs := make([]uint, 0, len(conversations))
+	for _, conv := range conversations {
+		contactIDs = append(contactIDs, uint(conv.ContactID))
+	}
+	groups, err := ListGroupsByContactIDs(contactIDs)
+	if err != nil {
+		return nil, err
+	}
+	for i := range conversations {
+		for j := range groups {
+			if groups[j].ContactID == uint(conversations[i].ContactID) && groups[j].InboxID == uint(conversations[i].InboxID) {
+				conversations[i].Group = &groups[j]
+				break
+			}
+		}
+	}
+
 	return conversations, nil
 }
 
@@ -316,6 +424,16 @@ func DeleteConversation(conversationID uint) error {
 		return err
 	}
 
+	// Deletar o histórico de edições das mensagens
+	if err := db.Instance.Where("conversation_id = ?", conversationID).Delete(&models.MessageRevision{}).Error; err != nil {
+		return err
+	}
+
+	// Deletar as reações das mensagens
+	if err := db.Instance.Where("conversation_id = ?", conversationID).Delete(&models.MessageReaction{}).Error; err != nil {
+		return err
+	}
+
 	// Deletar todas as mensagens da conversa
 	if err := db.Instance.Where("conversation_id = ?", conversationID).Delete(&models.Message{}).Error; err != nil {
 		return err
@@ -344,6 +462,16 @@ func DeleteConversationsByInbox(inboxID uint) (int64, error) {
 		return 0, err
 	}
 
+	// Deletar o histórico de edições das mensagens
+	if err := db.Instance.Where("conversation_id IN ?", conversationIDs).Delete(&models.MessageRevision{}).Error; err != nil {
+		return 0, err
+	}
+
+	// Deletar as reações das mensagens
+	if err := db.Instance.Where("conversation_id IN ?", conversationIDs).Delete(&models.MessageReaction{}).Error; err != nil {
+		return 0, err
+	}
+
 	// Deletar todas as mensagens dessas conversas
 	if err := db.Instance.Where("conversation_id IN ?", conversationIDs).Delete(&models.Message{}).Error; err != nil {
 		return 0, err
@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"errors"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// errDryRun desfaz a transação de um merge em modo simulação
+var errDryRun = errors.New("dry run")
+
+// DuplicateRepairReport resultado da correção de duplicados
+type DuplicateRepairReport struct {
+	ContactsMerged      int `json:"contacts_merged"`
+	ConversationsMerged int `json:"conversations_merged"`
+}
+
+// duplicateKey grupo de registros duplicados
+type duplicateKey struct {
+	AccountID uint
+	Value     string
+	InboxID   uint
+	ContactID uint
+}
+
+// RepairDuplicates mescla contatos duplicados (mesmo telefone, identifier ou email na conta) e depois
+// conversas ativas duplicadas (mesmo contato na inbox). Cada grupo é mesclado em sua própria transação;
+// com dryRun nada é gravado (os merges de conversa causados por merges de contato não são contados).
+func RepairDuplicates(dryRun bool) (DuplicateRepairReport, error) {
+	var report DuplicateRepairReport
+
+	for _, column := range []string{"phone_number", "identifier", "LOWER(email)"} {
+		var groups []duplicateKey
+		err := db.Instance.Model(&models.Contact{}).
+			Select("account_id, " + column + " AS value").
+			Where(column + " <> ''").
+			Group("account_id, " + column).
+			Having("COUNT(*) > 1").
+			Scan(&groups).Error
+		if err != nil {
+			return report, err
+		}
+
+		for _, group := range groups {
+			merged, err := mergeDuplicateContacts(group.AccountID, column, group.Value, dryRun)
+			if err != nil {
+				return report, err
+			}
+			report.ContactsMerged += merged
+		}
+	}
+
+	var groups []duplicateKey
+	err := db.Instance.Model(&models.Conversation{}).
+		Select("inbox_id, contact_id").
+		Where("status IN ?", []int{models.ConversationStatusOpen, models.ConversationStatusPending}).
+		Group("inbox_id, contact_id").
+		Having("COUNT(*) > 1").
+		Scan(&groups).Error
+	if err != nil {
+		return report, err
+	}
+
+	for _, group := range groups {
+		merged, err := mergeDuplicateConversations(group.InboxID, group.ContactID, dryRun)
+		if err != nil {
+			return report, err
+		}
+		report.ConversationsMerged += merged
+	}
+
+	return report, nil
+}
+
+// mergeDuplicateContacts mantém o contato mais antigo do grupo e move para ele as referências dos demais
+func mergeDuplicateContacts(accountID uint, column, value string, dryRun bool) (int, error) {
+	merged := 0
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		var contacts []models.Contact
+		if err := tx.Where("account_id = ? AND "+column+" = ?", accountID, value).Order("id ASC").Find(&contacts).Error; err != nil {
+			return err
+		}
+		if len(contacts) < 2 {
+			return nil
+		}
+
+		keep := contacts[0]
+		for _, duplicate := range contacts[1:] {
+			if err := mergeContactInto(tx, &keep, duplicate); err != nil {
+				return err
+			}
+			merged++
+		}
+
+		if err := tx.Save(&keep).Error; err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return 0, err
+	}
+	return merged, nil
+}
+
+// mergeContactInto move conversas, mensagens, reações, grupos e sessões do widget do duplicado para keep e apaga o duplicado.
+// Os dados que faltam em keep são completados com os do duplicado.
+func mergeContactInto(tx *gorm.DB, keep *models.Contact, duplicate models.Contact) error {
+	statements := []struct {
+		sql  string
+		args []interface{}
+	}{
+		{"UPDATE conversations SET contact_id = ? WHERE contact_id = ?", []interface{}{keep.ID, duplicate.ID}},
+		{"UPDATE messages SET sender_id = ? WHERE sender_type = 'Contact' AND sender_id = ?", []interface{}{keep.ID, duplicate.ID}},
+		{"UPDATE whatsapp_groups SET contact_id = ? WHERE contact_id = ?", []interface{}{keep.ID, duplicate.ID}},
+		{"UPDATE widget_sessions SET contact_id = ? WHERE contact_id = ?", []interface{}{keep.ID, duplicate.ID}},
+		// Reações e participações já existentes em keep prevalecem (índices únicos por reator/participante)
+		{`DELETE FROM message_reactions r WHERE r.reactor_type = 'Contact' AND r.reactor_id = ?
+			AND EXISTS (SELECT 1 FROM message_reactions k WHERE k.message_id = r.message_id AND k.reactor_type = 'Contact' AND k.reactor_id = ?)`,
+			[]interface{}{duplicate.ID, keep.ID}},
+		{"UPDATE message_reactions SET reactor_id = ? WHERE reactor_type = 'Contact' AND reactor_id = ?", []interface{}{keep.ID, duplicate.ID}},
+		{`DELETE FROM whatsapp_group_participants p WHERE p.contact_id = ?
+			AND EXISTS (SELECT 1 FROM whatsapp_group_participants k WHERE k.group_id = p.group_id AND k.contact_id = ?)`,
+			[]interface{}{duplicate.ID, keep.ID}},
+		{"UPDATE whatsapp_group_participants SET contact_id = ? WHERE contact_id = ?", []interface{}{keep.ID, duplicate.ID}},
+	}
+	for _, statement := range statements {
+		if err := tx.Exec(statement.sql, statement.args...).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Delete(&models.Contact{}, duplicate.ID).Error; err != nil {
+		return err
+	}
+
+	// Nome editado manualmente prevalece; senão, um nome real prevalece sobre o telefone
+	if duplicate.NameManuallySet && !keep.NameManuallySet {
+		keep.Name = duplicate.Name
+		keep.NameManuallySet = true
+	} else if !keep.NameManuallySet && (keep.Name == "" || keep.Name == keep.PhoneNumber) && duplicate.Name != duplicate.PhoneNumber {
+		keep.Name = duplicate.Name
+	}
+	if keep.Email == "" {
+		keep.Email = duplicate.Email
+	}
+	if keep.PhoneNumber == "" {
+		keep.PhoneNumber = duplicate.PhoneNumber
+	}
+	if keep.Identifier == "" {
+		keep.Identifier = duplicate.Identifier
+	}
+	if keep.AvatarURL == "" {
+		keep.AvatarURL = duplicate.AvatarURL
+	}
+	if len(keep.AdditionalAttributes) == 0 {
+		keep.AdditionalAttributes = duplicate.AdditionalAttributes
+	}
+
+	return nil
+}
+
+// mergeDuplicateConversations mantém a conversa ativa mais antiga e move para ela as mensagens (e envios pendentes) das demais
+func mergeDuplicateConversations(inboxID, contactID uint, dryRun bool) (int, error) {
+	merged := 0
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		var conversations []models.Conversation
+		err := tx.Where("inbox_id = ? AND contact_id = ? AND status IN ?", inboxID, contactID,
+			[]int{models.ConversationStatusOpen, models.ConversationStatusPending}).
+			Order("created_at ASC, id ASC").
+			Find(&conversations).Error
+		if err != nil {
+			return err
+		}
+		if len(conversations) < 2 {
+			return nil
+		}
+
+		keep := conversations[0]
+		for _, duplicate := range conversations[1:] {
+			for _, table := range []string{"messages", "message_read_status", "message_revisions", "message_reactions", "outbox_messages"} {
+				if err := tx.Exec("UPDATE "+table+" SET conversation_id = ? WHERE conversation_id = ?", keep.ID, duplicate.ID).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Delete(&models.Conversation{}, duplicate.ID).Error; err != nil {
+				return err
+			}
+
+			keep.UnreadCount += duplicate.UnreadCount
+			keep.LastActivityAt = latestTime(keep.LastActivityAt, duplicate.LastActivityAt)
+			keep.LastMessageAt = latestTime(keep.LastMessageAt, duplicate.LastMessageAt)
+			if keep.AssigneeID == nil {
+				keep.AssigneeID = duplicate.AssigneeID
+			}
+			if duplicate.Status == models.ConversationStatusOpen {
+				keep.Status = models.ConversationStatusOpen
+			}
+			merged++
+		}
+
+		err = tx.Model(&models.Conversation{}).Where("id = ?", keep.ID).Updates(map[string]interface{}{
+			"unread_count":     keep.UnreadCount,
+			"last_activity_at": keep.LastActivityAt,
+			"last_message_at":  keep.LastMessageAt,
+			"assignee_id":      keep.AssigneeID,
+			"status":           keep.Status,
+		}).Error
+		if err != nil {
+			return err
+		}
+		if dryRun {
+			return errDryRun
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, errDryRun) {
+		return 0, err
+	}
+	return merged, nil
+}
+
+// latestTime retorna o mais recente de dois horários opcionais
+func latestTime(a, b *time.Time) *time.Time {
+	if a == nil || (b != nil && b.After(*a)) {
+		return b
+	}
+	return a
+}
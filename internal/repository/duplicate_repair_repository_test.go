@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// createTestInbox cria uma conta com uma inbox
+func createTestInbox(t *testing.T, conn *gorm.DB) *models.Inbox {
+	t.Helper()
+	account := models.Account{Name: "Test"}
+	if err := conn.Create(&account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	inbox := models.Inbox{AccountID: uint64(account.ID), Name: "Inbox", ChannelType: "api", ChannelID: 1}
+	if err := conn.Create(&inbox).Error; err != nil {
+		t.Fatalf("create inbox: %v", err)
+	}
+	return &inbox
+}
+
+// mustCreate grava o registro ignorando as associações
+func mustCreate(t *testing.T, conn *gorm.DB, value interface{}) {
+	t.Helper()
+	if err := conn.Omit(clause.Associations).Create(value).Error; err != nil {
+		t.Fatalf("create %T: %v", value, err)
+	}
+}
+
+func TestRepairDuplicatesMergesContacts(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	accountID := uint(inbox.AccountID)
+
+	// Duplicados anteriores ao índice único
+	if err := conn.Exec("DROP INDEX idx_contacts_account_phone_unique").Error; err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+
+	keep := models.Contact{AccountID: accountID, Name: "5511999990000", PhoneNumber: "5511999990000"}
+	mustCreate(t, conn, &keep)
+	duplicate := models.Contact{AccountID: accountID, Name: "Maria", PhoneNumber: "5511999990000", Email: "maria@example.com"}
+	mustCreate(t, conn, &duplicate)
+
+	conversation := models.Conversation{AccountID: inbox.AccountID, InboxID: inbox.ID, ContactID: uint64(duplicate.ID)}
+	mustCreate(t, conn, &conversation)
+	message := models.Message{AccountID: accountID, InboxID: uint(inbox.ID), ConversationID: uint(conversation.ID),
+		Content: "oi", SenderType: "Contact", SenderID: duplicate.ID}
+	mustCreate(t, conn, &message)
+	session := models.WidgetSession{AccountID: accountID, InboxID: uint(inbox.ID), ContactID: duplicate.ID, TokenHash: "hash"}
+	mustCreate(t, conn, &session)
+
+	report, err := RepairDuplicates(false)
+	if err != nil {
+		t.Fatalf("RepairDuplicates: %v", err)
+	}
+	if report.ContactsMerged != 1 {
+		t.Fatalf("ContactsMerged = %d, want 1", report.ContactsMerged)
+	}
+
+	var contacts []models.Contact
+	conn.Where("account_id = ?", accountID).Find(&contacts)
+	if len(contacts) != 1 || contacts[0].ID != keep.ID {
+		t.Fatalf("contacts after merge = %+v, want only %d", contacts, keep.ID)
+	}
+	if contacts[0].Name != "Maria" || contacts[0].Email != "maria@example.com" {
+		t.Errorf("merged contact = %q <%s>, want the duplicate's name and email", contacts[0].Name, contacts[0].Email)
+	}
+
+	var got models.Conversation
+	conn.First(&got, conversation.ID)
+	if got.ContactID != uint64(keep.ID) {
+		t.Errorf("conversation contact = %d, want %d", got.ContactID, keep.ID)
+	}
+	var gotMessage models.Message
+	conn.First(&gotMessage, message.ID)
+	if gotMessage.SenderID != keep.ID {
+		t.Errorf("message sender = %d, want %d", gotMessage.SenderID, keep.ID)
+	}
+	var gotSession models.WidgetSession
+	conn.First(&gotSession, session.ID)
+	if gotSession.ContactID != keep.ID {
+		t.Errorf("widget session contact = %d, want %d", gotSession.ContactID, keep.ID)
+	}
+
+	// Sem duplicados o índice volta a ser criado
+	if err := conn.Exec(`CREATE UNIQUE INDEX idx_contacts_account_phone_unique ON contacts (account_id, phone_number) WHERE phone_number <> ''`).Error; err != nil {
+		t.Errorf("recreate unique index: %v", err)
+	}
+}
+
+func TestRepairDuplicatesMergesConversations(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	accountID := uint(inbox.AccountID)
+
+	if err := conn.Exec("DROP INDEX idx_conversations_active_contact_unique").Error; err != nil {
+		t.Fatalf("drop index: %v", err)
+	}
+
+	contact := models.Contact{AccountID: accountID, Name: "Ana", PhoneNumber: "5511988880000"}
+	mustCreate(t, conn, &contact)
+	keep := models.Conversation{AccountID: inbox.AccountID, InboxID: inbox.ID, ContactID: uint64(contact.ID)}
+	mustCreate(t, conn, &keep)
+	duplicate := models.Conversation{AccountID: inbox.AccountID, InboxID: inbox.ID, ContactID: uint64(contact.ID)}
+	mustCreate(t, conn, &duplicate)
+
+	message := models.Message{AccountID: accountID, InboxID: uint(inbox.ID), ConversationID: uint(duplicate.ID),
+		Content: "pendente", MessageType: models.MessageTypeOutgoing, Status: models.MessageStatusPending}
+	outbox := models.OutboxMessage{Status: models.OutboxStatusPending}
+	if err := CreateQueuedMessage(&message, &outbox); err != nil {
+		t.Fatalf("CreateQueuedMessage: %v", err)
+	}
+
+	report, err := RepairDuplicates(false)
+	if err != nil {
+		t.Fatalf("RepairDuplicates: %v", err)
+	}
+	if report.ConversationsMerged != 1 {
+		t.Fatalf("ConversationsMerged = %d, want 1", report.ConversationsMerged)
+	}
+
+	var gotMessage models.Message
+	conn.First(&gotMessage, message.ID)
+	if gotMessage.ConversationID != uint(keep.ID) {
+		t.Errorf("message conversation = %d, want %d", gotMessage.ConversationID, keep.ID)
+	}
+	var gotOutbox models.OutboxMessage
+	conn.First(&gotOutbox, outbox.ID)
+	if gotOutbox.ConversationID != uint(keep.ID) {
+		t.Errorf("outbox conversation = %d, want %d", gotOutbox.ConversationID, keep.ID)
+	}
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+)
+
+// GetEmailPollState busca a posição da leitura IMAP de uma inbox
+func GetEmailPollState(inboxID uint) (*models.EmailPollState, error) {
+	var state models.EmailPollState
+	if err := db.Instance.Where("inbox_id = ?", inboxID).First(&state).Error; err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// SaveEmailPollState grava a posição da leitura IMAP (cria no primeiro polling)
+func SaveEmailPollState(state *models.EmailPollState) error {
+	return db.Instance.Save(state).Error
+}
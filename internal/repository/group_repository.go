@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// GetGroupByJID busca um grupo da inbox pelo JID
+func GetGroupByJID(inboxID uint, jid string) (*models.Group, error) {
+	var group models.Group
+	err := db.Instance.Where("inbox_id = ? AND jid = ?", inboxID, jid).First(&group).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// GetGroupByContact busca o grupo representado pelo contato de uma conversa
+func GetGroupByContact(inboxID, contactID uint) (*models.Group, error) {
+	var group models.Group
+	err := db.Instance.
+		Preload("Participants").
+		Preload("Participants.Contact").
+		Where("inbox_id = ? AND contact_id = ?", inboxID, contactID).
+		First(&group).Error
+	if err != nil {
+		return nil, err
+	}
+	return &group, nil
+}
+
+// FindOrCreateGroup busca ou cria o grupo e o contato que representa o grupo na conversa.
+// O contato do grupo é identificado apenas pelo JID (sem telefone). Retorna true quando o grupo foi criado.
+func FindOrCreateGroup(accountID, inboxID uint, jid, subject string) (*models.Group, bool, error) {
+	if group, err := GetGroupByJID(inboxID, jid); err == nil {
+		return group, false, nil
+	}
+
+	contact, err := FindOrCreateContactByIdentifier(accountID, jid, subject)
+	if err != nil {
+		return nil, false, err
+	}
+	// Contatos de grupo antigos foram criados com o JID tratado como telefone
+	if contact.PhoneNumber != "" {
+		contact.PhoneNumber = ""
+		if err := UpdateContact(contact); err != nil {
+			return nil, false, err
+		}
+	}
+
+	group := &models.Group{
+		AccountID: accountID,
+		InboxID:   inboxID,
+		JID:       jid,
+		ContactID: contact.ID,
+		Subject:   subject,
+	}
+
+	// Outro webhook pode ter criado o grupo em paralelo
+	result := db.Instance.Clauses(clause.OnConflict{DoNothing: true}).Create(group)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 0 {
+		existing, err := GetGroupByJID(inboxID, jid)
+		return existing, false, err
+	}
+
+	return group, true, nil
+}
+
+// UpdateGroup atualiza os metadados do grupo
+func UpdateGroup(group *models.Group) error {
+	return db.Instance.Omit("Participants").Save(group).Error
+}
+
+// ReplaceGroupParticipants substitui a lista de participantes do grupo
+func ReplaceGroupParticipants(groupID uint, participants []models.GroupParticipant) error {
+	return db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("group_id = ?", groupID).Delete(&models.GroupParticipant{}).Error; err != nil {
+			return err
+		}
+		if len(participants) == 0 {
+			return nil
+		}
+		for i := range participants {
+			participants[i].ID = 0
+			participants[i].GroupID = groupID
+		}
+		return tx.Omit("Contact").Clauses(clause.OnConflict{DoNothing: true}).Create(&participants).Error
+	})
+}
+
+// AddGroupParticipant registra um participante sem alterar seus privilégios no grupo
+func AddGroupParticipant(participant *models.GroupParticipant) error {
+	return db.Instance.Omit("Contact").Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "group_id"}, {Name: "contact_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"jid", "updated_at"}),
+	}).Create(participant).Error
+}
+
+// RemoveGroupParticipants remove participantes do grupo pelo JID
+func RemoveGroupParticipants(groupID uint, jids []string) error {
+	if len(jids) == 0 {
+		return nil
+	}
+	return db.Instance.Where("group_id = ? AND jid IN ?", groupID, jids).Delete(&models.GroupParticipant{}).Error
+}
+
+// ListGroupsByContactIDs lista os grupos (com participantes) representados pelos contatos informados
+func ListGroupsByContactIDs(contactIDs []uint) ([]models.Group, error) {
+	var groups []models.Group
+	if len(contactIDs) == 0 {
+		return groups, nil
+	}
+	err := db.Instance.
+		Preload("Participants").
+		Preload("Participants.Contact").
+		Where("contact_id IN ?", contactIDs).
+		Find(&groups).Error
+	return groups, err
+}
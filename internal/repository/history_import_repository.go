@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// HistoryImportDelta contadores de um lote de histórico processado
+type HistoryImportDelta struct {
+	Chats                int
+	MessagesReceived     int
+	MessagesImported     int
+	MessagesSkipped      int
+	ConversationsTouched int
+	Progress             int // -1 quando o lote não informa progresso
+	Completed            bool
+	Error                string
+}
+
+// GetHistoryImport busca o progresso da importação de histórico de uma inbox
+func GetHistoryImport(inboxID uint) (*models.HistoryImport, error) {
+	var historyImport models.HistoryImport
+	if err := db.Instance.Where("inbox_id = ?", inboxID).First(&historyImport).Error; err != nil {
+		return nil, err
+	}
+	return &historyImport, nil
+}
+
+// RecordHistoryImportBatch soma os contadores de um lote ao progresso da inbox (criando o registro no primeiro lote).
+// Um novo lote após a conclusão (ex.: reconexão) reinicia o status para running, mantendo os totais.
+// batchKey identifica o lote: no retry de um lote já registrado só as mensagens gravadas nesta tentativa são somadas.
+func RecordHistoryImportBatch(accountID, inboxID uint, batchKey string, delta HistoryImportDelta) (*models.HistoryImport, error) {
+	now := time.Now()
+
+	status := models.HistoryImportStatusRunning
+	var completedAt *time.Time
+	if delta.Completed {
+		status = models.HistoryImportStatusCompleted
+		completedAt = &now
+	}
+
+	progress := delta.Progress
+	if progress < 0 {
+		progress = 0
+	}
+
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.HistoryImportBatch{InboxID: inboxID, BatchKey: batchKey})
+		if result.Error != nil {
+			return result.Error
+		}
+
+		batches := 1
+		if result.RowsAffected == 0 {
+			// Retry de um lote já contabilizado
+			batches = 0
+			delta = HistoryImportDelta{MessagesImported: delta.MessagesImported, Progress: delta.Progress, Completed: delta.Completed, Error: delta.Error}
+		}
+
+		record := &models.HistoryImport{
+			AccountID:            accountID,
+			InboxID:              inboxID,
+			Status:               status,
+			Progress:             progress,
+			Batches:              batches,
+			ChatsReceived:        delta.Chats,
+			MessagesReceived:     delta.MessagesReceived,
+			MessagesImported:     delta.MessagesImported,
+			MessagesSkipped:      delta.MessagesSkipped,
+			ConversationsTouched: delta.ConversationsTouched,
+			LastError:            delta.Error,
+			StartedAt:            now,
+			CompletedAt:          completedAt,
+		}
+
+		updates := map[string]interface{}{
+			"status":                status,
+			"batches":               gorm.Expr("history_imports.batches + ?", batches),
+			"chats_received":        gorm.Expr("history_imports.chats_received + ?", delta.Chats),
+			"messages_received":     gorm.Expr("history_imports.messages_received + ?", delta.MessagesReceived),
+			"messages_imported":     gorm.Expr("history_imports.messages_imported + ?", delta.MessagesImported),
+			"messages_skipped":      gorm.Expr("history_imports.messages_skipped + ?", delta.MessagesSkipped),
+			"conversations_touched": gorm.Expr("history_imports.conversations_touched + ?", delta.ConversationsTouched),
+			"completed_at":          completedAt,
+			"updated_at":            now,
+		}
+		if delta.Progress >= 0 {
+			updates["progress"] = delta.Progress
+		}
+		if delta.Error != "" {
+			updates["last_error"] = delta.Error
+		}
+
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "inbox_id"}},
+			DoUpdates: clause.Assignments(updates),
+		}).Create(record).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetHistoryImport(inboxID)
+}
@@ -18,3 +18,10 @@ func ListInboxesByAccount(accountID uint) ([]models.Inbox, error) {
 	err := db.Instance.Where("account_id = ?", accountID).Find(&inboxes).Error
 	return inboxes, err
 }
+
+// ListInboxesByChannelType lista as inboxes de um tipo de canal em todas as contas
+func ListInboxesByChannelType(channelType string) ([]models.Inbox, error) {
+	var inboxes []models.Inbox
+	err := db.Instance.Where("channel_type = ?", channelType).Find(&inboxes).Error
+	return inboxes, err
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+)
+
+// GetIntegration busca uma integração da conta
+func GetIntegration(id, accountID uint) (*models.Integration, error) {
+	var integration models.Integration
+	err := db.Instance.Where("id = ? AND account_id = ?", id, accountID).First(&integration).Error
+	if err != nil {
+		return nil, err
+	}
+	return &integration, nil
+}
+
+// UpdateIntegrationFields atualiza campos específicos de uma integração
+func UpdateIntegrationFields(id uint, updates map[string]interface{}) error {
+	return db.Instance.Model(&models.Integration{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// CreateIntegrationStatusEvent registra uma transição de status
+func CreateIntegrationStatusEvent(event *models.IntegrationStatusEvent) error {
+	return db.Instance.Create(event).Error
+}
+
+// ListIntegrationStatusEvents lista as transições mais recentes de uma integração
+func ListIntegrationStatusEvents(integrationID uint, limit int) ([]models.IntegrationStatusEvent, error) {
+	var events []models.IntegrationStatusEvent
+	err := db.Instance.
+		Where("integration_id = ?", integrationID).
+		Order("occurred_at DESC").
+		Limit(limit).
+		Find(&events).Error
+	return events, err
+}
+
+// ListInboxIDsByIntegration lista as inboxes atendidas pela integração
+func ListInboxIDsByIntegration(integrationID uint) ([]uint64, error) {
+	var ids []uint64
+	err := db.Instance.Model(&models.Inbox{}).Where("channel_id = ?", integrationID).Pluck("id", &ids).Error
+	return ids, err
+}
+
+// ListInboxesWithoutIntegration lista as inboxes da conta cujo channel_id não aponta para uma integração
+func ListInboxesWithoutIntegration(accountID uint) ([]models.Inbox, error) {
+	var inboxes []models.Inbox
+	err := db.Instance.
+		Where("account_id = ? AND NOT EXISTS (SELECT 1 FROM integrations WHERE integrations.id = inboxes.channel_id)", accountID).
+		Order("id").
+		Find(&inboxes).Error
+	return inboxes, err
+}
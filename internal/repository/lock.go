@@ -0,0 +1,26 @@
+package repository
+
+import (
+	"errors"
+	"mensager-go/internal/db"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// withAdvisoryLock executa fn em uma transação que segura um advisory lock do Postgres para a chave.
+// Serializa find-or-create concorrentes (ex.: várias mensagens de um contato novo chegando juntas).
+func withAdvisoryLock(key string, fn func(tx *gorm.DB) error) error {
+	return db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(hashtext(?))", key).Error; err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// isUniqueViolation indica erro de chave única duplicada (SQLSTATE 23505)
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// UpsertMessageReaction cria ou substitui a reação de um reator a uma mensagem
+func UpsertMessageReaction(reaction *models.MessageReaction) error {
+	return db.Instance.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "message_id"}, {Name: "reactor_type"}, {Name: "reactor_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"emoji", "whatsapp_message_id", "reacted_at", "updated_at"}),
+	}).Create(reaction).Error
+}
+
+// DeleteMessageReaction remove a reação de um reator a uma mensagem
+func DeleteMessageReaction(messageID uint, reactorType string, reactorID uint) error {
+	return db.Instance.
+		Where("message_id = ? AND reactor_type = ? AND reactor_id = ?", messageID, reactorType, reactorID).
+		Delete(&models.MessageReaction{}).Error
+}
+
+// GetReactionByWhatsAppID busca a reação a uma mensagem pelo ID da mensagem de reação no WhatsApp
+func GetReactionByWhatsAppID(messageID uint, whatsappMessageID string) (*models.MessageReaction, error) {
+	var reaction models.MessageReaction
+	err := db.Instance.Where("message_id = ? AND whatsapp_message_id = ?", messageID, whatsappMessageID).First(&reaction).Error
+	if err != nil {
+		return nil, err
+	}
+	return &reaction, nil
+}
+
+// ListReactionsByMessage lista as reações de uma mensagem
+func ListReactionsByMessage(messageID uint) ([]models.MessageReaction, error) {
+	var reactions []models.MessageReaction
+	err := db.Instance.Where("message_id = ?", messageID).Order("reacted_at ASC").Find(&reactions).Error
+	return reactions, err
+}
+
+// ListReactionsByMessageIDs retorna as reações agrupadas por mensagem
+func ListReactionsByMessageIDs(messageIDs []uint) (map[uint][]models.MessageReaction, error) {
+	grouped := make(map[uint][]models.MessageReaction)
+	if len(messageIDs) == 0 {
+		return grouped, nil
+	}
+
+	var reactions []models.MessageReaction
+	if err := db.Instance.Where("message_id IN ?", messageIDs).Order("reacted_at ASC").Find(&reactions).Error; err != nil {
+		return nil, err
+	}
+
+	for _, reaction := range reactions {
+		grouped[reaction.MessageID] = append(grouped[reaction.MessageID], reaction)
+	}
+	return grouped, nil
+}
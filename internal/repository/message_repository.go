@@ -1,15 +1,34 @@
 package repository
 
 import (
+	"fmt"
 	"mensager-go/internal/db"
 	"mensager-go/internal/models"
+	"strings"
+	"time"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // CreateMessage cria uma nova mensagem
 func CreateMessage(message *models.Message) error {
-	return db.Instance.Create(message).Error
+	if err := db.Instance.Create(message).Error; err != nil {
+		return err
+	}
+	return LinkQuotingReplies(message)
+}
+
+// LinkQuotingReplies preenche in_reply_to das respostas que citaram a mensagem antes de ela ser gravada
+// (eventos fora de ordem); assim as listagens não precisam resolver citações pendentes
+func LinkQuotingReplies(message *models.Message) error {
+	if message.WhatsAppMessageID == nil || *message.WhatsAppMessageID == "" {
+		return nil
+	}
+	return db.Instance.Model(&models.Message{}).
+		Where("quoted_message_id = ? AND conversation_id = ? AND in_reply_to IS NULL AND id <> ?",
+			*message.WhatsAppMessageID, message.ConversationID, message.ID).
+		Update("in_reply_to", message.ID).Error
 }
 
 // GetMessageByID busca uma mensagem por ID
@@ -26,6 +45,63 @@ func GetMessageByWhatsAppID(whatsappMessageID string) (*models.Message, error) {
 	return &message, err
 }
 
+// ListMessagesByIDs busca mensagens pelos IDs internos
+func ListMessagesByIDs(ids []uint) ([]models.Message, error) {
+	var messages []models.Message
+	if len(ids) == 0 {
+		return messages, nil
+	}
+	err := db.Instance.Where("id IN ?", ids).Find(&messages).Error
+	return messages, err
+}
+
+// ListMessagesByWhatsAppIDs busca mensagens pelos IDs do WhatsApp
+func ListMessagesByWhatsAppIDs(whatsappMessageIDs []string) ([]models.Message, error) {
+	var messages []models.Message
+	if len(whatsappMessageIDs) == 0 {
+		return messages, nil
+	}
+	err := db.Instance.Where("whatsapp_message_id IN ?", whatsappMessageIDs).Find(&messages).Error
+	return messages, err
+}
+
+// GetLatestEmailMessage busca a última mensagem da conversa com cabeçalhos de email (base do thread das respostas)
+func GetLatestEmailMessage(conversationID uint) (*models.Message, error) {
+	var message models.Message
+	err := db.Instance.
+		Where("conversation_id = ? AND content_attributes -> 'email' IS NOT NULL", conversationID).
+		Order("id DESC").
+		First(&message).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// GetLatestIncomingMessage busca a última mensagem recebida de um contato na inbox (base da janela de atendimento)
+func GetLatestIncomingMessage(inboxID uint, contactID uint) (*models.Message, error) {
+	var message models.Message
+	err := db.Instance.
+		Where("inbox_id = ? AND sender_type = ? AND sender_id = ? AND message_type = ?", inboxID, "Contact", contactID, models.MessageTypeIncoming).
+		Order("id DESC").
+		First(&message).Error
+	if err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// ListUnreadOutgoingMessages lista as mensagens enviadas da conversa ainda não lidas, criadas até o instante informado
+func ListUnreadOutgoingMessages(conversationID uint, until time.Time) ([]models.Message, error) {
+	var messages []models.Message
+	err := db.Instance.
+		Where("conversation_id = ? AND message_type = ? AND whatsapp_message_id IS NOT NULL AND status <> ? AND created_at <= ?",
+			conversationID, models.MessageTypeOutgoing, models.MessageStatusRead, until).
+		Order("id ASC").
+		Find(&messages).Error
+	return messages, err
+}
+
 // UpsertMessage cria ou atualiza mensagem baseado no WhatsApp Message ID
 func UpsertMessage(message *models.Message) error {
 	if message.WhatsAppMessageID == nil || *message.WhatsAppMessageID == "" {
@@ -46,7 +122,10 @@ func UpsertMessage(message *models.Message) error {
 
 	// Existe, atualiza
 	message.ID = existing.ID
-	return db.Instance.Save(message).Error
+	if err := db.Instance.Save(message).Error; err != nil {
+		return err
+	}
+	return LinkQuotingReplies(message)
 }
 
 // ListMessagesByConversation lista mensagens de uma conversa (últimas mensagens primeiro)
@@ -107,8 +186,87 @@ func UpdateMessageByWhatsAppID(whatsappMessageID string, updates map[string]inte
 		Updates(updates).Error
 }
 
+// ModifyMessageByWhatsAppID lê a mensagem com SELECT ... FOR UPDATE e aplica as alterações calculadas por modify
+// na mesma transação, evitando que atualizações concorrentes do mesmo JSON (ex: votos de enquete) se sobrescrevam
+func ModifyMessageByWhatsAppID(whatsappMessageID string, modify func(message *models.Message) (map[string]interface{}, error)) (*models.Message, error) {
+	var message models.Message
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("whatsapp_message_id = ?", whatsappMessageID).
+			First(&message).Error; err != nil {
+			return err
+		}
+
+		updates, err := modify(&message)
+		if err != nil || len(updates) == 0 {
+			return err
+		}
+		return tx.Model(&models.Message{}).Where("id = ?", message.ID).Updates(updates).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return GetMessageByID(message.ID)
+}
+
+// UpdateMessageFields atualiza campos de uma mensagem pelo ID interno
+func UpdateMessageFields(id uint, updates map[string]interface{}) error {
+	return db.Instance.Model(&models.Message{}).Where("id = ?", id).Updates(updates).Error
+}
+
+// messageStatusRankSQL expressão SQL equivalente a models.MessageStatusRank
+func messageStatusRankSQL(column string) string {
+	return fmt.Sprintf("(CASE %s WHEN '%s' THEN 1 WHEN '%s' THEN 2 WHEN '%s' THEN 3 ELSE 0 END)",
+		column, models.MessageStatusSent, models.MessageStatusDelivered, models.MessageStatusRead)
+}
+
+// AdvanceMessageStatus aplica um status de entrega em um único UPDATE condicional: o status só avança
+// (sent → delivered → read), "failed" só substitui mensagens sem confirmação de entrega e os timestamps
+// ausentes são preenchidos. Retorna false quando nada mudou (ou a mensagem não existe na inbox).
+func AdvanceMessageStatus(inboxID uint, whatsappMessageID, status string, at time.Time) (bool, error) {
+	current := messageStatusRankSQL("status")
+	rank := models.MessageStatusRank(status)
+	sentRank := models.MessageStatusRank(models.MessageStatusSent)
+
+	updates := map[string]interface{}{"updated_at": time.Now()}
+	var conditions []string
+	var args []interface{}
+
+	if status == models.MessageStatusFailed {
+		updates["status"] = status
+		conditions = append(conditions, current+" <= ? AND status <> ?")
+		args = append(args, sentRank, status)
+	} else {
+		updates["status"] = gorm.Expr("CASE WHEN "+current+" < ? THEN ? ELSE status END", rank, status)
+		conditions = append(conditions, current+" < ?")
+		args = append(args, rank)
+
+		// Leitura implica entrega: preencher delivered_at caso o evento de entrega chegue depois (ou nunca)
+		if rank >= models.MessageStatusRank(models.MessageStatusDelivered) {
+			updates["delivered_at"] = gorm.Expr("COALESCE(delivered_at, ?)", at)
+			conditions = append(conditions, "delivered_at IS NULL")
+		}
+		if status == models.MessageStatusRead {
+			updates["read_at"] = gorm.Expr("COALESCE(read_at, ?)", at)
+			conditions = append(conditions, "read_at IS NULL")
+		}
+	}
+
+	result := db.Instance.Model(&models.Message{}).
+		Where("whatsapp_message_id = ? AND inbox_id = ?", whatsappMessageID, inboxID).
+		Where("("+strings.Join(conditions, ") OR (")+")", args...).
+		Updates(updates)
+	return result.RowsAffected > 0, result.Error
+}
+
 // DeleteMessage deleta uma mensagem
 func DeleteMessage(id uint) error {
+	if err := db.Instance.Where("message_id = ?", id).Delete(&models.MessageRevision{}).Error; err != nil {
+		return err
+	}
+	if err := db.Instance.Where("message_id = ?", id).Delete(&models.MessageReaction{}).Error; err != nil {
+		return err
+	}
 	return db.Instance.Delete(&models.Message{}, id).Error
 }
 
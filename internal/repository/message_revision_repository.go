@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReviseMessageByWhatsAppID lê a mensagem com SELECT ... FOR UPDATE e grava, na mesma transação, a revisão com o
+// conteúdo anterior e as alterações calculadas por revise. Edições concorrentes são aplicadas uma após a outra e
+// uma falha não deixa revisão sem a alteração correspondente. Retorna nil quando revise não altera nada.
+func ReviseMessageByWhatsAppID(whatsappMessageID string, revise func(message *models.Message) (*models.MessageRevision, map[string]interface{}, error)) (*models.Message, error) {
+	var message models.Message
+	changed := false
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("whatsapp_message_id = ?", whatsappMessageID).
+			First(&message).Error; err != nil {
+			return err
+		}
+
+		revision, updates, err := revise(&message)
+		if err != nil || revision == nil {
+			return err
+		}
+		if err := tx.Create(revision).Error; err != nil {
+			return err
+		}
+		changed = true
+		return tx.Model(&models.Message{}).Where("id = ?", message.ID).Updates(updates).Error
+	})
+	if err != nil || !changed {
+		return nil, err
+	}
+	return GetMessageByID(message.ID)
+}
+
+// ListMessageRevisions lista o histórico de alterações de uma mensagem (mais antigas primeiro)
+func ListMessageRevisions(messageID uint) ([]models.MessageRevision, error) {
+	var revisions []models.MessageRevision
+	err := db.Instance.Where("message_id = ?", messageID).Order("revised_at ASC, id ASC").Find(&revisions).Error
+	return revisions, err
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"errors"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateQueuedMessage grava a mensagem e a sua entrada no outbox na mesma transação
+func CreateQueuedMessage(message *models.Message, outbox *models.OutboxMessage) error {
+	return db.Instance.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(message).Error; err != nil {
+			return err
+		}
+		outbox.MessageID = message.ID
+		outbox.AccountID = message.AccountID
+		outbox.InboxID = message.InboxID
+		outbox.ConversationID = message.ConversationID
+		return tx.Create(outbox).Error
+	})
+}
+
+// ClaimOutboxMessages reserva até limit envios prontos, marcando-os como "processing" até now+lease.
+// Envios "processing" com a reserva expirada (worker ou réplica interrompidos) voltam a ser elegíveis.
+// Um envio só é elegível quando não há outro anterior da mesma conversa ainda pendente,
+// o que garante a ordem de entrega por conversa.
+func ClaimOutboxMessages(limit int, lease time.Duration) ([]models.OutboxMessage, error) {
+	var entries []models.OutboxMessage
+	if limit <= 0 {
+		return entries, nil
+	}
+
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var ids []uint
+		err := tx.Raw(`
+			SELECT o.id FROM outbox_messages o
+			WHERE ((o.status IN (?, ?) AND (o.next_attempt_at IS NULL OR o.next_attempt_at <= ?))
+			    OR (o.status = ? AND (o.locked_until IS NULL OR o.locked_until <= ?)))
+			  AND NOT EXISTS (
+				SELECT 1 FROM outbox_messages p
+				WHERE p.conversation_id = o.conversation_id
+				  AND p.id < o.id
+				  AND p.status IN (?, ?, ?)
+			  )
+			ORDER BY o.id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED`,
+			models.OutboxStatusPending, models.OutboxStatusRetry, now,
+			models.OutboxStatusProcessing, now,
+			models.OutboxStatusPending, models.OutboxStatusRetry, models.OutboxStatusProcessing,
+			limit,
+		).Scan(&ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		if err := tx.Model(&models.OutboxMessage{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       models.OutboxStatusProcessing,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_until": now.Add(lease),
+			"updated_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ?", ids).Order("id ASC").Find(&entries).Error
+	})
+
+	return entries, err
+}
+
+// ExtendOutboxLease renova a reserva de um envio em andamento; false quando ele já não está "processing"
+func ExtendOutboxLease(id uint, until time.Time) (bool, error) {
+	result := db.Instance.Model(&models.OutboxMessage{}).
+		Where("id = ? AND status = ?", id, models.OutboxStatusProcessing).
+		Updates(map[string]interface{}{
+			"locked_until": until,
+			"updated_at":   time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkOutboxMessageSent marca o envio como entregue ao provedor
+func MarkOutboxMessageSent(id uint) error {
+	now := time.Now()
+	return db.Instance.Model(&models.OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.OutboxStatusSent,
+		"last_error":      "",
+		"next_attempt_at": nil,
+		"locked_until":    nil,
+		"sent_at":         now,
+		"updated_at":      now,
+	}).Error
+}
+
+// MarkOutboxMessageFailed registra a falha do envio; status é "retry" (com nextAttemptAt) ou "dead"
+func MarkOutboxMessageFailed(id uint, status, errorMessage string, nextAttemptAt *time.Time) error {
+	return db.Instance.Model(&models.OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"last_error":      errorMessage,
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    nil,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
+// DeferOutboxMessage devolve à fila um envio adiado pelo limite de taxa, sem consumir tentativa
+func DeferOutboxMessage(id uint, nextAttemptAt time.Time) error {
+	return db.Instance.Model(&models.OutboxMessage{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.OutboxStatusPending,
+		"attempts":        gorm.Expr("GREATEST(attempts - 1, 0)"),
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    nil,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
+// GetProcessingOutboxMessage mensagem do envio em andamento na conversa (só há um "processing" por conversa);
+// nil quando não há envio aguardando a resposta do provedor
+func GetProcessingOutboxMessage(conversationID uint) (*models.Message, error) {
+	var entry models.OutboxMessage
+	err := db.Instance.
+		Where("conversation_id = ? AND status = ?", conversationID, models.OutboxStatusProcessing).
+		Order("id ASC").
+		First(&entry).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var message models.Message
+	if err := db.Instance.First(&message, entry.MessageID).Error; err != nil {
+		return nil, err
+	}
+	return &message, nil
+}
+
+// OutboxQueueStats profundidade da fila de envio de um conjunto de inboxes
+type OutboxQueueStats struct {
+	Pending         int64      `json:"pending"`
+	Retry           int64      `json:"retry"`
+	Processing      int64      `json:"processing"`
+	Dead            int64      `json:"dead"`
+	OldestPendingAt *time.Time `json:"oldest_pending_at"` // Envio mais antigo ainda não entregue
+}
+
+// GetOutboxQueueStats conta os envios por status das inboxes informadas
+func GetOutboxQueueStats(inboxIDs []uint64) (*OutboxQueueStats, error) {
+	stats := &OutboxQueueStats{}
+	if len(inboxIDs) == 0 {
+		return stats, nil
+	}
+
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := db.Instance.Model(&models.OutboxMessage{}).
+		Select("status, COUNT(*) AS count").
+		Where("inbox_id IN ? AND status <> ?", inboxIDs, models.OutboxStatusSent).
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		switch row.Status {
+		case models.OutboxStatusPending:
+			stats.Pending = row.Count
+		case models.OutboxStatusRetry:
+			stats.Retry = row.Count
+		case models.OutboxStatusProcessing:
+			stats.Processing = row.Count
+		case models.OutboxStatusDead:
+			stats.Dead = row.Count
+		}
+	}
+
+	var oldest struct {
+		At *time.Time
+	}
+	err := db.Instance.Model(&models.OutboxMessage{}).
+		Select("MIN(created_at) AS at").
+		Where("inbox_id IN ? AND status IN ?", inboxIDs, []string{models.OutboxStatusPending, models.OutboxStatusRetry, models.OutboxStatusProcessing}).
+		Scan(&oldest).Error
+	stats.OldestPendingAt = oldest.At
+	return stats, err
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// queueTestMessage grava uma mensagem pendente e a sua entrada no outbox
+func queueTestMessage(t *testing.T, inbox *models.Inbox, conversationID uint64) *models.OutboxMessage {
+	t.Helper()
+	message := models.Message{AccountID: uint(inbox.AccountID), InboxID: uint(inbox.ID), ConversationID: uint(conversationID),
+		Content: "oi", MessageType: models.MessageTypeOutgoing, Status: models.MessageStatusPending}
+	entry := models.OutboxMessage{Status: models.OutboxStatusPending}
+	if err := CreateQueuedMessage(&message, &entry); err != nil {
+		t.Fatalf("CreateQueuedMessage: %v", err)
+	}
+	return &entry
+}
+
+// createTestConversation cria um contato com uma conversa na inbox
+func createTestConversation(t *testing.T, conn *gorm.DB, inbox *models.Inbox, phoneNumber string) *models.Conversation {
+	t.Helper()
+	contact := models.Contact{AccountID: uint(inbox.AccountID), Name: phoneNumber, PhoneNumber: phoneNumber}
+	mustCreate(t, conn, &contact)
+	conversation := models.Conversation{AccountID: inbox.AccountID, InboxID: inbox.ID, ContactID: uint64(contact.ID)}
+	mustCreate(t, conn, &conversation)
+	return &conversation
+}
+
+func claimedIDs(entries []models.OutboxMessage) []uint {
+	ids := make([]uint, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	return ids
+}
+
+func TestClaimOutboxMessagesKeepsConversationOrder(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	first := createTestConversation(t, conn, inbox, "5511911110000")
+	second := createTestConversation(t, conn, inbox, "5511922220000")
+
+	a1 := queueTestMessage(t, inbox, first.ID)
+	a2 := queueTestMessage(t, inbox, first.ID)
+	b1 := queueTestMessage(t, inbox, second.ID)
+
+	// Um envio por conversa, na ordem de criação
+	entries, err := ClaimOutboxMessages(10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutboxMessages: %v", err)
+	}
+	if ids := claimedIDs(entries); len(ids) != 2 || ids[0] != a1.ID || ids[1] != b1.ID {
+		t.Fatalf("claimed %v, want [%d %d]", ids, a1.ID, b1.ID)
+	}
+	if entries[0].Status != models.OutboxStatusProcessing || entries[0].Attempts != 1 || entries[0].LockedUntil == nil {
+		t.Errorf("claimed entry = %s, attempts %d, locked until %v", entries[0].Status, entries[0].Attempts, entries[0].LockedUntil)
+	}
+
+	// O segundo envio da conversa espera o primeiro
+	if entries, err := ClaimOutboxMessages(10, time.Minute); err != nil || len(entries) != 0 {
+		t.Fatalf("claimed %v (%v) while the first send is in progress", claimedIDs(entries), err)
+	}
+
+	// Em retry futuro o primeiro ainda bloqueia a conversa
+	next := time.Now().Add(time.Hour)
+	if err := MarkOutboxMessageFailed(a1.ID, models.OutboxStatusRetry, "timeout", &next); err != nil {
+		t.Fatalf("MarkOutboxMessageFailed: %v", err)
+	}
+	if entries, err := ClaimOutboxMessages(10, time.Minute); err != nil || len(entries) != 0 {
+		t.Fatalf("claimed %v (%v) ahead of a scheduled retry", claimedIDs(entries), err)
+	}
+
+	if err := MarkOutboxMessageSent(a1.ID); err != nil {
+		t.Fatalf("MarkOutboxMessageSent: %v", err)
+	}
+	entries, err = ClaimOutboxMessages(10, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutboxMessages: %v", err)
+	}
+	if ids := claimedIDs(entries); len(ids) != 1 || ids[0] != a2.ID {
+		t.Fatalf("claimed %v, want [%d]", ids, a2.ID)
+	}
+}
+
+func TestClaimOutboxMessagesRetakesExpiredLease(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	conversation := createTestConversation(t, conn, inbox, "5511933330000")
+	entry := queueTestMessage(t, inbox, conversation.ID)
+
+	if _, err := ClaimOutboxMessages(1, time.Minute); err != nil {
+		t.Fatalf("ClaimOutboxMessages: %v", err)
+	}
+	// Reserva válida: outra réplica não retoma o envio
+	if entries, err := ClaimOutboxMessages(1, time.Minute); err != nil || len(entries) != 0 {
+		t.Fatalf("claimed %v (%v) with a valid lease", claimedIDs(entries), err)
+	}
+
+	// Worker interrompido: a reserva expira e o envio volta a ser elegível
+	if err := conn.Model(&models.OutboxMessage{}).Where("id = ?", entry.ID).
+		Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expire lease: %v", err)
+	}
+	entries, err := ClaimOutboxMessages(1, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimOutboxMessages: %v", err)
+	}
+	if len(entries) != 1 || entries[0].ID != entry.ID || entries[0].Attempts != 2 {
+		t.Fatalf("claimed %+v, want entry %d at attempt 2", entries, entry.ID)
+	}
+
+	if ok, err := ExtendOutboxLease(entry.ID, time.Now().Add(time.Minute)); err != nil || !ok {
+		t.Errorf("ExtendOutboxLease = %v, %v", ok, err)
+	}
+	if err := MarkOutboxMessageSent(entry.ID); err != nil {
+		t.Fatalf("MarkOutboxMessageSent: %v", err)
+	}
+	if ok, _ := ExtendOutboxLease(entry.ID, time.Now().Add(time.Minute)); ok {
+		t.Error("lease extended after the send finished")
+	}
+}
+
+func TestGetProcessingOutboxMessage(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	conversation := createTestConversation(t, conn, inbox, "5511944440000")
+	entry := queueTestMessage(t, inbox, conversation.ID)
+
+	// Na fila, mas ainda não em andamento
+	if message, err := GetProcessingOutboxMessage(uint(conversation.ID)); err != nil || message != nil {
+		t.Fatalf("GetProcessingOutboxMessage before claim = %v, %v", message, err)
+	}
+
+	if _, err := ClaimOutboxMessages(1, time.Minute); err != nil {
+		t.Fatalf("ClaimOutboxMessages: %v", err)
+	}
+	message, err := GetProcessingOutboxMessage(uint(conversation.ID))
+	if err != nil || message == nil || message.ID != entry.MessageID {
+		t.Fatalf("GetProcessingOutboxMessage = %v, %v; want message %d", message, err, entry.MessageID)
+	}
+
+	if err := MarkOutboxMessageSent(entry.ID); err != nil {
+		t.Fatalf("MarkOutboxMessageSent: %v", err)
+	}
+	if message, err := GetProcessingOutboxMessage(uint(conversation.ID)); err != nil || message != nil {
+		t.Errorf("GetProcessingOutboxMessage after send = %v, %v", message, err)
+	}
+}
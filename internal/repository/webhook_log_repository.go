@@ -0,0 +1,218 @@
+package repository
+
+import (
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateWebhookLogs grava os payloads brutos de um webhook recebido (um lote dividido por chat) em uma única inserção
+func CreateWebhookLogs(webhookLogs []models.WebhookLog) error {
+	return db.Instance.Create(&webhookLogs).Error
+}
+
+// ClaimWebhookLogs reserva até limit webhooks prontos para processamento, marcando-os como "processing".
+// Um webhook só é elegível quando não há outro anterior com a mesma ordering_key ainda pendente,
+// o que garante o processamento em ordem por conversa. A reserva vale por lease (renovada com ExtendWebhookLogLease):
+// webhooks "processing" com lease expirado (worker ou réplica interrompidos) voltam a ser elegíveis.
+func ClaimWebhookLogs(limit int, lease time.Duration) ([]models.WebhookLog, error) {
+	var logs []models.WebhookLog
+	if limit <= 0 {
+		return logs, nil
+	}
+
+	err := db.Instance.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		var ids []uint
+		err := tx.Raw(`
+			SELECT w.id FROM webhook_logs w
+			WHERE ((w.status IN (?, ?) AND (w.next_attempt_at IS NULL OR w.next_attempt_at <= ?))
+			    OR (w.status = ? AND (w.locked_until IS NULL OR w.locked_until <= ?)))
+			  AND (COALESCE(w.ordering_key, '') = '' OR NOT EXISTS (
+				SELECT 1 FROM webhook_logs p
+				WHERE p.ordering_key = w.ordering_key
+				  AND p.id < w.id
+				  AND p.status IN (?, ?, ?)
+			  ))
+			ORDER BY w.id
+			LIMIT ?
+			FOR UPDATE SKIP LOCKED`,
+			models.WebhookLogStatusPending, models.WebhookLogStatusRetry, now,
+			models.WebhookLogStatusProcessing, now,
+			models.WebhookLogStatusPending, models.WebhookLogStatusRetry, models.WebhookLogStatusProcessing,
+			limit,
+		).Scan(&ids).Error
+		if err != nil || len(ids) == 0 {
+			return err
+		}
+
+		if err := tx.Model(&models.WebhookLog{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+			"status":       models.WebhookLogStatusProcessing,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_until": now.Add(lease),
+			"updated_at":   now,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Where("id IN ?", ids).Order("id ASC").Find(&logs).Error
+	})
+
+	return logs, err
+}
+
+// ExtendWebhookLogLease renova a reserva de um webhook em andamento; false quando ele já não está "processing"
+func ExtendWebhookLogLease(id uint, until time.Time) (bool, error) {
+	result := db.Instance.Model(&models.WebhookLog{}).
+		Where("id = ? AND status = ?", id, models.WebhookLogStatusProcessing).
+		Updates(map[string]interface{}{
+			"locked_until": until,
+			"updated_at":   time.Now(),
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// MarkWebhookLogSuccess marca o webhook como processado
+func MarkWebhookLogSuccess(id uint) error {
+	now := time.Now()
+	return db.Instance.Model(&models.WebhookLog{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          models.WebhookLogStatusSuccess,
+		"error_message":   "",
+		"next_attempt_at": nil,
+		"locked_until":    nil,
+		"processed_at":    now,
+		"updated_at":      now,
+	}).Error
+}
+
+// MarkWebhookLogFailed registra a falha do processamento; status é "retry" (com nextAttemptAt) ou "dead"
+func MarkWebhookLogFailed(id uint, status, errorMessage string, nextAttemptAt *time.Time) error {
+	return db.Instance.Model(&models.WebhookLog{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"status":          status,
+		"error_message":   errorMessage,
+		"next_attempt_at": nextAttemptAt,
+		"locked_until":    nil,
+		"updated_at":      time.Now(),
+	}).Error
+}
+
+// ClaimWebhookLogForReplay reserva um webhook para reprocessamento manual, em qualquer status exceto "processing"
+// (como RequeueWebhookLogs: inclui os "success" de quando um bug descartou mensagens);
+// retorna false quando ele já está em andamento (reservado por outro replay ou pela fila)
+func ClaimWebhookLogForReplay(id uint, lease time.Duration) (bool, error) {
+	now := time.Now()
+	result := db.Instance.Model(&models.WebhookLog{}).
+		Where("id = ? AND (status IS NULL OR status <> ?)", id, models.WebhookLogStatusProcessing).
+		Updates(map[string]interface{}{
+			"status":       models.WebhookLogStatusProcessing,
+			"attempts":     gorm.Expr("attempts + 1"),
+			"locked_until": now.Add(lease),
+			"updated_at":   now,
+		})
+	return result.RowsAffected > 0, result.Error
+}
+
+// PurgeWebhookLogs apaga até limit webhooks processados com sucesso antes de before (os "dead" ficam para replay)
+func PurgeWebhookLogs(before time.Time, limit int) (int64, error) {
+	result := db.Instance.Exec(`
+		DELETE FROM webhook_logs WHERE id IN (
+			SELECT id FROM webhook_logs
+			WHERE status = ? AND processed_at < ?
+			LIMIT ?
+		)`,
+		models.WebhookLogStatusSuccess, before, limit,
+	)
+	return result.RowsAffected, result.Error
+}
+
+// WebhookLogFilter filtros para listagem e replay de webhooks de uma conta
+type WebhookLogFilter struct {
+	AccountID uint
+	InboxID   *uint
+	Event     string
+	Status    string
+	From      *time.Time
+	To        *time.Time
+	FromID    uint
+	ToID      uint
+}
+
+// applyWebhookLogFilter restringe a consulta às inboxes da conta e aos filtros informados
+func applyWebhookLogFilter(query *gorm.DB, filter WebhookLogFilter) *gorm.DB {
+	query = query.Where("inbox_id IN (?)", db.Instance.Model(&models.Inbox{}).Select("id").Where("account_id = ?", filter.AccountID))
+
+	if filter.InboxID != nil {
+		query = query.Where("inbox_id = ?", *filter.InboxID)
+	}
+	if filter.Event != "" {
+		query = query.Where("event = ?", filter.Event)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+	if filter.From != nil {
+		query = query.Where("created_at >= ?", *filter.From)
+	}
+	if filter.To != nil {
+		query = query.Where("created_at <= ?", *filter.To)
+	}
+	if filter.FromID > 0 {
+		query = query.Where("id >= ?", filter.FromID)
+	}
+	if filter.ToID > 0 {
+		query = query.Where("id <= ?", filter.ToID)
+	}
+	return query
+}
+
+// ListWebhookLogs lista webhooks com paginação (sem o payload, que pode ser grande)
+func ListWebhookLogs(filter WebhookLogFilter, page, perPage int) ([]models.WebhookLog, int64, error) {
+	var logs []models.WebhookLog
+	var total int64
+
+	query := applyWebhookLogFilter(db.Instance.Model(&models.WebhookLog{}), filter)
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * perPage
+	if err := query.
+		Omit("payload").
+		Order("id DESC").
+		Limit(perPage).
+		Offset(offset).
+		Find(&logs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return logs, total, nil
+}
+
+// GetWebhookLog busca um webhook (com payload) de uma inbox da conta
+func GetWebhookLog(id, accountID uint) (*models.WebhookLog, error) {
+	var webhookLog models.WebhookLog
+	query := applyWebhookLogFilter(db.Instance.Model(&models.WebhookLog{}), WebhookLogFilter{AccountID: accountID})
+	if err := query.Where("id = ?", id).First(&webhookLog).Error; err != nil {
+		return nil, err
+	}
+	return &webhookLog, nil
+}
+
+// RequeueWebhookLogs devolve à fila os webhooks do filtro (exceto os em andamento), zerando as tentativas
+func RequeueWebhookLogs(filter WebhookLogFilter) (int64, error) {
+	query := applyWebhookLogFilter(db.Instance.Model(&models.WebhookLog{}), filter).
+		Where("status IS NULL OR status <> ?", models.WebhookLogStatusProcessing)
+
+	result := query.Updates(map[string]interface{}{
+		"status":          models.WebhookLogStatusPending,
+		"attempts":        0,
+		"error_message":   "",
+		"next_attempt_at": nil,
+		"updated_at":      time.Now(),
+	})
+	return result.RowsAffected, result.Error
+}
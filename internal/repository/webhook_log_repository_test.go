@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+)
+
+func TestClaimWebhookLogsRetakesExpiredLease(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createTestInbox(t, conn)
+	inboxID := uint(inbox.ID)
+
+	webhookLog := models.WebhookLog{InboxID: &inboxID, Provider: "evolution", Payload: []byte(`{}`),
+		Status: models.WebhookLogStatusPending, OrderingKey: "chat-1"}
+	mustCreate(t, conn, &webhookLog)
+
+	logs, err := ClaimWebhookLogs(1, time.Minute)
+	if err != nil || len(logs) != 1 || logs[0].LockedUntil == nil {
+		t.Fatalf("ClaimWebhookLogs = %+v, %v", logs, err)
+	}
+	// Reserva válida: outra réplica não retoma o webhook
+	if logs, err := ClaimWebhookLogs(1, time.Minute); err != nil || len(logs) != 0 {
+		t.Fatalf("claimed %d webhooks (%v) with a valid lease", len(logs), err)
+	}
+	if claimed, err := ClaimWebhookLogForReplay(webhookLog.ID, time.Minute); err != nil || claimed {
+		t.Fatalf("ClaimWebhookLogForReplay = %v, %v while processing", claimed, err)
+	}
+
+	// Worker interrompido: a reserva expira e o webhook volta a ser elegível
+	if err := conn.Model(&models.WebhookLog{}).Where("id = ?", webhookLog.ID).
+		Update("locked_until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatalf("expire lease: %v", err)
+	}
+	logs, err = ClaimWebhookLogs(1, time.Minute)
+	if err != nil {
+		t.Fatalf("ClaimWebhookLogs: %v", err)
+	}
+	if len(logs) != 1 || logs[0].ID != webhookLog.ID || logs[0].Attempts != 2 {
+		t.Fatalf("claimed %+v, want webhook %d at attempt 2", logs, webhookLog.ID)
+	}
+
+	if ok, err := ExtendWebhookLogLease(webhookLog.ID, time.Now().Add(time.Minute)); err != nil || !ok {
+		t.Errorf("ExtendWebhookLogLease = %v, %v", ok, err)
+	}
+	if err := MarkWebhookLogSuccess(webhookLog.ID); err != nil {
+		t.Fatalf("MarkWebhookLogSuccess: %v", err)
+	}
+	if ok, _ := ExtendWebhookLogLease(webhookLog.ID, time.Now().Add(time.Minute)); ok {
+		t.Error("lease extended after the webhook finished")
+	}
+	var stored models.WebhookLog
+	if err := conn.First(&stored, webhookLog.ID).Error; err != nil || stored.LockedUntil != nil {
+		t.Errorf("webhook after success = %+v, %v; want lease cleared", stored, err)
+	}
+}
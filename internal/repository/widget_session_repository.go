@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"errors"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreateWidgetSession grava uma nova sessão de visitante
+func CreateWidgetSession(session *models.WidgetSession) error {
+	return db.Instance.Create(session).Error
+}
+
+// GetWidgetSessionByTokenHash busca a sessão de visitante de uma inbox pelo hash do token
+func GetWidgetSessionByTokenHash(inboxID uint, tokenHash string) (*models.WidgetSession, error) {
+	var session models.WidgetSession
+	if err := db.Instance.Where("token_hash = ? AND inbox_id = ?", tokenHash, inboxID).First(&session).Error; err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// UpdateWidgetSession atualiza uma sessão de visitante
+func UpdateWidgetSession(session *models.WidgetSession) error {
+	return db.Instance.Save(session).Error
+}
+
+// TouchWidgetSession registra a última atividade do visitante
+func TouchWidgetSession(sessionID uint, at time.Time) error {
+	return db.Instance.Model(&models.WidgetSession{}).Where("id = ?", sessionID).Update("last_seen_at", at).Error
+}
+
+// GetVerifiedWidgetContact busca o contato de uma sessão verificada da inbox cujo identifier ainda é o
+// identifier do usuário do produto sem prefixo (sessões anteriores ao prefixo widget:)
+func GetVerifiedWidgetContact(inboxID uint, identifier string) (*models.Contact, error) {
+	var contact models.Contact
+	err := db.Instance.
+		Joins("JOIN widget_sessions ON widget_sessions.contact_id = contacts.id").
+		Where("widget_sessions.inbox_id = ? AND widget_sessions.identity_verified AND widget_sessions.identifier = ? AND contacts.identifier = ?",
+			inboxID, identifier, identifier).
+		First(&contact).Error
+	if err != nil {
+		return nil, err
+	}
+	return &contact, nil
+}
+
+// MergeInboxConversations transfere as conversas de um contato em uma inbox para outro contato
+// (visitante anônimo que se identificou como um contato já existente). Se os dois tiverem conversa ativa,
+// as mensagens da conversa do visitante passam para a do contato, mantendo uma única conversa ativa.
+func MergeInboxConversations(inboxID, fromContactID, toContactID uint) error {
+	return withAdvisoryLock(conversationLockKey(inboxID, toContactID), func(tx *gorm.DB) error {
+		activeStatuses := []int{models.ConversationStatusOpen, models.ConversationStatusPending}
+
+		var target models.Conversation
+		err := tx.Where("inbox_id = ? AND contact_id = ? AND status IN ?", inboxID, toContactID, activeStatuses).First(&target).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		if err == nil {
+			var source models.Conversation
+			err := tx.Where("inbox_id = ? AND contact_id = ? AND status IN ?", inboxID, fromContactID, activeStatuses).First(&source).Error
+			if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return err
+			}
+			if err == nil {
+				if err := tx.Model(&models.Message{}).Where("conversation_id = ?", source.ID).Update("conversation_id", target.ID).Error; err != nil {
+					return err
+				}
+				if err := tx.Model(&target).Update("unread_count", gorm.Expr("unread_count + ?", source.UnreadCount)).Error; err != nil {
+					return err
+				}
+				if err := tx.Delete(&source).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return tx.Model(&models.Conversation{}).
+			Where("inbox_id = ? AND contact_id = ?", inboxID, fromContactID).
+			Update("contact_id", toContactID).Error
+	})
+}
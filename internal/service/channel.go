@@ -0,0 +1,306 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"net/http"
+	"net/url"
+	"sync"
+)
+
+// Channel é um provedor de mensagens (Evolution, WhatsApp Cloud, Telegram...).
+// Cada inbox é atendida pelo canal registrado para o seu ChannelType.
+type Channel interface {
+	// Provider identifica o canal na URL de webhook (/webhooks/:provider) e em webhook_logs.provider
+	Provider() string
+	// Capabilities informa os recursos suportados pelo canal
+	Capabilities() ChannelCapabilities
+	// VerifyWebhook autentica um webhook recebido para a inbox, antes de gravá-lo na fila
+	VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error
+	// ProcessWebhook interpreta um webhook já gravado e cria contatos, conversas e mensagens
+	ProcessWebhook(inboxID uint, payload []byte) error
+	// SendText envia uma mensagem de texto
+	SendText(msg *OutboundMessage) (*SendResult, error)
+	// SendMedia envia uma mensagem com mídia (image, video, audio, document)
+	SendMedia(msg *OutboundMessage) (*SendResult, error)
+}
+
+// ChannelCapabilities recursos suportados por um canal
+type ChannelCapabilities struct {
+	Media     bool `json:"media"`
+	Replies   bool `json:"replies"`   // Responder citando uma mensagem
+	Reactions bool `json:"reactions"` // Enviar reações
+	Mentions  bool `json:"mentions"`  // Menções em grupos
+	Typing    bool `json:"typing"`    // Repassar "digitando" ao contato
+	Templates bool `json:"templates"` // Mensagens de template (fora da janela de atendimento)
+}
+
+// webhookRouter é implementado pelos canais que extraem evento e chave de ordenação do payload (ver EnqueueWebhook)
+type webhookRouter interface {
+	RoutingInfo(inboxID uint, payload []byte) (event string, orderingKey string)
+}
+
+// webhookSplitter é implementado pelos canais cujos webhooks trazem lotes de vários chats: cada parte
+// é gravada como um webhook próprio, com a sua chave de ordenação (nil = sem divisão)
+type webhookSplitter interface {
+	SplitWebhook(payload []byte) [][]byte
+}
+
+// webhookChallenger é implementado pelos canais que validam a URL do webhook com um desafio (GET)
+type webhookChallenger interface {
+	VerifyChallenge(inbox *models.Inbox, query url.Values) (string, error)
+}
+
+// webhookInstaller é implementado pelos canais que registram a URL de webhook no provedor
+type webhookInstaller interface {
+	InstallWebhook(inbox *models.Inbox, webhookURL string, secret string) error
+}
+
+// templateSender é implementado pelos canais que enviam mensagens de template
+type templateSender interface {
+	SendTemplate(msg *OutboundMessage) (*SendResult, error)
+}
+
+// webhookDecoder é implementado pelos canais cujos webhooks não são JSON (ex.: formulários do Twilio):
+// o corpo é convertido para JSON antes de ser gravado na fila
+type webhookDecoder interface {
+	DecodeWebhook(req *InboundRequest) ([]byte, error)
+}
+
+// webhookValidator é implementado pelos canais que recusam payloads inválidos na entrada, antes da fila
+type webhookValidator interface {
+	ValidateWebhook(payload []byte) error
+}
+
+// webhookAcknowledger é implementado pelos canais que esperam uma resposta específica ao webhook
+type webhookAcknowledger interface {
+	WebhookAck() (contentType string, body []byte)
+}
+
+// InboundRequest dados da requisição HTTP de um webhook, sem dependência do framework web
+type InboundRequest struct {
+	Method   string
+	Header   http.Header
+	Query    url.Values
+	Body     []byte
+	URL      string // URL completa da requisição (alguns provedores assinam a URL)
+	ClientIP string
+}
+
+// OutboundMessage mensagem a enviar para o contato de uma conversa
+type OutboundMessage struct {
+	Inbox        *models.Inbox
+	Conversation *models.Conversation
+	Contact      *models.Contact
+	Content      string
+	ContentType  string // text, image, video, audio, document
+	MediaURL     string
+	FileName     string
+	ReplyTo      *models.Message // Mensagem citada; nil quando não é resposta
+	Mentions     []uint          // IDs dos contatos mencionados
+	MentionAll   bool
+	Template     *MessageTemplate // Template aprovado; quando presente substitui texto e mídia
+	MessageID    uint             // ID da mensagem gravada (base de IDs estáveis entre tentativas)
+}
+
+// MessageTemplate template pré-aprovado no provedor
+type MessageTemplate struct {
+	Name       string          `json:"name"`
+	Language   string          `json:"language"`             // Ex.: pt_BR
+	Components json.RawMessage `json:"components,omitempty"` // Parâmetros no formato do provedor (repassados sem alteração)
+}
+
+// SendResult resultado do envio pelo canal
+type SendResult struct {
+	ExternalID *string  // ID da mensagem no provedor (gravado em whatsapp_message_id para status e deduplicação)
+	MediaURL   *string  // URL da mídia enviada, quando o canal a altera
+	FileName   *string  // Nome do arquivo enviado
+	QuotedID   *string  // ID externo da mensagem citada, quando a citação foi enviada
+	Mentions   []string // Identificadores dos mencionados no provedor
+	IsGroup    bool
+	Email      *models.EmailAttributes // Cabeçalhos do email enviado (thread das próximas respostas)
+}
+
+// ErrChannelNotFound indica inbox sem canal registrado para o seu ChannelType
+var ErrChannelNotFound = errors.New("channel not found")
+
+// ErrChannelUnsupported indica recurso não suportado pelo canal da inbox
+var ErrChannelUnsupported = errors.New("not supported by this channel")
+
+// ProviderError resposta de erro HTTP da API de um provedor (usada pelo outbox para decidir novas tentativas)
+type ProviderError struct {
+	Provider   string
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s API error: %s - %s", e.Provider, e.Status, e.Body)
+}
+
+// newProviderError monta o erro de uma resposta HTTP sem sucesso
+func newProviderError(provider string, resp *http.Response, body []byte) error {
+	return &ProviderError{Provider: provider, StatusCode: resp.StatusCode, Status: resp.Status, Body: string(body)}
+}
+
+// Limites de leitura das respostas dos provedores
+const (
+	maxProviderResponseSize = 1 << 20   // Respostas JSON das APIs
+	maxMediaDownloadSize    = 100 << 20 // Mídias recebidas (documentos do WhatsApp têm até 100 MB)
+)
+
+// ErrTooLarge indica resposta ou mídia acima do limite de leitura
+var ErrTooLarge = errors.New("content exceeds the maximum size")
+
+// readLimited lê até limit bytes e falha com ErrTooLarge quando o conteúdo é maior
+func readLimited(r io.Reader, limit int64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrTooLarge, limit)
+	}
+	return data, nil
+}
+
+var (
+	channelRegistryMu  sync.RWMutex
+	channelsByType     = map[string]Channel{}
+	channelsByProvider = map[string]Channel{}
+	channelResolvers   = map[string]channelResolver{}
+)
+
+// channelResolver escolhe o canal de um ChannelType atendido por mais de um provedor (ex.: "api")
+type channelResolver func(inbox *models.Inbox) (Channel, error)
+
+// RegisterChannel registra um canal para os ChannelTypes de inbox informados
+func RegisterChannel(channel Channel, channelTypes ...string) {
+	channelRegistryMu.Lock()
+	defer channelRegistryMu.Unlock()
+
+	channelsByProvider[channel.Provider()] = channel
+	for _, channelType := range channelTypes {
+		channelsByType[channelType] = channel
+	}
+}
+
+// registerChannelResolver registra a escolha do canal de um ChannelType compartilhado
+func registerChannelResolver(channelType string, resolver channelResolver) {
+	channelRegistryMu.Lock()
+	defer channelRegistryMu.Unlock()
+
+	channelResolvers[channelType] = resolver
+}
+
+// legacyChannelProvider canal das inboxes com ChannelType sem canal registrado (ex.: "web" de inboxes importadas):
+// antes do registro de canais todas as inboxes eram atendidas pela Evolution
+const legacyChannelProvider = "evolution"
+
+// ChannelForInbox retorna o canal que atende a inbox
+func ChannelForInbox(inbox *models.Inbox) (Channel, error) {
+	channelRegistryMu.RLock()
+	resolver, ok := channelResolvers[inbox.ChannelType]
+	channelRegistryMu.RUnlock()
+	if ok {
+		return resolver(inbox)
+	}
+
+	channelRegistryMu.RLock()
+	defer channelRegistryMu.RUnlock()
+
+	channel, ok := channelsByType[inbox.ChannelType]
+	if !ok {
+		channel, ok = channelsByProvider[legacyChannelProvider]
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w for channel type %q (inbox %d)", ErrChannelNotFound, inbox.ChannelType, inbox.ID)
+	}
+	return channel, nil
+}
+
+// ChannelByProvider retorna o canal pelo identificador usado nos webhooks
+func ChannelByProvider(provider string) (Channel, error) {
+	channelRegistryMu.RLock()
+	defer channelRegistryMu.RUnlock()
+
+	channel, ok := channelsByProvider[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrChannelNotFound, provider)
+	}
+	return channel, nil
+}
+
+// channelIntegrationConfig busca a integração da inbox (channel_id) do provedor informado e retorna o seu config
+func channelIntegrationConfig(inbox *models.Inbox, provider string) (map[string]interface{}, error) {
+	var integration models.Integration
+	if err := db.Instance.Where("id = ? AND account_id = ?", inbox.ChannelID, inbox.AccountID).First(&integration).Error; err != nil {
+		return nil, fmt.Errorf("integration not found for inbox %d: %w", inbox.ID, err)
+	}
+	if integration.Provider != provider {
+		return nil, fmt.Errorf("integration %d is %s, not %s", integration.ID, integration.Provider, provider)
+	}
+
+	configMap := map[string]interface{}{}
+	if len(integration.Config) > 0 {
+		if err := json.Unmarshal(integration.Config, &configMap); err != nil {
+			return nil, fmt.Errorf("failed to parse integration config: %w", err)
+		}
+	}
+	return configMap, nil
+}
+
+// VerifyWebhookChallenge responde ao desafio de verificação da URL de webhook de um canal
+func VerifyWebhookChallenge(channel Channel, inbox *models.Inbox, query url.Values) (string, error) {
+	challenger, ok := channel.(webhookChallenger)
+	if !ok {
+		return "", fmt.Errorf("webhook challenge is %w", ErrChannelUnsupported)
+	}
+	return challenger.VerifyChallenge(inbox, query)
+}
+
+// InstallInboxWebhook registra no provedor a URL de webhook da inbox com o segredo informado
+// (canais cujo webhook é configurado pela API do provedor, como o Telegram)
+func InstallInboxWebhook(inbox *models.Inbox, secret string) error {
+	channel, err := ChannelForInbox(inbox)
+	if err != nil {
+		return err
+	}
+	installer, ok := channel.(webhookInstaller)
+	if !ok {
+		return fmt.Errorf("webhook installation is %w", ErrChannelUnsupported)
+	}
+	return installer.InstallWebhook(inbox, InboxWebhookURL(inbox, secret), secret)
+}
+
+// DecodeWebhookPayload retorna o payload do webhook a gravar na fila (JSON); o corpo é usado sem alteração
+// pelos canais que já recebem JSON
+func DecodeWebhookPayload(channel Channel, req *InboundRequest) ([]byte, error) {
+	if decoder, ok := channel.(webhookDecoder); ok {
+		return decoder.DecodeWebhook(req)
+	}
+	return req.Body, nil
+}
+
+// ValidateWebhookPayload confere o payload na entrada nos canais que validam antes da fila
+func ValidateWebhookPayload(channel Channel, payload []byte) error {
+	if validator, ok := channel.(webhookValidator); ok {
+		return validator.ValidateWebhook(payload)
+	}
+	return nil
+}
+
+// WebhookAck resposta esperada pelo provedor ao webhook; ok=false para a resposta JSON padrão
+func WebhookAck(channel Channel) (contentType string, body []byte, ok bool) {
+	acknowledger, ok := channel.(webhookAcknowledger)
+	if !ok {
+		return "", nil, false
+	}
+	contentType, body = acknowledger.WebhookAck()
+	return contentType, body, true
+}
@@ -0,0 +1,509 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	// apiProvider canal "api": sistemas próprios enviam mensagens pelo webhook e recebem as respostas no webhook_url
+	apiProvider = "api"
+	// APIChannelIntegrationProvider provider da integração de uma inbox do canal api
+	// (integrações "api" sem ele são da integração Chatwoot da Evolution)
+	APIChannelIntegrationProvider = "api_channel"
+)
+
+// apiChannel canal genérico: entrada por POST /webhooks/api e saída por callback assinado no webhook_url
+type apiChannel struct{}
+
+func init() {
+	RegisterChannel(apiChannel{})
+	registerChannelResolver(apiProvider, resolveAPIChannel)
+}
+
+// resolveAPIChannel inboxes "api" são do canal api quando a integração é APIChannelIntegrationProvider;
+// as demais foram criadas pela integração Chatwoot da Evolution e continuam atendidas pela Evolution.
+// Falhas do banco são retornadas: não podem desviar mensagens do canal api para a Evolution.
+func resolveAPIChannel(inbox *models.Inbox) (Channel, error) {
+	var integration models.Integration
+	err := db.Instance.Select("id", "provider").
+		Where("id = ? AND account_id = ?", inbox.ChannelID, inbox.AccountID).
+		First(&integration).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, fmt.Errorf("failed to load integration of inbox %d: %w", inbox.ID, err)
+	}
+	if err == nil && integration.Provider == APIChannelIntegrationProvider {
+		return apiChannel{}, nil
+	}
+	return evolutionChannel{}, nil
+}
+
+func (apiChannel) Provider() string {
+	return apiProvider
+}
+
+func (apiChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:   true,
+		Replies: true,
+	}
+}
+
+// apiConfig configuração do canal api, lida do config da integração da inbox
+type apiConfig struct {
+	WebhookURL    string // Destino das mensagens dos agentes
+	SigningSecret string // Assinatura do callback; padrão: segredo de webhook da inbox
+	WebhookSecret string // Segredo de webhook da inbox (autentica as mensagens recebidas)
+}
+
+func loadAPIConfig(inbox *models.Inbox) (*apiConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, APIChannelIntegrationProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &apiConfig{
+		WebhookURL:    firstString(configMap, "webhook_url", "webhookUrl", "callback_url"),
+		SigningSecret: firstString(configMap, "signing_secret", "callback_secret"),
+		WebhookSecret: inboxWebhookSecret(configMap, inbox),
+	}
+	if config.SigningSecret == "" {
+		config.SigningSecret = config.WebhookSecret
+	}
+	return config, nil
+}
+
+// VerifyWebhook autentica com o segredo da inbox: token (?token= ou X-Webhook-Token) ou assinatura
+// X-Signature-256: sha256=hex(HMAC-SHA256(segredo, corpo))
+func (apiChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	config, err := loadAPIConfig(inbox)
+	if err != nil {
+		return err
+	}
+	if config.WebhookSecret == "" {
+		return ErrWebhookUnauthorized
+	}
+
+	for _, candidate := range []string{req.Query.Get("token"), req.Header.Get("X-Webhook-Token")} {
+		if secureEqual(candidate, config.WebhookSecret) {
+			return nil
+		}
+	}
+	if signature := req.Header.Get("X-Signature-256"); signature != "" {
+		if secureEqual(signature, apiSignature(config.WebhookSecret, req.Body)) {
+			return nil
+		}
+		return ErrInvalidSignature
+	}
+	return ErrWebhookUnauthorized
+}
+
+// apiInboundPayload mensagem recebida de um sistema próprio
+type apiInboundPayload struct {
+	Contact struct {
+		Identifier  string `json:"identifier"`
+		Name        string `json:"name"`
+		Email       string `json:"email"`
+		PhoneNumber string `json:"phone_number"`
+	} `json:"contact"`
+	Message struct {
+		ID        string `json:"id"` // ID no sistema de origem (deduplicação e respostas)
+		Content   string `json:"content"`
+		MediaURL  string `json:"media_url"`
+		FileName  string `json:"file_name"`
+		InReplyTo string `json:"in_reply_to"` // ID (no sistema de origem ou do callback) da mensagem respondida
+		Timestamp int64  `json:"timestamp"`   // Unix (segundos); padrão: agora
+	} `json:"message"`
+}
+
+// RoutingInfo usa o identifier do contato como chave de ordenação
+func (apiChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var p apiInboundPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return "", ""
+	}
+	return "message", fmt.Sprintf("%d:%s", inboxID, p.Contact.Identifier)
+}
+
+// ValidateWebhook recusa na entrada (antes da fila) mensagens sem identifier, sem conteúdo ou com media_url inválida
+func (apiChannel) ValidateWebhook(payload []byte) error {
+	var p apiInboundPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to parse api payload: %w", err)
+	}
+	return p.validate()
+}
+
+func (p *apiInboundPayload) validate() error {
+	if strings.TrimSpace(p.Contact.Identifier) == "" {
+		return fmt.Errorf("contact.identifier is required")
+	}
+	if strings.TrimSpace(p.Message.Content) == "" && p.Message.MediaURL == "" {
+		return fmt.Errorf("message.content or message.media_url is required")
+	}
+	if p.Message.MediaURL != "" {
+		if parsed, err := url.Parse(p.Message.MediaURL); err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return fmt.Errorf("message.media_url must be an http(s) URL")
+		}
+	}
+	return nil
+}
+
+// ProcessWebhook cria contato (pelo identifier), conversa e mensagem recebida
+func (apiChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	var p apiInboundPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to parse api payload: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+
+	sourceID := p.Message.ID
+	if sourceID == "" {
+		sourceID = uuid.New().String()
+	}
+	externalID := apiMessageRef(inboxID, sourceID)
+
+	// Verificar se a mensagem já foi processada (evitar duplicação)
+	if existing, err := repository.GetMessageByWhatsAppID(externalID); err == nil && existing != nil {
+		log.Printf("[API] Message already exists with ID %s, skipping", externalID)
+		return nil
+	}
+
+	contact, err := repository.FindOrCreateContactByIdentifier(uint(inbox.AccountID), p.Contact.Identifier, p.Contact.Name)
+	if err != nil {
+		return fmt.Errorf("failed to find/create contact: %w", err)
+	}
+	applyContactDetails(contact, p.Contact.Name, p.Contact.Email, p.Contact.PhoneNumber)
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), contact.ID)
+	if err != nil {
+		return fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	timestamp := time.Now()
+	if p.Message.Timestamp > 0 {
+		timestamp = time.Unix(p.Message.Timestamp, 0)
+	}
+
+	message := &models.Message{
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           uint(inbox.ID),
+		ConversationID:    uint(conversation.ID),
+		Content:           strings.TrimSpace(p.Message.Content),
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		SenderType:        "Contact",
+		SenderID:          contact.ID,
+		Status:            models.MessageStatusSent,
+		SourceID:          sourceID,
+		WhatsAppMessageID: &externalID,
+		Timestamp:         &timestamp,
+	}
+
+	if p.Message.InReplyTo != "" {
+		quotedID := apiMessageRef(inboxID, p.Message.InReplyTo)
+		message.QuotedMessageID = &quotedID
+		if quoted, err := repository.GetMessageByWhatsAppID(quotedID); err == nil && quoted.ConversationID == uint(conversation.ID) {
+			message.InReplyTo = &quoted.ID
+		}
+	}
+
+	if p.Message.MediaURL != "" {
+		if err := storeAPIMedia(message, p.Message.MediaURL, p.Message.FileName); err != nil {
+			return err
+		}
+	}
+
+	if err := repository.UpsertMessage(message); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+	publishInboundMessage(conversation, message)
+
+	return nil
+}
+
+// storeAPIMedia baixa a mídia informada pelo sistema de origem (apenas endereços públicos) e a grava no storage
+func storeAPIMedia(message *models.Message, mediaURL, fileName string) error {
+	if GlobalMediaStorage == nil {
+		return fmt.Errorf("media storage not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	data, mimeType, err := downloadPublicMedia(ctx, mediaURL)
+	if err != nil {
+		return fmt.Errorf("failed to download media: %w", err)
+	}
+	if mimeType == "" || baseMimeType(mimeType) == "application/octet-stream" {
+		mimeType = DetectMimeType(data)
+	}
+
+	extension := GetExtensionFromMimeType(baseMimeType(mimeType))
+	if dot := strings.LastIndex(fileName, "."); dot >= 0 {
+		extension = fileName[dot:]
+	}
+	storedURL, err := GlobalMediaStorage.Store(ctx, data, uuid.New().String()+extension, mimeType)
+	if err != nil {
+		return fmt.Errorf("failed to store media: %w", err)
+	}
+
+	size := int64(len(data))
+	fileName = firstNonEmpty(fileName, mediaFileName(mediaURL))
+	message.ContentType = mediaContentType(mimeType)
+	message.MediaURL = &storedURL
+	message.MimeType = &mimeType
+	message.FileName = &fileName
+	message.FileSize = &size
+	return nil
+}
+
+// ErrPrivateAddress indica URL informada por terceiros que aponta para a rede interna
+var ErrPrivateAddress = errors.New("private or loopback address not allowed")
+
+// publicMediaClient cliente HTTP que só conecta em endereços públicos: a verificação é feita no IP
+// efetivamente conectado (vale para redirects e DNS que resolve para a rede interna)
+var publicMediaClient = &http.Client{
+	Timeout: 5 * time.Minute,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 30 * time.Second,
+			Control: func(network, address string, conn syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !publicIP(ip) {
+					return fmt.Errorf("%s: %w", host, ErrPrivateAddress)
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   30 * time.Second,
+		ResponseHeaderTimeout: time.Minute,
+	},
+}
+
+// publicIP indica endereço roteável na internet (fora de loopback, redes privadas, link-local e CGNAT)
+func publicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		// 0.0.0.0/8 e 100.64.0.0/10 (CGNAT)
+		if ip4[0] == 0 || (ip4[0] == 100 && ip4[1]&0xc0 == 64) {
+			return false
+		}
+	}
+	return true
+}
+
+// downloadPublicMedia baixa uma mídia de URL informada por terceiros (limite de maxMediaDownloadSize)
+func downloadPublicMedia(ctx context.Context, mediaURL string) ([]byte, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, "", fmt.Errorf("unsupported media URL scheme %q", req.URL.Scheme)
+	}
+
+	resp, err := publicMediaClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+	if resp.ContentLength > maxMediaDownloadSize {
+		return nil, "", fmt.Errorf("media of %d bytes: %w", resp.ContentLength, ErrTooLarge)
+	}
+	data, err := readLimited(resp.Body, maxMediaDownloadSize)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, resp.Header.Get("Content-Type"), nil
+}
+
+// apiMessageRef monta o ID externo de uma mensagem do canal api (IDs de origem são únicos apenas por inbox)
+func apiMessageRef(inboxID uint, id string) string {
+	return fmt.Sprintf("api:%d:%s", inboxID, id)
+}
+
+// apiCallbackPayload mensagem de agente entregue no webhook_url da inbox
+type apiCallbackPayload struct {
+	Event          string             `json:"event"` // message.created
+	InboxID        uint64             `json:"inbox_id"`
+	ConversationID uint64             `json:"conversation_id"`
+	Contact        apiCallbackContact `json:"contact"`
+	Message        apiCallbackMessage `json:"message"`
+}
+
+type apiCallbackContact struct {
+	ID          uint   `json:"id"`
+	Identifier  string `json:"identifier"`
+	Name        string `json:"name"`
+	Email       string `json:"email,omitempty"`
+	PhoneNumber string `json:"phone_number,omitempty"`
+}
+
+type apiCallbackMessage struct {
+	ID          string `json:"id"`
+	Content     string `json:"content"`
+	ContentType string `json:"content_type"`
+	MediaURL    string `json:"media_url,omitempty"`
+	FileName    string `json:"file_name,omitempty"`
+	InReplyTo   string `json:"in_reply_to,omitempty"`
+	Timestamp   int64  `json:"timestamp"`
+}
+
+func (apiChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	return sendAPICallback(msg)
+}
+
+func (apiChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	result, err := sendAPICallback(msg)
+	if err != nil {
+		return nil, err
+	}
+	fileName := firstNonEmpty(msg.FileName, mediaFileName(msg.MediaURL))
+	result.FileName = &fileName
+	return result, nil
+}
+
+// sendAPICallback entrega a mensagem no webhook_url da inbox (POST JSON assinado). Os retries são do outbox:
+// o ID da mensagem no callback é o mesmo em todas as tentativas, para o destino descartar repetições.
+func sendAPICallback(msg *OutboundMessage) (*SendResult, error) {
+	config, err := loadAPIConfig(msg.Inbox)
+	if err != nil {
+		return nil, err
+	}
+	if config.WebhookURL == "" {
+		return nil, fmt.Errorf("api inbox %d has no webhook_url", msg.Inbox.ID)
+	}
+
+	messageID := apiCallbackMessageID(msg.MessageID)
+	payload := apiCallbackPayload{
+		Event:          "message.created",
+		InboxID:        msg.Inbox.ID,
+		ConversationID: msg.Conversation.ID,
+		Contact: apiCallbackContact{
+			ID:          msg.Contact.ID,
+			Identifier:  msg.Contact.Identifier,
+			Name:        msg.Contact.Name,
+			Email:       msg.Contact.Email,
+			PhoneNumber: msg.Contact.PhoneNumber,
+		},
+		Message: apiCallbackMessage{
+			ID:          messageID,
+			Content:     msg.Content,
+			ContentType: msg.ContentType,
+			MediaURL:    msg.MediaURL,
+			FileName:    msg.FileName,
+			Timestamp:   time.Now().Unix(),
+		},
+	}
+	if msg.ReplyTo != nil && msg.ReplyTo.WhatsAppMessageID != nil {
+		payload.Message.InReplyTo = strings.TrimPrefix(*msg.ReplyTo.WhatsAppMessageID, apiMessageRef(uint(msg.Inbox.ID), ""))
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal callback: %w", err)
+	}
+
+	var response struct {
+		ID string `json:"id"` // ID atribuído pelo sistema de destino (opcional)
+	}
+	respBody, err := postAPICallback(config, messageID, body)
+	if err != nil {
+		return nil, err
+	}
+	if len(respBody) > 0 && json.Unmarshal(respBody, &response) == nil && response.ID != "" {
+		messageID = response.ID
+	}
+
+	externalID := apiMessageRef(uint(msg.Inbox.ID), messageID)
+	result := &SendResult{ExternalID: &externalID}
+	if msg.ReplyTo != nil {
+		result.QuotedID = msg.ReplyTo.WhatsAppMessageID
+	}
+	return result, nil
+}
+
+// apiCallbackMessageID ID da mensagem do agente no callback, derivado do ID interno (estável entre tentativas)
+func apiCallbackMessageID(messageID uint) string {
+	if messageID == 0 {
+		return uuid.New().String()
+	}
+	return fmt.Sprintf("msg-%d", messageID)
+}
+
+// postAPICallback envia o callback; Idempotency-Key repete o ID da mensagem
+func postAPICallback(config *apiConfig, messageID string, body []byte) ([]byte, error) {
+	client := &http.Client{Timeout: 15 * time.Second}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req, err := http.NewRequest(http.MethodPost, config.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create callback request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", messageID)
+	req.Header.Set("X-NakaWoot-Event", "message.created")
+	req.Header.Set("X-NakaWoot-Timestamp", timestamp)
+	if config.SigningSecret != "" {
+		// Assinatura sobre "timestamp.corpo": o destino pode recusar callbacks antigos (replay)
+		req.Header.Set("X-Signature-256", apiSignature(config.SigningSecret, []byte(timestamp+"."+string(body))))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("callback request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponseSize))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newProviderError("callback", resp, respBody)
+	}
+	return respBody, nil
+}
+
+// apiSignature assinatura "sha256=<hex>" (HMAC-SHA256) usada na entrada e nos callbacks
+func apiSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"mensager-go/internal/models"
+)
+
+func TestAPIValidateWebhook(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload string
+		wantErr string
+	}{
+		{"text", `{"contact":{"identifier":"c1"},"message":{"content":"oi"}}`, ""},
+		{"media", `{"contact":{"identifier":"c1"},"message":{"media_url":"https://cdn.example.com/a.png"}}`, ""},
+		{"invalid json", `{"contact":`, "failed to parse"},
+		{"no identifier", `{"contact":{"identifier":" "},"message":{"content":"oi"}}`, "contact.identifier"},
+		{"no content", `{"contact":{"identifier":"c1"},"message":{"content":"  "}}`, "message.content"},
+		{"file url", `{"contact":{"identifier":"c1"},"message":{"media_url":"file:///etc/passwd"}}`, "media_url"},
+		{"relative url", `{"contact":{"identifier":"c1"},"message":{"media_url":"/a.png"}}`, "media_url"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateWebhookPayload(apiChannel{}, []byte(tt.payload))
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("error = %v, want it to mention %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.0.10", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"fd00::1", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+	for _, tt := range tests {
+		if got := publicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("publicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
+
+func TestDownloadPublicMediaBlocksPrivateAddresses(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("secret"))
+	}))
+	defer server.Close()
+
+	for _, mediaURL := range []string{server.URL + "/a.png", strings.Replace(server.URL, "127.0.0.1", "localhost", 1) + "/a.png"} {
+		if _, _, err := downloadPublicMedia(context.Background(), mediaURL); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("downloadPublicMedia(%s) error = %v, want ErrPrivateAddress", mediaURL, err)
+		}
+	}
+	if _, _, err := downloadPublicMedia(context.Background(), "ftp://example.com/a.png"); err == nil {
+		t.Error("downloadPublicMedia accepted an ftp URL")
+	}
+	if n := atomic.LoadInt32(&requests); n != 0 {
+		t.Errorf("server received %d requests", n)
+	}
+}
+
+func TestPostAPICallback(t *testing.T) {
+	var requests int32
+	var idempotencyKey, signature, timestamp string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) > 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		idempotencyKey = r.Header.Get("Idempotency-Key")
+		signature = r.Header.Get("X-Signature-256")
+		timestamp = r.Header.Get("X-NakaWoot-Timestamp")
+		body, _ = io.ReadAll(r.Body)
+		w.Write([]byte(`{"id":"ext-1"}`))
+	}))
+	defer server.Close()
+
+	config := &apiConfig{WebhookURL: server.URL, SigningSecret: "secret"}
+	respBody, err := postAPICallback(config, apiCallbackMessageID(42), []byte(`{"event":"message.created"}`))
+	if err != nil {
+		t.Fatalf("postAPICallback: %v", err)
+	}
+	if string(respBody) != `{"id":"ext-1"}` {
+		t.Errorf("response = %s", respBody)
+	}
+	if idempotencyKey != "msg-42" {
+		t.Errorf("Idempotency-Key = %q, want msg-42", idempotencyKey)
+	}
+	if want := apiSignature("secret", []byte(timestamp+"."+string(body))); signature != want {
+		t.Errorf("signature = %q, want %q", signature, want)
+	}
+
+	// Falhas voltam ao outbox na primeira tentativa (sem retries internos)
+	_, err = postAPICallback(config, apiCallbackMessageID(42), []byte(`{}`))
+	if err == nil || !retryableSendError(err) {
+		t.Errorf("error = %v, want a retryable provider error", err)
+	}
+	if n := atomic.LoadInt32(&requests); n != 2 {
+		t.Errorf("server received %d requests, want 2", n)
+	}
+}
+
+func TestAPICallbackMessageIDIsStable(t *testing.T) {
+	if apiCallbackMessageID(7) != apiCallbackMessageID(7) {
+		t.Error("callback ID changes between attempts")
+	}
+	if apiCallbackMessageID(7) == apiCallbackMessageID(8) {
+		t.Error("different messages share a callback ID")
+	}
+}
+
+func TestResolveAPIChannelReturnsDatabaseErrors(t *testing.T) {
+	useUnreachableDB(t)
+
+	channel, err := ChannelForInbox(&models.Inbox{ID: 1, AccountID: 1, ChannelID: 1, ChannelType: apiProvider})
+	if err == nil {
+		t.Fatalf("ChannelForInbox returned %T without error", channel)
+	}
+	if errors.Is(err, ErrChannelNotFound) {
+		t.Errorf("error = %v, want the database error", err)
+	}
+}
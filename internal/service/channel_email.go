@@ -0,0 +1,556 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// emailProvider identificador do canal de email em webhook_logs e integrações
+const emailProvider = "email"
+
+// emailMaxReferences limite de Message-IDs repassados no cabeçalho References das respostas
+const emailMaxReferences = 20
+
+// emailChannel canal de email: leitura por IMAP (polling) e envio por SMTP
+type emailChannel struct{}
+
+func init() {
+	RegisterChannel(emailChannel{}, emailProvider)
+}
+
+func (emailChannel) Provider() string {
+	return emailProvider
+}
+
+func (emailChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:   true,
+		Replies: true,
+	}
+}
+
+// emailConfig configuração da caixa de email, lida do config da integração da inbox
+type emailConfig struct {
+	IMAPHost     string
+	IMAPPort     int
+	IMAPTLS      bool // TLS implícito (993); false para servidores locais sem TLS
+	IMAPUsername string
+	IMAPPassword string
+	Mailbox      string
+	MarkSeen     bool // Marcar como lidas no servidor as mensagens importadas
+	SMTPHost     string
+	SMTPPort     int
+	SMTPTLS      bool // TLS implícito (465); nas demais portas usa STARTTLS quando o servidor oferece
+	SMTPUsername string
+	SMTPPassword string
+	FromAddress  string
+	FromName     string
+}
+
+// loadEmailConfig busca a integração da inbox (channel_id) e extrai a configuração IMAP/SMTP
+func loadEmailConfig(inbox *models.Inbox) (*emailConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, emailProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &emailConfig{
+		IMAPHost:     firstString(configMap, "imap_host", "imapHost"),
+		IMAPTLS:      configBool(configMap, true, "imap_tls", "imapTls"),
+		IMAPUsername: firstString(configMap, "imap_username", "imapUsername", "username"),
+		IMAPPassword: firstString(configMap, "imap_password", "imapPassword", "password"),
+		Mailbox:      firstString(configMap, "imap_mailbox", "mailbox"),
+		MarkSeen:     configBool(configMap, true, "mark_seen", "markSeen"),
+		SMTPHost:     firstString(configMap, "smtp_host", "smtpHost"),
+		SMTPUsername: firstString(configMap, "smtp_username", "smtpUsername", "username"),
+		SMTPPassword: firstString(configMap, "smtp_password", "smtpPassword", "password"),
+		FromAddress:  firstString(configMap, "from_address", "fromAddress", "email"),
+		FromName:     firstString(configMap, "from_name", "fromName"),
+	}
+	config.IMAPPort = configInt(configMap, 0, "imap_port", "imapPort")
+	if config.IMAPPort == 0 {
+		config.IMAPPort = 143
+		if config.IMAPTLS {
+			config.IMAPPort = 993
+		}
+	}
+	config.SMTPPort = configInt(configMap, 587, "smtp_port", "smtpPort")
+	config.SMTPTLS = configBool(configMap, config.SMTPPort == 465, "smtp_tls", "smtpTls")
+	if config.Mailbox == "" {
+		config.Mailbox = "INBOX"
+	}
+	if config.FromAddress == "" {
+		config.FromAddress = config.SMTPUsername
+	}
+	if config.FromName == "" {
+		config.FromName = inbox.Name
+	}
+
+	return config, nil
+}
+
+// configInt lê um número do config (JSON traz números como float64, mas aceita string)
+func configInt(configMap map[string]interface{}, fallback int, keys ...string) int {
+	for _, key := range keys {
+		switch v := configMap[key].(type) {
+		case float64:
+			return int(v)
+		case string:
+			if n, err := strconv.Atoi(v); err == nil {
+				return n
+			}
+		}
+	}
+	return fallback
+}
+
+// configBool lê um booleano do config (aceita também "true"/"false")
+func configBool(configMap map[string]interface{}, fallback bool, keys ...string) bool {
+	for _, key := range keys {
+		switch v := configMap[key].(type) {
+		case bool:
+			return v
+		case string:
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b
+			}
+		}
+	}
+	return fallback
+}
+
+// VerifyWebhook: inboxes de email não recebem webhooks, as mensagens chegam pelo polling IMAP
+func (emailChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	return fmt.Errorf("inbound webhooks are %w: email inboxes are polled over IMAP", ErrChannelUnsupported)
+}
+
+// emailWebhookPayload mensagem lida do IMAP e gravada na fila (webhook_logs) para processamento
+type emailWebhookPayload struct {
+	Mailbox     string `json:"mailbox"`
+	UIDValidity uint32 `json:"uid_validity"`
+	UID         uint32 `json:"uid"`
+	Raw         []byte `json:"raw"` // RFC 822 (base64 no JSON)
+}
+
+// RoutingInfo usa o remetente como chave de ordenação
+func (emailChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var p emailWebhookPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return "", ""
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(p.Raw))
+	if err != nil {
+		return "email", ""
+	}
+	from, err := mail.ParseAddress(msg.Header.Get("From"))
+	if err != nil {
+		return "email", ""
+	}
+	return "email", fmt.Sprintf("%d:%s", inboxID, strings.ToLower(from.Address))
+}
+
+// ProcessWebhook cria contato, conversa (seguindo o thread) e mensagens de um email lido do IMAP
+func (emailChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	var p emailWebhookPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return fmt.Errorf("failed to parse email payload: %w", err)
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+	config, err := loadEmailConfig(inbox)
+	if err != nil {
+		return err
+	}
+
+	email, err := parseEmail(p.Raw)
+	if err != nil {
+		return err
+	}
+	if email.From == nil || email.From.Address == "" {
+		log.Printf("[Email] Ignoring message UID %d without sender (inbox %d)", p.UID, inboxID)
+		return nil
+	}
+	// Cópias das nossas próprias respostas (ex.: caixa com enviados) não viram mensagens recebidas
+	if strings.EqualFold(email.From.Address, config.FromAddress) {
+		log.Printf("[Email] Ignoring message UID %d sent by the inbox address (inbox %d)", p.UID, inboxID)
+		return nil
+	}
+
+	if email.MessageID == "" {
+		email.MessageID = fmt.Sprintf("<uid-%d-%d@inbox-%d.nakawoot>", p.UIDValidity, p.UID, inboxID)
+	}
+	externalID := emailMessageRef(inboxID, email.MessageID)
+
+	content := email.Body()
+	if content == "" && len(email.Attachments) == 0 {
+		content = email.Subject
+	}
+
+	// Corpo e anexos são deduplicados cada um pelo seu ID: um retry após falha em um anexo
+	// grava apenas o que ainda falta
+	var refs []string
+	if content != "" {
+		refs = append(refs, externalID)
+	}
+	for i := range email.Attachments {
+		refs = append(refs, emailAttachmentRef(externalID, i))
+	}
+	existing, err := repository.ListMessagesByWhatsAppIDs(refs)
+	if err != nil {
+		return fmt.Errorf("failed to check existing messages: %w", err)
+	}
+	saved := make(map[string]*models.Message, len(existing))
+	for i := range existing {
+		if existing[i].WhatsAppMessageID != nil {
+			saved[*existing[i].WhatsAppMessageID] = &existing[i]
+		}
+	}
+	if len(saved) == len(refs) {
+		log.Printf("[Email] Message already exists with ID %s, skipping", externalID)
+		return nil
+	}
+
+	contact, err := repository.FindOrCreateContactByEmail(uint(inbox.AccountID), email.From.Address, email.From.Name)
+	if err != nil {
+		return fmt.Errorf("failed to find/create contact: %w", err)
+	}
+	if email.From.Name != "" && contact.Name != email.From.Name && !contact.NameManuallySet {
+		contact.Name = email.From.Name
+		repository.UpdateContact(contact)
+	}
+
+	conversation, threadMessage, err := emailThreadConversation(inbox, contact, email.ThreadIDs())
+	if err != nil {
+		return fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+	// Retry parcial: continuar na conversa em que o email começou a ser gravado
+	for _, ref := range refs {
+		if message := saved[ref]; message != nil {
+			if previous, err := repository.GetConversationByID(message.ConversationID); err == nil {
+				conversation = previous
+			}
+			break
+		}
+	}
+
+	message := newEmailMessage(inbox, conversation, contact, externalID, email.Date)
+	message.Content = content
+	message.ContentAttributes.Email = &models.EmailAttributes{
+		Subject:    email.Subject,
+		From:       email.From.Address,
+		To:         email.To,
+		Cc:         email.Cc,
+		MessageID:  email.MessageID,
+		InReplyTo:  email.InReplyTo,
+		References: email.References,
+	}
+	if threadMessage != nil && threadMessage.ConversationID == uint(conversation.ID) {
+		message.QuotedMessageID = threadMessage.WhatsAppMessageID
+		message.InReplyTo = &threadMessage.ID
+	}
+
+	if content != "" && saved[externalID] == nil {
+		if err := repository.UpsertMessage(message); err != nil {
+			return fmt.Errorf("failed to save message: %w", err)
+		}
+		publishInboundMessage(conversation, message)
+	}
+
+	// Cada anexo vira uma mensagem de mídia (o modelo comporta uma mídia por mensagem)
+	for i, attachment := range email.Attachments {
+		attachmentRef := emailAttachmentRef(externalID, i)
+		if saved[attachmentRef] != nil {
+			continue
+		}
+		attachmentMessage := newEmailMessage(inbox, conversation, contact, attachmentRef, email.Date)
+		if content == "" && i == 0 {
+			// Sem corpo: o primeiro anexo carrega os cabeçalhos do thread
+			attachmentMessage.ContentAttributes.Email = message.ContentAttributes.Email
+		}
+		if err := storeEmailAttachment(attachmentMessage, attachment); err != nil {
+			return err
+		}
+		if err := repository.UpsertMessage(attachmentMessage); err != nil {
+			return fmt.Errorf("failed to save attachment message: %w", err)
+		}
+		publishInboundMessage(conversation, attachmentMessage)
+	}
+
+	return nil
+}
+
+// newEmailMessage mensagem recebida base do canal de email
+func newEmailMessage(inbox *models.Inbox, conversation *models.Conversation, contact *models.Contact, externalID string, date time.Time) *models.Message {
+	id := externalID
+	return &models.Message{
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           uint(inbox.ID),
+		ConversationID:    uint(conversation.ID),
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		SenderType:        "Contact",
+		SenderID:          contact.ID,
+		Status:            models.MessageStatusSent,
+		SourceID:          id,
+		WhatsAppMessageID: &id,
+		Timestamp:         &date,
+	}
+}
+
+// storeEmailAttachment grava o anexo no storage e preenche os campos de mídia da mensagem
+func storeEmailAttachment(message *models.Message, attachment emailAttachment) error {
+	if GlobalMediaStorage == nil {
+		return fmt.Errorf("media storage not initialized")
+	}
+
+	mimeType := firstNonEmpty(attachment.ContentType, DetectMimeType(attachment.Data))
+	extension := GetExtensionFromMimeType(baseMimeType(mimeType))
+	if dot := strings.LastIndex(attachment.FileName, "."); dot >= 0 {
+		extension = attachment.FileName[dot:]
+	}
+	fileName := uuid.New().String() + extension
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	mediaURL, err := GlobalMediaStorage.Store(ctx, attachment.Data, fileName, mimeType)
+	if err != nil {
+		return fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	size := int64(len(attachment.Data))
+	message.ContentType = mediaContentType(mimeType)
+	message.Content = attachment.FileName
+	message.MediaURL = &mediaURL
+	message.MimeType = &mimeType
+	message.FileName = &attachment.FileName
+	message.FileSize = &size
+	return nil
+}
+
+// emailThreadConversation escolhe a conversa do email: a da mensagem referenciada (In-Reply-To/References)
+// quando ainda ativa, senão a conversa do remetente. Retorna também a mensagem referenciada, se encontrada.
+func emailThreadConversation(inbox *models.Inbox, contact *models.Contact, threadIDs []string) (*models.Conversation, *models.Message, error) {
+	var threadMessage *models.Message
+	if len(threadIDs) > 0 {
+		refs := make([]string, 0, len(threadIDs))
+		for _, id := range threadIDs {
+			refs = append(refs, emailMessageRef(uint(inbox.ID), id))
+		}
+		messages, err := repository.ListMessagesByWhatsAppIDs(refs)
+		if err != nil {
+			return nil, nil, err
+		}
+		// Preferir a referência mais recente (ordem de threadIDs)
+		for _, ref := range refs {
+			for i := range messages {
+				if messages[i].WhatsAppMessageID != nil && *messages[i].WhatsAppMessageID == ref {
+					threadMessage = &messages[i]
+					break
+				}
+			}
+			if threadMessage != nil {
+				break
+			}
+		}
+	}
+
+	if threadMessage != nil {
+		conversation, err := repository.GetConversationByID(threadMessage.ConversationID)
+		if err == nil && conversation.Status != models.ConversationStatusResolved {
+			return conversation, threadMessage, nil
+		}
+	}
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), uint(contact.ID))
+	if err != nil {
+		return nil, nil, err
+	}
+	return conversation, threadMessage, nil
+}
+
+// emailMessageRef monta o ID externo de um email (Message-ID é global, mas o mesmo email pode chegar em várias inboxes)
+func emailMessageRef(inboxID uint, messageID string) string {
+	return fmt.Sprintf("email:%d:%s", inboxID, messageID)
+}
+
+// emailAttachmentRef ID externo da mensagem do i-ésimo anexo (base 0) de um email
+func emailAttachmentRef(externalID string, i int) string {
+	return fmt.Sprintf("%s#%d", externalID, i+1)
+}
+
+func (emailChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	return sendEmail(msg, nil)
+}
+
+func (emailChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	if GlobalMediaStorage == nil {
+		return nil, fmt.Errorf("media storage not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	data, mimeType, err := GlobalMediaStorage.Download(ctx, msg.MediaURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download attachment: %w", err)
+	}
+	fileName := firstNonEmpty(msg.FileName, mediaFileName(msg.MediaURL))
+
+	result, err := sendEmail(msg, &emailAttachment{FileName: fileName, ContentType: mimeType, Data: data})
+	if err != nil {
+		return nil, err
+	}
+	result.FileName = &fileName
+	return result, nil
+}
+
+// sendEmail envia a resposta por SMTP mantendo o thread (Subject, In-Reply-To e References do último email)
+func sendEmail(msg *OutboundMessage, attachment *emailAttachment) (*SendResult, error) {
+	if msg.Contact.Email == "" {
+		return nil, fmt.Errorf("contact %d has no email address", msg.Contact.ID)
+	}
+	config, err := loadEmailConfig(msg.Inbox)
+	if err != nil {
+		return nil, err
+	}
+	if config.SMTPHost == "" || config.FromAddress == "" {
+		return nil, fmt.Errorf("email integration requires smtp_host and from_address")
+	}
+
+	// Base do thread: a mensagem respondida, se tiver cabeçalhos de email, senão o último email da conversa
+	var thread *models.EmailAttributes
+	if msg.ReplyTo != nil && msg.ReplyTo.ContentAttributes.Email != nil {
+		thread = msg.ReplyTo.ContentAttributes.Email
+	} else if latest, err := repository.GetLatestEmailMessage(uint(msg.Conversation.ID)); err == nil {
+		thread = latest.ContentAttributes.Email
+	}
+
+	subject := fmt.Sprintf("%s #%d", config.FromName, msg.Conversation.ID)
+	var inReplyTo string
+	var references []string
+	if thread != nil {
+		if thread.Subject != "" {
+			subject = replySubject(thread.Subject)
+		}
+		inReplyTo = thread.MessageID
+		references = append(references, thread.References...)
+		if thread.MessageID != "" {
+			references = append(references, thread.MessageID)
+		}
+		if len(references) > emailMaxReferences {
+			references = references[len(references)-emailMaxReferences:]
+		}
+	}
+
+	domain := config.FromAddress[strings.LastIndex(config.FromAddress, "@")+1:]
+	messageID := fmt.Sprintf("<%s@%s>", uuid.New().String(), domain)
+	from := mail.Address{Name: config.FromName, Address: config.FromAddress}
+	to := []string{msg.Contact.Email}
+
+	raw, err := composeEmail(from, to, subject, messageID, inReplyTo, references, msg.Content, attachment)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compose email: %w", err)
+	}
+	if err := sendSMTP(config, to, raw); err != nil {
+		return nil, err
+	}
+
+	externalID := emailMessageRef(uint(msg.Inbox.ID), messageID)
+	result := &SendResult{
+		ExternalID: &externalID,
+		Email: &models.EmailAttributes{
+			Subject:    subject,
+			From:       config.FromAddress,
+			To:         to,
+			MessageID:  messageID,
+			InReplyTo:  inReplyTo,
+			References: references,
+		},
+	}
+	if msg.ReplyTo != nil {
+		result.QuotedID = msg.ReplyTo.WhatsAppMessageID
+	}
+	return result, nil
+}
+
+// sendSMTP entrega a mensagem ao servidor SMTP (TLS implícito ou STARTTLS, autenticação quando configurada)
+func sendSMTP(config *emailConfig, to []string, raw []byte) error {
+	address := net.JoinHostPort(config.SMTPHost, strconv.Itoa(config.SMTPPort))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if config.SMTPTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: config.SMTPHost})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to SMTP server %s: %w", address, err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+
+	client, err := smtp.NewClient(conn, config.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to start SMTP session: %w", err)
+	}
+	defer client.Close()
+
+	if !config.SMTPTLS {
+		if ok, _ := client.Extension("STARTTLS"); ok {
+			if err := client.StartTLS(&tls.Config{ServerName: config.SMTPHost}); err != nil {
+				return fmt.Errorf("SMTP STARTTLS failed: %w", err)
+			}
+		}
+	}
+	if config.SMTPUsername != "" {
+		// Com credenciais configuradas não enviar sem autenticar
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return fmt.Errorf("SMTP server %s does not advertise AUTH", address)
+		}
+		if err := client.Auth(smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)); err != nil {
+			return fmt.Errorf("SMTP authentication failed: %w", err)
+		}
+	}
+
+	if err := client.Mail(config.FromAddress); err != nil {
+		return fmt.Errorf("SMTP MAIL FROM failed: %w", err)
+	}
+	for _, recipient := range to {
+		if err := client.Rcpt(recipient); err != nil {
+			return fmt.Errorf("SMTP RCPT TO %s failed: %w", recipient, err)
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return fmt.Errorf("SMTP DATA failed: %w", err)
+	}
+	if _, err := writer.Write(raw); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+	if err := writer.Close(); err != nil {
+		return fmt.Errorf("SMTP server rejected email: %w", err)
+	}
+	return client.Quit()
+}
@@ -0,0 +1,529 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+)
+
+const testEmail = "From: =?UTF-8?Q?Jo=C3=A3o?= <joao@example.com>\r\n" +
+	"To: suporte@example.com\r\n" +
+	"Subject: =?UTF-8?Q?Pedido_n=C2=BA_42?=\r\n" +
+	"Message-ID: <abc@example.com>\r\n" +
+	"In-Reply-To: <b@example.com>\r\n" +
+	"References: <a@example.com> <b@example.com>\r\n" +
+	"Date: Mon, 02 Jan 2006 15:04:05 -0300\r\n" +
+	"MIME-Version: 1.0\r\n" +
+	"Content-Type: multipart/mixed; boundary=\"outer\"\r\n" +
+	"\r\n" +
+	"--outer\r\n" +
+	"Content-Type: multipart/alternative; boundary=\"inner\"\r\n" +
+	"\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/plain; charset=UTF-8\r\n" +
+	"\r\n" +
+	"Segue o comprovante.\r\n" +
+	"\r\n" +
+	"Em seg, 2 jan 2006, Suporte escreveu:\r\n" +
+	"> Envie o comprovante\r\n" +
+	"--inner\r\n" +
+	"Content-Type: text/html; charset=UTF-8\r\n" +
+	"\r\n" +
+	"<p>Segue o comprovante.</p>\r\n" +
+	"--inner--\r\n" +
+	"--outer\r\n" +
+	"Content-Type: application/pdf; name=\"comprovante.pdf\"\r\n" +
+	"Content-Disposition: attachment; filename=\"comprovante.pdf\"\r\n" +
+	"Content-Transfer-Encoding: base64\r\n" +
+	"\r\n" +
+	"JVBERi0xLjQK\r\n" +
+	"--outer--\r\n"
+
+func TestParseEmail(t *testing.T) {
+	email, err := parseEmail([]byte(testEmail))
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+
+	if email.From == nil || email.From.Address != "joao@example.com" || email.From.Name != "João" {
+		t.Errorf("From = %+v", email.From)
+	}
+	if email.Subject != "Pedido nº 42" {
+		t.Errorf("Subject = %q", email.Subject)
+	}
+	if email.MessageID != "<abc@example.com>" {
+		t.Errorf("MessageID = %q", email.MessageID)
+	}
+	if got := strings.Join(email.ThreadIDs(), " "); got != "<b@example.com> <a@example.com>" {
+		t.Errorf("ThreadIDs = %q", got)
+	}
+	if got := email.Body(); got != "Segue o comprovante." {
+		t.Errorf("Body = %q", got)
+	}
+	if len(email.Attachments) != 1 {
+		t.Fatalf("got %d attachments, want 1", len(email.Attachments))
+	}
+	attachment := email.Attachments[0]
+	if attachment.FileName != "comprovante.pdf" || attachment.ContentType != "application/pdf" || string(attachment.Data) != "%PDF-1.4\n" {
+		t.Errorf("attachment = %+v", attachment)
+	}
+}
+
+func TestParseEmailHTMLOnly(t *testing.T) {
+	raw := "From: a@example.com\r\nContent-Type: text/html; charset=ISO-8859-1\r\n\r\n<style>p{}</style><p>Ol\xe1</p><p>Tudo bem?</p>"
+	email, err := parseEmail([]byte(raw))
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+	if got := email.Body(); got != "Olá\nTudo bem?" {
+		t.Errorf("Body = %q", got)
+	}
+}
+
+func TestComposeEmail(t *testing.T) {
+	from := mail.Address{Name: "Suporte", Address: "suporte@example.com"}
+	attachment := &emailAttachment{FileName: "nota.txt", ContentType: "text/plain", Data: bytes.Repeat([]byte("x"), 200)}
+	raw, err := composeEmail(from, []string{"joao@example.com"}, "Re: Pedido nº 42", "<new@example.com>", "<abc@example.com>",
+		[]string{"<a@example.com>", "<abc@example.com>"}, "Olá João,\nrecebido.", attachment)
+	if err != nil {
+		t.Fatalf("composeEmail: %v", err)
+	}
+
+	email, err := parseEmail(raw)
+	if err != nil {
+		t.Fatalf("parseEmail: %v", err)
+	}
+	if email.Subject != "Re: Pedido nº 42" || email.MessageID != "<new@example.com>" || email.InReplyTo != "<abc@example.com>" {
+		t.Errorf("headers = %q %q %q", email.Subject, email.MessageID, email.InReplyTo)
+	}
+	if got := email.Body(); got != "Olá João,\nrecebido." {
+		t.Errorf("Body = %q", got)
+	}
+	if len(email.Attachments) != 1 || !bytes.Equal(email.Attachments[0].Data, attachment.Data) {
+		t.Errorf("attachments = %+v", email.Attachments)
+	}
+}
+
+// fakeIMAP servidor IMAP em memória com as mensagens por UID
+type fakeIMAP struct {
+	uidValidity uint32
+	messages    map[uint32][]byte
+	literalSize int64 // Tamanho anunciado no FETCH no lugar do real (0 = real)
+
+	mu   sync.Mutex
+	seen map[uint32]bool
+}
+
+func startFakeIMAP(t *testing.T, server *fakeIMAP) (string, int) {
+	t.Helper()
+	server.seen = map[uint32]bool{}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+
+	addr := listener.Addr().(*net.TCPAddr)
+	return addr.IP.String(), addr.Port
+}
+
+func (s *fakeIMAP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "* OK fake IMAP ready\r\n")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			return
+		}
+		tag, command := fields[0], strings.ToUpper(strings.Join(fields[1:], " "))
+
+		switch {
+		case strings.HasPrefix(command, "LOGIN"):
+		case strings.HasPrefix(command, "SELECT"):
+			fmt.Fprintf(conn, "* %d EXISTS\r\n", len(s.messages))
+			fmt.Fprintf(conn, "* OK [UIDVALIDITY %d] UIDs valid\r\n", s.uidValidity)
+			fmt.Fprintf(conn, "* OK [UIDNEXT %d] Predicted next UID\r\n", s.maxUID()+1)
+		case strings.HasPrefix(command, "UID SEARCH"):
+			fmt.Fprintf(conn, "* SEARCH%s\r\n", s.search(fields[3:]))
+		case strings.HasPrefix(command, "UID FETCH"):
+			uid, _ := strconv.ParseUint(fields[3], 10, 32)
+			raw := s.messages[uint32(uid)]
+			if s.literalSize > 0 {
+				fmt.Fprintf(conn, "* 1 FETCH (UID %d BODY[] {%d}\r\n", uid, s.literalSize)
+				return
+			}
+			fmt.Fprintf(conn, "* 1 FETCH (UID %d BODY[] {%d}\r\n%s)\r\n", uid, len(raw), raw)
+		case strings.HasPrefix(command, "UID STORE"):
+			uid, _ := strconv.ParseUint(fields[3], 10, 32)
+			s.mu.Lock()
+			s.seen[uint32(uid)] = true
+			s.mu.Unlock()
+		case strings.HasPrefix(command, "LOGOUT"):
+			fmt.Fprintf(conn, "* BYE\r\n%s OK LOGOUT completed\r\n", tag)
+			return
+		default:
+			fmt.Fprintf(conn, "%s BAD unknown command\r\n", tag)
+			continue
+		}
+		fmt.Fprintf(conn, "%s OK completed\r\n", tag)
+	}
+}
+
+func (s *fakeIMAP) maxUID() uint32 {
+	var max uint32
+	for uid := range s.messages {
+		if uid > max {
+			max = uid
+		}
+	}
+	return max
+}
+
+// search atende "UNSEEN" e "UID n:*" (que sempre inclui a última mensagem)
+func (s *fakeIMAP) search(criteria []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var from uint64
+	if len(criteria) == 2 && strings.EqualFold(criteria[0], "UID") {
+		from, _ = strconv.ParseUint(strings.TrimSuffix(criteria[1], ":*"), 10, 32)
+	}
+
+	var uids []int
+	for uid := range s.messages {
+		if (from == 0 && !s.seen[uid]) || (from > 0 && (uint64(uid) >= from || uid == s.maxUID())) {
+			uids = append(uids, int(uid))
+		}
+	}
+	sort.Ints(uids)
+
+	var result string
+	for _, uid := range uids {
+		result += " " + strconv.Itoa(uid)
+	}
+	return result
+}
+
+func TestIMAPClientFetch(t *testing.T) {
+	server := &fakeIMAP{uidValidity: 7, messages: map[uint32][]byte{3: []byte(testEmail), 5: []byte("Subject: b\r\n\r\nb")}}
+	host, port := startFakeIMAP(t, server)
+
+	client, err := dialIMAP(host, port, false)
+	if err != nil {
+		t.Fatalf("dialIMAP: %v", err)
+	}
+	defer client.close()
+
+	if err := client.login("user", `pa"ss`); err != nil {
+		t.Fatalf("login: %v", err)
+	}
+	status, err := client.selectMailbox("INBOX")
+	if err != nil {
+		t.Fatalf("selectMailbox: %v", err)
+	}
+	if status.UIDValidity != 7 || status.UIDNext != 6 {
+		t.Errorf("status = %+v, want UIDVALIDITY 7 and UIDNEXT 6", status)
+	}
+
+	uids, err := client.uidSearch("UNSEEN")
+	if err != nil {
+		t.Fatalf("uidSearch: %v", err)
+	}
+	if len(uids) != 2 || uids[0] != 3 || uids[1] != 5 {
+		t.Errorf("uids = %v, want [3 5]", uids)
+	}
+
+	raw, err := client.fetchRaw(3)
+	if err != nil {
+		t.Fatalf("fetchRaw: %v", err)
+	}
+	if string(raw) != testEmail {
+		t.Errorf("fetchRaw returned %d bytes, want the %d bytes of the message", len(raw), len(testEmail))
+	}
+}
+
+func TestIMAPClientRejectsOversizedLiteral(t *testing.T) {
+	server := &fakeIMAP{uidValidity: 1, messages: map[uint32][]byte{1: []byte("x")}, literalSize: maxEmailSize + 1}
+	host, port := startFakeIMAP(t, server)
+
+	client, err := dialIMAP(host, port, false)
+	if err != nil {
+		t.Fatalf("dialIMAP: %v", err)
+	}
+	defer client.close()
+
+	if _, err := client.fetchRaw(1); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("fetchRaw error = %v, want ErrTooLarge", err)
+	}
+}
+
+// fakeSMTP servidor SMTP em memória; guarda os comandos e a última mensagem recebida
+type fakeSMTP struct {
+	auth bool // Anunciar AUTH PLAIN
+
+	mu       sync.Mutex
+	commands []string
+	data     string
+}
+
+func startFakeSMTP(t *testing.T, server *fakeSMTP) int {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go server.serve(conn)
+		}
+	}()
+	return listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	text.PrintfLine("220 fake SMTP ready")
+
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			if s.auth {
+				text.PrintfLine("250-fake\r\n250 AUTH PLAIN")
+			} else {
+				text.PrintfLine("250 fake")
+			}
+		case strings.HasPrefix(command, "AUTH PLAIN"):
+			text.PrintfLine("235 Authentication successful")
+		case strings.HasPrefix(command, "DATA"):
+			text.PrintfLine("354 Go ahead")
+			data, err := text.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.data = string(data)
+			s.mu.Unlock()
+			text.PrintfLine("250 Queued")
+		case strings.HasPrefix(command, "QUIT"):
+			text.PrintfLine("221 Bye")
+			return
+		default:
+			text.PrintfLine("250 OK")
+		}
+	}
+}
+
+func TestSendSMTP(t *testing.T) {
+	server := &fakeSMTP{auth: true}
+	port := startFakeSMTP(t, server)
+
+	config := &emailConfig{
+		SMTPHost:     "127.0.0.1",
+		SMTPPort:     port,
+		SMTPUsername: "suporte@example.com",
+		SMTPPassword: "secret",
+		FromAddress:  "suporte@example.com",
+	}
+	if err := sendSMTP(config, []string{"joao@example.com"}, []byte("Subject: oi\r\n\r\nolá\r\n")); err != nil {
+		t.Fatalf("sendSMTP: %v", err)
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	credentials := base64.StdEncoding.EncodeToString([]byte("\x00suporte@example.com\x00secret"))
+	want := []string{"AUTH PLAIN " + credentials, "MAIL FROM:<suporte@example.com>", "RCPT TO:<joao@example.com>", "DATA"}
+	for _, command := range want {
+		found := false
+		for _, got := range server.commands {
+			if strings.HasPrefix(got, command) {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("command %q not sent, got %v", command, server.commands)
+		}
+	}
+	if server.data != "Subject: oi\n\nolá\n" {
+		t.Errorf("data = %q", server.data)
+	}
+}
+
+func TestSendSMTPRequiresAuthWithCredentials(t *testing.T) {
+	server := &fakeSMTP{}
+	port := startFakeSMTP(t, server)
+
+	config := &emailConfig{
+		SMTPHost:     "127.0.0.1",
+		SMTPPort:     port,
+		SMTPUsername: "suporte@example.com",
+		SMTPPassword: "secret",
+		FromAddress:  "suporte@example.com",
+	}
+	err := sendSMTP(config, []string{"joao@example.com"}, []byte("Subject: oi\r\n\r\nolá\r\n"))
+	if err == nil || !strings.Contains(err.Error(), "AUTH") {
+		t.Fatalf("sendSMTP error = %v, want missing AUTH error", err)
+	}
+
+	server.mu.Lock()
+	for _, command := range server.commands {
+		if strings.HasPrefix(command, "MAIL") {
+			t.Errorf("MAIL sent without authentication: %v", server.commands)
+		}
+	}
+	server.mu.Unlock()
+
+	// Sem credenciais o envio segue sem autenticação
+	config.SMTPUsername, config.SMTPPassword = "", ""
+	if err := sendSMTP(config, []string{"joao@example.com"}, []byte("Subject: oi\r\n\r\nolá\r\n")); err != nil {
+		t.Fatalf("sendSMTP without credentials: %v", err)
+	}
+}
+
+func TestPollEmailInbox(t *testing.T) {
+	conn := dbtest.Open(t)
+
+	server := &fakeIMAP{uidValidity: 9, messages: map[uint32][]byte{4: []byte(testEmail), 6: []byte("From: b@example.com\r\n\r\nb")}}
+	host, port := startFakeIMAP(t, server)
+	inbox := createChannelInbox(t, conn, emailProvider, emailProvider, map[string]interface{}{
+		"imap_host": host,
+		"imap_port": port,
+		"imap_tls":  false,
+	})
+
+	if err := PollEmailInbox(inbox); err != nil {
+		t.Fatalf("PollEmailInbox: %v", err)
+	}
+
+	var logs []models.WebhookLog
+	if err := conn.Where("inbox_id = ?", inbox.ID).Order("id").Find(&logs).Error; err != nil {
+		t.Fatalf("list webhook logs: %v", err)
+	}
+	if len(logs) != 2 {
+		t.Fatalf("got %d webhook logs, want 2", len(logs))
+	}
+	var payload emailWebhookPayload
+	if err := json.Unmarshal(logs[0].Payload, &payload); err != nil {
+		t.Fatalf("unmarshal payload: %v", err)
+	}
+	if payload.UID != 4 || payload.UIDValidity != 9 || string(payload.Raw) != testEmail {
+		t.Errorf("payload = UID %d, UIDVALIDITY %d, %d bytes", payload.UID, payload.UIDValidity, len(payload.Raw))
+	}
+	if logs[0].OrderingKey != fmt.Sprintf("%d:joao@example.com", inbox.ID) {
+		t.Errorf("ordering key = %q", logs[0].OrderingKey)
+	}
+	server.mu.Lock()
+	if !server.seen[4] || !server.seen[6] {
+		t.Errorf("messages not marked as seen: %v", server.seen)
+	}
+	server.mu.Unlock()
+
+	var state models.EmailPollState
+	if err := conn.Where("inbox_id = ?", inbox.ID).First(&state).Error; err != nil {
+		t.Fatalf("load poll state: %v", err)
+	}
+	if state.LastUID != 6 || state.UIDValidity != 9 || state.LastError != "" {
+		t.Errorf("state = %+v", state)
+	}
+
+	// Segunda leitura sem mensagens novas não enfileira nada
+	if err := PollEmailInbox(inbox); err != nil {
+		t.Fatalf("second PollEmailInbox: %v", err)
+	}
+	var count int64
+	conn.Model(&models.WebhookLog{}).Where("inbox_id = ?", inbox.ID).Count(&count)
+	if count != 2 {
+		t.Errorf("got %d webhook logs after second poll, want 2", count)
+	}
+}
+
+func TestEmailProcessWebhookRetriesAttachments(t *testing.T) {
+	conn := dbtest.Open(t)
+
+	inbox := createChannelInbox(t, conn, emailProvider, emailProvider, map[string]interface{}{
+		"from_address": "suporte@example.com",
+	})
+	payload, _ := json.Marshal(emailWebhookPayload{Mailbox: "INBOX", UIDValidity: 1, UID: 1, Raw: []byte(testEmail)})
+
+	// Primeira tentativa: o corpo é gravado e o anexo falha (storage indisponível)
+	previous := GlobalMediaStorage
+	GlobalMediaStorage = nil
+	err := emailChannel{}.ProcessWebhook(uint(inbox.ID), payload)
+	GlobalMediaStorage = previous
+	if err == nil {
+		t.Fatal("ProcessWebhook succeeded without media storage")
+	}
+	if messages := inboxMessages(t, conn, inbox.ID); len(messages) != 1 {
+		t.Fatalf("got %d messages after failed attempt, want 1", len(messages))
+	}
+
+	// Retry: grava apenas o anexo que faltava, na mesma conversa
+	useMemoryMediaStorage(t)
+	if err := (emailChannel{}).ProcessWebhook(uint(inbox.ID), payload); err != nil {
+		t.Fatalf("ProcessWebhook retry: %v", err)
+	}
+	messages := inboxMessages(t, conn, inbox.ID)
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages after retry, want 2", len(messages))
+	}
+	if messages[0].Content != "Segue o comprovante." || messages[1].FileName == nil || *messages[1].FileName != "comprovante.pdf" {
+		t.Errorf("messages = %q, %v", messages[0].Content, messages[1].FileName)
+	}
+	if messages[0].ConversationID != messages[1].ConversationID {
+		t.Errorf("attachment in conversation %d, body in %d", messages[1].ConversationID, messages[0].ConversationID)
+	}
+
+	// Reprocessar o email completo não duplica nada
+	if err := (emailChannel{}).ProcessWebhook(uint(inbox.ID), payload); err != nil {
+		t.Fatalf("ProcessWebhook again: %v", err)
+	}
+	if messages := inboxMessages(t, conn, inbox.ID); len(messages) != 2 {
+		t.Errorf("got %d messages after reprocessing, want 2", len(messages))
+	}
+}
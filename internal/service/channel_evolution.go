@@ -0,0 +1,226 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"strings"
+)
+
+// evolutionChannel canal WhatsApp via Evolution API (v2 e Evolution Go)
+type evolutionChannel struct{}
+
+func init() {
+	// "api" também é o tipo criado pela integração Chatwoot da Evolution: ver resolveAPIChannel
+	RegisterChannel(evolutionChannel{}, "whatsapp", "evolution")
+}
+
+func (evolutionChannel) Provider() string {
+	return "evolution"
+}
+
+func (evolutionChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:     true,
+		Replies:   true,
+		Reactions: true,
+		Mentions:  true,
+		Typing:    true,
+	}
+}
+
+// VerifyWebhook autentica com o segredo da inbox (token na URL, header ou instanceToken do payload)
+func (evolutionChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	var envelope struct {
+		InstanceToken string `json:"instanceToken"`
+		APIKey        string `json:"apikey"`
+	}
+	_ = json.Unmarshal(req.Body, &envelope)
+	if envelope.InstanceToken == "" {
+		envelope.InstanceToken = envelope.APIKey
+	}
+
+	return VerifyEvolutionWebhook(uint(inbox.ID), WebhookCredentials{
+		URLToken:      req.Query.Get("token"),
+		HeaderToken:   req.Header.Get("X-Webhook-Token"),
+		InstanceToken: envelope.InstanceToken,
+	})
+}
+
+func (evolutionChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	return ProcessEvolutionWebhook(inboxID, payload)
+}
+
+// RoutingInfo extrai o evento e a chave de ordenação (inbox + chat) de um payload da Evolution
+func (evolutionChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var webhook EvolutionWebhookPayload
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return "", ""
+	}
+
+	// Lotes de histórico abrangem vários chats: são processados em ordem entre si
+	if historyEvents[webhook.Event] {
+		return webhook.Event, fmt.Sprintf("%d:history", inboxID)
+	}
+
+	data := webhook.Data
+	if data == nil && len(webhook.DataList) > 0 {
+		data = webhook.DataList[0]
+	}
+
+	chat := evolutionChatJID(data)
+	if chat == "" {
+		return webhook.Event, ""
+	}
+
+	return webhook.Event, fmt.Sprintf("%d:%s", inboxID, chat)
+}
+
+// evolutionChatJID JID do chat de um evento (key.remoteJid ou os campos equivalentes das versões da Evolution)
+func evolutionChatJID(data map[string]interface{}) string {
+	if keyData, ok := data["key"].(map[string]interface{}); ok {
+		if chat := getString(keyData, "remoteJid"); chat != "" {
+			return chat
+		}
+	}
+	return firstString(data, "remoteJid", "Chat", "chatId", "chat")
+}
+
+func (evolutionChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	target, err := evolutionTargetFor(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	mentionedJIDs, err := resolveMentions(target, SendMessageOptions{Mentions: msg.Mentions, MentionAll: msg.MentionAll})
+	if err != nil {
+		return nil, err
+	}
+	quoted := evolutionQuotedFor(msg.ReplyTo)
+
+	sent, err := target.Service.SendTextMessage(SendTextMessageInput{
+		InstanceName: target.InstanceName,
+		Number:       target.Number,
+		Text:         withMentionTokens(msg.Content, mentionedJIDs),
+		Quoted:       quoted,
+		MentionedJID: mentionedJIDs,
+		MentionAll:   msg.MentionAll,
+		Delay:        loadSendRateLimit(&target.Integration).TypingDelay(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return evolutionSendResult(target, sent, quoted, mentionedJIDs), nil
+}
+
+func (evolutionChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	target, err := evolutionTargetFor(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	mentionedJIDs, err := resolveMentions(target, SendMessageOptions{Mentions: msg.Mentions, MentionAll: msg.MentionAll})
+	if err != nil {
+		return nil, err
+	}
+	quoted := evolutionQuotedFor(msg.ReplyTo)
+
+	// Converter URL de localhost para URL interna do Docker para Evolution API acessar
+	internalMediaURL := msg.MediaURL
+	if strings.Contains(msg.MediaURL, "localhost:4120") {
+		internalMediaURL = strings.Replace(msg.MediaURL, "localhost:4120", "mensager-go-api-1:4120", 1)
+		log.Printf("[SendMessage] Converted media URL for Evolution: %s -> %s", msg.MediaURL, internalMediaURL)
+	}
+
+	sent, err := target.Service.SendMediaMessage(SendMediaMessageInput{
+		InstanceName: target.InstanceName,
+		Number:       target.Number,
+		MediaType:    msg.ContentType,
+		MediaURL:     internalMediaURL,
+		Caption:      withMentionTokens(msg.Content, mentionedJIDs),
+		FileName:     msg.FileName,
+		Quoted:       quoted,
+		MentionedJID: mentionedJIDs,
+		MentionAll:   msg.MentionAll,
+		Delay:        loadSendRateLimit(&target.Integration).TypingDelay(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return evolutionSendResult(target, sent, quoted, mentionedJIDs), nil
+}
+
+// evolutionTargetFor monta o destino da Evolution API a partir da mensagem a enviar
+func evolutionTargetFor(msg *OutboundMessage) (*evolutionTarget, error) {
+	client, err := resolveEvolutionClient(msg.Inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	return &evolutionTarget{
+		Service:      client.Service,
+		InstanceName: client.InstanceName,
+		Number:       evolutionContactNumber(msg.Contact),
+		Conversation: *msg.Conversation,
+		Inbox:        msg.Inbox,
+		Integration:  client.Integration,
+	}, nil
+}
+
+// evolutionQuotedFor monta a citação de uma resposta; mensagens sem ID do WhatsApp são enviadas sem citação
+func evolutionQuotedFor(replyTo *models.Message) *EvolutionQuoted {
+	if replyTo == nil {
+		return nil
+	}
+	if replyTo.WhatsAppMessageID == nil || *replyTo.WhatsAppMessageID == "" {
+		log.Printf("[SendMessage] in_reply_to message %d has no WhatsApp ID, sending without quote", replyTo.ID)
+		return nil
+	}
+
+	quoted := &EvolutionQuoted{MessageID: *replyTo.WhatsAppMessageID}
+	if !replyTo.IsFromMe && replyTo.Participant != nil {
+		quoted.Participant = *replyTo.Participant
+	} else if !replyTo.IsFromMe && replyTo.RemoteJid != nil {
+		quoted.Participant = *replyTo.RemoteJid
+	}
+	return quoted
+}
+
+// evolutionSendResult converte a resposta da Evolution no resultado genérico do canal
+func evolutionSendResult(target *evolutionTarget, sent *models.Message, quoted *EvolutionQuoted, mentionedJIDs []string) *SendResult {
+	result := &SendResult{
+		ExternalID: sent.WhatsAppMessageID,
+		MediaURL:   sent.MediaURL,
+		FileName:   sent.FileName,
+		Mentions:   mentionedJIDs,
+		IsGroup:    strings.HasSuffix(target.Number, "@g.us"),
+	}
+	if quoted != nil {
+		result.QuotedID = &quoted.MessageID
+	}
+	return result
+}
+
+// evolutionContactNumber número de destino do contato (grupos são endereçados pelo JID)
+func evolutionContactNumber(contact *models.Contact) string {
+	phoneNumber := contact.PhoneNumber
+	if (phoneNumber == "" || strings.HasSuffix(contact.Identifier, "@g.us")) && contact.Identifier != "" {
+		phoneNumber = contact.Identifier
+	}
+	return formatWhatsAppNumber(phoneNumber)
+}
+
+// requireEvolutionInbox garante que a inbox é atendida pela Evolution (recursos exclusivos do WhatsApp via Evolution)
+func requireEvolutionInbox(inbox *models.Inbox) error {
+	channel, err := ChannelForInbox(inbox)
+	if err != nil {
+		return err
+	}
+	if _, ok := channel.(evolutionChannel); !ok {
+		return fmt.Errorf("evolution API is %w (inbox %d is %s)", ErrChannelUnsupported, inbox.ID, inbox.ChannelType)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package service
+
+import (
+	"log"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"strings"
+	"time"
+)
+
+// publishInboundMessage conclui o recebimento de uma mensagem já gravada por qualquer canal:
+// broadcast em tempo real, última atividade e unread_count da conversa
+func publishInboundMessage(conversation *models.Conversation, message *models.Message) {
+	// Broadcast em tempo real
+	NotifyNewMessage(message)
+
+	// Atualizar última atividade da conversa
+	now := time.Now()
+	conversation.LastActivityAt = &now
+
+	// Preparar campos a atualizar
+	updates := map[string]interface{}{
+		"last_activity_at": conversation.LastActivityAt,
+		"updated_at":       now,
+	}
+
+	// Se for mensagem incoming, incrementar unread_count
+	if message.MessageType == models.MessageTypeIncoming {
+		conversation.UnreadCount++
+		updates["unread_count"] = conversation.UnreadCount
+	}
+
+	// Atualizar explicitamente no banco usando Updates para garantir persistência
+	if err := db.Instance.Model(conversation).Updates(updates).Error; err != nil {
+		log.Printf("[publishInboundMessage] Error updating conversation: %v", err)
+	}
+
+	// Notificar atualização da conversa para atualizar lista em tempo real
+	NotifyConversationUpdated(conversation)
+}
+
+// mediaContentType tipo da mensagem a partir do MIME type de uma mídia recebida
+func mediaContentType(mimeType string) string {
+	switch {
+	case strings.HasPrefix(mimeType, "image/"):
+		return "image"
+	case strings.HasPrefix(mimeType, "video/"):
+		return "video"
+	case strings.HasPrefix(mimeType, "audio/"):
+		return "audio"
+	}
+	return "document"
+}
+
+// applyContactDetails completa nome, email e telefone informados pelo canal (sem sobrescrever edições dos agentes)
+func applyContactDetails(contact *models.Contact, name, email, phoneNumber string) {
+	changed := false
+	if name != "" && contact.Name != name && !contact.NameManuallySet {
+		contact.Name = name
+		changed = true
+	}
+	if email != "" && contact.Email == "" {
+		contact.Email = strings.ToLower(strings.TrimSpace(email))
+		changed = true
+	}
+	if phoneNumber != "" && contact.PhoneNumber == "" {
+		contact.PhoneNumber = phoneNumber
+		changed = true
+	}
+	if changed {
+		if err := repository.UpdateContact(contact); err != nil {
+			log.Printf("[applyContactDetails] Error updating contact %d: %v", contact.ID, err)
+		}
+	}
+}
@@ -0,0 +1,749 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Identificadores dos canais Messenger e Instagram (Messenger Platform da Meta) em webhooks e integrações
+const (
+	facebookProvider  = "facebook"
+	instagramProvider = "instagram"
+)
+
+// Janelas de atendimento da Messenger Platform: respostas livres até 24h após a última mensagem do contato;
+// com a tag HUMAN_AGENT (quando aprovada para o app) até 7 dias
+const (
+	metaMessagingWindow  = 24 * time.Hour
+	metaHumanAgentWindow = 7 * 24 * time.Hour
+)
+
+// ErrMessagingWindowClosed indica envio fora da janela de atendimento do canal
+var ErrMessagingWindowClosed = errors.New("messaging window is closed")
+
+// metaChannel canal Messenger (páginas do Facebook) ou Instagram Direct, ambos pela Messenger Platform
+type metaChannel struct {
+	provider string
+}
+
+func init() {
+	RegisterChannel(metaChannel{provider: facebookProvider}, facebookProvider, "messenger")
+	RegisterChannel(metaChannel{provider: instagramProvider}, instagramProvider)
+}
+
+func (c metaChannel) Provider() string {
+	return c.provider
+}
+
+func (metaChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:   true,
+		Replies: true,
+	}
+}
+
+// metaConfig configuração da página/conta, lida do config da integração da inbox
+type metaConfig struct {
+	PageID        string // ID da página (Messenger) ou da conta profissional (Instagram); padrão: "me"
+	AccessToken   string // Token de acesso da página
+	AppSecret     string // Assina os webhooks (X-Hub-Signature-256)
+	VerifyToken   string // Desafio de verificação da URL do webhook
+	GraphBaseURL  string
+	APIVersion    string
+	HumanAgentTag bool // Responder até 7 dias com a tag HUMAN_AGENT
+}
+
+// loadMetaConfig busca a integração da inbox (channel_id) e extrai a configuração da página
+func loadMetaConfig(inbox *models.Inbox, provider string) (*metaConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, provider)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &metaConfig{
+		PageID:        firstString(configMap, "page_id", "pageId", "instagram_id", "instagramId"),
+		AccessToken:   firstString(configMap, "page_access_token", "pageAccessToken", "access_token", "accessToken"),
+		AppSecret:     firstString(configMap, "app_secret", "appSecret"),
+		VerifyToken:   firstString(configMap, "verify_token", "verifyToken"),
+		GraphBaseURL:  firstString(configMap, "graph_base_url", "graphBaseUrl"),
+		APIVersion:    firstString(configMap, "api_version", "apiVersion"),
+		HumanAgentTag: configBool(configMap, false, "human_agent_tag", "humanAgentTag"),
+	}
+
+	// O token de verificação padrão é o segredo de webhook da inbox
+	if config.VerifyToken == "" {
+		config.VerifyToken = inboxWebhookSecret(configMap, inbox)
+	}
+	if config.GraphBaseURL == "" {
+		config.GraphBaseURL = os.Getenv("META_GRAPH_URL")
+	}
+	if config.GraphBaseURL == "" {
+		config.GraphBaseURL = defaultGraphBaseURL
+	}
+	config.GraphBaseURL = strings.TrimSuffix(config.GraphBaseURL, "/")
+	if config.APIVersion == "" {
+		config.APIVersion = defaultGraphAPIVersion
+	}
+
+	return config, nil
+}
+
+// VerifyChallenge responde ao desafio de verificação da Meta (hub.mode=subscribe, hub.verify_token, hub.challenge)
+func (c metaChannel) VerifyChallenge(inbox *models.Inbox, query url.Values) (string, error) {
+	config, err := loadMetaConfig(inbox, c.provider)
+	if err != nil {
+		return "", err
+	}
+	return verifyHubChallenge(config.VerifyToken, query)
+}
+
+// VerifyWebhook confere a assinatura X-Hub-Signature-256 (HMAC-SHA256 do corpo com o app secret)
+func (c metaChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	config, err := loadMetaConfig(inbox, c.provider)
+	if err != nil {
+		return err
+	}
+	return verifyHubSignature(config.AppSecret, req.Header.Get("X-Hub-Signature-256"), req.Body)
+}
+
+// metaWebhookPayload envelope dos webhooks da Messenger Platform (object "page" ou "instagram")
+type metaWebhookPayload struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID        string          `json:"id"` // Página ou conta do Instagram
+		Time      int64           `json:"time"`
+		Messaging []metaMessaging `json:"messaging"`
+	} `json:"entry"`
+}
+
+type metaMessaging struct {
+	Sender struct {
+		ID string `json:"id"` // PSID (Messenger) ou IGSID (Instagram)
+	} `json:"sender"`
+	Recipient struct {
+		ID string `json:"id"`
+	} `json:"recipient"`
+	Timestamp int64        `json:"timestamp"` // Milissegundos
+	Message   *metaMessage `json:"message"`
+	Postback  *struct {
+		MID     string `json:"mid"`
+		Title   string `json:"title"`
+		Payload string `json:"payload"`
+	} `json:"postback"`
+	Reaction *struct {
+		MID    string `json:"mid"`
+		Action string `json:"action"` // react, unreact
+		Emoji  string `json:"emoji"`
+	} `json:"reaction"`
+	Delivery *struct {
+		MIDs      []string `json:"mids"`
+		Watermark int64    `json:"watermark"`
+	} `json:"delivery"`
+	Read *struct {
+		MID       string `json:"mid"` // Instagram
+		Watermark int64  `json:"watermark"`
+	} `json:"read"`
+}
+
+type metaMessage struct {
+	MID           string `json:"mid"`
+	Text          string `json:"text"`
+	IsEcho        bool   `json:"is_echo"`
+	IsDeleted     bool   `json:"is_deleted"`
+	IsUnsupported bool   `json:"is_unsupported"`
+	ReplyTo       *struct {
+		MID   string `json:"mid"`
+		Story *struct {
+			ID  string `json:"id"`
+			URL string `json:"url"`
+		} `json:"story"`
+	} `json:"reply_to"`
+	Attachments []metaAttachment `json:"attachments"`
+}
+
+type metaAttachment struct {
+	Type    string `json:"type"` // image, video, audio, file, story_mention, share, ig_reel, reel, fallback...
+	Payload struct {
+		URL   string `json:"url"`
+		Title string `json:"title"`
+	} `json:"payload"`
+}
+
+// RoutingInfo usa o PSID/IGSID do contato como chave de ordenação (mensagens e confirmações do mesmo chat em ordem)
+func (metaChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var webhook metaWebhookPayload
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return "", ""
+	}
+
+	for _, entry := range webhook.Entry {
+		for _, event := range entry.Messaging {
+			return metaEventType(&event), fmt.Sprintf("%d:%s", inboxID, event.Sender.ID)
+		}
+	}
+	return webhook.Object, ""
+}
+
+// metaEventType nome do evento de um item de messaging (usado em webhook_logs.event)
+func metaEventType(event *metaMessaging) string {
+	switch {
+	case event.Message != nil:
+		return "message"
+	case event.Postback != nil:
+		return "postback"
+	case event.Reaction != nil:
+		return "reaction"
+	case event.Delivery != nil:
+		return "delivery"
+	case event.Read != nil:
+		return "read"
+	}
+	return "messaging"
+}
+
+// ProcessWebhook grava mensagens, reações e confirmações de entrega/leitura de um webhook da Messenger Platform.
+// Em caso de erro os demais itens do lote continuam; o primeiro erro é retornado para a fila tentar de novo.
+func (c metaChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	var webhook metaWebhookPayload
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return fmt.Errorf("failed to parse %s webhook: %w", c.provider, err)
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+	config, err := loadMetaConfig(inbox, c.provider)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, entry := range webhook.Entry {
+		if config.PageID != "" && entry.ID != "" && entry.ID != config.PageID {
+			log.Printf("[%s] Ignoring entry for %s (inbox %d uses %s)", c.logPrefix(), entry.ID, inboxID, config.PageID)
+			continue
+		}
+
+		for i := range entry.Messaging {
+			event := &entry.Messaging[i]
+			switch {
+			case event.Message != nil:
+				keep(c.saveMessage(inbox, config, event))
+			case event.Postback != nil:
+				keep(c.savePostback(inbox, config, event))
+			case event.Reaction != nil:
+				keep(c.applyReaction(inbox, event))
+			case event.Delivery != nil:
+				for _, mid := range event.Delivery.MIDs {
+					applyMetaStatus(inboxID, mid, models.MessageStatusDelivered, metaTimestamp(event.Delivery.Watermark))
+				}
+			case event.Read != nil:
+				keep(c.applyRead(inbox, event))
+			default:
+				log.Printf("[%s] Ignoring messaging event without known fields (inbox %d)", c.logPrefix(), inboxID)
+			}
+		}
+	}
+
+	return firstErr
+}
+
+func (c metaChannel) logPrefix() string {
+	if c.provider == instagramProvider {
+		return "Instagram"
+	}
+	return "Messenger"
+}
+
+// contactIdentifier Contact.Identifier de um PSID/IGSID (escopados por página/conta, prefixados pelo canal)
+func (c metaChannel) contactIdentifier(senderID string) string {
+	return c.provider + ":" + senderID
+}
+
+// findOrCreateContact busca o contato do PSID/IGSID; contatos novos recebem o nome do perfil (User Profile API)
+func (c metaChannel) findOrCreateContact(inbox *models.Inbox, config *metaConfig, senderID string) (*models.Contact, error) {
+	identifier := c.contactIdentifier(senderID)
+	contact, err := repository.FindOrCreateContactByIdentifier(uint(inbox.AccountID), identifier, "")
+	if err != nil {
+		return nil, fmt.Errorf("failed to find/create contact: %w", err)
+	}
+
+	if contact.Name == identifier {
+		name, err := newMetaClient(config).profileName(c.provider, senderID)
+		if err != nil {
+			log.Printf("[%s] Could not fetch profile of %s: %v", c.logPrefix(), senderID, err)
+		} else {
+			applyContactDetails(contact, name, "", "")
+		}
+	}
+	return contact, nil
+}
+
+// saveMessage cria contato, conversa e mensagem a partir de uma mensagem recebida
+func (c metaChannel) saveMessage(inbox *models.Inbox, config *metaConfig, event *metaMessaging) error {
+	msg := event.Message
+	if msg.MID == "" || event.Sender.ID == "" {
+		return fmt.Errorf("message without mid or sender")
+	}
+	inboxID := uint(inbox.ID)
+
+	// Eco das mensagens enviadas pela página (pelo NakaWoot ou por outro app)
+	if msg.IsEcho {
+		log.Printf("[%s] Ignoring echo %s (inbox %d)", c.logPrefix(), msg.MID, inboxID)
+		return nil
+	}
+	if msg.IsDeleted {
+		return RevokeMessage(inboxID, msg.MID, metaTimestamp(event.Timestamp))
+	}
+
+	// Verificar se a mensagem já foi processada (evitar duplicação)
+	if existing, err := repository.GetMessageByWhatsAppID(msg.MID); err == nil && existing != nil {
+		log.Printf("[%s] Message already exists with ID %s, skipping", c.logPrefix(), msg.MID)
+		return nil
+	}
+
+	contact, err := c.findOrCreateContact(inbox, config, event.Sender.ID)
+	if err != nil {
+		return err
+	}
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), inboxID, uint(contact.ID))
+	if err != nil {
+		return fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	identifier := contact.Identifier
+	timestamp := metaTimestamp(event.Timestamp)
+	message := &models.Message{
+		Content:           msg.Text,
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           inboxID,
+		ConversationID:    uint(conversation.ID),
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		SenderType:        "Contact",
+		SenderID:          contact.ID,
+		Status:            models.MessageStatusSent,
+		SourceID:          msg.MID,
+		WhatsAppMessageID: &msg.MID,
+		RemoteJid:         &identifier,
+		PushName:          &contact.Name,
+		Timestamp:         &timestamp,
+	}
+
+	if len(msg.Attachments) > 0 {
+		c.fillAttachment(message, &msg.Attachments[0])
+		if len(msg.Attachments) > 1 {
+			log.Printf("[%s] Message %s has %d attachments, only the first is stored", c.logPrefix(), msg.MID, len(msg.Attachments))
+		}
+	}
+	if msg.IsUnsupported && message.Content == "" {
+		message.Content = "[Mensagem não suportada]"
+	}
+
+	if msg.ReplyTo != nil {
+		// Resposta a um story do Instagram
+		if msg.ReplyTo.Story != nil {
+			message.ContentAttributes.Story = &models.StoryAttributes{ID: msg.ReplyTo.Story.ID, URL: msg.ReplyTo.Story.URL}
+		}
+		// Mensagem citada - resolver para o ID interno quando já estiver armazenada
+		if msg.ReplyTo.MID != "" {
+			quotedID := msg.ReplyTo.MID
+			message.QuotedMessageID = &quotedID
+			message.InReplyTo = resolveInReplyTo(quotedID, uint(conversation.ID))
+		}
+	}
+
+	metadataJSON, _ := json.Marshal(map[string]interface{}{
+		"provider":  c.provider,
+		"sender_id": event.Sender.ID,
+		"page_id":   event.Recipient.ID,
+	})
+	message.Metadata = metadataJSON
+
+	if err := repository.UpsertMessage(message); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	publishInboundMessage(conversation, message)
+	return nil
+}
+
+// fillAttachment baixa o anexo (URL do CDN da Meta, expira) e preenche os campos de mídia da mensagem
+func (c metaChannel) fillAttachment(message *models.Message, attachment *metaAttachment) {
+	switch attachment.Type {
+	case "story_mention":
+		message.ContentAttributes.Story = &models.StoryAttributes{URL: attachment.Payload.URL, Mention: true}
+		if message.Content == "" {
+			message.Content = "[Menção em story]"
+		}
+	case "share", "ig_reel", "reel", "fallback", "template":
+		// Links e publicações compartilhadas: guardar a URL no texto
+		message.Content = strings.TrimSpace(strings.Join([]string{message.Content, attachment.Payload.Title, attachment.Payload.URL}, "\n"))
+		return
+	}
+
+	if attachment.Payload.URL == "" {
+		return
+	}
+	mediaURL, mimeType, size, err := storeMetaAttachment(attachment.Payload.URL, message.SourceID)
+	if err != nil {
+		log.Printf("[%s] Failed to store %s attachment of %s: %v", c.logPrefix(), attachment.Type, message.SourceID, err)
+		if message.Content == "" {
+			message.Content = attachment.Payload.URL
+		}
+		return
+	}
+
+	message.ContentType = mediaContentType(mimeType)
+	message.MediaURL = &mediaURL
+	message.MimeType = &mimeType
+	message.FileSize = &size
+	if message.ContentType == "document" {
+		fileName := mediaFileName(attachment.Payload.URL)
+		message.FileName = &fileName
+	}
+	if message.Content == "" && message.ContentType == "audio" {
+		message.Content = "[Áudio]"
+	}
+}
+
+// storeMetaAttachment baixa um anexo recebido e o grava no storage
+func storeMetaAttachment(attachmentURL, messageID string) (string, string, int64, error) {
+	if GlobalMediaStorage == nil {
+		return "", "", 0, fmt.Errorf("media storage not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	data, mimeType, err := GlobalMediaStorage.Download(ctx, attachmentURL)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to download attachment: %w", err)
+	}
+	if mimeType == "" || baseMimeType(mimeType) == "application/octet-stream" {
+		mimeType = DetectMimeType(data)
+	}
+
+	// mids podem conter caracteres inválidos em nomes de arquivo
+	fileName := strings.NewReplacer("/", "_", "+", "-", "=", "").Replace(messageID) + GetExtensionFromMimeType(baseMimeType(mimeType))
+	storedURL, err := GlobalMediaStorage.Store(ctx, data, fileName, mimeType)
+	if err != nil {
+		return "", "", 0, fmt.Errorf("failed to store attachment: %w", err)
+	}
+	return storedURL, mimeType, int64(len(data)), nil
+}
+
+// savePostback grava o clique em um botão (postback) como mensagem de texto do contato
+func (c metaChannel) savePostback(inbox *models.Inbox, config *metaConfig, event *metaMessaging) error {
+	mid := event.Postback.MID
+	if mid == "" {
+		mid = fmt.Sprintf("%s:postback:%s:%d", c.provider, event.Sender.ID, event.Timestamp)
+	}
+	return c.saveMessage(inbox, config, &metaMessaging{
+		Sender:    event.Sender,
+		Recipient: event.Recipient,
+		Timestamp: event.Timestamp,
+		Message:   &metaMessage{MID: mid, Text: firstNonEmpty(event.Postback.Title, event.Postback.Payload)},
+	})
+}
+
+// applyReaction registra a reação do contato a uma mensagem (unreact remove)
+func (c metaChannel) applyReaction(inbox *models.Inbox, event *metaMessaging) error {
+	message, err := getInboxMessageByWhatsAppID(uint(inbox.ID), event.Reaction.MID)
+	if err != nil {
+		log.Printf("[%s] Ignoring reaction to unknown message: %v", c.logPrefix(), err)
+		return nil
+	}
+
+	contact, err := repository.GetContactByIdentifier(c.contactIdentifier(event.Sender.ID), uint(inbox.AccountID))
+	if err != nil {
+		return fmt.Errorf("reactor contact not found: %w", err)
+	}
+
+	emoji := event.Reaction.Emoji
+	if event.Reaction.Action == "unreact" {
+		emoji = ""
+	}
+	_, err = applyReaction(message, models.ReactorTypeContact, contact.ID, emoji, nil, metaTimestamp(event.Timestamp))
+	return err
+}
+
+// applyRead marca como lidas as mensagens enviadas: pelo mid (Instagram) ou até o watermark (Messenger)
+func (c metaChannel) applyRead(inbox *models.Inbox, event *metaMessaging) error {
+	inboxID := uint(inbox.ID)
+	if event.Read.MID != "" {
+		applyMetaStatus(inboxID, event.Read.MID, models.MessageStatusRead, metaTimestamp(event.Timestamp))
+		return nil
+	}
+
+	contact, err := repository.GetContactByIdentifier(c.contactIdentifier(event.Sender.ID), uint(inbox.AccountID))
+	if err != nil {
+		return nil
+	}
+	conversation, err := repository.FindLatestConversation(inboxID, contact.ID)
+	if err != nil {
+		return nil
+	}
+
+	watermark := metaTimestamp(event.Read.Watermark)
+	messages, err := repository.ListUnreadOutgoingMessages(uint(conversation.ID), watermark)
+	if err != nil {
+		return fmt.Errorf("failed to list unread messages: %w", err)
+	}
+	for _, message := range messages {
+		applyMetaStatus(inboxID, *message.WhatsAppMessageID, models.MessageStatusRead, watermark)
+	}
+	return nil
+}
+
+// applyMetaStatus aplica uma confirmação de entrega/leitura a uma mensagem enviada
+func applyMetaStatus(inboxID uint, mid, status string, at time.Time) {
+	message, err := ApplyMessageStatus(inboxID, mid, status, at)
+	if err != nil {
+		// Confirmações de mensagens enviadas fora do NakaWoot
+		log.Printf("[Meta] Could not apply status %s to %s: %v", status, mid, err)
+		return
+	}
+	if message != nil {
+		DispatchMessageUpdated(message)
+	}
+}
+
+// metaTimestamp converte o timestamp em milissegundos da Messenger Platform
+func metaTimestamp(ms int64) time.Time {
+	if ms <= 0 {
+		return time.Now()
+	}
+	return time.UnixMilli(ms)
+}
+
+func (c metaChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	return c.send(msg, map[string]interface{}{"text": msg.Content})
+}
+
+// SendMedia envia o anexo pela URL; a Send API não aceita legenda, então o texto segue em uma segunda mensagem
+func (c metaChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	attachmentType := msg.ContentType
+	switch attachmentType {
+	case "image", "video", "audio":
+	case "document":
+		attachmentType = "file"
+	default:
+		return nil, fmt.Errorf("media type %s is %w", msg.ContentType, ErrChannelUnsupported)
+	}
+
+	result, err := c.send(msg, map[string]interface{}{
+		"attachment": map[string]interface{}{
+			"type":    attachmentType,
+			"payload": map[string]interface{}{"url": msg.MediaURL, "is_reusable": true},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if msg.ContentType == "document" {
+		fileName := firstNonEmpty(msg.FileName, mediaFileName(msg.MediaURL))
+		result.FileName = &fileName
+	}
+
+	if msg.Content != "" {
+		caption := *msg
+		caption.ReplyTo = nil
+		if _, err := c.send(&caption, map[string]interface{}{"text": msg.Content}); err != nil {
+			log.Printf("[%s] Attachment sent but caption failed: %v", c.logPrefix(), err)
+		}
+	}
+	return result, nil
+}
+
+// send confere a janela de atendimento, completa destinatário e citação e envia pela Send API
+func (c metaChannel) send(msg *OutboundMessage, message map[string]interface{}) (*SendResult, error) {
+	config, err := loadMetaConfig(msg.Inbox, c.provider)
+	if err != nil {
+		return nil, err
+	}
+
+	recipientID, ok := strings.CutPrefix(msg.Contact.Identifier, c.provider+":")
+	if !ok || recipientID == "" {
+		return nil, fmt.Errorf("contact %d has no %s id", msg.Contact.ID, c.provider)
+	}
+
+	payload := map[string]interface{}{
+		"recipient": map[string]string{"id": recipientID},
+		"message":   message,
+	}
+	if err := applyMetaMessagingWindow(msg, config, payload); err != nil {
+		return nil, err
+	}
+
+	result := &SendResult{}
+	if msg.ReplyTo != nil && msg.ReplyTo.WhatsAppMessageID != nil {
+		message["reply_to"] = map[string]string{"mid": *msg.ReplyTo.WhatsAppMessageID}
+		result.QuotedID = msg.ReplyTo.WhatsAppMessageID
+	}
+
+	result.ExternalID, err = newMetaClient(config).sendMessage(payload)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// applyMetaMessagingWindow define o messaging_type conforme a última mensagem do contato:
+// RESPONSE dentro de 24h, tag HUMAN_AGENT até 7 dias (se habilitada) e erro fora da janela
+func applyMetaMessagingWindow(msg *OutboundMessage, config *metaConfig, payload map[string]interface{}) error {
+	last, err := repository.GetLatestIncomingMessage(uint(msg.Inbox.ID), msg.Contact.ID)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return fmt.Errorf("%w: contact has never sent a message", ErrMessagingWindowClosed)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to load last customer message: %w", err)
+	}
+
+	lastAt := last.CreatedAt
+	if last.Timestamp != nil {
+		lastAt = *last.Timestamp
+	}
+
+	messagingType, tag, err := metaMessagingType(lastAt, time.Now(), config.HumanAgentTag)
+	if err != nil {
+		return err
+	}
+	payload["messaging_type"] = messagingType
+	if tag != "" {
+		payload["tag"] = tag
+	}
+	return nil
+}
+
+// metaMessagingType messaging_type (e tag) de uma resposta ao contato cuja última mensagem foi em lastAt
+func metaMessagingType(lastAt, now time.Time, humanAgentTag bool) (string, string, error) {
+	elapsed := now.Sub(lastAt)
+	switch {
+	case elapsed <= metaMessagingWindow:
+		return "RESPONSE", "", nil
+	case humanAgentTag && elapsed <= metaHumanAgentWindow:
+		return "MESSAGE_TAG", "HUMAN_AGENT", nil
+	}
+	return "", "", fmt.Errorf("%w: last customer message was at %s", ErrMessagingWindowClosed, lastAt.Format(time.RFC3339))
+}
+
+// metaClient cliente HTTP da Graph API para uma página/conta
+type metaClient struct {
+	config     *metaConfig
+	httpClient *http.Client
+}
+
+func newMetaClient(config *metaConfig) *metaClient {
+	return &metaClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// sendMessage envia para /{page_id}/messages e retorna o mid da mensagem criada
+func (c *metaClient) sendMessage(payload map[string]interface{}) (*string, error) {
+	if c.config.AccessToken == "" {
+		return nil, fmt.Errorf("meta integration requires page_access_token")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	pageID := firstNonEmpty(c.config.PageID, "me")
+	endpoint := fmt.Sprintf("%s/%s/%s/messages", c.config.GraphBaseURL, c.config.APIVersion, pageID)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	respBody, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		RecipientID string `json:"recipient_id"`
+		MessageID   string `json:"message_id"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if response.MessageID == "" {
+		return nil, fmt.Errorf("send API response without message_id")
+	}
+	return &response.MessageID, nil
+}
+
+// profileName busca o nome do contato (User Profile API do Messenger ou perfil do usuário do Instagram)
+func (c *metaClient) profileName(provider, userID string) (string, error) {
+	fields := "first_name,last_name,name"
+	if provider == instagramProvider {
+		fields = "name,username"
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/%s?fields=%s", c.config.GraphBaseURL, c.config.APIVersion, url.PathEscape(userID), fields)
+	req, err := http.NewRequest("GET", endpoint, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	respBody, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var profile struct {
+		Name      string `json:"name"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Username  string `json:"username"`
+	}
+	if err := json.Unmarshal(respBody, &profile); err != nil {
+		return "", fmt.Errorf("failed to parse profile: %w", err)
+	}
+	return firstNonEmpty(profile.Name, strings.TrimSpace(profile.FirstName+" "+profile.LastName), profile.Username), nil
+}
+
+// do executa a requisição autenticada e retorna o corpo; erros da Graph API incluem a mensagem retornada
+func (c *metaClient) do(req *http.Request) ([]byte, error) {
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := readLimited(resp.Body, maxProviderResponseSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, newProviderError("graph", resp, respBody)
+	}
+	return respBody, nil
+}
@@ -0,0 +1,290 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+
+	"gorm.io/gorm"
+)
+
+func TestMetaMessagingType(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name       string
+		elapsed    time.Duration
+		humanAgent bool
+		wantType   string
+		wantTag    string
+		wantClosed bool
+	}{
+		{"within 24h", 23 * time.Hour, false, "RESPONSE", "", false},
+		{"at 24h", metaMessagingWindow, false, "RESPONSE", "", false},
+		{"after 24h without tag", 25 * time.Hour, false, "", "", true},
+		{"after 24h with tag", 25 * time.Hour, true, "MESSAGE_TAG", "HUMAN_AGENT", false},
+		{"at 7 days with tag", metaHumanAgentWindow, true, "MESSAGE_TAG", "HUMAN_AGENT", false},
+		{"after 7 days with tag", metaHumanAgentWindow + time.Minute, true, "", "", true},
+	}
+	for _, tt := range tests {
+		messagingType, tag, err := metaMessagingType(now.Add(-tt.elapsed), now, tt.humanAgent)
+		if tt.wantClosed {
+			if !errors.Is(err, ErrMessagingWindowClosed) {
+				t.Errorf("%s: err = %v, want ErrMessagingWindowClosed", tt.name, err)
+			}
+			continue
+		}
+		if err != nil || messagingType != tt.wantType || tag != tt.wantTag {
+			t.Errorf("%s: got %q, %q, %v; want %q, %q", tt.name, messagingType, tag, err, tt.wantType, tt.wantTag)
+		}
+	}
+}
+
+func TestApplyMetaMessagingWindowDatabaseError(t *testing.T) {
+	useUnreachableDB(t)
+
+	msg := &OutboundMessage{Inbox: &models.Inbox{ID: 1}, Contact: &models.Contact{ID: 1}}
+	err := applyMetaMessagingWindow(msg, &metaConfig{}, map[string]interface{}{})
+	if err == nil || errors.Is(err, ErrMessagingWindowClosed) {
+		t.Errorf("err = %v, want the database error (not ErrMessagingWindowClosed)", err)
+	}
+}
+
+// fakeMetaGraph servidor da Graph API da Messenger Platform: perfis, Send API e CDN de anexos
+type fakeMetaGraph struct {
+	*httptest.Server
+	mu   sync.Mutex
+	sent []map[string]interface{}
+}
+
+func newFakeMetaGraph(t *testing.T) *fakeMetaGraph {
+	t.Helper()
+	graph := &fakeMetaGraph{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v20.0/PAGE_ID/messages", func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		graph.mu.Lock()
+		graph.sent = append(graph.sent, payload)
+		n := len(graph.sent)
+		graph.mu.Unlock()
+		fmt.Fprintf(w, `{"recipient_id":"PSID1","message_id":"m_SENT%d"}`, n)
+	})
+	mux.HandleFunc("/v20.0/PSID1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"first_name":"Ana","last_name":"Souza"}`)
+	})
+	mux.HandleFunc("/v20.0/IGSID1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"username":"ana.ig"}`)
+	})
+	mux.HandleFunc("/cdn/story.jpg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/jpeg")
+		fmt.Fprint(w, "\xff\xd8\xff\xe0story")
+	})
+	graph.Server = httptest.NewServer(mux)
+	t.Cleanup(graph.Close)
+	return graph
+}
+
+func createMetaInbox(t *testing.T, conn *gorm.DB, provider string, graph *fakeMetaGraph, extra map[string]interface{}) *models.Inbox {
+	t.Helper()
+	config := map[string]interface{}{
+		"page_id":           "PAGE_ID",
+		"page_access_token": "token",
+		"app_secret":        "app-secret",
+		"verify_token":      "verify-me",
+		"graph_base_url":    graph.URL,
+		"api_version":       "v20.0",
+	}
+	for key, value := range extra {
+		config[key] = value
+	}
+	return createChannelInbox(t, conn, provider, provider, config)
+}
+
+func TestMetaVerifyWebhook(t *testing.T) {
+	conn := dbtest.Open(t)
+	graph := newFakeMetaGraph(t)
+	inbox := createMetaInbox(t, conn, facebookProvider, graph, nil)
+	channel := metaChannel{provider: facebookProvider}
+
+	body := []byte(`{"object":"page","entry":[]}`)
+	req := &InboundRequest{Header: http.Header{"X-Hub-Signature-256": {hubSignature("app-secret", body)}}, Body: body}
+	if err := channel.VerifyWebhook(inbox, req); err != nil {
+		t.Errorf("valid signature: %v", err)
+	}
+	req.Header.Set("X-Hub-Signature-256", hubSignature("other-secret", body))
+	if err := channel.VerifyWebhook(inbox, req); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("wrong secret: err = %v, want ErrInvalidSignature", err)
+	}
+
+	query := url.Values{"hub.mode": {"subscribe"}, "hub.verify_token": {"verify-me"}, "hub.challenge": {"42"}}
+	if challenge, err := channel.VerifyChallenge(inbox, query); err != nil || challenge != "42" {
+		t.Errorf("VerifyChallenge = %q, %v; want 42", challenge, err)
+	}
+	query.Set("hub.verify_token", "wrong")
+	if _, err := channel.VerifyChallenge(inbox, query); !errors.Is(err, ErrWebhookUnauthorized) {
+		t.Errorf("wrong verify token: err = %v, want ErrWebhookUnauthorized", err)
+	}
+}
+
+func TestMetaProcessWebhookMapsSendersToContacts(t *testing.T) {
+	conn := dbtest.Open(t)
+	graph := newFakeMetaGraph(t)
+	inbox := createMetaInbox(t, conn, facebookProvider, graph, nil)
+	channel := metaChannel{provider: facebookProvider}
+
+	webhook := `{"object":"page","entry":[
+		{"id":"PAGE_ID","time":1700000000000,"messaging":[
+			{"sender":{"id":"PSID1"},"recipient":{"id":"PAGE_ID"},"timestamp":1700000000000,"message":{"mid":"m_1","text":"oi"}},
+			{"sender":{"id":"PSID1"},"recipient":{"id":"PAGE_ID"},"timestamp":1700000001000,"message":{"mid":"m_2","text":"tudo bem?"}}
+		]},
+		{"id":"OTHER_PAGE","time":1700000000000,"messaging":[
+			{"sender":{"id":"PSID2"},"recipient":{"id":"OTHER_PAGE"},"timestamp":1700000000000,"message":{"mid":"m_3","text":"outra página"}}
+		]}
+	]}`
+	if err := channel.ProcessWebhook(uint(inbox.ID), []byte(webhook)); err != nil {
+		t.Fatalf("ProcessWebhook: %v", err)
+	}
+
+	messages := inboxMessages(t, conn, inbox.ID)
+	if len(messages) != 2 {
+		t.Fatalf("stored %d messages, want 2 (entry of another page ignored)", len(messages))
+	}
+	if messages[0].SenderID != messages[1].SenderID || messages[0].ConversationID != messages[1].ConversationID {
+		t.Errorf("messages of the same PSID in different contacts or conversations: %+v", messages)
+	}
+
+	contact, err := repository.GetContactByIdentifier("facebook:PSID1", uint(inbox.AccountID))
+	if err != nil {
+		t.Fatalf("contact facebook:PSID1: %v", err)
+	}
+	if contact.ID != messages[0].SenderID || contact.Name != "Ana Souza" {
+		t.Errorf("contact = %d %q, want sender %d named Ana Souza", contact.ID, contact.Name, messages[0].SenderID)
+	}
+}
+
+func TestMetaProcessWebhookStoryReplies(t *testing.T) {
+	conn := dbtest.Open(t)
+	graph := newFakeMetaGraph(t)
+	useMemoryMediaStorage(t)
+	inbox := createMetaInbox(t, conn, instagramProvider, graph, nil)
+	channel := metaChannel{provider: instagramProvider}
+
+	webhook := fmt.Sprintf(`{"object":"instagram","entry":[{"id":"PAGE_ID","time":1700000000000,"messaging":[
+		{"sender":{"id":"IGSID1"},"recipient":{"id":"PAGE_ID"},"timestamp":1700000000000,
+		 "message":{"mid":"ig_1","text":"que lindo!","reply_to":{"story":{"id":"STORY_1","url":"%[1]s/cdn/story.jpg"}}}},
+		{"sender":{"id":"IGSID1"},"recipient":{"id":"PAGE_ID"},"timestamp":1700000001000,
+		 "message":{"mid":"ig_2","attachments":[{"type":"story_mention","payload":{"url":"%[1]s/cdn/story.jpg"}}]}}
+	]}]}`, graph.URL)
+	if err := channel.ProcessWebhook(uint(inbox.ID), []byte(webhook)); err != nil {
+		t.Fatalf("ProcessWebhook: %v", err)
+	}
+
+	messages := inboxMessages(t, conn, inbox.ID)
+	if len(messages) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(messages))
+	}
+
+	reply := messages[0]
+	if reply.Content != "que lindo!" || reply.ContentAttributes.Story == nil || reply.ContentAttributes.Story.ID != "STORY_1" || reply.ContentAttributes.Story.Mention {
+		t.Errorf("story reply = %q %+v", reply.Content, reply.ContentAttributes.Story)
+	}
+
+	mention := messages[1]
+	if mention.ContentAttributes.Story == nil || !mention.ContentAttributes.Story.Mention || mention.Content != "[Menção em story]" {
+		t.Errorf("story mention = %q %+v", mention.Content, mention.ContentAttributes.Story)
+	}
+	if mention.ContentType != "image" || mention.MediaURL == nil || !strings.HasPrefix(*mention.MediaURL, "memory://") {
+		t.Errorf("story mention media = %s %v", mention.ContentType, mention.MediaURL)
+	}
+
+	contact, err := repository.GetContactByIdentifier("instagram:IGSID1", uint(inbox.AccountID))
+	if err != nil || contact.Name != "ana.ig" {
+		t.Errorf("contact instagram:IGSID1 = %+v, %v", contact, err)
+	}
+}
+
+func TestMetaSendMessagingWindow(t *testing.T) {
+	conn := dbtest.Open(t)
+	graph := newFakeMetaGraph(t)
+	inbox := createMetaInbox(t, conn, facebookProvider, graph, map[string]interface{}{"human_agent_tag": true})
+	channel := metaChannel{provider: facebookProvider}
+
+	contact := models.Contact{AccountID: uint(inbox.AccountID), Name: "Ana", Identifier: "facebook:PSID1"}
+	if err := conn.Create(&contact).Error; err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	msg := &OutboundMessage{Inbox: inbox, Contact: &contact, Content: "olá"}
+
+	// Contato que nunca escreveu: janela fechada, nada é enviado
+	if _, err := channel.SendText(msg); !errors.Is(err, ErrMessagingWindowClosed) {
+		t.Fatalf("no incoming message: err = %v, want ErrMessagingWindowClosed", err)
+	}
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), contact.ID)
+	if err != nil {
+		t.Fatalf("FindOrCreateConversation: %v", err)
+	}
+	lastAt := time.Now().Add(-time.Hour)
+	incoming := models.Message{AccountID: uint(inbox.AccountID), InboxID: uint(inbox.ID), ConversationID: uint(conversation.ID),
+		Content: "oi", MessageType: models.MessageTypeIncoming, SenderType: "Contact", SenderID: contact.ID,
+		Status: models.MessageStatusSent, Timestamp: &lastAt}
+	if err := conn.Omit("Conversation", "Inbox", "Account", "Reactions").Create(&incoming).Error; err != nil {
+		t.Fatalf("create incoming message: %v", err)
+	}
+
+	steps := []struct {
+		elapsed  time.Duration
+		wantType string
+		wantTag  string
+	}{
+		{time.Hour, "RESPONSE", ""},
+		{3 * 24 * time.Hour, "MESSAGE_TAG", "HUMAN_AGENT"},
+		{8 * 24 * time.Hour, "", ""},
+	}
+	for i, step := range steps {
+		at := time.Now().Add(-step.elapsed)
+		if err := conn.Model(&models.Message{}).Where("id = ?", incoming.ID).Update("timestamp", at).Error; err != nil {
+			t.Fatalf("update timestamp: %v", err)
+		}
+
+		result, err := channel.SendText(msg)
+		if step.wantType == "" {
+			if !errors.Is(err, ErrMessagingWindowClosed) {
+				t.Errorf("%s after the last message: err = %v, want ErrMessagingWindowClosed", step.elapsed, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s after the last message: SendText: %v", step.elapsed, err)
+		}
+		if result.ExternalID == nil || *result.ExternalID != fmt.Sprintf("m_SENT%d", i+1) {
+			t.Errorf("ExternalID = %v", result.ExternalID)
+		}
+
+		graph.mu.Lock()
+		sent := graph.sent[len(graph.sent)-1]
+		graph.mu.Unlock()
+		recipient, _ := sent["recipient"].(map[string]interface{})
+		tag, _ := sent["tag"].(string)
+		if sent["messaging_type"] != step.wantType || tag != step.wantTag || recipient["id"] != "PSID1" {
+			t.Errorf("%s after the last message: graph received %v", step.elapsed, sent)
+		}
+	}
+
+	graph.mu.Lock()
+	defer graph.mu.Unlock()
+	if len(graph.sent) != 2 {
+		t.Errorf("graph received %d messages, want 2", len(graph.sent))
+	}
+}
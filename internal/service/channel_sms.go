@@ -0,0 +1,536 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// smsProvider identificador do canal SMS (API compatível com o Twilio) em webhooks e integrações
+const smsProvider = "sms"
+
+// defaultTwilioAPIURL endereço da REST API; api_base_url permite usar provedores compatíveis ou um servidor local em testes
+const defaultTwilioAPIURL = "https://api.twilio.com"
+
+// smsChannel canal SMS/MMS por uma API compatível com o Twilio
+type smsChannel struct{}
+
+func init() {
+	RegisterChannel(smsChannel{}, smsProvider, "twilio_sms")
+}
+
+func (smsChannel) Provider() string {
+	return smsProvider
+}
+
+func (smsChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media: true,
+	}
+}
+
+// smsConfig configuração da conta/número, lida do config da integração da inbox
+type smsConfig struct {
+	AccountSID          string
+	AuthToken           string // Autentica a REST API e assina os webhooks (X-Twilio-Signature)
+	PhoneNumber         string // Remetente (From) em E.164
+	MessagingServiceSID string // Alternativa ao PhoneNumber
+	APIBaseURL          string
+	WebhookSecret       string // Segredo de webhook da inbox (usado na URL de status callback)
+}
+
+// loadSMSConfig busca a integração da inbox (channel_id) e extrai a configuração da conta
+func loadSMSConfig(inbox *models.Inbox) (*smsConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, smsProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &smsConfig{
+		AccountSID:          firstString(configMap, "account_sid", "accountSid"),
+		AuthToken:           firstString(configMap, "auth_token", "authToken"),
+		PhoneNumber:         firstString(configMap, "phone_number", "phoneNumber", "from"),
+		MessagingServiceSID: firstString(configMap, "messaging_service_sid", "messagingServiceSid"),
+		APIBaseURL:          firstString(configMap, "api_base_url", "apiBaseUrl"),
+		WebhookSecret:       inboxWebhookSecret(configMap, inbox),
+	}
+	if config.APIBaseURL == "" {
+		config.APIBaseURL = os.Getenv("TWILIO_API_URL")
+	}
+	if config.APIBaseURL == "" {
+		config.APIBaseURL = defaultTwilioAPIURL
+	}
+	config.APIBaseURL = strings.TrimSuffix(config.APIBaseURL, "/")
+
+	return config, nil
+}
+
+// VerifyWebhook confere o X-Twilio-Signature: base64(HMAC-SHA1(auth_token, URL + parâmetros ordenados)).
+// A URL assinada é a configurada no provedor; atrás de proxy ela é remontada com SERVER_URL.
+func (smsChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	config, err := loadSMSConfig(inbox)
+	if err != nil {
+		return err
+	}
+	if config.AuthToken == "" {
+		return fmt.Errorf("%w: auth token not configured", ErrInvalidSignature)
+	}
+
+	signature := req.Header.Get("X-Twilio-Signature")
+	if signature == "" {
+		return ErrInvalidSignature
+	}
+	params, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return fmt.Errorf("invalid form body: %w", err)
+	}
+
+	candidates := []string{req.URL}
+	if serverURL := os.Getenv("SERVER_URL"); serverURL != "" {
+		if parsed, err := url.Parse(req.URL); err == nil {
+			candidates = append(candidates, strings.TrimSuffix(serverURL, "/")+parsed.RequestURI())
+		}
+	}
+	for _, candidate := range candidates {
+		if secureEqual(signature, twilioSignature(config.AuthToken, candidate, params)) {
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// twilioSignature assinatura de uma requisição no formato do Twilio
+func twilioSignature(authToken, requestURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var data strings.Builder
+	data.WriteString(requestURL)
+	for _, key := range keys {
+		for _, value := range params[key] {
+			data.WriteString(key)
+			data.WriteString(value)
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data.String()))
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DecodeWebhook converte o formulário do webhook em um objeto JSON (um valor por campo), formato gravado na fila
+func (smsChannel) DecodeWebhook(req *InboundRequest) ([]byte, error) {
+	params, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return nil, fmt.Errorf("invalid form body: %w", err)
+	}
+
+	fields := make(map[string]string, len(params))
+	for key := range params {
+		fields[key] = params.Get(key)
+	}
+	return json.Marshal(fields)
+}
+
+// WebhookAck responde com TwiML vazio: nenhuma resposta automática ao contato
+func (smsChannel) WebhookAck() (string, []byte) {
+	return "text/xml", []byte("<Response></Response>")
+}
+
+// smsWebhook campos dos webhooks de mensagem recebida e de status callback
+type smsWebhook struct {
+	MessageSID    string `json:"MessageSid"`
+	SmsSID        string `json:"SmsSid"`
+	AccountSID    string `json:"AccountSid"`
+	From          string `json:"From"`
+	To            string `json:"To"`
+	Body          string `json:"Body"`
+	NumMedia      string `json:"NumMedia"`
+	MessageStatus string `json:"MessageStatus"` // Status callback: queued, sent, delivered, undelivered, failed, read
+	SmsStatus     string `json:"SmsStatus"`     // Mensagem recebida: received
+	ErrorCode     string `json:"ErrorCode"`
+	ErrorMessage  string `json:"ErrorMessage"`
+	ProfileName   string `json:"ProfileName"`
+}
+
+func (w *smsWebhook) sid() string {
+	return firstNonEmpty(w.MessageSID, w.SmsSID)
+}
+
+// isInbound diferencia a mensagem recebida do status callback de uma mensagem enviada
+func (w *smsWebhook) isInbound() bool {
+	status := firstNonEmpty(w.MessageStatus, w.SmsStatus)
+	return status == "" || status == "received"
+}
+
+// RoutingInfo usa o número do contato como chave de ordenação (mensagens e status do mesmo número em ordem)
+func (smsChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var webhook smsWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return "", ""
+	}
+	if webhook.isInbound() {
+		return "message", fmt.Sprintf("%d:%s", inboxID, webhook.From)
+	}
+	return "status", fmt.Sprintf("%d:%s", inboxID, webhook.To)
+}
+
+// ProcessWebhook grava a mensagem recebida ou aplica o status callback de uma mensagem enviada
+func (smsChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	var webhook smsWebhook
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return fmt.Errorf("failed to parse sms webhook: %w", err)
+	}
+
+	if !webhook.isInbound() {
+		return applySMSStatus(inboxID, &webhook, payload)
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+	config, err := loadSMSConfig(inbox)
+	if err != nil {
+		return err
+	}
+	return saveSMSMessage(inbox, config, &webhook, payload)
+}
+
+// saveSMSMessage cria contato (pelo telefone), conversa e mensagens a partir de um SMS/MMS recebido.
+// O texto e a primeira mídia ficam na mensagem do SID; cada mídia seguinte (MediaUrl1..N) vira
+// uma mensagem própria, deduplicada pelo seu ID (smsMediaRef).
+func saveSMSMessage(inbox *models.Inbox, config *smsConfig, webhook *smsWebhook, payload []byte) error {
+	sid := webhook.sid()
+	phoneNumber := smsDigits(webhook.From)
+	if sid == "" || phoneNumber == "" {
+		return fmt.Errorf("message without sid or sender")
+	}
+	inboxID := uint(inbox.ID)
+
+	var fields map[string]string
+	_ = json.Unmarshal(payload, &fields)
+	numMedia, _ := strconv.Atoi(webhook.NumMedia)
+
+	refs := []string{sid}
+	for i := 1; i < numMedia; i++ {
+		refs = append(refs, smsMediaRef(sid, i))
+	}
+	existing, err := repository.ListMessagesByWhatsAppIDs(refs)
+	if err != nil {
+		return fmt.Errorf("failed to check existing messages: %w", err)
+	}
+	saved := make(map[string]*models.Message, len(existing))
+	for i := range existing {
+		if existing[i].WhatsAppMessageID != nil {
+			saved[*existing[i].WhatsAppMessageID] = &existing[i]
+		}
+	}
+	if len(saved) == len(refs) {
+		log.Printf("[SMS] Message already exists with SID %s, skipping", sid)
+		return nil
+	}
+
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), phoneNumber, "")
+	if err != nil {
+		return fmt.Errorf("failed to find/create contact: %w", err)
+	}
+	applyContactDetails(contact, webhook.ProfileName, "", "")
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), inboxID, uint(contact.ID))
+	if err != nil {
+		return fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+	// Retry parcial: continuar na conversa em que o MMS começou a ser gravado
+	for _, ref := range refs {
+		if message := saved[ref]; message != nil {
+			if previous, err := repository.GetConversationByID(message.ConversationID); err == nil {
+				conversation = previous
+			}
+			break
+		}
+	}
+
+	metadataJSON, _ := json.Marshal(map[string]interface{}{
+		"provider": smsProvider,
+		"from":     webhook.From,
+		"to":       webhook.To,
+	})
+	timestamp := time.Now()
+
+	// MMS: MediaUrl0..N / MediaContentType0..N, uma mídia por mensagem
+	for i, ref := range refs {
+		if saved[ref] != nil {
+			continue
+		}
+		externalID := ref
+		message := &models.Message{
+			AccountID:         uint(inbox.AccountID),
+			InboxID:           inboxID,
+			ConversationID:    uint(conversation.ID),
+			MessageType:       models.MessageTypeIncoming,
+			ContentType:       "text",
+			SenderType:        "Contact",
+			SenderID:          contact.ID,
+			Status:            models.MessageStatusSent,
+			SourceID:          externalID,
+			WhatsAppMessageID: &externalID,
+			Timestamp:         &timestamp,
+			Metadata:          metadataJSON,
+		}
+		if i == 0 {
+			message.Content = webhook.Body
+		}
+		if mediaURL := fields[fmt.Sprintf("MediaUrl%d", i)]; mediaURL != "" {
+			if err := fillSMSMedia(config, message, mediaURL, fields[fmt.Sprintf("MediaContentType%d", i)]); err != nil {
+				// Sem texto não há o que gravar: o webhook volta à fila e grava apenas o que falta
+				if message.Content == "" {
+					return fmt.Errorf("media %d of %s: %w", i, sid, err)
+				}
+				log.Printf("[SMS] Failed to store media of %s: %v", sid, err)
+			}
+		}
+
+		if err := repository.UpsertMessage(message); err != nil {
+			return fmt.Errorf("failed to save message: %w", err)
+		}
+		publishInboundMessage(conversation, message)
+	}
+	return nil
+}
+
+// smsMediaRef ID externo da mensagem da i-ésima mídia (base 0) de um MMS; a primeira usa o próprio SID
+func smsMediaRef(sid string, i int) string {
+	if i == 0 {
+		return sid
+	}
+	return fmt.Sprintf("%s#%d", sid, i)
+}
+
+// fillSMSMedia baixa a mídia do MMS (autenticada com as credenciais da conta) e preenche os campos de mídia
+func fillSMSMedia(config *smsConfig, message *models.Message, mediaURL, declaredMime string) error {
+	if GlobalMediaStorage == nil {
+		return fmt.Errorf("media storage not initialized")
+	}
+
+	data, mimeType, err := newSMSClient(config).download(mediaURL)
+	if err != nil {
+		return fmt.Errorf("failed to download media: %w", err)
+	}
+	mimeType = firstNonEmpty(declaredMime, mimeType, DetectMimeType(data))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	fileName := strings.ReplaceAll(message.SourceID, "#", "-") + GetExtensionFromMimeType(baseMimeType(mimeType))
+	storedURL, err := GlobalMediaStorage.Store(ctx, data, fileName, mimeType)
+	if err != nil {
+		return fmt.Errorf("failed to store media: %w", err)
+	}
+
+	size := int64(len(data))
+	message.ContentType = mediaContentType(mimeType)
+	message.MediaURL = &storedURL
+	message.MimeType = &mimeType
+	message.FileSize = &size
+	if message.ContentType == "document" {
+		message.FileName = &fileName
+	}
+	if message.Content == "" && message.ContentType == "audio" {
+		message.Content = "[Áudio]"
+	}
+	return nil
+}
+
+// applySMSStatus aplica um status callback a uma mensagem enviada
+func applySMSStatus(inboxID uint, webhook *smsWebhook, payload []byte) error {
+	newStatus := smsMessageStatus(webhook.MessageStatus)
+	if newStatus == "" {
+		// queued, accepted, sending, scheduled...: a mensagem já está gravada como enviada
+		return nil
+	}
+	if newStatus == models.MessageStatusFailed {
+		log.Printf("[SMS] Message %s %s: %s %s", webhook.sid(), webhook.MessageStatus, webhook.ErrorCode, webhook.ErrorMessage)
+	}
+
+	message, err := ApplyMessageStatus(inboxID, webhook.sid(), newStatus, time.Now())
+	if err != nil {
+		// Status de mensagens enviadas fora do NakaWoot
+		log.Printf("[SMS] Could not apply status %s to %s: %v", newStatus, webhook.sid(), err)
+		return nil
+	}
+	if message != nil {
+		DispatchMessageUpdated(message)
+	}
+	return nil
+}
+
+// smsMessageStatus converte o MessageStatus do status callback; "" para estados intermediários
+func smsMessageStatus(status string) string {
+	switch status {
+	case "sent":
+		return models.MessageStatusSent
+	case "delivered":
+		return models.MessageStatusDelivered
+	case "read":
+		return models.MessageStatusRead
+	case "undelivered", "failed":
+		return models.MessageStatusFailed
+	default:
+		return ""
+	}
+}
+
+// smsDigits normaliza um número E.164 (+5511...) para o formato dos contatos (apenas dígitos)
+func smsDigits(phoneNumber string) string {
+	var digits strings.Builder
+	for _, c := range phoneNumber {
+		if c >= '0' && c <= '9' {
+			digits.WriteRune(c)
+		}
+	}
+	return digits.String()
+}
+
+func (smsChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	return sendSMS(msg, nil)
+}
+
+// SendMedia envia um MMS com a mídia (MediaUrl) e o texto como corpo
+func (smsChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	result, err := sendSMS(msg, []string{msg.MediaURL})
+	if err != nil {
+		return nil, err
+	}
+	if msg.ContentType == "document" {
+		fileName := firstNonEmpty(msg.FileName, mediaFileName(msg.MediaURL))
+		result.FileName = &fileName
+	}
+	return result, nil
+}
+
+// sendSMS envia pela REST API com o status callback apontando para o webhook da inbox
+func sendSMS(msg *OutboundMessage, mediaURLs []string) (*SendResult, error) {
+	config, err := loadSMSConfig(msg.Inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	phoneNumber := smsDigits(msg.Contact.PhoneNumber)
+	if phoneNumber == "" {
+		return nil, fmt.Errorf("contact %d has no phone number", msg.Contact.ID)
+	}
+
+	form := url.Values{}
+	form.Set("To", "+"+phoneNumber)
+	if config.MessagingServiceSID != "" {
+		form.Set("MessagingServiceSid", config.MessagingServiceSID)
+	} else {
+		form.Set("From", config.PhoneNumber)
+	}
+	if msg.Content != "" {
+		form.Set("Body", msg.Content)
+	}
+	for _, mediaURL := range mediaURLs {
+		form.Add("MediaUrl", mediaURL)
+	}
+	if config.WebhookSecret != "" {
+		form.Set("StatusCallback", InboxWebhookURL(msg.Inbox, config.WebhookSecret))
+	}
+
+	sid, err := newSMSClient(config).sendMessage(form)
+	if err != nil {
+		return nil, err
+	}
+	return &SendResult{ExternalID: &sid}, nil
+}
+
+// smsClient cliente HTTP da REST API (compatível com o Twilio) de uma conta
+type smsClient struct {
+	config     *smsConfig
+	httpClient *http.Client
+}
+
+func newSMSClient(config *smsConfig) *smsClient {
+	return &smsClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// sendMessage cria a mensagem em /2010-04-01/Accounts/{sid}/Messages.json e retorna o SID
+func (c *smsClient) sendMessage(form url.Values) (string, error) {
+	if c.config.AccountSID == "" || c.config.AuthToken == "" {
+		return "", fmt.Errorf("sms integration requires account_sid and auth_token")
+	}
+	if form.Get("From") == "" && form.Get("MessagingServiceSid") == "" {
+		return "", fmt.Errorf("sms integration requires phone_number or messaging_service_sid")
+	}
+
+	endpoint := fmt.Sprintf("%s/2010-04-01/Accounts/%s/Messages.json", c.config.APIBaseURL, url.PathEscape(c.config.AccountSID))
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	respBody, _, err := c.do(req)
+	if err != nil {
+		return "", err
+	}
+
+	var response struct {
+		SID    string `json:"sid"`
+		Status string `json:"status"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return "", fmt.Errorf("failed to parse response: %w", err)
+	}
+	if response.SID == "" {
+		return "", fmt.Errorf("sms API response without sid")
+	}
+	return response.SID, nil
+}
+
+// download baixa a mídia de um MMS recebido
+func (c *smsClient) download(mediaURL string) ([]byte, string, error) {
+	req, err := http.NewRequest("GET", mediaURL, nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+	return c.do(req)
+}
+
+// do executa a requisição com autenticação básica (account_sid:auth_token) e retorna corpo e Content-Type
+func (c *smsClient) do(req *http.Request) ([]byte, string, error) {
+	req.SetBasicAuth(c.config.AccountSID, c.config.AuthToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, "", newProviderError("sms", resp, respBody)
+	}
+	return respBody, resp.Header.Get("Content-Type"), nil
+}
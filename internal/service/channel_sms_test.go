@@ -0,0 +1,188 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+func TestTwilioSignature(t *testing.T) {
+	// Exemplo publicado na documentação de segurança do Twilio
+	params := url.Values{
+		"CallSid": {"CA1234567890ABCDE"},
+		"Caller":  {"+12349013030"},
+		"Digits":  {"1234"},
+		"From":    {"+12349013030"},
+		"To":      {"+18005551212"},
+	}
+	got := twilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", params)
+	if want := "0/KCTR6DLpKmkAf8muzZqo1nDgQ="; got != want {
+		t.Errorf("twilioSignature = %q, want %q", got, want)
+	}
+
+	params.Set("Digits", "4321")
+	if twilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", params) == got {
+		t.Error("signature does not cover the parameters")
+	}
+}
+
+func TestSMSMessageStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{"sent", models.MessageStatusSent},
+		{"delivered", models.MessageStatusDelivered},
+		{"read", models.MessageStatusRead},
+		{"undelivered", models.MessageStatusFailed},
+		{"failed", models.MessageStatusFailed},
+		{"queued", ""},
+		{"accepted", ""},
+		{"sending", ""},
+		{"scheduled", ""},
+	}
+	for _, tt := range tests {
+		if got := smsMessageStatus(tt.status); got != tt.want {
+			t.Errorf("smsMessageStatus(%q) = %q, want %q", tt.status, got, tt.want)
+		}
+	}
+}
+
+func TestSMSWebhookIsInbound(t *testing.T) {
+	tests := []struct {
+		webhook smsWebhook
+		want    bool
+	}{
+		{smsWebhook{SmsStatus: "received"}, true},
+		{smsWebhook{}, true},
+		{smsWebhook{MessageStatus: "delivered", SmsStatus: "delivered"}, false},
+		{smsWebhook{MessageStatus: "failed"}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.webhook.isInbound(); got != tt.want {
+			t.Errorf("isInbound(%+v) = %v, want %v", tt.webhook, got, tt.want)
+		}
+	}
+}
+
+func TestSMSProcessWebhookAppliesStatusCallback(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, smsProvider, smsProvider, map[string]interface{}{"account_sid": "AC1", "auth_token": "token"})
+
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), "5511999990000", "")
+	if err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), uint(contact.ID))
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+
+	sid := "SM-out-1"
+	message := models.Message{
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           uint(inbox.ID),
+		ConversationID:    uint(conversation.ID),
+		MessageType:       models.MessageTypeOutgoing,
+		ContentType:       "text",
+		Status:            models.MessageStatusSent,
+		SourceID:          sid,
+		WhatsAppMessageID: &sid,
+	}
+	if err := conn.Omit("Conversation", "Inbox", "Account", "Reactions").Create(&message).Error; err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	for _, step := range []struct {
+		status string
+		want   string
+	}{
+		{"queued", models.MessageStatusSent},
+		{"delivered", models.MessageStatusDelivered},
+		{"sent", models.MessageStatusDelivered}, // Atrasado: não regride
+		{"read", models.MessageStatusRead},
+	} {
+		payload, _ := json.Marshal(map[string]string{"MessageSid": sid, "MessageStatus": step.status, "SmsStatus": step.status, "To": "+5511999990000"})
+		if err := (smsChannel{}).ProcessWebhook(uint(inbox.ID), payload); err != nil {
+			t.Fatalf("ProcessWebhook(%s): %v", step.status, err)
+		}
+		var stored models.Message
+		conn.First(&stored, message.ID)
+		if stored.Status != step.want {
+			t.Errorf("after %s: status = %q, want %q", step.status, stored.Status, step.want)
+		}
+	}
+}
+
+func TestSMSProcessWebhookStoresEachMedia(t *testing.T) {
+	conn := dbtest.Open(t)
+	useMemoryMediaStorage(t)
+
+	media := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/broken.png" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png " + r.URL.Path))
+	}))
+	defer media.Close()
+
+	inbox := createChannelInbox(t, conn, smsProvider, smsProvider, map[string]interface{}{"account_sid": "AC1", "auth_token": "token"})
+	fields := map[string]string{
+		"MessageSid":        "SM-in-1",
+		"SmsStatus":         "received",
+		"From":              "+5511988887777",
+		"To":                "+15005550006",
+		"Body":              "fotos",
+		"NumMedia":          "3",
+		"MediaUrl0":         media.URL + "/a.png",
+		"MediaContentType0": "image/png",
+		"MediaUrl1":         media.URL + "/b.png",
+		"MediaContentType1": "image/png",
+		"MediaUrl2":         media.URL + "/broken.png",
+		"MediaContentType2": "image/png",
+	}
+	payload, _ := json.Marshal(fields)
+
+	// A terceira mídia falha: o webhook volta à fila com as duas primeiras gravadas
+	if err := (smsChannel{}).ProcessWebhook(uint(inbox.ID), payload); err == nil {
+		t.Fatal("ProcessWebhook succeeded with a failed media download")
+	}
+	if messages := inboxMessages(t, conn, inbox.ID); len(messages) != 2 {
+		t.Fatalf("messages after the first attempt = %d, want 2", len(messages))
+	}
+
+	fields["MediaUrl2"] = media.URL + "/c.png"
+	payload, _ = json.Marshal(fields)
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := (smsChannel{}).ProcessWebhook(uint(inbox.ID), payload); err != nil {
+			t.Fatalf("ProcessWebhook: %v", err)
+		}
+	}
+
+	messages := inboxMessages(t, conn, inbox.ID)
+	if len(messages) != 3 {
+		t.Fatalf("messages = %d, want 3", len(messages))
+	}
+	for i, message := range messages {
+		if want := smsMediaRef("SM-in-1", i); message.WhatsAppMessageID == nil || *message.WhatsAppMessageID != want {
+			t.Errorf("message %d external ID = %v, want %s", i, message.WhatsAppMessageID, want)
+		}
+		if message.ContentType != "image" || message.MediaURL == nil {
+			t.Errorf("message %d = %s without media", i, message.ContentType)
+		}
+		if message.ConversationID != messages[0].ConversationID {
+			t.Errorf("message %d in conversation %d, want %d", i, message.ConversationID, messages[0].ConversationID)
+		}
+	}
+	if messages[0].Content != "fotos" || messages[1].Content != "" {
+		t.Errorf("contents = %q, %q; want the body only in the first message", messages[0].Content, messages[1].Content)
+	}
+}
@@ -0,0 +1,515 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// telegramProvider identificador do canal Telegram em webhooks e integrações
+const telegramProvider = "telegram"
+
+// defaultTelegramAPIURL endereço da Bot API; api_base_url permite apontar para um servidor local em testes
+const defaultTelegramAPIURL = "https://api.telegram.org"
+
+// telegramIdentifierPrefix prefixo do Contact.Identifier dos chats do Telegram
+const telegramIdentifierPrefix = "telegram:"
+
+// telegramChannel canal Telegram Bot API
+type telegramChannel struct{}
+
+func init() {
+	RegisterChannel(telegramChannel{}, telegramProvider)
+}
+
+func (telegramChannel) Provider() string {
+	return telegramProvider
+}
+
+func (telegramChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:   true,
+		Replies: true,
+	}
+}
+
+// telegramConfig configuração do bot, lida do config da integração da inbox
+type telegramConfig struct {
+	BotToken      string
+	APIBaseURL    string
+	WebhookSecret string // Enviado pelo Telegram em X-Telegram-Bot-Api-Secret-Token
+}
+
+// loadTelegramConfig busca a integração da inbox (channel_id) e extrai a configuração do bot
+func loadTelegramConfig(inbox *models.Inbox) (*telegramConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, telegramProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &telegramConfig{
+		BotToken:      firstString(configMap, "bot_token", "botToken", "token"),
+		APIBaseURL:    firstString(configMap, "api_base_url", "apiBaseUrl"),
+		WebhookSecret: inboxWebhookSecret(configMap, inbox),
+	}
+	if config.APIBaseURL == "" {
+		config.APIBaseURL = os.Getenv("TELEGRAM_API_URL")
+	}
+	if config.APIBaseURL == "" {
+		config.APIBaseURL = defaultTelegramAPIURL
+	}
+	config.APIBaseURL = strings.TrimSuffix(config.APIBaseURL, "/")
+
+	return config, nil
+}
+
+// InstallWebhook registra a URL de webhook da inbox no bot (setWebhook), com o segredo como secret_token
+func (telegramChannel) InstallWebhook(inbox *models.Inbox, webhookURL string, secret string) error {
+	config, err := loadTelegramConfig(inbox)
+	if err != nil {
+		return err
+	}
+
+	_, err = newTelegramClient(config).call("setWebhook", map[string]interface{}{
+		"url":             webhookURL,
+		"secret_token":    secret,
+		"allowed_updates": []string{"message", "edited_message"},
+	})
+	return err
+}
+
+// VerifyWebhook confere o secret_token registrado no setWebhook (header ou token na URL)
+func (telegramChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	config, err := loadTelegramConfig(inbox)
+	if err != nil {
+		return err
+	}
+	if secureEqual(req.Header.Get("X-Telegram-Bot-Api-Secret-Token"), config.WebhookSecret) ||
+		secureEqual(req.Query.Get("token"), config.WebhookSecret) {
+		return nil
+	}
+	return ErrWebhookUnauthorized
+}
+
+// telegramUpdate update recebido da Bot API
+type telegramUpdate struct {
+	UpdateID      int64            `json:"update_id"`
+	Message       *telegramMessage `json:"message"`
+	EditedMessage *telegramMessage `json:"edited_message"`
+}
+
+type telegramMessage struct {
+	MessageID int64 `json:"message_id"`
+	From      *struct {
+		ID        int64  `json:"id"`
+		IsBot     bool   `json:"is_bot"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Username  string `json:"username"`
+	} `json:"from"`
+	Chat struct {
+		ID        int64  `json:"id"`
+		Type      string `json:"type"` // private, group, supergroup, channel
+		Title     string `json:"title"`
+		FirstName string `json:"first_name"`
+		LastName  string `json:"last_name"`
+		Username  string `json:"username"`
+	} `json:"chat"`
+	Date           int64            `json:"date"`
+	EditDate       int64            `json:"edit_date"`
+	Text           string           `json:"text"`
+	Caption        string           `json:"caption"`
+	Photo          []telegramFile   `json:"photo"` // Tamanhos disponíveis, do menor para o maior
+	Document       *telegramFile    `json:"document"`
+	Voice          *telegramFile    `json:"voice"`
+	Audio          *telegramFile    `json:"audio"`
+	Video          *telegramFile    `json:"video"`
+	ReplyToMessage *telegramMessage `json:"reply_to_message"`
+}
+
+type telegramFile struct {
+	FileID   string `json:"file_id"`
+	FileName string `json:"file_name"`
+	MimeType string `json:"mime_type"`
+	FileSize int64  `json:"file_size"`
+}
+
+// RoutingInfo usa o chat como chave de ordenação
+func (telegramChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var update telegramUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return "", ""
+	}
+
+	switch {
+	case update.Message != nil:
+		return "message", fmt.Sprintf("%d:%d", inboxID, update.Message.Chat.ID)
+	case update.EditedMessage != nil:
+		return "edited_message", fmt.Sprintf("%d:%d", inboxID, update.EditedMessage.Chat.ID)
+	}
+	return "", ""
+}
+
+// ProcessWebhook grava a mensagem de um update do Telegram (ou aplica a edição de uma mensagem existente)
+func (telegramChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	var update telegramUpdate
+	if err := json.Unmarshal(payload, &update); err != nil {
+		return fmt.Errorf("failed to parse telegram update: %w", err)
+	}
+
+	if update.EditedMessage != nil {
+		edited := update.EditedMessage
+		text := firstNonEmpty(edited.Text, edited.Caption)
+		return EditMessage(inboxID, telegramMessageRef(inboxID, edited.Chat.ID, edited.MessageID), text, time.Unix(edited.EditDate, 0))
+	}
+	if update.Message == nil {
+		log.Printf("[Telegram] Ignoring update %d without message (inbox %d)", update.UpdateID, inboxID)
+		return nil
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+	config, err := loadTelegramConfig(inbox)
+	if err != nil {
+		return err
+	}
+
+	return saveTelegramMessage(inbox, config, update.Message)
+}
+
+// saveTelegramMessage cria contato (por chat), conversa e mensagem a partir de uma mensagem recebida
+func saveTelegramMessage(inbox *models.Inbox, config *telegramConfig, msg *telegramMessage) error {
+	inboxID := uint(inbox.ID)
+	externalID := telegramMessageRef(inboxID, msg.Chat.ID, msg.MessageID)
+
+	// Verificar se a mensagem já foi processada (evitar duplicação)
+	if existing, err := repository.GetMessageByWhatsAppID(externalID); err == nil && existing != nil {
+		log.Printf("[Telegram] Message already exists with ID %s, skipping", externalID)
+		return nil
+	}
+
+	// O contato é o chat: a própria pessoa em chats privados, o grupo nos demais
+	chatName := msg.Chat.Title
+	if chatName == "" {
+		chatName = strings.TrimSpace(msg.Chat.FirstName + " " + msg.Chat.LastName)
+	}
+	if chatName == "" {
+		chatName = msg.Chat.Username
+	}
+	identifier := telegramIdentifierPrefix + strconv.FormatInt(msg.Chat.ID, 10)
+
+	contact, err := repository.FindOrCreateContactByIdentifier(uint(inbox.AccountID), identifier, chatName)
+	if err != nil {
+		return fmt.Errorf("failed to find/create contact: %w", err)
+	}
+	if chatName != "" && contact.Name != chatName && !contact.NameManuallySet {
+		contact.Name = chatName
+		repository.UpdateContact(contact)
+	}
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), inboxID, uint(contact.ID))
+	if err != nil {
+		return fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	senderName := chatName
+	if msg.From != nil {
+		senderName = firstNonEmpty(strings.TrimSpace(msg.From.FirstName+" "+msg.From.LastName), msg.From.Username, chatName)
+	}
+
+	timestamp := time.Unix(msg.Date, 0)
+	message := &models.Message{
+		Content:           msg.Text,
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           inboxID,
+		ConversationID:    uint(conversation.ID),
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		SenderType:        "Contact",
+		SenderID:          contact.ID,
+		Status:            models.MessageStatusSent,
+		SourceID:          externalID,
+		WhatsAppMessageID: &externalID,
+		RemoteJid:         &identifier,
+		PushName:          &senderName,
+		IsGroup:           msg.Chat.Type != "private",
+		Timestamp:         &timestamp,
+	}
+
+	var file *telegramFile
+	switch {
+	case len(msg.Photo) > 0:
+		message.ContentType = "image"
+		file = &msg.Photo[len(msg.Photo)-1]
+	case msg.Video != nil:
+		message.ContentType = "video"
+		file = msg.Video
+	case msg.Voice != nil:
+		message.ContentType = "audio"
+		message.Content = "[Áudio]"
+		file = msg.Voice
+	case msg.Audio != nil:
+		message.ContentType = "audio"
+		message.Content = "[Áudio]"
+		file = msg.Audio
+	case msg.Document != nil:
+		message.ContentType = "document"
+		file = msg.Document
+		if file.FileName != "" {
+			message.FileName = &file.FileName
+			message.Content = file.FileName
+		}
+	}
+	if msg.Caption != "" {
+		message.Caption = &msg.Caption
+		message.Content = msg.Caption
+	}
+
+	if file != nil {
+		if file.MimeType != "" {
+			message.MimeType = &file.MimeType
+		}
+		mediaURL, size, err := newTelegramClient(config).storeFile(file.FileID, externalID, file.MimeType)
+		if err != nil {
+			log.Printf("[Telegram] Failed to store %s file %s: %v", message.ContentType, file.FileID, err)
+		} else {
+			message.MediaURL = &mediaURL
+			message.FileSize = &size
+		}
+	}
+
+	// Mensagem respondida - resolver para o ID interno quando já estiver armazenada
+	if msg.ReplyToMessage != nil {
+		quotedID := telegramMessageRef(inboxID, msg.Chat.ID, msg.ReplyToMessage.MessageID)
+		message.QuotedMessageID = &quotedID
+		message.InReplyTo = resolveInReplyTo(quotedID, uint(conversation.ID))
+	}
+
+	metadataJSON, _ := json.Marshal(map[string]interface{}{
+		"provider":  telegramProvider,
+		"chat_id":   msg.Chat.ID,
+		"chat_type": msg.Chat.Type,
+	})
+	message.Metadata = metadataJSON
+
+	if err := repository.UpsertMessage(message); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	publishInboundMessage(conversation, message)
+	return nil
+}
+
+// telegramMessageRef monta o ID externo de uma mensagem (message_id só é único dentro do chat)
+func telegramMessageRef(inboxID uint, chatID, messageID int64) string {
+	return fmt.Sprintf("telegram:%d:%d:%d", inboxID, chatID, messageID)
+}
+
+// telegramMessageID extrai o message_id de um ID externo montado por telegramMessageRef
+func telegramMessageID(ref string) (int64, bool) {
+	if !strings.HasPrefix(ref, telegramProvider+":") {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(ref[strings.LastIndex(ref, ":")+1:], 10, 64)
+	return id, err == nil
+}
+
+// telegramChatID extrai o chat_id do identificador do contato
+func telegramChatID(contact *models.Contact) (int64, error) {
+	chatID, err := strconv.ParseInt(strings.TrimPrefix(contact.Identifier, telegramIdentifierPrefix), 10, 64)
+	if err != nil || !strings.HasPrefix(contact.Identifier, telegramIdentifierPrefix) {
+		return 0, fmt.Errorf("contact %d is not a telegram chat", contact.ID)
+	}
+	return chatID, nil
+}
+
+func (telegramChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	return sendTelegram(msg, "sendMessage", map[string]interface{}{"text": msg.Content})
+}
+
+func (telegramChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	method, field := "sendDocument", "document"
+	switch msg.ContentType {
+	case "image":
+		method, field = "sendPhoto", "photo"
+	case "video":
+		method, field = "sendVideo", "video"
+	case "audio":
+		// Mensagens de voz precisam de OGG/Opus; outros formatos vão como arquivo de áudio
+		method, field = "sendAudio", "audio"
+		if ext := strings.ToLower(mediaFileName(msg.MediaURL)); strings.HasSuffix(ext, ".ogg") || strings.HasSuffix(ext, ".oga") || strings.HasSuffix(ext, ".opus") {
+			method, field = "sendVoice", "voice"
+		}
+	}
+
+	params := map[string]interface{}{field: msg.MediaURL}
+	if msg.Content != "" {
+		params["caption"] = msg.Content
+	}
+
+	result, err := sendTelegram(msg, method, params)
+	if err != nil {
+		return nil, err
+	}
+	if msg.ContentType == "document" {
+		fileName := msg.FileName
+		if fileName == "" {
+			fileName = mediaFileName(msg.MediaURL)
+		}
+		result.FileName = &fileName
+	}
+	return result, nil
+}
+
+// sendTelegram completa os parâmetros com chat e resposta e chama o método da Bot API
+func sendTelegram(msg *OutboundMessage, method string, params map[string]interface{}) (*SendResult, error) {
+	chatID, err := telegramChatID(msg.Contact)
+	if err != nil {
+		return nil, err
+	}
+	config, err := loadTelegramConfig(msg.Inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	params["chat_id"] = chatID
+	result := &SendResult{IsGroup: chatID < 0}
+	if msg.ReplyTo != nil && msg.ReplyTo.WhatsAppMessageID != nil {
+		if replyID, ok := telegramMessageID(*msg.ReplyTo.WhatsAppMessageID); ok {
+			params["reply_parameters"] = map[string]interface{}{"message_id": replyID, "allow_sending_without_reply": true}
+			result.QuotedID = msg.ReplyTo.WhatsAppMessageID
+		}
+	}
+
+	raw, err := newTelegramClient(config).call(method, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var sent struct {
+		MessageID int64 `json:"message_id"`
+	}
+	if err := json.Unmarshal(raw, &sent); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	externalID := telegramMessageRef(uint(msg.Inbox.ID), chatID, sent.MessageID)
+	result.ExternalID = &externalID
+	return result, nil
+}
+
+// telegramClient cliente HTTP da Bot API para um bot
+type telegramClient struct {
+	config     *telegramConfig
+	httpClient *http.Client
+}
+
+func newTelegramClient(config *telegramConfig) *telegramClient {
+	return &telegramClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// call chama um método da Bot API e retorna o campo result da resposta
+func (c *telegramClient) call(method string, params map[string]interface{}) (json.RawMessage, error) {
+	if c.config.BotToken == "" {
+		return nil, fmt.Errorf("telegram integration requires bot_token")
+	}
+
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("%s/bot%s/%s", c.config.APIBaseURL, c.config.BotToken, method), bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	var response struct {
+		OK          bool            `json:"ok"`
+		Result      json.RawMessage `json:"result"`
+		Description string          `json:"description"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, newProviderError("telegram", resp, respBody)
+	}
+	if !response.OK {
+		return nil, newProviderError("telegram", resp, []byte(method+": "+response.Description))
+	}
+	return response.Result, nil
+}
+
+// storeFile resolve o caminho do arquivo (getFile), faz o download e grava no storage
+func (c *telegramClient) storeFile(fileID, messageID, declaredMime string) (string, int64, error) {
+	if GlobalMediaStorage == nil {
+		return "", 0, fmt.Errorf("media storage not initialized")
+	}
+
+	raw, err := c.call("getFile", map[string]interface{}{"file_id": fileID})
+	if err != nil {
+		return "", 0, err
+	}
+	var file struct {
+		FilePath string `json:"file_path"`
+	}
+	if err := json.Unmarshal(raw, &file); err != nil || file.FilePath == "" {
+		return "", 0, fmt.Errorf("telegram file %s without file_path", fileID)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	fileURL := fmt.Sprintf("%s/file/bot%s/%s", c.config.APIBaseURL, c.config.BotToken, file.FilePath)
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", 0, fmt.Errorf("failed to download file: %s", resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Fotos não informam mime_type; a extensão do caminho é usada como nome quando presente
+	mimeType := firstNonEmpty(declaredMime, DetectMimeType(data))
+	extension := GetExtensionFromMimeType(baseMimeType(mimeType))
+	if dot := strings.LastIndex(file.FilePath, "."); dot >= 0 && declaredMime == "" {
+		extension = file.FilePath[dot:]
+	}
+	fileName := strings.ReplaceAll(messageID, ":", "_") + extension
+
+	storedURL, err := GlobalMediaStorage.Store(ctx, data, fileName, mimeType)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to store media: %w", err)
+	}
+	return storedURL, int64(len(data)), nil
+}
@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"mensager-go/internal/models"
+)
+
+func TestChannelForInbox(t *testing.T) {
+	tests := []struct {
+		channelType string
+		provider    string
+	}{
+		{"whatsapp", "evolution"},
+		{"telegram", "telegram"},
+		{"website", "website"},
+		// Tipos sem canal registrado continuam na Evolution
+		{"web", "evolution"},
+		{"", "evolution"},
+	}
+	for _, tt := range tests {
+		channel, err := ChannelForInbox(&models.Inbox{ID: 1, ChannelType: tt.channelType})
+		if err != nil {
+			t.Errorf("ChannelForInbox(%q): %v", tt.channelType, err)
+			continue
+		}
+		if channel.Provider() != tt.provider {
+			t.Errorf("ChannelForInbox(%q) = %s, want %s", tt.channelType, channel.Provider(), tt.provider)
+		}
+	}
+}
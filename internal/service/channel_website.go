@@ -0,0 +1,391 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// websiteProvider canal do widget de chat do site (visitantes usam a API pública /widget)
+const websiteProvider = "website"
+
+var (
+	// ErrWidgetUnauthorized indica token de sessão do widget ausente ou inválido
+	ErrWidgetUnauthorized = errors.New("invalid widget session")
+	// ErrWidgetIdentityInvalid indica identifier sem identifier_hash válido (HMAC da inbox)
+	ErrWidgetIdentityInvalid = errors.New("identity verification failed")
+	// ErrWidgetRateLimited indica excesso de sessões criadas pelo IP ou na inbox
+	ErrWidgetRateLimited = errors.New("too many widget sessions")
+)
+
+// widgetIdentifierPrefix prefixo do Contact.Identifier dos usuários do produto identificados no widget,
+// para que um identifier verificado não coincida com o de contatos de outros canais
+const widgetIdentifierPrefix = "widget:"
+
+// websiteChannel entrega as respostas pelo stream SSE do visitante: o envio apenas gera o ID externo,
+// o broadcast da mensagem gravada chega aos clientes do visitante inscritos na conversa
+type websiteChannel struct{}
+
+func init() {
+	RegisterChannel(websiteChannel{}, websiteProvider)
+}
+
+func (websiteChannel) Provider() string {
+	return websiteProvider
+}
+
+func (websiteChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:   true,
+		Replies: true,
+		Typing:  true,
+	}
+}
+
+// VerifyWebhook: o widget não usa webhooks, os visitantes falam com a API pública /widget
+func (websiteChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	return fmt.Errorf("inbound webhooks are %w: website inboxes use the widget API", ErrChannelUnsupported)
+}
+
+func (websiteChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	return fmt.Errorf("inbound webhooks are %w: website inboxes use the widget API", ErrChannelUnsupported)
+}
+
+func (websiteChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	return sendWebsite(msg), nil
+}
+
+func (websiteChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	result := sendWebsite(msg)
+	fileName := firstNonEmpty(msg.FileName, mediaFileName(msg.MediaURL))
+	result.FileName = &fileName
+	return result, nil
+}
+
+func sendWebsite(msg *OutboundMessage) *SendResult {
+	externalID := fmt.Sprintf("website:%s", uuid.New().String())
+	result := &SendResult{ExternalID: &externalID}
+	if msg.ReplyTo != nil {
+		result.QuotedID = msg.ReplyTo.WhatsAppMessageID
+	}
+	return result
+}
+
+// websiteConfig configuração do widget, lida do config da integração da inbox
+type websiteConfig struct {
+	HMACSecret    string // Segredo para verificar identifier_hash = HMAC-SHA256(segredo, identifier)
+	HMACMandatory bool   // Recusar visitantes sem identidade verificada
+}
+
+func loadWebsiteConfig(inbox *models.Inbox) (*websiteConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, websiteProvider)
+	if err != nil {
+		return nil, err
+	}
+	return &websiteConfig{
+		HMACSecret:    firstString(configMap, "hmac_secret", "hmacSecret"),
+		HMACMandatory: configBool(configMap, false, "hmac_mandatory", "hmacMandatory"),
+	}, nil
+}
+
+// WidgetIdentity dados informados pelo visitante. Identifier só é aceito com identifier_hash válido.
+type WidgetIdentity struct {
+	Identifier     string `json:"identifier"`
+	IdentifierHash string `json:"identifier_hash"`
+	Name           string `json:"name"`
+	Email          string `json:"email"`
+	PhoneNumber    string `json:"phone_number"`
+}
+
+// WidgetAttachment arquivo enviado pelo visitante
+type WidgetAttachment struct {
+	FileName string
+	Data     []byte
+}
+
+// GetWebsiteInbox busca uma inbox do canal website (as demais não são expostas na API pública)
+func GetWebsiteInbox(inboxID uint) (*models.Inbox, error) {
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return nil, fmt.Errorf("inbox not found: %w", err)
+	}
+	if inbox.ChannelType != websiteProvider {
+		return nil, fmt.Errorf("inbox %d is not a website inbox", inboxID)
+	}
+	return inbox, nil
+}
+
+// CreateWidgetSession cria o contato do visitante (anônimo ou identificado) e uma sessão.
+// Retorna o token da sessão, que não é armazenado e não pode ser recuperado depois.
+func CreateWidgetSession(inbox *models.Inbox, identity WidgetIdentity, clientIP string) (*models.WidgetSession, *models.Contact, string, error) {
+	perIP := envInt("WIDGET_SESSION_RATE_PER_IP", defaultWidgetSessionsPerIP)
+	perInbox := envInt("WIDGET_SESSION_RATE_PER_INBOX", defaultWidgetSessionsPerInbox)
+	if !widgetSessions.allow(uint(inbox.ID), clientIP, perIP, perInbox, time.Now()) {
+		return nil, nil, "", ErrWidgetRateLimited
+	}
+
+	config, err := loadWebsiteConfig(inbox)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if err := verifyWidgetIdentity(config, identity); err != nil {
+		return nil, nil, "", err
+	}
+
+	var contact *models.Contact
+	if identity.Identifier != "" {
+		contact, err = findOrCreateWidgetContact(inbox, identity.Identifier, identity.Name)
+	} else {
+		contact, err = repository.FindOrCreateContactByIdentifier(uint(inbox.AccountID), fmt.Sprintf("website:%s", uuid.New().String()), identity.Name)
+	}
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("failed to find/create contact: %w", err)
+	}
+	applyContactDetails(contact, identity.Name, identity.Email, identity.PhoneNumber)
+
+	token, err := generateWidgetToken()
+	if err != nil {
+		return nil, nil, "", err
+	}
+	now := time.Now()
+	session := &models.WidgetSession{
+		AccountID:        uint(inbox.AccountID),
+		InboxID:          uint(inbox.ID),
+		ContactID:        contact.ID,
+		TokenHash:        hashWidgetToken(token),
+		Identifier:       identity.Identifier,
+		IdentityVerified: identity.Identifier != "",
+		LastSeenAt:       &now,
+	}
+	if err := repository.CreateWidgetSession(session); err != nil {
+		return nil, nil, "", fmt.Errorf("failed to create widget session: %w", err)
+	}
+
+	return session, contact, token, nil
+}
+
+// AuthenticateWidgetSession valida o token de sessão do visitante na inbox
+func AuthenticateWidgetSession(inbox *models.Inbox, token string) (*models.WidgetSession, error) {
+	if token == "" {
+		return nil, ErrWidgetUnauthorized
+	}
+	session, err := repository.GetWidgetSessionByTokenHash(uint(inbox.ID), hashWidgetToken(token))
+	if err != nil {
+		return nil, ErrWidgetUnauthorized
+	}
+
+	// Evitar uma escrita por requisição: last_seen_at com resolução de um minuto
+	now := time.Now()
+	if session.LastSeenAt == nil || now.Sub(*session.LastSeenAt) > time.Minute {
+		session.LastSeenAt = &now
+		repository.TouchWidgetSession(session.ID, now)
+	}
+	return session, nil
+}
+
+// IdentifyWidgetSession atualiza os dados do visitante. Com identifier verificado, a sessão passa para o
+// contato desse usuário do produto e as conversas do visitante anônimo nesta inbox são transferidas para ele.
+func IdentifyWidgetSession(inbox *models.Inbox, session *models.WidgetSession, identity WidgetIdentity) (*models.Contact, error) {
+	config, err := loadWebsiteConfig(inbox)
+	if err != nil {
+		return nil, err
+	}
+	if identity.Identifier != "" {
+		if err := verifyWidgetIdentity(config, identity); err != nil {
+			return nil, err
+		}
+	}
+
+	contact, err := repository.GetContact(session.ContactID, session.AccountID)
+	if err != nil {
+		return nil, fmt.Errorf("contact not found: %w", err)
+	}
+
+	if identity.Identifier != "" && widgetIdentifierPrefix+identity.Identifier != contact.Identifier {
+		if session.IdentityVerified && session.Identifier != identity.Identifier {
+			// Outro usuário no mesmo navegador: precisa de uma nova sessão
+			return nil, fmt.Errorf("%w: session already belongs to another user", ErrWidgetIdentityInvalid)
+		}
+
+		identified, err := findOrCreateWidgetContact(inbox, identity.Identifier, identity.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find/create contact: %w", err)
+		}
+		if identified.ID != contact.ID {
+			if err := repository.MergeInboxConversations(session.InboxID, contact.ID, identified.ID); err != nil {
+				return nil, fmt.Errorf("failed to move visitor conversations: %w", err)
+			}
+		}
+
+		session.ContactID = identified.ID
+		session.Identifier = identity.Identifier
+		session.IdentityVerified = true
+		if err := repository.UpdateWidgetSession(session); err != nil {
+			return nil, fmt.Errorf("failed to update widget session: %w", err)
+		}
+		contact = identified
+	}
+
+	applyContactDetails(contact, identity.Name, identity.Email, identity.PhoneNumber)
+	return contact, nil
+}
+
+// findOrCreateWidgetContact contato do usuário do produto com identifier verificado. Contatos gravados
+// antes do prefixo (identifier puro, vinculado a uma sessão verificada) recebem o prefixo.
+func findOrCreateWidgetContact(inbox *models.Inbox, identifier, name string) (*models.Contact, error) {
+	accountID := uint(inbox.AccountID)
+	prefixed := widgetIdentifierPrefix + identifier
+
+	if _, err := repository.GetContactByIdentifier(prefixed, accountID); errors.Is(err, gorm.ErrRecordNotFound) {
+		if legacy, err := repository.GetVerifiedWidgetContact(uint(inbox.ID), identifier); err == nil {
+			legacy.Identifier = prefixed
+			if err := repository.UpdateContact(legacy); err != nil {
+				return nil, err
+			}
+			return legacy, nil
+		}
+	}
+	return repository.FindOrCreateContactByIdentifier(accountID, prefixed, name)
+}
+
+// verifyWidgetIdentity confere identifier_hash = hex(HMAC-SHA256(hmac_secret, identifier))
+func verifyWidgetIdentity(config *websiteConfig, identity WidgetIdentity) error {
+	if identity.Identifier == "" {
+		if config.HMACMandatory {
+			return fmt.Errorf("%w: identifier is required", ErrWidgetIdentityInvalid)
+		}
+		return nil
+	}
+	if config.HMACSecret == "" {
+		return fmt.Errorf("%w: identity verification is not configured for this inbox", ErrWidgetIdentityInvalid)
+	}
+
+	mac := hmac.New(sha256.New, []byte(config.HMACSecret))
+	mac.Write([]byte(identity.Identifier))
+	expected := hex.EncodeToString(mac.Sum(nil))
+	if !hmac.Equal([]byte(strings.ToLower(identity.IdentifierHash)), []byte(expected)) {
+		return ErrWidgetIdentityInvalid
+	}
+	return nil
+}
+
+// WidgetConversation retorna a conversa atual do visitante na inbox (nil se ele ainda não escreveu)
+func WidgetConversation(session *models.WidgetSession) *models.Conversation {
+	conversation, err := repository.FindLatestConversation(session.InboxID, session.ContactID)
+	if err != nil {
+		return nil
+	}
+	return conversation
+}
+
+// CreateWidgetMessage grava uma mensagem do visitante (texto ou anexo) e a publica para os agentes
+func CreateWidgetMessage(inbox *models.Inbox, session *models.WidgetSession, content string, attachment *WidgetAttachment) (*models.Message, *models.Conversation, error) {
+	content = strings.TrimSpace(content)
+	if content == "" && attachment == nil {
+		return nil, nil, fmt.Errorf("content is required")
+	}
+
+	conversation, err := repository.FindOrCreateConversation(session.AccountID, session.InboxID, session.ContactID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	externalID := fmt.Sprintf("website:%s", uuid.New().String())
+	now := time.Now()
+	message := &models.Message{
+		AccountID:         session.AccountID,
+		InboxID:           session.InboxID,
+		ConversationID:    uint(conversation.ID),
+		Content:           content,
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		SenderType:        "Contact",
+		SenderID:          session.ContactID,
+		Status:            models.MessageStatusSent,
+		SourceID:          externalID,
+		WhatsAppMessageID: &externalID,
+		Timestamp:         &now,
+	}
+
+	if attachment != nil {
+		if err := storeWidgetAttachment(message, attachment); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := repository.CreateMessage(message); err != nil {
+		return nil, nil, fmt.Errorf("failed to save message: %w", err)
+	}
+	publishInboundMessage(conversation, message)
+
+	return message, conversation, nil
+}
+
+// storeWidgetAttachment grava o anexo do visitante no storage e preenche os campos de mídia da mensagem
+func storeWidgetAttachment(message *models.Message, attachment *WidgetAttachment) error {
+	if GlobalMediaStorage == nil {
+		return fmt.Errorf("media storage not initialized")
+	}
+
+	mimeType := DetectMimeType(attachment.Data)
+	extension := GetExtensionFromMimeType(baseMimeType(mimeType))
+	if dot := strings.LastIndex(attachment.FileName, "."); dot >= 0 {
+		extension = attachment.FileName[dot:]
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	mediaURL, err := GlobalMediaStorage.Store(ctx, attachment.Data, uuid.New().String()+extension, mimeType)
+	if err != nil {
+		return fmt.Errorf("failed to store attachment: %w", err)
+	}
+
+	size := int64(len(attachment.Data))
+	fileName := firstNonEmpty(attachment.FileName, mediaFileName(mediaURL))
+	message.ContentType = mediaContentType(mimeType)
+	message.MediaURL = &mediaURL
+	message.MimeType = &mimeType
+	message.FileName = &fileName
+	message.FileSize = &size
+	return nil
+}
+
+// SetVisitorTyping repassa aos agentes que o visitante está (ou parou de) digitar
+func SetVisitorTyping(session *models.WidgetSession, typing bool) {
+	conversation := WidgetConversation(session)
+	if conversation == nil {
+		return
+	}
+	DispatchTyping(TypingPayload{
+		ConversationID: uint(conversation.ID),
+		SenderType:     "Contact",
+		SenderID:       session.ContactID,
+	}, typing)
+}
+
+// hashWidgetToken hash do token de sessão gravado no banco
+func hashWidgetToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateWidgetToken gera o token de sessão entregue ao visitante
+func generateWidgetToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate session token: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+)
+
+func TestWidgetSessionLimiter(t *testing.T) {
+	limiter := &widgetSessionLimiter{windows: map[string]*widgetSessionWindow{}}
+	now := time.Now()
+
+	for i := 0; i < 2; i++ {
+		if !limiter.allow(1, "10.0.0.1", 2, 3, now) {
+			t.Fatalf("session %d from 10.0.0.1 rejected", i+1)
+		}
+	}
+	if limiter.allow(1, "10.0.0.1", 2, 3, now) {
+		t.Error("third session from the same IP allowed")
+	}
+	// Outro IP ainda tem cota, até o limite da inbox
+	if !limiter.allow(1, "10.0.0.2", 2, 3, now) {
+		t.Error("session from another IP rejected")
+	}
+	if limiter.allow(1, "10.0.0.3", 2, 3, now) {
+		t.Error("session allowed above the inbox limit")
+	}
+	// Outra inbox tem cotas próprias
+	if !limiter.allow(2, "10.0.0.1", 2, 3, now) {
+		t.Error("session in another inbox rejected")
+	}
+	// Nova janela
+	if !limiter.allow(1, "10.0.0.1", 2, 3, now.Add(widgetSessionWindowDuration)) {
+		t.Error("session rejected after the window expired")
+	}
+	// 0 = sem limite
+	for i := 0; i < 10; i++ {
+		if !limiter.allow(3, "10.0.0.1", 0, 0, now) {
+			t.Fatal("session rejected without limits")
+		}
+	}
+}
+
+func widgetIdentifierHash(secret, identifier string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(identifier))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestCreateWidgetSessionPrefixesIdentifier(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, websiteProvider, websiteProvider, map[string]interface{}{"hmac_secret": "secret"})
+
+	// Contato de outro canal com o mesmo identifier não pode ser assumido pelo visitante
+	other := models.Contact{AccountID: uint(inbox.AccountID), Name: "Grupo", Identifier: "user-1"}
+	if err := conn.Create(&other).Error; err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+
+	identity := WidgetIdentity{Identifier: "user-1", IdentifierHash: widgetIdentifierHash("secret", "user-1")}
+	_, contact, _, err := CreateWidgetSession(inbox, identity, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateWidgetSession: %v", err)
+	}
+	if contact.ID == other.ID || contact.Identifier != "widget:user-1" {
+		t.Errorf("contact = %d %q, want a new contact widget:user-1", contact.ID, contact.Identifier)
+	}
+
+	// Nova sessão do mesmo usuário volta ao mesmo contato
+	_, again, _, err := CreateWidgetSession(inbox, identity, "10.0.0.2")
+	if err != nil {
+		t.Fatalf("CreateWidgetSession again: %v", err)
+	}
+	if again.ID != contact.ID {
+		t.Errorf("second session contact = %d, want %d", again.ID, contact.ID)
+	}
+}
+
+func TestCreateWidgetSessionPrefixesLegacyContact(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, websiteProvider, websiteProvider, map[string]interface{}{"hmac_secret": "secret"})
+
+	// Contato criado antes do prefixo, vinculado a uma sessão verificada
+	legacy := models.Contact{AccountID: uint(inbox.AccountID), Name: "Ana", Identifier: "user-2"}
+	if err := conn.Create(&legacy).Error; err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	session := models.WidgetSession{
+		AccountID:        uint(inbox.AccountID),
+		InboxID:          uint(inbox.ID),
+		ContactID:        legacy.ID,
+		TokenHash:        "legacy",
+		Identifier:       "user-2",
+		IdentityVerified: true,
+	}
+	if err := conn.Create(&session).Error; err != nil {
+		t.Fatalf("create session: %v", err)
+	}
+
+	identity := WidgetIdentity{Identifier: "user-2", IdentifierHash: widgetIdentifierHash("secret", "user-2")}
+	_, contact, _, err := CreateWidgetSession(inbox, identity, "10.0.0.1")
+	if err != nil {
+		t.Fatalf("CreateWidgetSession: %v", err)
+	}
+	if contact.ID != legacy.ID || contact.Identifier != "widget:user-2" {
+		t.Errorf("contact = %d %q, want legacy contact %d renamed to widget:user-2", contact.ID, contact.Identifier, legacy.ID)
+	}
+}
+
+func TestCreateWidgetSessionRateLimited(t *testing.T) {
+	t.Setenv("WIDGET_SESSION_RATE_PER_IP", "1")
+
+	previous := widgetSessions
+	widgetSessions = &widgetSessionLimiter{windows: map[string]*widgetSessionWindow{}}
+	t.Cleanup(func() { widgetSessions = previous })
+
+	inbox := &models.Inbox{ID: 1}
+	widgetSessions.allow(uint(inbox.ID), "10.0.0.1", 1, 0, time.Now())
+	if _, _, _, err := CreateWidgetSession(inbox, WidgetIdentity{}, "10.0.0.1"); !errors.Is(err, ErrWidgetRateLimited) {
+		t.Errorf("CreateWidgetSession error = %v, want ErrWidgetRateLimited", err)
+	}
+}
@@ -0,0 +1,887 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// whatsAppCloudProvider identificador do canal WhatsApp Cloud API (Meta) em webhooks e integrações
+const whatsAppCloudProvider = "whatsapp_cloud"
+
+// Valores padrão da Graph API; graph_base_url permite apontar para um servidor local em testes
+const (
+	defaultGraphBaseURL    = "https://graph.facebook.com"
+	defaultGraphAPIVersion = "v20.0"
+)
+
+// ErrInvalidSignature indica webhook com X-Hub-Signature-256 ausente ou inválida
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// whatsAppCloudChannel canal WhatsApp Business Cloud API (Meta)
+type whatsAppCloudChannel struct{}
+
+func init() {
+	RegisterChannel(whatsAppCloudChannel{}, whatsAppCloudProvider)
+}
+
+func (whatsAppCloudChannel) Provider() string {
+	return whatsAppCloudProvider
+}
+
+func (whatsAppCloudChannel) Capabilities() ChannelCapabilities {
+	return ChannelCapabilities{
+		Media:     true,
+		Replies:   true,
+		Templates: true,
+	}
+}
+
+// whatsAppCloudConfig configuração do número na Cloud API, lida do config da integração da inbox
+type whatsAppCloudConfig struct {
+	PhoneNumberID string
+	AccessToken   string
+	AppSecret     string // Assina os webhooks (X-Hub-Signature-256)
+	VerifyToken   string // Desafio de verificação da URL do webhook
+	GraphBaseURL  string
+	APIVersion    string
+}
+
+// loadWhatsAppCloudConfig busca a integração da inbox (channel_id) e extrai a configuração da Cloud API
+func loadWhatsAppCloudConfig(inbox *models.Inbox) (*whatsAppCloudConfig, error) {
+	configMap, err := channelIntegrationConfig(inbox, whatsAppCloudProvider)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &whatsAppCloudConfig{
+		PhoneNumberID: firstString(configMap, "phone_number_id", "phoneNumberId"),
+		AccessToken:   firstString(configMap, "access_token", "accessToken", "token"),
+		AppSecret:     firstString(configMap, "app_secret", "appSecret"),
+		VerifyToken:   firstString(configMap, "verify_token", "verifyToken"),
+		GraphBaseURL:  firstString(configMap, "graph_base_url", "graphBaseUrl"),
+		APIVersion:    firstString(configMap, "api_version", "apiVersion"),
+	}
+
+	// O token de verificação padrão é o segredo de webhook da inbox
+	if config.VerifyToken == "" {
+		config.VerifyToken = inboxWebhookSecret(configMap, inbox)
+	}
+	if config.GraphBaseURL == "" {
+		config.GraphBaseURL = os.Getenv("WHATSAPP_CLOUD_GRAPH_URL")
+	}
+	if config.GraphBaseURL == "" {
+		config.GraphBaseURL = defaultGraphBaseURL
+	}
+	config.GraphBaseURL = strings.TrimSuffix(config.GraphBaseURL, "/")
+	if config.APIVersion == "" {
+		config.APIVersion = defaultGraphAPIVersion
+	}
+
+	return config, nil
+}
+
+// VerifyChallenge responde ao desafio de verificação da Meta (hub.mode=subscribe, hub.verify_token, hub.challenge)
+func (whatsAppCloudChannel) VerifyChallenge(inbox *models.Inbox, query url.Values) (string, error) {
+	config, err := loadWhatsAppCloudConfig(inbox)
+	if err != nil {
+		return "", err
+	}
+	return verifyHubChallenge(config.VerifyToken, query)
+}
+
+// verifyHubChallenge confere o hub.verify_token do desafio e retorna o hub.challenge a devolver
+func verifyHubChallenge(verifyToken string, query url.Values) (string, error) {
+	if verifyToken == "" || query.Get("hub.mode") != "subscribe" || !secureEqual(query.Get("hub.verify_token"), verifyToken) {
+		return "", ErrWebhookUnauthorized
+	}
+	return query.Get("hub.challenge"), nil
+}
+
+// VerifyWebhook confere a assinatura X-Hub-Signature-256 (HMAC-SHA256 do corpo com o app secret)
+func (whatsAppCloudChannel) VerifyWebhook(inbox *models.Inbox, req *InboundRequest) error {
+	config, err := loadWhatsAppCloudConfig(inbox)
+	if err != nil {
+		return err
+	}
+	return verifyHubSignature(config.AppSecret, req.Header.Get("X-Hub-Signature-256"), req.Body)
+}
+
+// verifyHubSignature valida o header "sha256=<hex>" enviado pela Meta
+func verifyHubSignature(appSecret, header string, body []byte) error {
+	if appSecret == "" {
+		return fmt.Errorf("%w: app secret not configured", ErrInvalidSignature)
+	}
+	signature, ok := strings.CutPrefix(header, "sha256=")
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+	if !secureEqual(strings.ToLower(signature), hex.EncodeToString(mac.Sum(nil))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// cloudWebhookPayload envelope dos webhooks da Cloud API
+type cloudWebhookPayload struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID      string `json:"id"`
+		Changes []struct {
+			Field string           `json:"field"`
+			Value cloudChangeValue `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+type cloudChangeValue struct {
+	MessagingProduct string `json:"messaging_product"`
+	Metadata         struct {
+		DisplayPhoneNumber string `json:"display_phone_number"`
+		PhoneNumberID      string `json:"phone_number_id"`
+	} `json:"metadata"`
+	Contacts []struct {
+		Profile struct {
+			Name string `json:"name"`
+		} `json:"profile"`
+		WaID string `json:"wa_id"`
+	} `json:"contacts"`
+	Messages []cloudMessage `json:"messages"`
+	Statuses []cloudStatus  `json:"statuses"`
+}
+
+type cloudMessage struct {
+	From      string `json:"from"`
+	ID        string `json:"id"`
+	Timestamp string `json:"timestamp"`
+	Type      string `json:"type"`
+	Context   *struct {
+		From string `json:"from"`
+		ID   string `json:"id"`
+	} `json:"context"`
+	Text *struct {
+		Body string `json:"body"`
+	} `json:"text"`
+	Image    *cloudMedia `json:"image"`
+	Video    *cloudMedia `json:"video"`
+	Audio    *cloudMedia `json:"audio"`
+	Document *cloudMedia `json:"document"`
+	Sticker  *cloudMedia `json:"sticker"`
+	Location *struct {
+		Latitude  float64 `json:"latitude"`
+		Longitude float64 `json:"longitude"`
+		Name      string  `json:"name"`
+		Address   string  `json:"address"`
+		URL       string  `json:"url"`
+	} `json:"location"`
+	Contacts []cloudContactCard `json:"contacts"`
+	Reaction *struct {
+		MessageID string `json:"message_id"`
+		Emoji     string `json:"emoji"`
+	} `json:"reaction"`
+	Button *struct {
+		Text    string `json:"text"`
+		Payload string `json:"payload"`
+	} `json:"button"`
+	Interactive *struct {
+		Type        string `json:"type"`
+		ButtonReply *struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"button_reply"`
+		ListReply *struct {
+			ID    string `json:"id"`
+			Title string `json:"title"`
+		} `json:"list_reply"`
+	} `json:"interactive"`
+}
+
+type cloudMedia struct {
+	ID       string `json:"id"`
+	MimeType string `json:"mime_type"`
+	Caption  string `json:"caption"`
+	Filename string `json:"filename"`
+	Animated bool   `json:"animated"`
+}
+
+type cloudContactCard struct {
+	Name struct {
+		FormattedName string `json:"formatted_name"`
+	} `json:"name"`
+	Org struct {
+		Company string `json:"company"`
+	} `json:"org"`
+	Phones []struct {
+		Phone string `json:"phone"`
+		WaID  string `json:"wa_id"`
+		Type  string `json:"type"`
+	} `json:"phones"`
+	Emails []struct {
+		Email string `json:"email"`
+	} `json:"emails"`
+}
+
+type cloudStatus struct {
+	ID          string `json:"id"`
+	Status      string `json:"status"` // sent, delivered, read, failed
+	Timestamp   string `json:"timestamp"`
+	RecipientID string `json:"recipient_id"`
+	Errors      []struct {
+		Code  int    `json:"code"`
+		Title string `json:"title"`
+	} `json:"errors"`
+}
+
+// RoutingInfo usa o número do contato como chave de ordenação (mensagens e status do mesmo chat em ordem).
+// Lotes com vários chats chegam aqui já divididos por SplitWebhook.
+func (whatsAppCloudChannel) RoutingInfo(inboxID uint, payload []byte) (string, string) {
+	var webhook cloudWebhookPayload
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return "", ""
+	}
+
+	for _, entry := range webhook.Entry {
+		for _, change := range entry.Changes {
+			if len(change.Value.Messages) > 0 {
+				return "messages", fmt.Sprintf("%d:%s", inboxID, change.Value.Messages[0].From)
+			}
+			if len(change.Value.Statuses) > 0 {
+				return "statuses", fmt.Sprintf("%d:%s", inboxID, change.Value.Statuses[0].RecipientID)
+			}
+			return change.Field, ""
+		}
+	}
+	return webhook.Object, ""
+}
+
+// cloudRawPayload envelope da Cloud API com os itens brutos, para dividir o lote sem perder campos
+type cloudRawPayload struct {
+	Object string `json:"object"`
+	Entry  []struct {
+		ID      string `json:"id"`
+		Changes []struct {
+			Field string                     `json:"field"`
+			Value map[string]json.RawMessage `json:"value"`
+		} `json:"changes"`
+	} `json:"entry"`
+}
+
+// cloudSplitPart itens de um chat (ou de uma mudança sem mensagens) em uma parte do lote
+type cloudSplitPart struct {
+	entryID  string
+	field    string
+	value    map[string]json.RawMessage
+	messages []json.RawMessage
+	statuses []json.RawMessage
+}
+
+// SplitWebhook divide um lote com mensagens e status de vários chats em um webhook por chat,
+// para que cada um entre na fila com a sua chave de ordenação
+func (whatsAppCloudChannel) SplitWebhook(payload []byte) [][]byte {
+	var webhook cloudRawPayload
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return nil
+	}
+
+	var parts []*cloudSplitPart
+	byChat := map[string]*cloudSplitPart{}
+	partFor := func(entryID, field string, value map[string]json.RawMessage, chat string) *cloudSplitPart {
+		key := entryID + "|" + field + "|" + value["metadata"].String() + "|" + chat
+		if part, ok := byChat[key]; ok {
+			return part
+		}
+		part := &cloudSplitPart{entryID: entryID, field: field, value: value}
+		byChat[key] = part
+		parts = append(parts, part)
+		return part
+	}
+
+	for _, entry := range webhook.Entry {
+		for _, change := range entry.Changes {
+			var messages, statuses []json.RawMessage
+			_ = json.Unmarshal(change.Value["messages"], &messages)
+			_ = json.Unmarshal(change.Value["statuses"], &statuses)
+			if len(messages) == 0 && len(statuses) == 0 {
+				partFor(entry.ID, change.Field, change.Value, "")
+				continue
+			}
+
+			for _, raw := range messages {
+				var item struct {
+					From string `json:"from"`
+				}
+				_ = json.Unmarshal(raw, &item)
+				part := partFor(entry.ID, change.Field, change.Value, item.From)
+				part.messages = append(part.messages, raw)
+			}
+			for _, raw := range statuses {
+				var item struct {
+					RecipientID string `json:"recipient_id"`
+				}
+				_ = json.Unmarshal(raw, &item)
+				part := partFor(entry.ID, change.Field, change.Value, item.RecipientID)
+				part.statuses = append(part.statuses, raw)
+			}
+		}
+	}
+	if len(parts) < 2 {
+		return nil
+	}
+
+	split := make([][]byte, 0, len(parts))
+	for _, part := range parts {
+		value := make(map[string]json.RawMessage, len(part.value))
+		for key, raw := range part.value {
+			value[key] = raw
+		}
+		delete(value, "messages")
+		delete(value, "statuses")
+		if len(part.messages) > 0 {
+			value["messages"], _ = json.Marshal(part.messages)
+		}
+		if len(part.statuses) > 0 {
+			value["statuses"], _ = json.Marshal(part.statuses)
+		}
+
+		body, err := json.Marshal(map[string]interface{}{
+			"object": webhook.Object,
+			"entry": []interface{}{map[string]interface{}{
+				"id":      part.entryID,
+				"changes": []interface{}{map[string]interface{}{"field": part.field, "value": value}},
+			}},
+		})
+		if err != nil {
+			return nil
+		}
+		split = append(split, body)
+	}
+	return split
+}
+
+// ProcessWebhook grava mensagens e aplica status de um webhook da Cloud API.
+// Em caso de erro os demais itens do lote continuam; o primeiro erro é retornado para a fila tentar de novo.
+func (whatsAppCloudChannel) ProcessWebhook(inboxID uint, payload []byte) error {
+	var webhook cloudWebhookPayload
+	if err := json.Unmarshal(payload, &webhook); err != nil {
+		return fmt.Errorf("failed to parse whatsapp cloud webhook: %w", err)
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+	config, err := loadWhatsAppCloudConfig(inbox)
+	if err != nil {
+		return err
+	}
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	for _, entry := range webhook.Entry {
+		for _, change := range entry.Changes {
+			if change.Field != "messages" {
+				log.Printf("[WhatsAppCloud] Ignoring field %s for inbox %d", change.Field, inboxID)
+				continue
+			}
+			value := change.Value
+			if config.PhoneNumberID != "" && value.Metadata.PhoneNumberID != "" && value.Metadata.PhoneNumberID != config.PhoneNumberID {
+				log.Printf("[WhatsAppCloud] Ignoring change for phone number %s (inbox %d uses %s)", value.Metadata.PhoneNumberID, inboxID, config.PhoneNumberID)
+				continue
+			}
+
+			names := map[string]string{}
+			for _, contact := range value.Contacts {
+				names[contact.WaID] = contact.Profile.Name
+			}
+
+			for i := range value.Messages {
+				if err := saveWhatsAppCloudMessage(inbox, config, &value.Messages[i], names[value.Messages[i].From]); err != nil {
+					log.Printf("[WhatsAppCloud] Error processing message %s: %v", value.Messages[i].ID, err)
+					keep(err)
+				}
+			}
+
+			for _, status := range value.Statuses {
+				keep(applyWhatsAppCloudStatus(inboxID, status))
+			}
+		}
+	}
+
+	return firstErr
+}
+
+// saveWhatsAppCloudMessage cria contato, conversa e mensagem a partir de uma mensagem recebida
+func saveWhatsAppCloudMessage(inbox *models.Inbox, config *whatsAppCloudConfig, msg *cloudMessage, profileName string) error {
+	if msg.ID == "" || msg.From == "" {
+		return fmt.Errorf("message without id or sender")
+	}
+	inboxID := uint(inbox.ID)
+
+	if msg.Type == "reaction" && msg.Reaction != nil {
+		return applyWhatsAppCloudReaction(inbox, msg)
+	}
+
+	// Verificar se a mensagem já foi processada (evitar duplicação)
+	if existing, err := repository.GetMessageByWhatsAppID(msg.ID); err == nil && existing != nil {
+		log.Printf("[WhatsAppCloud] Message already exists with WhatsApp ID %s, skipping", msg.ID)
+		return nil
+	}
+
+	remoteJid := msg.From + "@s.whatsapp.net"
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), msg.From, remoteJid)
+	if err != nil {
+		return fmt.Errorf("failed to find/create contact: %w", err)
+	}
+	if profileName != "" && contact.Name != profileName && !contact.NameManuallySet {
+		contact.Name = profileName
+		repository.UpdateContact(contact)
+	}
+
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), inboxID, uint(contact.ID))
+	if err != nil {
+		return fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	timestamp := parseUnixSeconds(msg.Timestamp)
+	message := &models.Message{
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           inboxID,
+		ConversationID:    uint(conversation.ID),
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		SenderType:        "Contact",
+		SenderID:          contact.ID,
+		Status:            models.MessageStatusSent,
+		SourceID:          msg.ID,
+		WhatsAppMessageID: &msg.ID,
+		RemoteJid:         &remoteJid,
+		PushName:          &profileName,
+		Timestamp:         &timestamp,
+	}
+
+	switch msg.Type {
+	case "text":
+		if msg.Text != nil {
+			message.Content = msg.Text.Body
+		}
+	case "image", "video", "audio", "document", "sticker":
+		fillWhatsAppCloudMedia(config, msg, message)
+	case "location":
+		if msg.Location != nil {
+			location := &models.LocationAttributes{
+				Latitude:  msg.Location.Latitude,
+				Longitude: msg.Location.Longitude,
+				Name:      msg.Location.Name,
+				Address:   msg.Location.Address,
+				URL:       msg.Location.URL,
+			}
+			message.ContentType = "location"
+			message.Content = firstNonEmpty(location.Name, location.Address, "[Localização]")
+			message.ContentAttributes.Location = location
+		}
+	case "contacts":
+		message.ContentType = "contact"
+		for _, card := range msg.Contacts {
+			message.ContentAttributes.Contacts = append(message.ContentAttributes.Contacts, cloudContactAttributes(card))
+		}
+		if len(message.ContentAttributes.Contacts) == 1 {
+			message.Content = message.ContentAttributes.Contacts[0].DisplayName
+		} else {
+			message.Content = fmt.Sprintf("[%d contatos]", len(message.ContentAttributes.Contacts))
+		}
+	case "button":
+		if msg.Button != nil {
+			message.Content = msg.Button.Text
+		}
+	case "interactive":
+		if msg.Interactive != nil && msg.Interactive.ButtonReply != nil {
+			message.Content = msg.Interactive.ButtonReply.Title
+		} else if msg.Interactive != nil && msg.Interactive.ListReply != nil {
+			message.Content = msg.Interactive.ListReply.Title
+		}
+	default:
+		log.Printf("[WhatsAppCloud] Unsupported message type %s (%s)", msg.Type, msg.ID)
+	}
+
+	// Mensagem citada - resolver para o ID interno quando já estiver armazenada
+	if msg.Context != nil && msg.Context.ID != "" {
+		quotedID := msg.Context.ID
+		message.QuotedMessageID = &quotedID
+		message.InReplyTo = resolveInReplyTo(quotedID, uint(conversation.ID))
+	}
+
+	metadataJSON, _ := json.Marshal(map[string]interface{}{
+		"provider":        whatsAppCloudProvider,
+		"phone_number_id": config.PhoneNumberID,
+		"type":            msg.Type,
+	})
+	message.Metadata = metadataJSON
+
+	if err := repository.UpsertMessage(message); err != nil {
+		return fmt.Errorf("failed to save message: %w", err)
+	}
+
+	publishInboundMessage(conversation, message)
+	return nil
+}
+
+// fillWhatsAppCloudMedia baixa a mídia da Graph API e preenche os campos de mídia da mensagem
+func fillWhatsAppCloudMedia(config *whatsAppCloudConfig, msg *cloudMessage, message *models.Message) {
+	media := map[string]*cloudMedia{
+		"image":    msg.Image,
+		"video":    msg.Video,
+		"audio":    msg.Audio,
+		"document": msg.Document,
+		"sticker":  msg.Sticker,
+	}[msg.Type]
+	if media == nil {
+		return
+	}
+
+	message.ContentType = msg.Type
+	if media.MimeType != "" {
+		message.MimeType = &media.MimeType
+	}
+	if media.Caption != "" {
+		message.Caption = &media.Caption
+		message.Content = media.Caption
+	}
+
+	switch msg.Type {
+	case "audio":
+		message.Content = "[Áudio]"
+	case "document":
+		if media.Filename != "" {
+			message.FileName = &media.Filename
+			if message.Content == "" {
+				message.Content = media.Filename
+			}
+		}
+	case "sticker":
+		message.Content = "[Figurinha]"
+		message.ContentAttributes.Sticker = &models.StickerAttributes{Animated: media.Animated}
+	}
+
+	if media.ID == "" {
+		return
+	}
+	mediaURL, size, err := newWhatsAppCloudClient(config).storeMedia(media.ID, msg.ID, media.MimeType)
+	if err != nil {
+		log.Printf("[WhatsAppCloud] Failed to store %s media %s: %v", msg.Type, media.ID, err)
+		return
+	}
+	message.MediaURL = &mediaURL
+	message.FileSize = &size
+}
+
+// cloudContactAttributes converte um cartão de contato da Cloud API
+func cloudContactAttributes(card cloudContactCard) models.ContactCardAttributes {
+	attributes := models.ContactCardAttributes{
+		DisplayName:  card.Name.FormattedName,
+		FullName:     card.Name.FormattedName,
+		Organization: card.Org.Company,
+	}
+	for _, phone := range card.Phones {
+		attributes.Phones = append(attributes.Phones, models.ContactCardPhone{Number: phone.Phone, WaID: phone.WaID, Type: phone.Type})
+	}
+	for _, email := range card.Emails {
+		attributes.Emails = append(attributes.Emails, email.Email)
+	}
+	return attributes
+}
+
+// applyWhatsAppCloudReaction registra a reação do contato (emoji vazio remove)
+func applyWhatsAppCloudReaction(inbox *models.Inbox, msg *cloudMessage) error {
+	message, err := getInboxMessageByWhatsAppID(uint(inbox.ID), msg.Reaction.MessageID)
+	if err != nil {
+		return err
+	}
+
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), msg.From, msg.From+"@s.whatsapp.net")
+	if err != nil {
+		return fmt.Errorf("failed to find/create reactor contact: %w", err)
+	}
+
+	reactionID := msg.ID
+	_, err = applyReaction(message, models.ReactorTypeContact, contact.ID, msg.Reaction.Emoji, &reactionID, parseUnixSeconds(msg.Timestamp))
+	return err
+}
+
+// applyWhatsAppCloudStatus aplica um status de entrega da Cloud API a uma mensagem enviada
+func applyWhatsAppCloudStatus(inboxID uint, status cloudStatus) error {
+	var newStatus string
+	switch status.Status {
+	case "sent":
+		newStatus = models.MessageStatusSent
+	case "delivered":
+		newStatus = models.MessageStatusDelivered
+	case "read":
+		newStatus = models.MessageStatusRead
+	case "failed":
+		newStatus = models.MessageStatusFailed
+		for _, e := range status.Errors {
+			log.Printf("[WhatsAppCloud] Message %s failed: %d %s", status.ID, e.Code, e.Title)
+		}
+	default:
+		log.Printf("[WhatsAppCloud] Ignoring unknown status %q for %s", status.Status, status.ID)
+		return nil
+	}
+
+	message, err := ApplyMessageStatus(inboxID, status.ID, newStatus, parseUnixSeconds(status.Timestamp))
+	if err != nil {
+		// Status de mensagens enviadas fora do NakaWoot (ex.: pelo gerenciador da Meta)
+		log.Printf("[WhatsAppCloud] Could not apply status %s to %s: %v", newStatus, status.ID, err)
+		return nil
+	}
+	if message != nil {
+		DispatchMessageUpdated(message)
+	}
+	return nil
+}
+
+// parseUnixSeconds converte o timestamp em segundos (string) usado pela Cloud API
+func parseUnixSeconds(value string) time.Time {
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Now()
+	}
+	return time.Unix(seconds, 0)
+}
+
+// firstNonEmpty retorna o primeiro valor não vazio
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (whatsAppCloudChannel) SendText(msg *OutboundMessage) (*SendResult, error) {
+	payload := map[string]interface{}{
+		"type": "text",
+		"text": map[string]interface{}{"body": msg.Content, "preview_url": true},
+	}
+	return sendWhatsAppCloud(msg, payload)
+}
+
+func (whatsAppCloudChannel) SendMedia(msg *OutboundMessage) (*SendResult, error) {
+	mediaType := msg.ContentType
+	if mediaType != "image" && mediaType != "video" && mediaType != "audio" && mediaType != "document" {
+		return nil, fmt.Errorf("media type %s is %w", mediaType, ErrChannelUnsupported)
+	}
+
+	media := map[string]interface{}{"link": msg.MediaURL}
+	// Áudio não aceita legenda na Cloud API
+	if msg.Content != "" && mediaType != "audio" {
+		media["caption"] = msg.Content
+	}
+	fileName := msg.FileName
+	if mediaType == "document" {
+		if fileName == "" {
+			fileName = mediaFileName(msg.MediaURL)
+		}
+		media["filename"] = fileName
+	}
+
+	result, err := sendWhatsAppCloud(msg, map[string]interface{}{"type": mediaType, mediaType: media})
+	if err != nil {
+		return nil, err
+	}
+	if fileName != "" {
+		result.FileName = &fileName
+	}
+	return result, nil
+}
+
+// SendTemplate envia um template aprovado (permitido fora da janela de 24h)
+func (whatsAppCloudChannel) SendTemplate(msg *OutboundMessage) (*SendResult, error) {
+	if msg.Template == nil {
+		return nil, fmt.Errorf("template is required")
+	}
+
+	template := map[string]interface{}{
+		"name":     msg.Template.Name,
+		"language": map[string]string{"code": msg.Template.Language},
+	}
+	if len(msg.Template.Components) > 0 {
+		template["components"] = msg.Template.Components
+	}
+	return sendWhatsAppCloud(msg, map[string]interface{}{"type": "template", "template": template})
+}
+
+// sendWhatsAppCloud completa o payload com destinatário e citação e o envia pela Graph API
+func sendWhatsAppCloud(msg *OutboundMessage, payload map[string]interface{}) (*SendResult, error) {
+	if strings.HasSuffix(msg.Contact.Identifier, "@g.us") {
+		return nil, fmt.Errorf("group conversations are %w", ErrChannelUnsupported)
+	}
+	config, err := loadWhatsAppCloudConfig(msg.Inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	payload["messaging_product"] = "whatsapp"
+	payload["recipient_type"] = "individual"
+	payload["to"] = evolutionContactNumber(msg.Contact)
+
+	result := &SendResult{}
+	if msg.ReplyTo != nil && msg.ReplyTo.WhatsAppMessageID != nil {
+		payload["context"] = map[string]string{"message_id": *msg.ReplyTo.WhatsAppMessageID}
+		result.QuotedID = msg.ReplyTo.WhatsAppMessageID
+	}
+
+	result.ExternalID, err = newWhatsAppCloudClient(config).sendMessage(payload)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// mediaFileName extrai o nome do arquivo da URL da mídia
+func mediaFileName(mediaURL string) string {
+	if parsed, err := url.Parse(mediaURL); err == nil {
+		if name := parsed.Path[strings.LastIndex(parsed.Path, "/")+1:]; name != "" {
+			return name
+		}
+	}
+	return "document"
+}
+
+// whatsAppCloudClient cliente HTTP da Graph API para um número
+type whatsAppCloudClient struct {
+	config     *whatsAppCloudConfig
+	httpClient *http.Client
+}
+
+func newWhatsAppCloudClient(config *whatsAppCloudConfig) *whatsAppCloudClient {
+	return &whatsAppCloudClient{
+		config:     config,
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// sendMessage envia para /{phone_number_id}/messages e retorna o wamid da mensagem criada
+func (c *whatsAppCloudClient) sendMessage(payload map[string]interface{}) (*string, error) {
+	if c.config.PhoneNumberID == "" || c.config.AccessToken == "" {
+		return nil, fmt.Errorf("whatsapp cloud integration requires phone_number_id and access_token")
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	endpoint := fmt.Sprintf("%s/%s/%s/messages", c.config.GraphBaseURL, c.config.APIVersion, c.config.PhoneNumberID)
+	req, err := http.NewRequest("POST", endpoint, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	respBody, err := c.do(req, maxProviderResponseSize)
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Messages []struct {
+			ID string `json:"id"`
+		} `json:"messages"`
+	}
+	if err := json.Unmarshal(respBody, &response); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	if len(response.Messages) == 0 || response.Messages[0].ID == "" {
+		return nil, fmt.Errorf("graph API response without message id")
+	}
+	return &response.Messages[0].ID, nil
+}
+
+// storeMedia resolve a URL temporária da mídia, faz o download autenticado e grava no storage
+func (c *whatsAppCloudClient) storeMedia(mediaID, messageID, declaredMime string) (string, int64, error) {
+	if GlobalMediaStorage == nil {
+		return "", 0, fmt.Errorf("media storage not initialized")
+	}
+
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s/%s", c.config.GraphBaseURL, c.config.APIVersion, mediaID), nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	respBody, err := c.do(req, maxProviderResponseSize)
+	if err != nil {
+		return "", 0, err
+	}
+
+	var media struct {
+		URL      string `json:"url"`
+		MimeType string `json:"mime_type"`
+	}
+	if err := json.Unmarshal(respBody, &media); err != nil || media.URL == "" {
+		return "", 0, fmt.Errorf("graph API media %s without url", mediaID)
+	}
+
+	req, err = http.NewRequest("GET", media.URL, nil)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to create request: %w", err)
+	}
+	data, err := c.do(req, maxMediaDownloadSize)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to download media: %w", err)
+	}
+
+	mimeType := firstNonEmpty(declaredMime, media.MimeType, DetectMimeType(data))
+	fileName := fmt.Sprintf("%s%s", messageID, GetExtensionFromMimeType(baseMimeType(mimeType)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	storedURL, err := GlobalMediaStorage.Store(ctx, data, fileName, mimeType)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to store media: %w", err)
+	}
+	return storedURL, int64(len(data)), nil
+}
+
+// do executa a requisição autenticada e retorna o corpo (até limit bytes); erros da Graph API incluem a mensagem retornada
+func (c *whatsAppCloudClient) do(req *http.Request, limit int64) ([]byte, error) {
+	req.Header.Set("Authorization", "Bearer "+c.config.AccessToken)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, maxProviderResponseSize))
+		return nil, newProviderError("graph", resp, respBody)
+	}
+	if resp.ContentLength > limit {
+		return nil, fmt.Errorf("%w (%d bytes)", ErrTooLarge, limit)
+	}
+	return readLimited(resp.Body, limit)
+}
@@ -0,0 +1,384 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+func hubSignature(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHubSignature(t *testing.T) {
+	body := []byte(`{"object":"whatsapp_business_account"}`)
+	valid := hubSignature("app-secret", body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		header    string
+		wantValid bool
+	}{
+		{"valid", "app-secret", valid, true},
+		{"uppercase hex", "app-secret", "sha256=" + strings.ToUpper(strings.TrimPrefix(valid, "sha256=")), true},
+		{"wrong secret", "other-secret", valid, false},
+		{"missing prefix", "app-secret", strings.TrimPrefix(valid, "sha256="), false},
+		{"missing header", "app-secret", "", false},
+		{"secret not configured", "", valid, false},
+	}
+	for _, tt := range tests {
+		err := verifyHubSignature(tt.secret, tt.header, body)
+		if tt.wantValid && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.wantValid && !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%s: err = %v, want ErrInvalidSignature", tt.name, err)
+		}
+	}
+
+	if err := verifyHubSignature("app-secret", valid, []byte(`{"object":"tampered"}`)); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("tampered body: err = %v, want ErrInvalidSignature", err)
+	}
+}
+
+func TestVerifyHubChallenge(t *testing.T) {
+	query := url.Values{"hub.mode": {"subscribe"}, "hub.verify_token": {"verify-me"}, "hub.challenge": {"1158201444"}}
+
+	challenge, err := verifyHubChallenge("verify-me", query)
+	if err != nil || challenge != "1158201444" {
+		t.Fatalf("verifyHubChallenge = %q, %v; want the challenge", challenge, err)
+	}
+
+	if _, err := verifyHubChallenge("other-token", query); !errors.Is(err, ErrWebhookUnauthorized) {
+		t.Errorf("wrong token: err = %v, want ErrWebhookUnauthorized", err)
+	}
+	if _, err := verifyHubChallenge("", url.Values{"hub.mode": {"subscribe"}}); !errors.Is(err, ErrWebhookUnauthorized) {
+		t.Errorf("empty token: err = %v, want ErrWebhookUnauthorized", err)
+	}
+	unsubscribe := url.Values{"hub.mode": {"unsubscribe"}, "hub.verify_token": {"verify-me"}, "hub.challenge": {"1"}}
+	if _, err := verifyHubChallenge("verify-me", unsubscribe); !errors.Is(err, ErrWebhookUnauthorized) {
+		t.Errorf("wrong mode: err = %v, want ErrWebhookUnauthorized", err)
+	}
+}
+
+// cloudBatch lote com mensagens de dois contatos e o status de uma mensagem enviada ao primeiro
+const cloudBatch = `{
+  "object": "whatsapp_business_account",
+  "entry": [{
+    "id": "WABA_ID",
+    "changes": [{
+      "field": "messages",
+      "value": {
+        "messaging_product": "whatsapp",
+        "metadata": {"display_phone_number": "15550000000", "phone_number_id": "PHONE_ID"},
+        "contacts": [{"profile": {"name": "Ana"}, "wa_id": "5511911111111"}, {"profile": {"name": "Bruno"}, "wa_id": "5511922222222"}],
+        "messages": [
+          {"from": "5511911111111", "id": "wamid.A1", "timestamp": "1700000000", "type": "text", "text": {"body": "oi"}},
+          {"from": "5511922222222", "id": "wamid.B1", "timestamp": "1700000001", "type": "text", "text": {"body": "olá"}, "referral": {"source_type": "ad"}},
+          {"from": "5511911111111", "id": "wamid.A2", "timestamp": "1700000002", "type": "text", "text": {"body": "tudo bem?"}}
+        ],
+        "statuses": [
+          {"id": "wamid.OUT", "status": "read", "timestamp": "1700000003", "recipient_id": "5511911111111"}
+        ]
+      }
+    }]
+  }]
+}`
+
+func TestWhatsAppCloudSplitWebhook(t *testing.T) {
+	channel := whatsAppCloudChannel{}
+
+	parts := channel.SplitWebhook([]byte(cloudBatch))
+	if len(parts) != 2 {
+		t.Fatalf("SplitWebhook returned %d parts, want 2", len(parts))
+	}
+
+	wantKeys := []string{"7:5511911111111", "7:5511922222222"}
+	wantMessages := [][]string{{"wamid.A1", "wamid.A2"}, {"wamid.B1"}}
+	wantStatuses := []int{1, 0}
+	for i, part := range parts {
+		event, key := channel.RoutingInfo(7, part)
+		if event != "messages" || key != wantKeys[i] {
+			t.Errorf("part %d: RoutingInfo = %q, %q; want messages, %q", i, event, key, wantKeys[i])
+		}
+
+		var webhook cloudWebhookPayload
+		if err := json.Unmarshal(part, &webhook); err != nil {
+			t.Fatalf("part %d: %v", i, err)
+		}
+		value := webhook.Entry[0].Changes[0].Value
+		var ids []string
+		for _, message := range value.Messages {
+			ids = append(ids, message.ID)
+		}
+		if fmt.Sprint(ids) != fmt.Sprint(wantMessages[i]) {
+			t.Errorf("part %d: messages = %v, want %v", i, ids, wantMessages[i])
+		}
+		if len(value.Statuses) != wantStatuses[i] {
+			t.Errorf("part %d: %d statuses, want %d", i, len(value.Statuses), wantStatuses[i])
+		}
+		if value.Metadata.PhoneNumberID != "PHONE_ID" || len(value.Contacts) == 0 {
+			t.Errorf("part %d: metadata or contacts lost: %+v", i, value.Metadata)
+		}
+	}
+
+	// Campos que o canal não interpreta são mantidos para o replay
+	if !strings.Contains(string(parts[1]), `"referral"`) {
+		t.Errorf("split lost unknown message fields: %s", parts[1])
+	}
+
+	single := `{"object":"whatsapp_business_account","entry":[{"id":"W","changes":[{"field":"messages","value":{"messages":[{"from":"1","id":"x","type":"text"}]}}]}]}`
+	if parts := channel.SplitWebhook([]byte(single)); parts != nil {
+		t.Errorf("single-chat webhook was split into %d parts", len(parts))
+	}
+}
+
+// fakeGraph servidor da Graph API: envio de mensagens e download de mídia
+type fakeGraph struct {
+	*httptest.Server
+	sent []map[string]interface{}
+}
+
+func newFakeGraph(t *testing.T) *fakeGraph {
+	t.Helper()
+	graph := &fakeGraph{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v20.0/PHONE_ID/messages", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"message":"Invalid OAuth access token","code":190}}`)
+			return
+		}
+		var payload map[string]interface{}
+		_ = json.NewDecoder(r.Body).Decode(&payload)
+		if payload["to"] == "5511900000000" {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":{"message":"Recipient phone number not in allowed list","code":131030}}`)
+			return
+		}
+		graph.sent = append(graph.sent, payload)
+		fmt.Fprintf(w, `{"messaging_product":"whatsapp","messages":[{"id":"wamid.SENT%d"}]}`, len(graph.sent))
+	})
+	mux.HandleFunc("/v20.0/MEDIA_ID", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"url":"%s/download/MEDIA_ID","mime_type":"image/jpeg"}`, graph.URL)
+	})
+	mux.HandleFunc("/download/MEDIA_ID", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Header().Set("Content-Type", "image/jpeg")
+		fmt.Fprint(w, "\xff\xd8\xff\xe0jpeg-data")
+	})
+	mux.HandleFunc("/v20.0/HUGE_ID", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"url":"%s/download/HUGE_ID","mime_type":"video/mp4"}`, graph.URL)
+	})
+	mux.HandleFunc("/download/HUGE_ID", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", fmt.Sprint(maxMediaDownloadSize+1))
+		w.WriteHeader(http.StatusOK)
+	})
+	graph.Server = httptest.NewServer(mux)
+	t.Cleanup(graph.Close)
+	return graph
+}
+
+func (g *fakeGraph) config() *whatsAppCloudConfig {
+	return &whatsAppCloudConfig{PhoneNumberID: "PHONE_ID", AccessToken: "token", GraphBaseURL: g.URL, APIVersion: "v20.0"}
+}
+
+func TestWhatsAppCloudClientSendMessage(t *testing.T) {
+	graph := newFakeGraph(t)
+	client := newWhatsAppCloudClient(graph.config())
+
+	id, err := client.sendMessage(map[string]interface{}{"messaging_product": "whatsapp", "to": "5511911111111", "type": "text", "text": map[string]interface{}{"body": "oi"}})
+	if err != nil {
+		t.Fatalf("sendMessage: %v", err)
+	}
+	if id == nil || *id != "wamid.SENT1" {
+		t.Fatalf("sendMessage id = %v, want wamid.SENT1", id)
+	}
+	if len(graph.sent) != 1 || graph.sent[0]["to"] != "5511911111111" {
+		t.Fatalf("graph received %v", graph.sent)
+	}
+
+	_, err = client.sendMessage(map[string]interface{}{"to": "5511900000000", "type": "text"})
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("err = %v, want a 400 ProviderError", err)
+	}
+	if retryableSendError(err) {
+		t.Errorf("400 from the Graph API must not be retried")
+	}
+
+	config := graph.config()
+	config.AccessToken = "expired"
+	_, err = newWhatsAppCloudClient(config).sendMessage(map[string]interface{}{"to": "5511911111111"})
+	if !errors.As(err, &providerErr) || providerErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("err = %v, want a 401 ProviderError", err)
+	}
+}
+
+func TestWhatsAppCloudClientStoreMedia(t *testing.T) {
+	graph := newFakeGraph(t)
+	storage := useMemoryMediaStorage(t)
+	client := newWhatsAppCloudClient(graph.config())
+
+	mediaURL, size, err := client.storeMedia("MEDIA_ID", "wamid.IMG", "")
+	if err != nil {
+		t.Fatalf("storeMedia: %v", err)
+	}
+	if mediaURL != "memory://wamid.IMG.jpg" || size != int64(len("\xff\xd8\xff\xe0jpeg-data")) {
+		t.Errorf("storeMedia = %q, %d", mediaURL, size)
+	}
+	if len(storage.files) != 1 {
+		t.Errorf("stored %d files, want 1", len(storage.files))
+	}
+
+	if _, _, err := client.storeMedia("HUGE_ID", "wamid.VID", ""); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("oversized media: err = %v, want ErrTooLarge", err)
+	}
+}
+
+func TestReadLimited(t *testing.T) {
+	data, err := readLimited(strings.NewReader("12345"), 5)
+	if err != nil || string(data) != "12345" {
+		t.Errorf("readLimited at the limit = %q, %v", data, err)
+	}
+	if _, err := readLimited(strings.NewReader("123456"), 5); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("readLimited above the limit: err = %v, want ErrTooLarge", err)
+	}
+	if _, err := readLimited(io.MultiReader(strings.NewReader("1"), strings.NewReader("")), 5); err != nil {
+		t.Errorf("readLimited: %v", err)
+	}
+}
+
+func TestWhatsAppCloudProcessWebhook(t *testing.T) {
+	conn := dbtest.Open(t)
+	graph := newFakeGraph(t)
+	useMemoryMediaStorage(t)
+	inbox := createChannelInbox(t, conn, whatsAppCloudProvider, whatsAppCloudProvider, map[string]interface{}{
+		"phone_number_id": "PHONE_ID",
+		"access_token":    "token",
+		"app_secret":      "app-secret",
+		"graph_base_url":  graph.URL,
+	})
+	channel := whatsAppCloudChannel{}
+
+	inbound := `{"object":"whatsapp_business_account","entry":[{"id":"W","changes":[{"field":"messages","value":{
+		"metadata":{"phone_number_id":"PHONE_ID"},
+		"contacts":[{"profile":{"name":"Ana"},"wa_id":"5511911111111"}],
+		"messages":[
+			{"from":"5511911111111","id":"wamid.A1","timestamp":"1700000000","type":"text","text":{"body":"oi"}},
+			{"from":"5511911111111","id":"wamid.A2","timestamp":"1700000001","type":"image","image":{"id":"MEDIA_ID","mime_type":"image/jpeg","caption":"foto"}}
+		]}}]}]}`
+	if err := channel.ProcessWebhook(uint(inbox.ID), []byte(inbound)); err != nil {
+		t.Fatalf("ProcessWebhook: %v", err)
+	}
+	// Reentrega do mesmo webhook não duplica as mensagens
+	if err := channel.ProcessWebhook(uint(inbox.ID), []byte(inbound)); err != nil {
+		t.Fatalf("ProcessWebhook (redelivery): %v", err)
+	}
+
+	messages := inboxMessages(t, conn, inbox.ID)
+	if len(messages) != 2 {
+		t.Fatalf("stored %d messages, want 2", len(messages))
+	}
+	if messages[0].Content != "oi" || messages[0].MessageType != models.MessageTypeIncoming {
+		t.Errorf("text message = %q (type %d)", messages[0].Content, messages[0].MessageType)
+	}
+	if messages[1].ContentType != "image" || messages[1].MediaURL == nil || *messages[1].MediaURL != "memory://wamid.A2.jpg" {
+		t.Errorf("image message = %s %v", messages[1].ContentType, messages[1].MediaURL)
+	}
+
+	contact, err := repository.GetContact(messages[0].SenderID, uint(inbox.AccountID))
+	if err != nil || contact.Name != "Ana" || contact.PhoneNumber != "5511911111111" {
+		t.Fatalf("contact = %+v, %v", contact, err)
+	}
+
+	outgoingID := "wamid.OUT"
+	outgoing := models.Message{AccountID: uint(inbox.AccountID), InboxID: uint(inbox.ID), ConversationID: messages[0].ConversationID,
+		Content: "resposta", MessageType: models.MessageTypeOutgoing, Status: models.MessageStatusSent, WhatsAppMessageID: &outgoingID}
+	if err := conn.Omit("Conversation", "Inbox", "Account", "Reactions").Create(&outgoing).Error; err != nil {
+		t.Fatalf("create outgoing message: %v", err)
+	}
+
+	statuses := `{"object":"whatsapp_business_account","entry":[{"id":"W","changes":[{"field":"messages","value":{
+		"metadata":{"phone_number_id":"PHONE_ID"},
+		"statuses":[
+			{"id":"wamid.OUT","status":"read","timestamp":"1700000010","recipient_id":"5511911111111"},
+			{"id":"wamid.OUT","status":"delivered","timestamp":"1700000009","recipient_id":"5511911111111"}
+		]}}]}]}`
+	if err := channel.ProcessWebhook(uint(inbox.ID), []byte(statuses)); err != nil {
+		t.Fatalf("ProcessWebhook (statuses): %v", err)
+	}
+
+	updated, err := repository.GetMessageByWhatsAppID(outgoingID)
+	if err != nil {
+		t.Fatalf("GetMessageByWhatsAppID: %v", err)
+	}
+	// O "delivered" atrasado não rebaixa o "read"
+	if updated.Status != models.MessageStatusRead || updated.ReadAt == nil || updated.DeliveredAt == nil {
+		t.Errorf("status = %s (read_at %v, delivered_at %v), want read", updated.Status, updated.ReadAt, updated.DeliveredAt)
+	}
+
+	// Outro número da mesma conta Meta é ignorado
+	otherNumber := strings.Replace(inbound, `"phone_number_id":"PHONE_ID"`, `"phone_number_id":"OTHER"`, 1)
+	otherNumber = strings.NewReplacer("wamid.A1", "wamid.C1", "wamid.A2", "wamid.C2").Replace(otherNumber)
+	if err := channel.ProcessWebhook(uint(inbox.ID), []byte(otherNumber)); err != nil {
+		t.Fatalf("ProcessWebhook (other number): %v", err)
+	}
+	if n := len(inboxMessages(t, conn, inbox.ID)); n != 3 {
+		t.Errorf("messages after other number = %d, want 3", n)
+	}
+}
+
+func TestWhatsAppCloudSendText(t *testing.T) {
+	conn := dbtest.Open(t)
+	graph := newFakeGraph(t)
+	inbox := createChannelInbox(t, conn, whatsAppCloudProvider, whatsAppCloudProvider, map[string]interface{}{
+		"phone_number_id": "PHONE_ID",
+		"access_token":    "token",
+		"graph_base_url":  graph.URL,
+	})
+
+	quotedID := "wamid.A1"
+	result, err := whatsAppCloudChannel{}.SendText(&OutboundMessage{
+		Inbox:   inbox,
+		Contact: &models.Contact{PhoneNumber: "5511911111111"},
+		Content: "olá",
+		ReplyTo: &models.Message{WhatsAppMessageID: &quotedID},
+	})
+	if err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	if result.ExternalID == nil || *result.ExternalID != "wamid.SENT1" || result.QuotedID == nil {
+		t.Errorf("result = %+v", result)
+	}
+
+	sent := graph.sent[0]
+	text, _ := sent["text"].(map[string]interface{})
+	context, _ := sent["context"].(map[string]interface{})
+	if sent["to"] != "5511911111111" || text["body"] != "olá" || context["message_id"] != "wamid.A1" {
+		t.Errorf("graph received %v", sent)
+	}
+
+	if _, err := (whatsAppCloudChannel{}).SendText(&OutboundMessage{Inbox: inbox, Contact: &models.Contact{Identifier: "123@g.us"}, Content: "x"}); !errors.Is(err, ErrChannelUnsupported) {
+		t.Errorf("group send: err = %v, want ErrChannelUnsupported", err)
+	}
+}
@@ -0,0 +1,93 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"mensager-go/internal/repository"
+	"strings"
+)
+
+// processContactsSync cria ou atualiza contatos em lote a partir dos eventos contacts.upsert/contacts.update
+// (Evolution v2) e Contact/PushName (Evolution Go)
+func processContactsSync(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	items := webhook.DataList
+	if len(items) == 0 && webhook.Data != nil {
+		items = []map[string]interface{}{webhook.Data}
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+
+	// O mesmo contato pode vir repetido no lote: o último valor prevalece
+	entries := make([]repository.WhatsAppContactSync, 0, len(items))
+	index := make(map[string]int, len(items))
+	for _, item := range items {
+		entry, ok := parseContactSync(item)
+		if !ok {
+			continue
+		}
+		if i, exists := index[entry.PhoneNumber]; exists {
+			if entry.Name == "" {
+				entry.Name = entries[i].Name
+			}
+			if entry.AvatarURL == "" {
+				entry.AvatarURL = entries[i].AvatarURL
+			}
+			entries[i] = entry
+			continue
+		}
+		index[entry.PhoneNumber] = len(entries)
+		entries = append(entries, entry)
+	}
+
+	created, updated, err := repository.BulkUpsertWhatsAppContacts(uint(inbox.AccountID), entries)
+	if err != nil {
+		return fmt.Errorf("failed to sync contacts: %w", err)
+	}
+
+	if created > 0 || updated > 0 {
+		log.Printf("[processContactsSync] Inbox %d: %d contacts created, %d updated (event=%s)", inboxID, created, updated, webhook.Event)
+	}
+	return nil
+}
+
+// parseContactSync extrai JID, nome e avatar de um contato; grupos, listas de transmissão e canais são ignorados
+func parseContactSync(item map[string]interface{}) (repository.WhatsAppContactSync, bool) {
+	jid := firstString(item, "remoteJid", "id", "JID", "jid")
+	if jid == "" || !strings.Contains(jid, "@") {
+		return repository.WhatsAppContactSync{}, false
+	}
+	if strings.HasSuffix(jid, "@g.us") || strings.HasSuffix(jid, "@broadcast") || strings.HasSuffix(jid, "@newsletter") {
+		return repository.WhatsAppContactSync{}, false
+	}
+
+	phone := extractPhoneNumber(jid)
+	if phone == "" {
+		return repository.WhatsAppContactSync{}, false
+	}
+
+	name := firstString(item, "pushName", "name", "notify", "verifiedName", "NewPushName", "FullName", "PushName")
+	if name == "" {
+		// Evolution Go: {"JID": ..., "Action": {"fullName": ..., "firstName": ...}}
+		if action, ok := item["Action"].(map[string]interface{}); ok {
+			name = firstString(action, "fullName", "firstName")
+		}
+	}
+
+	avatar := firstString(item, "profilePicUrl", "profilePictureUrl", "imgUrl")
+	if !strings.HasPrefix(avatar, "http") {
+		avatar = ""
+	}
+
+	return repository.WhatsAppContactSync{
+		PhoneNumber: phone,
+		Identifier:  jid,
+		Name:        strings.TrimSpace(name),
+		AvatarURL:   avatar,
+	}, true
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"bufio"
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// imapCommandTimeout prazo de cada comando IMAP (inclui o download da mensagem)
+const imapCommandTimeout = 2 * time.Minute
+
+// maxEmailSize tamanho máximo de um email (literal IMAP) aceito do servidor
+const maxEmailSize = 50 << 20
+
+// imapClient cliente IMAP4rev1 mínimo: apenas o necessário para ler novas mensagens por UID
+type imapClient struct {
+	conn net.Conn
+	r    *bufio.Reader
+	tag  int
+}
+
+// imapResponse resposta não marcada (*) com os literais ({n}) que ela trouxe
+type imapResponse struct {
+	Text     string
+	Literals [][]byte
+}
+
+// imapMailboxStatus dados do SELECT usados para acompanhar novos UIDs
+type imapMailboxStatus struct {
+	UIDValidity uint32
+	UIDNext     uint32
+}
+
+var (
+	imapLiteralPattern     = regexp.MustCompile(`\{(\d+)\}$`)
+	imapUIDValidityPattern = regexp.MustCompile(`\[UIDVALIDITY (\d+)\]`)
+	imapUIDNextPattern     = regexp.MustCompile(`\[UIDNEXT (\d+)\]`)
+)
+
+// dialIMAP conecta ao servidor (TLS implícito quando useTLS) e lê a saudação
+func dialIMAP(host string, port int, useTLS bool) (*imapClient, error) {
+	address := net.JoinHostPort(host, strconv.Itoa(port))
+	dialer := &net.Dialer{Timeout: 30 * time.Second}
+
+	var conn net.Conn
+	var err error
+	if useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{ServerName: host})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to IMAP server %s: %w", address, err)
+	}
+
+	c := &imapClient{conn: conn, r: bufio.NewReader(conn)}
+	conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	greeting, err := c.readLine()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to read IMAP greeting: %w", err)
+	}
+	if !strings.HasPrefix(greeting, "* OK") && !strings.HasPrefix(greeting, "* PREAUTH") {
+		conn.Close()
+		return nil, fmt.Errorf("unexpected IMAP greeting: %s", greeting)
+	}
+	return c, nil
+}
+
+// command envia um comando e lê as respostas até a resposta marcada, que precisa ser OK
+func (c *imapClient) command(format string, args ...interface{}) ([]imapResponse, error) {
+	c.tag++
+	tag := fmt.Sprintf("A%04d", c.tag)
+	command := fmt.Sprintf(format, args...)
+
+	c.conn.SetDeadline(time.Now().Add(imapCommandTimeout))
+	if _, err := fmt.Fprintf(c.conn, "%s %s\r\n", tag, command); err != nil {
+		return nil, fmt.Errorf("failed to send IMAP command: %w", err)
+	}
+
+	var responses []imapResponse
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read IMAP response: %w", err)
+		}
+
+		if strings.HasPrefix(line, tag+" ") {
+			status := strings.TrimPrefix(line, tag+" ")
+			if !strings.HasPrefix(strings.ToUpper(status), "OK") {
+				// Não incluir argumentos (LOGIN leva a senha) no erro
+				name := strings.SplitN(command, " ", 2)[0]
+				return nil, fmt.Errorf("IMAP %s failed: %s", name, status)
+			}
+			return responses, nil
+		}
+
+		response := imapResponse{Text: line}
+		// Literais: a linha termina com {n}, seguem n bytes e o restante da resposta
+		for {
+			match := imapLiteralPattern.FindStringSubmatch(line)
+			if match == nil {
+				break
+			}
+			// O tamanho vem do servidor: limitar antes de ler
+			size, err := strconv.ParseInt(match[1], 10, 64)
+			if err != nil || size > maxEmailSize {
+				return nil, fmt.Errorf("IMAP literal of %s bytes exceeds %d bytes: %w", match[1], maxEmailSize, ErrTooLarge)
+			}
+			literal, err := io.ReadAll(io.LimitReader(c.r, size))
+			if err != nil {
+				return nil, fmt.Errorf("failed to read IMAP literal: %w", err)
+			}
+			if int64(len(literal)) < size {
+				return nil, fmt.Errorf("failed to read IMAP literal: %w", io.ErrUnexpectedEOF)
+			}
+			response.Literals = append(response.Literals, literal)
+
+			if line, err = c.readLine(); err != nil {
+				return nil, fmt.Errorf("failed to read IMAP response: %w", err)
+			}
+			response.Text += " " + line
+		}
+		responses = append(responses, response)
+	}
+}
+
+func (c *imapClient) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *imapClient) login(username, password string) error {
+	_, err := c.command("LOGIN %s %s", imapQuote(username), imapQuote(password))
+	return err
+}
+
+// selectMailbox abre a caixa e retorna UIDVALIDITY e UIDNEXT
+func (c *imapClient) selectMailbox(mailbox string) (*imapMailboxStatus, error) {
+	responses, err := c.command("SELECT %s", imapQuote(mailbox))
+	if err != nil {
+		return nil, err
+	}
+
+	status := &imapMailboxStatus{}
+	for _, response := range responses {
+		if match := imapUIDValidityPattern.FindStringSubmatch(response.Text); match != nil {
+			value, _ := strconv.ParseUint(match[1], 10, 32)
+			status.UIDValidity = uint32(value)
+		}
+		if match := imapUIDNextPattern.FindStringSubmatch(response.Text); match != nil {
+			value, _ := strconv.ParseUint(match[1], 10, 32)
+			status.UIDNext = uint32(value)
+		}
+	}
+	return status, nil
+}
+
+// uidSearch retorna os UIDs que atendem ao critério (ex.: "UNSEEN", "UID 10:*")
+func (c *imapClient) uidSearch(criteria string) ([]uint32, error) {
+	responses, err := c.command("UID SEARCH %s", criteria)
+	if err != nil {
+		return nil, err
+	}
+
+	var uids []uint32
+	for _, response := range responses {
+		if !strings.HasPrefix(strings.ToUpper(response.Text), "* SEARCH") {
+			continue
+		}
+		for _, field := range strings.Fields(response.Text)[2:] {
+			if uid, err := strconv.ParseUint(field, 10, 32); err == nil {
+				uids = append(uids, uint32(uid))
+			}
+		}
+	}
+	return uids, nil
+}
+
+// fetchRaw baixa a mensagem completa (RFC 822) sem marcá-la como lida
+func (c *imapClient) fetchRaw(uid uint32) ([]byte, error) {
+	responses, err := c.command("UID FETCH %d (BODY.PEEK[])", uid)
+	if err != nil {
+		return nil, err
+	}
+	for _, response := range responses {
+		if len(response.Literals) > 0 {
+			return response.Literals[0], nil
+		}
+	}
+	return nil, fmt.Errorf("message UID %d not found", uid)
+}
+
+func (c *imapClient) markSeen(uid uint32) error {
+	_, err := c.command("UID STORE %d +FLAGS.SILENT (\\Seen)", uid)
+	return err
+}
+
+// close encerra a sessão (LOGOUT) e a conexão
+func (c *imapClient) close() {
+	c.command("LOGOUT")
+	c.conn.Close()
+}
+
+// imapQuote monta uma string IMAP entre aspas
+func imapQuote(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, `"`, `\"`)
+	return `"` + value + `"`
+}
@@ -0,0 +1,336 @@
+package service
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// parsedEmail dados de um email recebido usados para criar as mensagens
+type parsedEmail struct {
+	MessageID   string
+	InReplyTo   string
+	References  []string
+	Subject     string
+	From        *mail.Address
+	To          []string
+	Cc          []string
+	Date        time.Time
+	Text        string
+	HTML        string
+	Attachments []emailAttachment
+}
+
+// emailAttachment anexo de um email (recebido ou a enviar)
+type emailAttachment struct {
+	FileName    string
+	ContentType string
+	Data        []byte
+}
+
+var (
+	emailWordDecoder = &mime.WordDecoder{CharsetReader: emailCharsetReader}
+	// Início do histórico citado em respostas ("On ... wrote:" / "Em ... escreveu:")
+	emailQuoteHeaderPattern = regexp.MustCompile(`(?im)^\s*(On|Em)\s.+(wrote|escreveu):\s*$`)
+	htmlBlockPattern        = regexp.MustCompile(`(?i)<\s*(br|/p|/div|/tr|/li|/h[1-6])\s*/?>`)
+	htmlTagPattern          = regexp.MustCompile(`(?s)<[^>]*>`)
+	htmlHiddenPattern       = regexp.MustCompile(`(?is)<(style|script|head)[^>]*>.*?</(style|script|head)>`)
+	blankLinesPattern       = regexp.MustCompile(`\n{3,}`)
+)
+
+// parseEmail interpreta uma mensagem RFC 822: cabeçalhos, corpo (texto ou HTML) e anexos
+func parseEmail(raw []byte) (*parsedEmail, error) {
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse email: %w", err)
+	}
+
+	header := msg.Header
+	email := &parsedEmail{
+		MessageID:  normalizeMessageID(header.Get("Message-Id")),
+		InReplyTo:  normalizeMessageID(header.Get("In-Reply-To")),
+		References: strings.Fields(header.Get("References")),
+		Subject:    decodeEmailHeader(header.Get("Subject")),
+	}
+
+	parser := &mail.AddressParser{WordDecoder: emailWordDecoder}
+	if from, err := parser.Parse(header.Get("From")); err == nil {
+		email.From = from
+	}
+	email.To = emailAddressList(parser, header.Get("To"))
+	email.Cc = emailAddressList(parser, header.Get("Cc"))
+	if date, err := header.Date(); err == nil {
+		email.Date = date
+	} else {
+		email.Date = time.Now()
+	}
+
+	if err := email.walkPart(textproto.MIMEHeader(header), msg.Body); err != nil {
+		return nil, err
+	}
+	return email, nil
+}
+
+// walkPart percorre as partes MIME guardando o primeiro corpo texto/HTML e os anexos
+func (e *parsedEmail) walkPart(header textproto.MIMEHeader, body io.Reader) error {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", map[string]string{}
+	}
+
+	switch strings.ToLower(header.Get("Content-Transfer-Encoding")) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body)
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("failed to read email part: %w", err)
+			}
+			if err := e.walkPart(part.Header, part); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return fmt.Errorf("failed to read email body: %w", err)
+	}
+
+	disposition, dispositionParams, _ := mime.ParseMediaType(header.Get("Content-Disposition"))
+	fileName := decodeEmailHeader(firstNonEmpty(dispositionParams["filename"], params["name"]))
+	isBody := disposition != "attachment" && fileName == ""
+
+	switch {
+	case len(data) == 0:
+	case isBody && mediaType == "text/plain":
+		if e.Text == "" {
+			e.Text = decodeEmailCharset(params["charset"], data)
+		}
+	case isBody && mediaType == "text/html":
+		if e.HTML == "" {
+			e.HTML = decodeEmailCharset(params["charset"], data)
+		}
+	case !isBody || !strings.HasPrefix(mediaType, "text/"):
+		if fileName == "" {
+			fileName = "attachment" + GetExtensionFromMimeType(mediaType)
+		}
+		e.Attachments = append(e.Attachments, emailAttachment{FileName: fileName, ContentType: mediaType, Data: data})
+	}
+	return nil
+}
+
+// Body retorna o texto da mensagem sem o histórico citado (HTML convertido quando não há parte texto)
+func (e *parsedEmail) Body() string {
+	text := e.Text
+	if strings.TrimSpace(text) == "" && e.HTML != "" {
+		text = htmlToText(e.HTML)
+	}
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+
+	if loc := emailQuoteHeaderPattern.FindStringIndex(text); loc != nil && loc[0] > 0 {
+		text = text[:loc[0]]
+	}
+
+	// Remover linhas citadas (">") no final da mensagem
+	lines := strings.Split(strings.TrimRight(text, "\n "), "\n")
+	for len(lines) > 1 && strings.HasPrefix(strings.TrimSpace(lines[len(lines)-1]), ">") {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// ThreadIDs retorna os Message-IDs que a mensagem responde, do mais recente para o mais antigo
+func (e *parsedEmail) ThreadIDs() []string {
+	var ids []string
+	if e.InReplyTo != "" {
+		ids = append(ids, e.InReplyTo)
+	}
+	for i := len(e.References) - 1; i >= 0; i-- {
+		if id := normalizeMessageID(e.References[i]); id != "" && id != e.InReplyTo {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// composeEmail monta uma mensagem RFC 822 em UTF-8, com anexo opcional (multipart/mixed)
+func composeEmail(from mail.Address, to []string, subject, messageID, inReplyTo string, references []string, text string, attachment *emailAttachment) ([]byte, error) {
+	var buf bytes.Buffer
+
+	headers := [][2]string{
+		{"From", from.String()},
+		{"To", strings.Join(to, ", ")},
+		{"Subject", mime.QEncoding.Encode("utf-8", subject)},
+		{"Date", time.Now().Format(time.RFC1123Z)},
+		{"Message-ID", messageID},
+	}
+	if inReplyTo != "" {
+		headers = append(headers, [2]string{"In-Reply-To", inReplyTo})
+	}
+	if len(references) > 0 {
+		headers = append(headers, [2]string{"References", strings.Join(references, " ")})
+	}
+	headers = append(headers, [2]string{"MIME-Version", "1.0"})
+	for _, h := range headers {
+		fmt.Fprintf(&buf, "%s: %s\r\n", h[0], h[1])
+	}
+
+	if attachment == nil {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\nContent-Transfer-Encoding: quoted-printable\r\n\r\n")
+		if err := writeQuotedPrintable(&buf, text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	writer := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", writer.Boundary())
+
+	textPart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=UTF-8"},
+		"Content-Transfer-Encoding": {"quoted-printable"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := writeQuotedPrintable(textPart, text); err != nil {
+		return nil, err
+	}
+
+	contentType := firstNonEmpty(attachment.ContentType, "application/octet-stream")
+	filePart, err := writer.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {mime.FormatMediaType(contentType, map[string]string{"name": attachment.FileName})},
+		"Content-Disposition":       {mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	encoded := base64.StdEncoding.EncodeToString(attachment.Data)
+	for len(encoded) > 76 {
+		io.WriteString(filePart, encoded[:76]+"\r\n")
+		encoded = encoded[76:]
+	}
+	io.WriteString(filePart, encoded+"\r\n")
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, text string) error {
+	qp := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qp, strings.ReplaceAll(text, "\n", "\r\n")); err != nil {
+		return err
+	}
+	return qp.Close()
+}
+
+// normalizeMessageID padroniza um Message-ID no formato <id@dominio>
+func normalizeMessageID(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	if !strings.HasPrefix(value, "<") {
+		value = "<" + value
+	}
+	if !strings.HasSuffix(value, ">") {
+		value += ">"
+	}
+	return value
+}
+
+// replySubject prefixa "Re: " quando o assunto ainda não é uma resposta
+func replySubject(subject string) string {
+	if subject == "" {
+		return ""
+	}
+	if strings.HasPrefix(strings.ToLower(subject), "re:") {
+		return subject
+	}
+	return "Re: " + subject
+}
+
+func emailAddressList(parser *mail.AddressParser, value string) []string {
+	if value == "" {
+		return nil
+	}
+	addresses, err := parser.ParseList(value)
+	if err != nil {
+		return nil
+	}
+	list := make([]string, 0, len(addresses))
+	for _, address := range addresses {
+		list = append(list, address.Address)
+	}
+	return list
+}
+
+func decodeEmailHeader(value string) string {
+	if decoded, err := emailWordDecoder.DecodeHeader(value); err == nil {
+		return decoded
+	}
+	return value
+}
+
+// emailCharsetReader converte charsets comuns em emails (ISO-8859-1, Windows-1252...) para UTF-8
+func emailCharsetReader(charset string, input io.Reader) (io.Reader, error) {
+	encoding, err := htmlindex.Get(charset)
+	if err != nil {
+		return nil, fmt.Errorf("unsupported charset %s", charset)
+	}
+	return encoding.NewDecoder().Reader(input), nil
+}
+
+func decodeEmailCharset(charset string, data []byte) string {
+	if charset == "" || strings.EqualFold(charset, "utf-8") || strings.EqualFold(charset, "us-ascii") {
+		return string(data)
+	}
+	reader, err := emailCharsetReader(charset, bytes.NewReader(data))
+	if err != nil {
+		return string(data)
+	}
+	decoded, err := io.ReadAll(reader)
+	if err != nil {
+		return string(data)
+	}
+	return string(decoded)
+}
+
+// htmlToText extrai um texto legível de um corpo HTML
+func htmlToText(body string) string {
+	text := htmlHiddenPattern.ReplaceAllString(body, "")
+	text = htmlBlockPattern.ReplaceAllString(text, "\n")
+	text = htmlTagPattern.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.TrimSpace(blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n"))
+}
@@ -0,0 +1,150 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"os"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const defaultEmailPollInterval = 60 * time.Second
+
+// StartEmailPoller inicia a leitura periódica das caixas IMAP das inboxes de email (EMAIL_POLL_INTERVAL em segundos, padrão 60).
+// As mensagens novas são gravadas na fila de webhooks, que cuida do processamento e dos retries.
+func StartEmailPoller() {
+	interval := defaultEmailPollInterval
+	if n, err := strconv.Atoi(os.Getenv("EMAIL_POLL_INTERVAL")); err == nil && n > 0 {
+		interval = time.Duration(n) * time.Second
+	}
+
+	go func() {
+		for {
+			pollEmailInboxes()
+			time.Sleep(interval)
+		}
+	}()
+	log.Printf("[EmailPoller] Started with interval %s", interval)
+}
+
+func pollEmailInboxes() {
+	inboxes, err := repository.ListInboxesByChannelType(emailProvider)
+	if err != nil {
+		log.Printf("[EmailPoller] Error listing email inboxes: %v", err)
+		return
+	}
+	for i := range inboxes {
+		if err := PollEmailInbox(&inboxes[i]); err != nil {
+			log.Printf("[EmailPoller] Error polling inbox %d: %v", inboxes[i].ID, err)
+		}
+	}
+}
+
+// PollEmailInbox lê as mensagens novas da caixa IMAP da inbox e as enfileira.
+// Na primeira leitura (ou quando o UIDVALIDITY muda) importa apenas as não lidas.
+func PollEmailInbox(inbox *models.Inbox) error {
+	config, err := loadEmailConfig(inbox)
+	if err != nil {
+		return err
+	}
+	if config.IMAPHost == "" {
+		return fmt.Errorf("email integration has no imap_host")
+	}
+
+	state, err := repository.GetEmailPollState(uint(inbox.ID))
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		state = &models.EmailPollState{InboxID: uint(inbox.ID)}
+	} else if err != nil {
+		return err
+	}
+
+	err = pollEmailMailbox(inbox, config, state)
+
+	now := time.Now()
+	state.LastPolledAt = &now
+	state.LastError = ""
+	if err != nil {
+		state.LastError = err.Error()
+	}
+	if saveErr := repository.SaveEmailPollState(state); saveErr != nil {
+		log.Printf("[EmailPoller] Error saving poll state for inbox %d: %v", inbox.ID, saveErr)
+	}
+	return err
+}
+
+func pollEmailMailbox(inbox *models.Inbox, config *emailConfig, state *models.EmailPollState) error {
+	client, err := dialIMAP(config.IMAPHost, config.IMAPPort, config.IMAPTLS)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+
+	if err := client.login(config.IMAPUsername, config.IMAPPassword); err != nil {
+		return err
+	}
+	status, err := client.selectMailbox(config.Mailbox)
+	if err != nil {
+		return err
+	}
+
+	// Caixa nova, trocada ou com UIDs reiniciados: recomeçar pelas mensagens não lidas
+	fresh := state.Mailbox != config.Mailbox || state.UIDValidity != status.UIDValidity
+	var uids []uint32
+	if fresh {
+		state.Mailbox = config.Mailbox
+		state.UIDValidity = status.UIDValidity
+		state.LastUID = 0
+		uids, err = client.uidSearch("UNSEEN")
+	} else {
+		uids, err = client.uidSearch(fmt.Sprintf("UID %d:*", state.LastUID+1))
+	}
+	if err != nil {
+		return err
+	}
+
+	for _, uid := range uids {
+		// "UID n:*" sempre retorna a última mensagem, mesmo com UID menor que n
+		if uid <= state.LastUID {
+			continue
+		}
+
+		raw, err := client.fetchRaw(uid)
+		if err != nil {
+			return err
+		}
+		payload, err := json.Marshal(emailWebhookPayload{
+			Mailbox:     config.Mailbox,
+			UIDValidity: status.UIDValidity,
+			UID:         uid,
+			Raw:         raw,
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := EnqueueWebhook(uint(inbox.ID), emailProvider, payload); err != nil {
+			return err
+		}
+		if config.MarkSeen {
+			if err := client.markSeen(uid); err != nil {
+				log.Printf("[EmailPoller] Error marking UID %d as seen (inbox %d): %v", uid, inbox.ID, err)
+			}
+		}
+
+		state.LastUID = uid
+		if err := repository.SaveEmailPollState(state); err != nil {
+			return err
+		}
+	}
+
+	// Na primeira leitura as mensagens já lidas ficam para trás
+	if fresh && status.UIDNext > 0 && status.UIDNext-1 > state.LastUID {
+		state.LastUID = status.UIDNext - 1
+	}
+	return nil
+}
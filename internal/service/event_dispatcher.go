@@ -3,6 +3,7 @@ package service
 import (
 	"log"
 	"mensager-go/internal/models"
+	"time"
 )
 
 /**
@@ -17,16 +18,23 @@ type EventType string
 
 const (
 	// Eventos de Mensagem
-	EventMessageNew     EventType = "message.new"
-	EventMessageUpdated EventType = "message.updated"
+	EventMessageNew      EventType = "message.new"
+	EventMessageUpdated  EventType = "message.updated"
+	EventMessageReaction EventType = "message.reaction"
 
 	// Eventos de Conversa
 	EventConversationNew     EventType = "conversation.new"
 	EventConversationUpdated EventType = "conversation.updated"
 	EventConversationDeleted EventType = "conversation.deleted"
+	EventTypingOn            EventType = "conversation.typing_on"
+	EventTypingOff           EventType = "conversation.typing_off"
 
 	// Eventos de Inbox
-	EventInboxCleared EventType = "inbox.cleared"
+	EventInboxCleared       EventType = "inbox.cleared"
+	EventInboxHistoryImport EventType = "inbox.history_import"
+
+	// Eventos de Integração
+	EventIntegrationStatus EventType = "integration.status"
 
 	// Eventos de Conexão
 	EventConnectionEstablished EventType = "connection.established"
@@ -83,6 +91,40 @@ func DispatchMessageUpdated(message *models.Message) {
 	}
 }
 
+// MessageReactionPayload payload para evento de reação
+type MessageReactionPayload struct {
+	MessageID      uint                     `json:"message_id"`
+	ConversationID uint                     `json:"conversation_id"`
+	Reactions      []models.MessageReaction `json:"reactions"`
+}
+
+// DispatchMessageReaction dispara evento com o conjunto atual de reações de uma mensagem
+func DispatchMessageReaction(message *models.Message, reactions []models.MessageReaction) {
+	if message == nil {
+		log.Printf("[EventDispatcher] WARNING: DispatchMessageReaction called with nil message")
+		return
+	}
+
+	log.Printf("[EventDispatcher] Dispatching %s - MessageID=%d, Reactions=%d", EventMessageReaction, message.ID, len(reactions))
+
+	event := BroadcastEvent{
+		Type: string(EventMessageReaction),
+		Payload: MessageReactionPayload{
+			MessageID:      message.ID,
+			ConversationID: message.ConversationID,
+			Reactions:      reactions,
+		},
+	}
+
+	// Broadcast para conversa e conta
+	if BroadcastToConversationFunc != nil {
+		BroadcastToConversationFunc(message.ConversationID, event)
+	}
+	if BroadcastToAccountFunc != nil {
+		BroadcastToAccountFunc(message.AccountID, event)
+	}
+}
+
 // DispatchConversationNew dispara evento de nova conversa
 func DispatchConversationNew(conversation *models.Conversation) {
 	if conversation == nil {
@@ -150,6 +192,33 @@ func DispatchConversationDeleted(conversationID uint, accountID uint) {
 	}
 }
 
+// TypingPayload payload para eventos de digitação em uma conversa
+type TypingPayload struct {
+	ConversationID uint   `json:"conversation_id"`
+	SenderType     string `json:"sender_type"` // Contact, User
+	SenderID       uint   `json:"sender_id"`
+	SenderName     string `json:"sender_name,omitempty"`
+	Recording      bool   `json:"recording"` // Gravando áudio em vez de digitando
+}
+
+// DispatchTyping dispara conversation.typing_on/typing_off para os inscritos na conversa
+func DispatchTyping(payload TypingPayload, typing bool) {
+	eventType := EventTypingOff
+	if typing {
+		eventType = EventTypingOn
+	}
+
+	event := BroadcastEvent{
+		Type:    string(eventType),
+		Payload: payload,
+	}
+
+	// Broadcast apenas para a conversa
+	if BroadcastToConversationFunc != nil {
+		BroadcastToConversationFunc(payload.ConversationID, event)
+	}
+}
+
 // InboxClearedPayload payload para evento de inbox limpa
 type InboxClearedPayload struct {
 	InboxID   uint64 `json:"inbox_id"`
@@ -177,15 +246,83 @@ func DispatchInboxCleared(inboxID uint, count int64, accountID uint) {
 	}
 }
 
+// IntegrationStatusPayload payload para evento de mudança de status de uma integração
+type IntegrationStatusPayload struct {
+	IntegrationID  uint       `json:"integration_id"`
+	InboxIDs       []uint64   `json:"inbox_ids"`
+	Status         string     `json:"status"`
+	PreviousStatus string     `json:"previous_status"`
+	Reason         string     `json:"reason,omitempty"`
+	ChangedAt      *time.Time `json:"changed_at"`
+	HasQRCode      bool       `json:"has_qrcode"`
+	Disconnected   bool       `json:"disconnected"` // Agentes devem ser avisados: mensagens não serão entregues
+}
+
+// DispatchIntegrationStatus dispara evento de mudança de status da conexão de uma integração
+func DispatchIntegrationStatus(integration *models.Integration, previousStatus string, inboxIDs []uint64) {
+	if integration == nil {
+		log.Printf("[EventDispatcher] WARNING: DispatchIntegrationStatus called with nil integration")
+		return
+	}
+
+	log.Printf("[EventDispatcher] Dispatching %s - IntegrationID=%d, Status=%s -> %s",
+		EventIntegrationStatus, integration.ID, previousStatus, integration.Status)
+
+	event := BroadcastEvent{
+		Type: string(EventIntegrationStatus),
+		Payload: IntegrationStatusPayload{
+			IntegrationID:  integration.ID,
+			InboxIDs:       inboxIDs,
+			Status:         integration.Status,
+			PreviousStatus: previousStatus,
+			Reason:         integration.StatusReason,
+			ChangedAt:      integration.StatusChangedAt,
+			HasQRCode:      integration.QRCode != "",
+			Disconnected:   IsIntegrationDisconnected(integration.Status),
+		},
+	}
+
+	// Broadcast para conta
+	if BroadcastToAccountFunc != nil {
+		BroadcastToAccountFunc(integration.AccountID, event)
+	}
+}
+
+// DispatchHistoryImport dispara o progresso da importação de histórico de uma inbox (um evento por lote)
+func DispatchHistoryImport(historyImport *models.HistoryImport) {
+	if historyImport == nil {
+		log.Printf("[EventDispatcher] WARNING: DispatchHistoryImport called with nil history import")
+		return
+	}
+
+	log.Printf("[EventDispatcher] Dispatching %s - InboxID=%d, Status=%s, Imported=%d",
+		EventInboxHistoryImport, historyImport.InboxID, historyImport.Status, historyImport.MessagesImported)
+
+	event := BroadcastEvent{
+		Type:    string(EventInboxHistoryImport),
+		Payload: historyImport,
+	}
+
+	// Broadcast para conta
+	if BroadcastToAccountFunc != nil {
+		BroadcastToAccountFunc(historyImport.AccountID, event)
+	}
+}
+
 // ValidateEvent valida se um evento é válido
 func ValidateEvent(eventType EventType) bool {
 	validEvents := []EventType{
 		EventMessageNew,
 		EventMessageUpdated,
+		EventMessageReaction,
 		EventConversationNew,
 		EventConversationUpdated,
 		EventConversationDeleted,
+		EventTypingOn,
+		EventTypingOff,
 		EventInboxCleared,
+		EventInboxHistoryImport,
+		EventIntegrationStatus,
 		EventConnectionEstablished,
 		EventHeartbeat,
 	}
@@ -204,10 +341,15 @@ func GetEventTypeName(eventType EventType) string {
 	names := map[EventType]string{
 		EventMessageNew:            "Nova Mensagem",
 		EventMessageUpdated:        "Mensagem Atualizada",
+		EventMessageReaction:       "Reação na Mensagem",
 		EventConversationNew:       "Nova Conversa",
 		EventConversationUpdated:   "Conversa Atualizada",
 		EventConversationDeleted:   "Conversa Deletada",
+		EventTypingOn:              "Digitando",
+		EventTypingOff:             "Parou de Digitar",
 		EventInboxCleared:          "Inbox Limpa",
+		EventInboxHistoryImport:    "Importação de Histórico",
+		EventIntegrationStatus:     "Status da Integração",
 		EventConnectionEstablished: "Conexão Estabelecida",
 		EventHeartbeat:             "Heartbeat",
 	}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// storeEvolutionMedia armazena a mídia de uma mensagem recebida, seja embutida em base64 (webhook com
+// "Webhook Base64" ativo) ou por download do mediaUrl. Retorna a URL e o tamanho em bytes; sem mídia
+// armazenada, o tamanho vem do fileLength declarado pelo WhatsApp.
+func storeEvolutionMedia(data, messageData, media map[string]interface{}, messageID, contentType string) (*string, *int64) {
+	declaredMime := getString(media, "mimetype")
+
+	encoded := firstString(messageData, "base64")
+	if encoded == "" {
+		encoded = firstString(data, "base64")
+	}
+	if encoded != "" {
+		url, size, err := storeBase64Media(encoded, messageID, declaredMime)
+		if err == nil {
+			return &url, &size
+		}
+		log.Printf("[ProcessMessage] Error storing base64 %s for message %s: %v", contentType, messageID, err)
+	}
+
+	if url := getString(data, "mediaUrl"); url != "" {
+		// Fazer download e armazenar localmente
+		localURL, size, err := downloadAndStoreMedia(url, messageID, contentType)
+		if err != nil {
+			log.Printf("[ProcessMessage] Error downloading %s: %v", contentType, err)
+			return &url, declaredFileLength(media) // Usar URL original como fallback
+		}
+		return &localURL, &size
+	}
+
+	log.Printf("[ProcessMessage] WARNING: No base64 or mediaUrl found for %s message %s", contentType, messageID)
+	return nil, declaredFileLength(media)
+}
+
+// storeBase64Media decodifica a mídia, confere o conteúdo com o MIME type declarado e a grava no storage
+func storeBase64Media(encoded, messageID, declaredMime string) (string, int64, error) {
+	if GlobalMediaStorage == nil {
+		return "", 0, fmt.Errorf("media storage not initialized")
+	}
+
+	// Aceita também data URI (data:image/jpeg;base64,...)
+	if strings.HasPrefix(encoded, "data:") {
+		if idx := strings.Index(encoded, ","); idx >= 0 {
+			encoded = encoded[idx+1:]
+		}
+	}
+
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		if raw, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(encoded, "=")); err != nil {
+			return "", 0, fmt.Errorf("invalid base64: %w", err)
+		}
+	}
+	if len(raw) == 0 {
+		return "", 0, fmt.Errorf("empty media")
+	}
+
+	detected := DetectMimeType(raw)
+	if !mimeTypeMatches(declaredMime, detected) {
+		return "", 0, fmt.Errorf("content type %s does not match declared %s", detected, declaredMime)
+	}
+
+	mimeType := declaredMime
+	if mimeType == "" {
+		mimeType = detected
+	}
+
+	fileName := fmt.Sprintf("%s%s", messageID, GetExtensionFromMimeType(baseMimeType(mimeType)))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+
+	url, err := GlobalMediaStorage.Store(ctx, raw, fileName, mimeType)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to store media: %w", err)
+	}
+
+	log.Printf("[ProcessMessage] Base64 media stored: %s (%d bytes)", url, len(raw))
+	return url, int64(len(raw)), nil
+}
+
+// mimeTypeMatches confere o tipo detectado pelo conteúdo com o declarado pelo WhatsApp.
+// A detecção (http.DetectContentType) é limitada, então só recusa quando o conteúdo é claramente de outra categoria.
+func mimeTypeMatches(declared, detected string) bool {
+	declared = baseMimeType(declared)
+	detected = baseMimeType(detected)
+
+	if declared == "" || detected == "application/octet-stream" || declared == detected {
+		return true
+	}
+
+	declaredMajor, _, _ := strings.Cut(declared, "/")
+	detectedMajor, _, _ := strings.Cut(detected, "/")
+
+	switch declaredMajor {
+	case "image":
+		return detectedMajor == "image"
+	case "audio", "video":
+		// Contêineres (mp4, webm, ogg) são detectados sem distinguir áudio de vídeo
+		return detectedMajor == "audio" || detectedMajor == "video" || detected == "application/ogg"
+	default:
+		// Documentos podem ter qualquer conteúdo (office é zip, csv é texto...)
+		return true
+	}
+}
+
+// baseMimeType remove parâmetros do MIME type (ex.: "audio/ogg; codecs=opus" -> "audio/ogg")
+func baseMimeType(mimeType string) string {
+	base, _, _ := strings.Cut(mimeType, ";")
+	return strings.ToLower(strings.TrimSpace(base))
+}
+
+// declaredFileLength tamanho informado pelo WhatsApp (fileLength pode vir como número ou string)
+func declaredFileLength(media map[string]interface{}) *int64 {
+	switch v := media["fileLength"].(type) {
+	case float64:
+		size := int64(v)
+		return &size
+	case string:
+		if size, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return &size
+		}
+	}
+	return nil
+}
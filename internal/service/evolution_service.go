@@ -1,14 +1,15 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
 	"log"
-	"mensager-go/internal/db"
 	"mensager-go/internal/models"
 	"mensager-go/internal/repository"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -87,6 +88,32 @@ type EvolutionWebhookPayload struct {
 	InstanceID    string                 `json:"instanceId"`
 	InstanceName  string                 `json:"instanceName"`
 	Data          map[string]interface{} `json:"data"`
+	// DataList recebe "data" quando a Evolution envia um lote (array), como em groups.upsert
+	DataList []map[string]interface{} `json:"-"`
+}
+
+// UnmarshalJSON aceita "data" tanto como objeto quanto como array de objetos
+func (p *EvolutionWebhookPayload) UnmarshalJSON(payload []byte) error {
+	type alias EvolutionWebhookPayload
+	var raw struct {
+		alias
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return err
+	}
+
+	*p = EvolutionWebhookPayload(raw.alias)
+
+	data := bytes.TrimSpace(raw.Data)
+	switch {
+	case len(data) == 0 || bytes.Equal(data, []byte("null")):
+		return nil
+	case data[0] == '[':
+		return json.Unmarshal(data, &p.DataList)
+	default:
+		return json.Unmarshal(data, &p.Data)
+	}
 }
 
 // Evolution Message Key estrutura
@@ -110,22 +137,86 @@ func ProcessEvolutionWebhook(inboxID uint, payload []byte) error {
 		return nil
 	}
 
-	// Processa apenas eventos de mensagem
-	if webhookData.Event != "Message" {
+	switch webhookData.Event {
+	case "Message":
+		return processMessage(inboxID, &webhookData)
+	case "Receipt", "MessagesUpdate", "messages.update", "ack":
+		// Confirmações de entrega/leitura de mensagens enviadas
+		return processMessageStatus(inboxID, &webhookData)
+	case "messages.delete", "MessagesDelete":
+		return processMessageDelete(inboxID, &webhookData)
+	case "messages.edited", "MessagesEdited":
+		return processMessageEdited(inboxID, &webhookData)
+	case "GroupInfo", "JoinedGroup", "groups.upsert", "groups.update", "group-participants.update":
+		return processGroupEvent(inboxID, &webhookData)
+	case "connection.update", "CONNECTION_UPDATE", "Connected", "PairSuccess", "Disconnected", "LoggedOut",
+		"StreamReplaced", "TemporaryBan", "ConnectFailure", "ClientOutdated":
+		return processConnectionUpdate(inboxID, &webhookData)
+	case "qrcode.updated", "QRCODE_UPDATED", "QRCode":
+		return processQRCodeUpdate(inboxID, &webhookData)
+	case "presence.update", "PRESENCE_UPDATE", "ChatPresence":
+		return processPresence(inboxID, &webhookData)
+	case "contacts.upsert", "contacts.update", "CONTACTS_UPSERT", "CONTACTS_UPDATE", "Contact", "PushName":
+		return processContactsSync(inboxID, &webhookData)
+	case "messages.set", "MESSAGES_SET", "chats.set", "CHATS_SET", "messaging-history.set", "HistorySync":
+		return processHistorySync(inboxID, &webhookData)
+	default:
 		// Ignorar outros eventos por enquanto
 		return nil
 	}
+}
+
+// outboxEchoMatches indica se o eco tem o tipo e o texto da mensagem enviada pelo outbox
+// (as menções da Evolution apenas acrescentam "@número" ao fim do texto)
+func outboxEchoMatches(message *models.Message, messageData map[string]interface{}) bool {
+	contentType, content := evolutionEchoContent(messageData)
+	if contentType != message.ContentType {
+		return false
+	}
+	switch contentType {
+	case "text", "image", "video":
+		return strings.HasPrefix(strings.TrimSpace(content), strings.TrimSpace(message.Content))
+	}
+	return true
+}
 
-	return processMessage(inboxID, &webhookData)
+// evolutionEchoContent tipo e texto (ou legenda) de uma mensagem, sem baixar a mídia
+func evolutionEchoContent(messageData map[string]interface{}) (string, string) {
+	for key, contentType := range map[string]string{
+		"imageMessage":    "image",
+		"videoMessage":    "video",
+		"audioMessage":    "audio",
+		"documentMessage": "document",
+		"stickerMessage":  "sticker",
+	} {
+		if media, ok := messageData[key].(map[string]interface{}); ok {
+			caption, _ := media["caption"].(string)
+			return contentType, caption
+		}
+	}
+	if text, ok := messageData["conversation"].(string); ok {
+		return "text", text
+	}
+	if extended, ok := messageData["extendedTextMessage"].(map[string]interface{}); ok {
+		text, _ := extended["text"].(string)
+		return "text", text
+	}
+	return "", ""
 }
 
 func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
-	data := webhook.Data
+	_, err := saveEvolutionMessage(inboxID, webhook, webhook.Data, false)
+	return err
+}
 
+// saveEvolutionMessage grava uma mensagem recebida da Evolution. Em modo histórico (importação) a mensagem
+// mantém a data original, não reabre a conversa, não incrementa unread_count e não dispara eventos;
+// retorna nil quando a mensagem já existe ou não gera uma nova mensagem.
+func saveEvolutionMessage(inboxID uint, webhook *EvolutionWebhookPayload, data map[string]interface{}, history bool) (*models.Message, error) {
 	// Extrair chave da mensagem
 	keyData, ok := data["key"].(map[string]interface{})
 	if !ok {
-		return fmt.Errorf("invalid message key structure")
+		return nil, fmt.Errorf("invalid message key structure")
 	}
 
 	remoteJid := getString(keyData, "remoteJid")
@@ -133,53 +224,121 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 	messageID := getString(keyData, "id")
 
 	if messageID == "" {
-		return fmt.Errorf("message ID is required")
+		return nil, fmt.Errorf("message ID is required")
+	}
+
+	// Mensagens de protocolo (apagar para todos / editar) alteram uma mensagem existente
+	// No histórico elas são ignoradas: o estado final já vem nas próprias mensagens
+	if history {
+		if isMessageUpdateOnly(data) {
+			return nil, nil
+		}
+	} else if handled, err := processProtocolMessage(inboxID, data); handled {
+		return nil, err
+	}
+
+	// Reações alteram uma mensagem existente em vez de criar uma nova
+	if messageData, ok := data["message"].(map[string]interface{}); ok && !history {
+		if reaction, ok := messageData["reactionMessage"].(map[string]interface{}); ok {
+			return nil, processReaction(inboxID, keyData, reaction)
+		}
+		if pollUpdate, ok := messageData["pollUpdateMessage"].(map[string]interface{}); ok {
+			return nil, processPollVote(inboxID, keyData, pollUpdate)
+		}
 	}
 
 	// Verificar se a mensagem já foi processada (evitar duplicação)
 	existingMsg, err := repository.GetMessageByWhatsAppID(messageID)
 	if err == nil && existingMsg != nil {
 		log.Printf("[processMessage] Message already exists with WhatsApp ID %s, skipping", messageID)
-		return nil // Mensagem já processada, ignorar
+		return nil, nil // Mensagem já processada, ignorar
 	}
 
 	// Buscar ou criar inbox
 	inbox, err := repository.GetInboxByID(inboxID)
 	if err != nil {
-		return fmt.Errorf("inbox not found: %w", err)
-	}
-
-	// Extrair número do telefone do RemoteJid
-	phoneNumber := extractPhoneNumber(remoteJid)
-
-	// Buscar ou criar contato
-	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), phoneNumber, remoteJid)
-	if err != nil {
-		return fmt.Errorf("failed to find/create contact: %w", err)
+		return nil, fmt.Errorf("inbox not found: %w", err)
 	}
 
-	// Atualizar nome e avatar do contato se disponível
+	isGroup := strings.HasSuffix(remoteJid, "@g.us")
 	pushName := getString(data, "pushName")
 	profilePicUrl := getString(data, "profilePicUrl")
 
-	updated := false
-	if pushName != "" && contact.Name != pushName {
-		contact.Name = pushName
-		updated = true
-	}
-	if profilePicUrl != "" && contact.AvatarURL != profilePicUrl {
-		contact.AvatarURL = profilePicUrl
-		updated = true
+	// contact é o dono da conversa (o próprio contato ou o grupo); sender é o autor da mensagem
+	var contact, sender *models.Contact
+	var participant *string
+	if isGroup {
+		group, groupContact, err := resolveGroup(inbox, remoteJid, data)
+		if err != nil {
+			return nil, err
+		}
+		contact = groupContact
+
+		if participantJID := extractParticipantJID(data, keyData); participantJID != "" {
+			participant = &participantJID
+			if !fromMe {
+				sender, err = resolveGroupParticipant(inbox, group, participantJID)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		// O avatar enviado junto da mensagem é o do grupo, sincronizado à parte
+		profilePicUrl = ""
+	} else {
+		// Extrair número do telefone do RemoteJid
+		phoneNumber := extractPhoneNumber(remoteJid)
+
+		// Buscar ou criar contato
+		contact, err = repository.FindOrCreateContactByPhone(uint(inbox.AccountID), phoneNumber, remoteJid)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find/create contact: %w", err)
+		}
+		sender = contact
 	}
 
-	if updated {
-		repository.UpdateContact(contact)
+	// Atualizar nome e avatar do autor se disponível (em mensagens enviadas o pushName é o nosso)
+	if sender != nil && !fromMe {
+		updated := false
+		if pushName != "" && sender.Name != pushName && !sender.NameManuallySet {
+			sender.Name = pushName
+			updated = true
+		}
+		if profilePicUrl != "" && sender.AvatarURL != profilePicUrl {
+			sender.AvatarURL = profilePicUrl
+			updated = true
+		}
+
+		if updated {
+			repository.UpdateContact(sender)
+		}
 	}
 
+	// Timestamp original do WhatsApp
+	timestamp := messageTimestamp(data)
+
 	// Buscar ou criar conversa
-	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), inboxID, uint(contact.ID))
+	var conversation *models.Conversation
+	if history {
+		conversation, _, err = repository.FindOrCreateHistoryConversation(uint(inbox.AccountID), inboxID, uint(contact.ID), timestamp)
+	} else {
+		conversation, err = repository.FindOrCreateConversation(uint(inbox.AccountID), inboxID, uint(contact.ID))
+	}
 	if err != nil {
-		return fmt.Errorf("failed to find/create conversation: %w", err)
+		return nil, fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	// Eco que pode ser do envio em andamento na conversa: o ID devolvido pelo provedor (gravado pelo outbox)
+	// decide. O webhook volta à fila e, na nova tentativa, é ignorado (mesmo ID) ou gravado como mensagem enviada
+	if fromMe && !history {
+		pending, err := repository.GetProcessingOutboxMessage(uint(conversation.ID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check in-flight send: %w", err)
+		}
+		messageData, _ := data["message"].(map[string]interface{})
+		if pending != nil && outboxEchoMatches(pending, messageData) {
+			return nil, fmt.Errorf("echo %s may belong to queued message %d, waiting for the provider ID", messageID, pending.ID)
+		}
 	}
 
 	// Extrair conteúdo da mensagem
@@ -190,6 +349,7 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 	var fileName *string
 	var fileSize *int64
 	var caption *string
+	var contentAttributes models.ContentAttributes
 
 	messageData, _ := data["message"].(map[string]interface{})
 	if messageData != nil {
@@ -198,102 +358,68 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 			messageContent = conv
 		}
 
+		// Texto estendido, localização, contatos, enquetes e figurinhas
+		if parsed := parseStructuredContent(messageData); parsed != nil {
+			contentType = parsed.ContentType
+			messageContent = parsed.Content
+			contentAttributes = parsed.Attributes
+		}
+
 		// Mensagem de imagem
 		if imgMsg, ok := messageData["imageMessage"].(map[string]interface{}); ok {
 			contentType = "image"
-
-			// Debug: log media URL field
-			rawMediaUrl := data["mediaUrl"]
-			log.Printf("[ProcessMessage] Image message detected. mediaUrl field: %v (type: %T)", rawMediaUrl, rawMediaUrl)
-
-			if url, ok := data["mediaUrl"].(string); ok && url != "" {
-				log.Printf("[ProcessMessage] Downloading media from: %s", url)
-				// Fazer download e armazenar localmente
-				localURL, err := downloadAndStoreMedia(url, messageID, contentType)
-				if err != nil {
-					log.Printf("[ProcessMessage] Error downloading image: %v", err)
-					mediaURL = &url // Usar URL original como fallback
-				} else {
-					log.Printf("[ProcessMessage] Media downloaded and stored: %s", localURL)
-					mediaURL = &localURL
-				}
-			} else {
-				log.Printf("[ProcessMessage] WARNING: No mediaUrl found for image message")
+			if mime, ok := imgMsg["mimetype"].(string); ok {
+				mimeType = &mime
 			}
+			mediaURL, fileSize = storeEvolutionMedia(data, messageData, imgMsg, messageID, contentType)
 			if cap, ok := imgMsg["caption"].(string); ok {
 				caption = &cap
 				messageContent = cap
 			}
-			if mime, ok := imgMsg["mimetype"].(string); ok {
-				mimeType = &mime
-			}
 		}
 
 		// Mensagem de vídeo
 		if vidMsg, ok := messageData["videoMessage"].(map[string]interface{}); ok {
 			contentType = "video"
-			if url, ok := data["mediaUrl"].(string); ok {
-				// Fazer download e armazenar localmente
-				localURL, err := downloadAndStoreMedia(url, messageID, contentType)
-				if err != nil {
-					log.Printf("[ProcessMessage] Error downloading video: %v", err)
-					mediaURL = &url // Usar URL original como fallback
-				} else {
-					mediaURL = &localURL
-				}
+			if mime, ok := vidMsg["mimetype"].(string); ok {
+				mimeType = &mime
 			}
+			mediaURL, fileSize = storeEvolutionMedia(data, messageData, vidMsg, messageID, contentType)
 			if cap, ok := vidMsg["caption"].(string); ok {
 				caption = &cap
 				messageContent = cap
 			}
-			if mime, ok := vidMsg["mimetype"].(string); ok {
-				mimeType = &mime
-			}
 		}
 
 		// Mensagem de áudio
 		if audMsg, ok := messageData["audioMessage"].(map[string]interface{}); ok {
 			contentType = "audio"
-			if url, ok := data["mediaUrl"].(string); ok {
-				// Fazer download e armazenar localmente
-				localURL, err := downloadAndStoreMedia(url, messageID, contentType)
-				if err != nil {
-					log.Printf("[ProcessMessage] Error downloading audio: %v", err)
-					mediaURL = &url // Usar URL original como fallback
-				} else {
-					mediaURL = &localURL
-				}
-			}
 			if mime, ok := audMsg["mimetype"].(string); ok {
 				mimeType = &mime
 			}
+			mediaURL, fileSize = storeEvolutionMedia(data, messageData, audMsg, messageID, contentType)
 			messageContent = "[Áudio]"
 		}
 
 		// Mensagem de documento
 		if docMsg, ok := messageData["documentMessage"].(map[string]interface{}); ok {
 			contentType = "document"
-			if url, ok := data["mediaUrl"].(string); ok {
-				// Fazer download e armazenar localmente
-				localURL, err := downloadAndStoreMedia(url, messageID, contentType)
-				if err != nil {
-					log.Printf("[ProcessMessage] Error downloading document: %v", err)
-					mediaURL = &url // Usar URL original como fallback
-				} else {
-					mediaURL = &localURL
-				}
+			if mime, ok := docMsg["mimetype"].(string); ok {
+				mimeType = &mime
 			}
+			mediaURL, fileSize = storeEvolutionMedia(data, messageData, docMsg, messageID, contentType)
 			if name, ok := docMsg["fileName"].(string); ok {
 				fileName = &name
 				messageContent = name
 			}
-			if mime, ok := docMsg["mimetype"].(string); ok {
+		}
+
+		// Figurinha (atributos já extraídos por parseStructuredContent)
+		if stickerMsg, ok := messageData["stickerMessage"].(map[string]interface{}); ok {
+			if mime, ok := stickerMsg["mimetype"].(string); ok {
 				mimeType = &mime
 			}
-			if size, ok := docMsg["fileLength"].(float64); ok {
-				fs := int64(size)
-				fileSize = &fs
-			}
+			mediaURL, fileSize = storeEvolutionMedia(data, messageData, stickerMsg, messageID, contentType)
 		}
 	}
 
@@ -303,12 +429,6 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 		messageType = models.MessageTypeOutgoing
 	}
 
-	// Timestamp
-	timestamp := time.Now()
-	if ts, ok := data["timestamp"].(float64); ok {
-		timestamp = time.Unix(int64(ts), 0)
-	}
-
 	// Status da mensagem
 	status := models.MessageStatusSent
 	statusStr := getString(data, "status")
@@ -321,12 +441,12 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 		status = models.MessageStatusFailed
 	}
 
-	// Mensagem citada
+	// Mensagem citada - resolver para o ID interno quando já estiver armazenada
 	var quotedMessageID *string
-	if quoted, ok := data["quoted"].(map[string]interface{}); ok {
-		if stanzaID, ok := quoted["stanzaID"].(string); ok {
-			quotedMessageID = &stanzaID
-		}
+	var inReplyTo *uint
+	if stanzaID := extractQuotedStanzaID(data, messageData); stanzaID != "" {
+		quotedMessageID = &stanzaID
+		inReplyTo = resolveInReplyTo(stanzaID, uint(conversation.ID))
 	}
 
 	// Dados do grupo
@@ -345,17 +465,23 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 	}
 	metadataJSON, _ := json.Marshal(metadataMap)
 
+	// Menções (@) em mensagens de grupo
+	if isGroup {
+		contentAttributes.Mentions = extractMentionedJIDs(data, messageData)
+	}
+
 	// Determinar sender_type e sender_id
 	senderType := "Contact"
 	senderID := contact.ID
+	if sender != nil {
+		senderID = sender.ID
+	}
 	if fromMe {
 		senderType = "User"
 		// TODO: Buscar user_id baseado no inbox ou account
 		senderID = 0 // Placeholder
 	}
 
-	isGroup := strings.HasSuffix(remoteJid, "@g.us")
-
 	// Criar mensagem
 	message := &models.Message{
 		Content:           messageContent,
@@ -374,8 +500,10 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 		PushName:          &pushName,
 		IsFromMe:          fromMe,
 		IsGroup:           isGroup,
+		Participant:       participant,
 		Timestamp:         &timestamp,
 		QuotedMessageID:   quotedMessageID,
+		InReplyTo:         inReplyTo,
 		MediaURL:          mediaURL,
 		MimeType:          mimeType,
 		FileName:          fileName,
@@ -383,43 +511,52 @@ func processMessage(inboxID uint, webhook *EvolutionWebhookPayload) error {
 		Caption:           caption,
 		GroupData:         groupData,
 		Metadata:          metadataJSON,
+		ContentAttributes: contentAttributes,
 		Revoked:           getBool(data, "revoked"),
 		Edited:            getBool(data, "edited"),
 	}
 
-	// Upsert mensagem (criar ou atualizar se já existe)
-	if err := repository.UpsertMessage(message); err != nil {
-		return fmt.Errorf("failed to save message: %w", err)
+	// No histórico a mensagem é ordenada pela data original
+	if history {
+		message.CreatedAt = timestamp
 	}
 
-	// Broadcast em tempo real
-	NotifyNewMessage(message)
-
-	// Atualizar última atividade da conversa
-	now := time.Now()
-	conversation.LastActivityAt = &now
-
-	// Preparar campos a atualizar
-	updates := map[string]interface{}{
-		"last_activity_at": conversation.LastActivityAt,
-		"updated_at":       now,
+	// Upsert mensagem (criar ou atualizar se já existe)
+	if err := repository.UpsertMessage(message); err != nil {
+		return nil, fmt.Errorf("failed to save message: %w", err)
 	}
 
-	// Se for mensagem incoming, incrementar unread_count
-	if messageType == models.MessageTypeIncoming {
-		conversation.UnreadCount++
-		updates["unread_count"] = conversation.UnreadCount
+	// Importação de histórico: sem eventos em tempo real nem unread_count
+	if history {
+		return message, nil
 	}
 
-	// Atualizar explicitamente no banco usando Updates para garantir persistência
-	if err := db.Instance.Model(&conversation).Updates(updates).Error; err != nil {
-		log.Printf("[ProcessMessage] Error updating conversation: %v", err)
-	}
+	publishInboundMessage(conversation, message)
 
-	// Notificar atualização da conversa para atualizar lista em tempo real
-	NotifyConversationUpdated(conversation)
+	return message, nil
+}
 
-	return nil
+// messageTimestamp lê o timestamp original da mensagem (timestamp / messageTimestamp). Além dos formatos de
+// parseEventTime, aceita segundos em string e o formato Long {low, high} do protobuf (payloads de histórico).
+func messageTimestamp(data map[string]interface{}) time.Time {
+	for _, key := range []string{"timestamp", "messageTimestamp"} {
+		switch v := data[key].(type) {
+		case nil:
+			continue
+		case string:
+			if n, err := strconv.ParseFloat(v, 64); err == nil {
+				return parseEventTime(n)
+			}
+			return parseEventTime(v)
+		case map[string]interface{}:
+			if low, ok := v["low"].(float64); ok {
+				return parseEventTime(float64(uint32(int32(low))))
+			}
+		default:
+			return parseEventTime(v)
+		}
+	}
+	return time.Now()
 }
 
 // Helper functions
@@ -446,10 +583,10 @@ func extractPhoneNumber(jid string) string {
 	return jid
 }
 
-// downloadAndStoreMedia faz download da mídia e armazena localmente
-func downloadAndStoreMedia(mediaURL, messageID, contentType string) (string, error) {
+// downloadAndStoreMedia faz download da mídia e armazena localmente, retornando a URL e o tamanho em bytes
+func downloadAndStoreMedia(mediaURL, messageID, contentType string) (string, int64, error) {
 	if GlobalMediaStorage == nil {
-		return "", fmt.Errorf("media storage not initialized")
+		return "", 0, fmt.Errorf("media storage not initialized")
 	}
 
 	// Fazer download da mídia
@@ -458,7 +595,7 @@ func downloadAndStoreMedia(mediaURL, messageID, contentType string) (string, err
 
 	data, mimeType, err := GlobalMediaStorage.Download(ctx, mediaURL)
 	if err != nil {
-		return "", fmt.Errorf("failed to download media: %w", err)
+		return "", 0, fmt.Errorf("failed to download media: %w", err)
 	}
 
 	// Gerar nome do arquivo
@@ -468,9 +605,9 @@ func downloadAndStoreMedia(mediaURL, messageID, contentType string) (string, err
 	// Armazenar arquivo localmente
 	localURL, err := GlobalMediaStorage.Store(ctx, data, fileName, mimeType)
 	if err != nil {
-		return "", fmt.Errorf("failed to store media: %w", err)
+		return "", 0, fmt.Errorf("failed to store media: %w", err)
 	}
 
 	log.Printf("[DownloadMedia] Successfully downloaded and stored: %s -> %s", mediaURL, localURL)
-	return localURL, nil
+	return localURL, int64(len(data)), nil
 }
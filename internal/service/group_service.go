@@ -0,0 +1,411 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"strings"
+	"time"
+)
+
+// groupSyncInterval intervalo mínimo entre sincronizações de metadados de um grupo
+const groupSyncInterval = 24 * time.Hour
+
+// groupInfo metadados de grupo normalizados a partir da Evolution (Evolution Go / v2)
+type groupInfo struct {
+	JID             string
+	Subject         string
+	Description     string
+	OwnerJID        string
+	AvatarURL       string
+	Participants    []groupParticipantInfo
+	HasParticipants bool // Lista completa de participantes presente no payload
+}
+
+type groupParticipantInfo struct {
+	JID          string
+	IsAdmin      bool
+	IsSuperAdmin bool
+}
+
+// resolveGroup busca ou cria o grupo de uma mensagem e agenda a sincronização dos metadados
+func resolveGroup(inbox *models.Inbox, jid string, data map[string]interface{}) (*models.Group, *models.Contact, error) {
+	subject := ""
+	if groupData, ok := data["groupData"].(map[string]interface{}); ok {
+		subject = parseGroupInfo(groupData).Subject
+	}
+
+	group, created, err := repository.FindOrCreateGroup(uint(inbox.AccountID), uint(inbox.ID), jid, subject)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find/create group: %w", err)
+	}
+
+	contact, err := repository.GetContact(group.ContactID, uint(inbox.AccountID))
+	if err != nil {
+		return nil, nil, fmt.Errorf("group contact not found: %w", err)
+	}
+
+	if created || group.SyncedAt == nil || time.Since(*group.SyncedAt) > groupSyncInterval {
+		syncGroupAsync(uint(inbox.ID), jid)
+	}
+
+	return group, contact, nil
+}
+
+// resolveGroupParticipant busca ou cria o contato do autor de uma mensagem de grupo
+// (mesma normalização de telefone dos contatos individuais) e o registra como participante
+func resolveGroupParticipant(inbox *models.Inbox, group *models.Group, participantJID string) (*models.Contact, error) {
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), extractPhoneNumber(participantJID), participantJID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find/create participant contact: %w", err)
+	}
+
+	if err := repository.AddGroupParticipant(&models.GroupParticipant{
+		GroupID:   group.ID,
+		ContactID: contact.ID,
+		JID:       participantJID,
+	}); err != nil {
+		log.Printf("[resolveGroupParticipant] Could not register participant %s in group %s: %v", participantJID, group.JID, err)
+	}
+
+	return contact, nil
+}
+
+// extractParticipantJID extrai o JID do autor de uma mensagem de grupo, priorizando o JID
+// de telefone quando a Evolution também envia o LID
+func extractParticipantJID(data, keyData map[string]interface{}) string {
+	candidates := []string{
+		getString(keyData, "participantPn"),
+		getString(keyData, "participantAlt"),
+		getString(keyData, "participant"),
+		getString(data, "participant"),
+	}
+
+	for _, jid := range candidates {
+		if strings.HasSuffix(jid, "@s.whatsapp.net") {
+			return jid
+		}
+	}
+	for _, jid := range candidates {
+		if jid != "" {
+			return jid
+		}
+	}
+	return ""
+}
+
+// extractMentionedJIDs extrai os JIDs mencionados do contextInfo da mensagem
+func extractMentionedJIDs(data, messageData map[string]interface{}) []string {
+	contexts := []interface{}{data["contextInfo"]}
+	for _, value := range messageData {
+		if inner, ok := value.(map[string]interface{}); ok {
+			contexts = append(contexts, inner["contextInfo"])
+		}
+	}
+
+	var mentions []string
+	for _, ctx := range contexts {
+		contextInfo, ok := ctx.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		list, ok := contextInfo["mentionedJid"].([]interface{})
+		if !ok {
+			continue
+		}
+		for _, item := range list {
+			if jid, ok := item.(string); ok && jid != "" {
+				mentions = append(mentions, jid)
+			}
+		}
+		if len(mentions) > 0 {
+			return mentions
+		}
+	}
+	return mentions
+}
+
+// resolveMentions converte os contatos mencionados em JIDs de participantes do grupo da conversa
+func resolveMentions(target *evolutionTarget, opts SendMessageOptions) ([]string, error) {
+	if len(opts.Mentions) == 0 && !opts.MentionAll {
+		return nil, nil
+	}
+	if !strings.HasSuffix(target.Number, "@g.us") {
+		return nil, fmt.Errorf("mentions are only supported in group conversations")
+	}
+
+	group, err := repository.GetGroupByContact(uint(target.Inbox.ID), uint(target.Conversation.ContactID))
+	if err != nil {
+		return nil, fmt.Errorf("group not found for conversation %d: %w", target.Conversation.ID, err)
+	}
+
+	jids := make([]string, 0, len(opts.Mentions))
+	for _, contactID := range opts.Mentions {
+		jid := ""
+		for _, participant := range group.Participants {
+			if participant.ContactID == contactID {
+				jid = participant.JID
+				break
+			}
+		}
+		if jid == "" {
+			return nil, fmt.Errorf("contact %d is not a participant of group %s", contactID, group.JID)
+		}
+		jids = append(jids, jid)
+	}
+
+	return jids, nil
+}
+
+// withMentionTokens acrescenta ao texto o "@<número>" de cada JID mencionado que ainda não aparece nele:
+// o WhatsApp só destaca a menção quando o token está presente no texto
+func withMentionTokens(text string, jids []string) string {
+	for _, jid := range jids {
+		number, _, _ := strings.Cut(jid, "@")
+		if number == "" || containsMentionToken(text, number) {
+			continue
+		}
+		if text != "" && !strings.HasSuffix(text, " ") && !strings.HasSuffix(text, "\n") {
+			text += " "
+		}
+		text += "@" + number
+	}
+	return text
+}
+
+// containsMentionToken indica se o texto tem "@<número>" sem outro dígito em seguida
+func containsMentionToken(text, number string) bool {
+	token := "@" + number
+	for i := strings.Index(text, token); i >= 0; {
+		end := i + len(token)
+		if end == len(text) || text[end] < '0' || text[end] > '9' {
+			return true
+		}
+		next := strings.Index(text[end:], token)
+		if next < 0 {
+			return false
+		}
+		i = end + next
+	}
+	return false
+}
+
+// processGroupEvent processa eventos de criação/atualização de grupos e de participantes
+func processGroupEvent(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+
+	items := webhook.DataList
+	if webhook.Data != nil {
+		items = append(items, webhook.Data)
+	}
+
+	for _, item := range items {
+		info := parseGroupInfo(item)
+		if info.JID == "" {
+			continue
+		}
+
+		if _, err := applyGroupInfo(inbox, info); err != nil {
+			log.Printf("[processGroupEvent] Could not apply group %s: %v", info.JID, err)
+			continue
+		}
+
+		// Eventos parciais (entrada/saída, promoção) não trazem a lista completa: buscar da Evolution
+		if !info.HasParticipants {
+			syncGroupAsync(inboxID, info.JID)
+		}
+	}
+
+	return nil
+}
+
+// SyncGroup busca os metadados do grupo na Evolution API e atualiza assunto, avatar e participantes
+func SyncGroup(inboxID uint, jid string) (*models.Group, error) {
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return nil, fmt.Errorf("inbox not found: %w", err)
+	}
+
+	if err := requireEvolutionInbox(inbox); err != nil {
+		return nil, err
+	}
+
+	client, err := resolveEvolutionClient(inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := client.Service.FetchGroupInfo(client.InstanceName, jid)
+	if err != nil {
+		return nil, err
+	}
+
+	info := parseGroupInfo(data)
+	if info.JID == "" {
+		info.JID = jid
+	}
+
+	return applyGroupInfo(inbox, info)
+}
+
+// syncGroupAsync sincroniza o grupo em segundo plano sem bloquear o webhook
+func syncGroupAsync(inboxID uint, jid string) {
+	go func() {
+		if _, err := SyncGroup(inboxID, jid); err != nil {
+			log.Printf("[SyncGroup] Could not sync group %s (inbox %d): %v", jid, inboxID, err)
+		}
+	}()
+}
+
+// applyGroupInfo grava os metadados recebidos no grupo e no contato que o representa
+func applyGroupInfo(inbox *models.Inbox, info groupInfo) (*models.Group, error) {
+	accountID := uint(inbox.AccountID)
+
+	group, _, err := repository.FindOrCreateGroup(accountID, uint(inbox.ID), info.JID, info.Subject)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.Subject != "" {
+		group.Subject = info.Subject
+	}
+	if info.Description != "" {
+		group.Description = info.Description
+	}
+	if info.OwnerJID != "" {
+		group.OwnerJID = info.OwnerJID
+	}
+	if info.AvatarURL != "" {
+		group.AvatarURL = info.AvatarURL
+	}
+	if info.HasParticipants {
+		now := time.Now()
+		group.SyncedAt = &now
+	}
+	if err := repository.UpdateGroup(group); err != nil {
+		return nil, fmt.Errorf("failed to update group: %w", err)
+	}
+
+	// Manter nome e avatar do contato do grupo coerentes na lista de conversas
+	if contact, err := repository.GetContact(group.ContactID, accountID); err == nil {
+		updated := false
+		if group.Subject != "" && contact.Name != group.Subject {
+			contact.Name = group.Subject
+			updated = true
+		}
+		if group.AvatarURL != "" && contact.AvatarURL != group.AvatarURL {
+			contact.AvatarURL = group.AvatarURL
+			updated = true
+		}
+		if updated {
+			repository.UpdateContact(contact)
+		}
+	}
+
+	if !info.HasParticipants {
+		return group, nil
+	}
+
+	participants := make([]models.GroupParticipant, 0, len(info.Participants))
+	for _, p := range info.Participants {
+		contact, err := repository.FindOrCreateContactByPhone(accountID, extractPhoneNumber(p.JID), p.JID)
+		if err != nil {
+			log.Printf("[applyGroupInfo] Could not find/create participant %s: %v", p.JID, err)
+			continue
+		}
+		participants = append(participants, models.GroupParticipant{
+			ContactID:    contact.ID,
+			JID:          p.JID,
+			IsAdmin:      p.IsAdmin || p.IsSuperAdmin,
+			IsSuperAdmin: p.IsSuperAdmin,
+		})
+	}
+
+	if err := repository.ReplaceGroupParticipants(group.ID, participants); err != nil {
+		return nil, fmt.Errorf("failed to update group participants: %w", err)
+	}
+	group.Participants = participants
+
+	return group, nil
+}
+
+// parseGroupInfo normaliza os metadados de grupo (Evolution v2: id/subject/participants[].admin,
+// Evolution Go: JID/Name/Topic/Participants[].IsAdmin)
+func parseGroupInfo(data map[string]interface{}) groupInfo {
+	info := groupInfo{
+		JID:         firstString(data, "id", "JID", "jid", "groupJid"),
+		Subject:     firstString(data, "subject", "Name", "name"),
+		Description: firstString(data, "desc", "description", "Topic", "topic"),
+		OwnerJID:    firstString(data, "owner", "OwnerJID", "ownerJid"),
+		AvatarURL:   firstString(data, "pictureUrl", "profilePicUrl", "PictureURL"),
+	}
+
+	// Evolution Go envia nome e descrição como objetos em eventos GroupInfo
+	if name, ok := data["Name"].(map[string]interface{}); ok && info.Subject == "" {
+		info.Subject = getString(name, "Name")
+	}
+	if topic, ok := data["Topic"].(map[string]interface{}); ok && info.Description == "" {
+		info.Description = getString(topic, "Topic")
+	}
+
+	list, ok := data["participants"].([]interface{})
+	if !ok {
+		list, ok = data["Participants"].([]interface{})
+	}
+	if !ok {
+		return info
+	}
+
+	for _, item := range list {
+		participant, ok := item.(map[string]interface{})
+		if !ok {
+			// Evolution v2 group-participants.update envia apenas os JIDs afetados
+			continue
+		}
+
+		jid := firstString(participant, "phoneNumber", "PhoneNumber")
+		if !strings.HasSuffix(jid, "@s.whatsapp.net") {
+			jid = firstString(participant, "id", "JID", "jid")
+		}
+		if jid == "" {
+			continue
+		}
+
+		admin := strings.ToLower(getString(participant, "admin"))
+		info.Participants = append(info.Participants, groupParticipantInfo{
+			JID:          jid,
+			IsAdmin:      admin == "admin" || getBool(participant, "IsAdmin"),
+			IsSuperAdmin: admin == "superadmin" || getBool(participant, "IsSuperAdmin"),
+		})
+		info.HasParticipants = true
+	}
+
+	return info
+}
+
+// firstString retorna o primeiro valor string não vazio entre as chaves informadas
+func firstString(data map[string]interface{}, keys ...string) string {
+	for _, key := range keys {
+		if value := getString(data, key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// FetchGroupInfo busca os metadados de um grupo na Evolution API
+func (s *EvolutionSendService) FetchGroupInfo(instanceName, groupJID string) (map[string]interface{}, error) {
+	resp, err := s.post("/group/info", instanceName, map[string]string{"groupJid": groupJID})
+	if err != nil {
+		return nil, err
+	}
+
+	if data, ok := resp["data"].(map[string]interface{}); ok {
+		return data, nil
+	}
+	return resp, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+
+	"gorm.io/datatypes"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/logger"
+)
+
+// memoryMediaStorage guarda as mídias em memória
+type memoryMediaStorage struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func useMemoryMediaStorage(t *testing.T) *memoryMediaStorage {
+	t.Helper()
+	storage := &memoryMediaStorage{files: map[string][]byte{}}
+	previous := GlobalMediaStorage
+	GlobalMediaStorage = storage
+	t.Cleanup(func() { GlobalMediaStorage = previous })
+	return storage
+}
+
+func (s *memoryMediaStorage) Store(ctx context.Context, data []byte, fileName string, contentType string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[fileName] = data
+	return "memory://" + fileName, nil
+}
+
+func (s *memoryMediaStorage) GetURL(ctx context.Context, fileName string) (string, error) {
+	return "memory://" + fileName, nil
+}
+
+// Download lê as mídias gravadas (memory://) ou baixa por HTTP (CDNs falsos dos testes)
+func (s *memoryMediaStorage) Download(ctx context.Context, url string) ([]byte, string, error) {
+	if fileName, ok := strings.CutPrefix(url, "memory://"); ok {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.files[fileName], "", nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	return data, resp.Header.Get("Content-Type"), err
+}
+
+// useUnreachableDB aponta db.Instance para um banco inacessível: as consultas falham com erro de conexão
+func useUnreachableDB(t *testing.T) {
+	t.Helper()
+	conn, err := gorm.Open(postgres.Open("host=127.0.0.1 port=1 user=x dbname=x sslmode=disable connect_timeout=1"), &gorm.Config{
+		DisableAutomaticPing: true,
+		Logger:               logger.Discard,
+	})
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	previous := db.Instance
+	db.Instance = conn
+	t.Cleanup(func() { db.Instance = previous })
+}
+
+// createChannelInbox cria conta, integração do provedor com o config informado e a inbox do canal
+func createChannelInbox(t *testing.T, conn *gorm.DB, provider, channelType string, config map[string]interface{}) *models.Inbox {
+	t.Helper()
+
+	account := models.Account{Name: "Test"}
+	if err := conn.Create(&account).Error; err != nil {
+		t.Fatalf("create account: %v", err)
+	}
+	configJSON, _ := json.Marshal(config)
+	integration := models.Integration{AccountID: account.ID, Provider: provider, Config: datatypes.JSON(configJSON), Status: "active"}
+	if err := conn.Omit(clause.Associations).Create(&integration).Error; err != nil {
+		t.Fatalf("create integration: %v", err)
+	}
+	inbox := models.Inbox{AccountID: uint64(account.ID), Name: provider, ChannelType: channelType, ChannelID: uint64(integration.ID)}
+	if err := conn.Create(&inbox).Error; err != nil {
+		t.Fatalf("create inbox: %v", err)
+	}
+	return &inbox
+}
+
+// inboxMessages mensagens da inbox em ordem de criação
+func inboxMessages(t *testing.T, conn *gorm.DB, inboxID uint64) []models.Message {
+	t.Helper()
+	var messages []models.Message
+	if err := conn.Where("inbox_id = ?", inboxID).Order("id").Find(&messages).Error; err != nil {
+		t.Fatalf("list messages: %v", err)
+	}
+	return messages
+}
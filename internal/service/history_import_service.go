@@ -0,0 +1,287 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"sort"
+	"strings"
+	"time"
+)
+
+// historyEvents eventos de sincronização de histórico (Evolution v2 e Evolution Go)
+var historyEvents = map[string]bool{
+	"messages.set":          true,
+	"MESSAGES_SET":          true,
+	"chats.set":             true,
+	"CHATS_SET":             true,
+	"messaging-history.set": true,
+	"HistorySync":           true,
+}
+
+// historyBatch conteúdo normalizado de um lote de histórico
+type historyBatch struct {
+	Chats     []map[string]interface{}
+	Contacts  []map[string]interface{}
+	Messages  []map[string]interface{}
+	Progress  int // -1 quando não informado
+	Completed bool
+}
+
+// processHistorySync importa um lote de histórico: contatos, conversas e mensagens com a data original.
+// As mensagens são gravadas em ordem de Timestamp, sem unread_count nem eventos por mensagem;
+// ao final o progresso da inbox é atualizado e notificado uma única vez.
+func processHistorySync(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+
+	batch := parseHistoryBatch(webhook)
+	delta := repository.HistoryImportDelta{
+		Chats:            len(batch.Chats),
+		MessagesReceived: len(batch.Messages),
+		Progress:         batch.Progress,
+		Completed:        batch.Completed,
+	}
+
+	// Última atividade importada por conversa
+	touched := map[uint]time.Time{}
+
+	var batchErr error
+	if len(batch.Contacts) > 0 {
+		entries := make([]repository.WhatsAppContactSync, 0, len(batch.Contacts))
+		for _, item := range batch.Contacts {
+			if entry, ok := parseContactSync(item); ok {
+				entries = append(entries, entry)
+			}
+		}
+		if _, _, err := repository.BulkUpsertWhatsAppContacts(uint(inbox.AccountID), entries); err != nil {
+			log.Printf("[processHistorySync] Inbox %d: error syncing contacts: %v", inboxID, err)
+			batchErr = err
+		}
+	}
+
+	for _, chat := range batch.Chats {
+		conversation, at, err := importHistoryChat(inbox, chat)
+		if err != nil {
+			log.Printf("[processHistorySync] Inbox %d: error importing chat: %v", inboxID, err)
+			batchErr = err
+			continue
+		}
+		if conversation != nil && !at.IsZero() {
+			touchHistoryConversation(touched, uint(conversation.ID), at)
+		}
+	}
+
+	// Ordem original do WhatsApp (os lotes não vêm ordenados)
+	sort.SliceStable(batch.Messages, func(i, j int) bool {
+		return messageTimestamp(batch.Messages[i]).Before(messageTimestamp(batch.Messages[j]))
+	})
+
+	for _, data := range batch.Messages {
+		keyData, _ := data["key"].(map[string]interface{})
+		if getString(keyData, "id") == "" || getString(keyData, "remoteJid") == "" || isIgnoredHistoryJID(getString(keyData, "remoteJid")) {
+			delta.MessagesSkipped++
+			continue
+		}
+
+		message, err := saveEvolutionMessage(inboxID, webhook, data, true)
+		if err != nil {
+			// Não conta como ignorada: o lote volta para a fila e a mensagem é importada na nova tentativa
+			log.Printf("[processHistorySync] Inbox %d: error importing message %s: %v", inboxID, getString(keyData, "id"), err)
+			batchErr = err
+			continue
+		}
+		if message == nil {
+			delta.MessagesSkipped++
+			continue
+		}
+
+		// Só mensagens gravadas nesta tentativa: as já existentes retornam nil acima
+		delta.MessagesImported++
+		if message.Timestamp != nil {
+			touchHistoryConversation(touched, message.ConversationID, *message.Timestamp)
+		}
+	}
+
+	for conversationID, at := range touched {
+		if err := repository.TouchConversationActivity(conversationID, at); err != nil {
+			log.Printf("[processHistorySync] Error updating last activity of conversation %d: %v", conversationID, err)
+		}
+	}
+	delta.ConversationsTouched = len(touched)
+
+	// Com erro, o lote volta para a fila; as mensagens já gravadas são ignoradas na nova tentativa
+	if batchErr != nil {
+		delta.Completed = false
+		delta.Error = batchErr.Error()
+	}
+
+	historyImport, err := repository.RecordHistoryImportBatch(uint(inbox.AccountID), inboxID, historyBatchKey(webhook), delta)
+	if err != nil {
+		log.Printf("[processHistorySync] Error recording history import progress for inbox %d: %v", inboxID, err)
+	} else {
+		DispatchHistoryImport(historyImport)
+	}
+
+	log.Printf("[processHistorySync] Inbox %d (%s): %d chats, %d/%d messages imported, %d conversations",
+		inboxID, webhook.Event, delta.Chats, delta.MessagesImported, delta.MessagesReceived, delta.ConversationsTouched)
+
+	return batchErr
+}
+
+// historyBatchKey identifica o lote pelo conteúdo: o retry pela fila de webhooks reprocessa o mesmo payload
+func historyBatchKey(webhook *EvolutionWebhookPayload) string {
+	content, _ := json.Marshal([]interface{}{webhook.Event, webhook.Data, webhook.DataList})
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// GetHistoryImport retorna o progresso da importação de histórico de uma inbox
+func GetHistoryImport(inboxID uint) (*models.HistoryImport, error) {
+	return repository.GetHistoryImport(inboxID)
+}
+
+// parseHistoryBatch normaliza os formatos de histórico:
+// - Evolution v2 messages.set / chats.set: lista em data ou {messages|chats, isLatest, progress}
+// - Evolution v2 messaging-history.set: {messages, chats, contacts, isLatest, progress}
+// - Evolution Go HistorySync: {Data: {conversations: [{id, name, messages: [{message: WebMessageInfo}]}], progress}}
+func parseHistoryBatch(webhook *EvolutionWebhookPayload) historyBatch {
+	batch := historyBatch{Progress: -1}
+
+	data := webhook.Data
+	if inner, ok := data["Data"].(map[string]interface{}); ok {
+		data = inner
+	}
+
+	if len(webhook.DataList) > 0 {
+		if strings.Contains(strings.ToLower(webhook.Event), "chats") {
+			batch.Chats = webhook.DataList
+		} else {
+			batch.Messages = webhook.DataList
+		}
+	}
+
+	batch.Messages = append(batch.Messages, historyMapList(data, "messages", "Messages")...)
+	batch.Chats = append(batch.Chats, historyMapList(data, "chats", "Chats")...)
+	batch.Contacts = historyMapList(data, "contacts", "Contacts")
+
+	for _, conversation := range historyMapList(data, "conversations", "Conversations") {
+		batch.Chats = append(batch.Chats, conversation)
+		for _, item := range historyMapList(conversation, "messages", "Messages") {
+			// HistorySyncMsg: {message: WebMessageInfo, msgOrderID}
+			if info, ok := item["message"].(map[string]interface{}); ok {
+				if _, hasKey := info["key"]; hasKey {
+					item = info
+				}
+			}
+			batch.Messages = append(batch.Messages, item)
+		}
+	}
+
+	if progress, ok := data["progress"].(float64); ok {
+		batch.Progress = int(progress)
+	}
+	batch.Completed = getBool(data, "isLatest") || batch.Progress >= 100
+
+	return batch
+}
+
+// importHistoryChat cria o contato (ou grupo) e a conversa de um chat do histórico;
+// retorna a data da última atividade do chat (zero quando não informada)
+func importHistoryChat(inbox *models.Inbox, chat map[string]interface{}) (*models.Conversation, time.Time, error) {
+	jid := firstString(chat, "id", "ID", "remoteJid", "jid")
+	if jid == "" || isIgnoredHistoryJID(jid) {
+		return nil, time.Time{}, nil
+	}
+
+	// Data da última atividade do chat, quando informada
+	var at time.Time
+	for _, key := range []string{"conversationTimestamp", "lastMessageRecvTimestamp"} {
+		if chat[key] != nil {
+			at = messageTimestamp(map[string]interface{}{"timestamp": chat[key]})
+			break
+		}
+	}
+	createdAt := at
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	var contact *models.Contact
+	if strings.HasSuffix(jid, "@g.us") {
+		_, groupContact, err := resolveGroup(inbox, jid, map[string]interface{}{
+			"groupData": map[string]interface{}{"subject": firstString(chat, "name", "subject", "Name")},
+		})
+		if err != nil {
+			return nil, at, err
+		}
+		contact = groupContact
+	} else {
+		// Nome e avatar do chat seguem as mesmas regras da sincronização de contatos
+		if entry, ok := parseContactSync(chat); ok {
+			if _, _, err := repository.BulkUpsertWhatsAppContacts(uint(inbox.AccountID), []repository.WhatsAppContactSync{entry}); err != nil {
+				return nil, at, err
+			}
+		}
+
+		var err error
+		contact, err = repository.FindOrCreateContactByPhone(uint(inbox.AccountID), extractPhoneNumber(jid), jid)
+		if err != nil {
+			return nil, at, fmt.Errorf("failed to find/create contact: %w", err)
+		}
+	}
+
+	conversation, _, err := repository.FindOrCreateHistoryConversation(uint(inbox.AccountID), uint(inbox.ID), contact.ID, createdAt)
+	if err != nil {
+		return nil, at, fmt.Errorf("failed to find/create conversation: %w", err)
+	}
+
+	return conversation, at, nil
+}
+
+// isMessageUpdateOnly indica mensagens que só alteram outra (apagar/editar, reações, votos em enquete)
+func isMessageUpdateOnly(data map[string]interface{}) bool {
+	messageData, _ := data["message"].(map[string]interface{})
+	for _, key := range []string{"protocolMessage", "editedMessage", "reactionMessage", "pollUpdateMessage"} {
+		if _, ok := messageData[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isIgnoredHistoryJID chats que não viram conversas (status, listas de transmissão e canais)
+func isIgnoredHistoryJID(jid string) bool {
+	return strings.HasSuffix(jid, "@broadcast") || strings.HasSuffix(jid, "@newsletter")
+}
+
+// touchHistoryConversation guarda a atividade mais recente de cada conversa importada
+func touchHistoryConversation(touched map[uint]time.Time, conversationID uint, at time.Time) {
+	if current, ok := touched[conversationID]; !ok || at.After(current) {
+		touched[conversationID] = at
+	}
+}
+
+// historyMapList lê uma lista de objetos do payload pela primeira chave encontrada
+func historyMapList(data map[string]interface{}, keys ...string) []map[string]interface{} {
+	for _, key := range keys {
+		list, ok := data[key].([]interface{})
+		if !ok {
+			continue
+		}
+		items := make([]map[string]interface{}, 0, len(list))
+		for _, value := range list {
+			if item, ok := value.(map[string]interface{}); ok {
+				items = append(items, item)
+			}
+		}
+		return items
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/repository"
+)
+
+func TestProcessHistorySyncCountsRetriedBatchOnce(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, "evolution", "whatsapp", map[string]interface{}{})
+
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event": "messaging-history.set",
+		"data": map[string]interface{}{
+			"messages": []interface{}{
+				map[string]interface{}{
+					"key":              map[string]interface{}{"remoteJid": "5511988880000@s.whatsapp.net", "fromMe": false, "id": "HIST1"},
+					"message":          map[string]interface{}{"conversation": "primeira"},
+					"messageTimestamp": 1700000000,
+				},
+				map[string]interface{}{
+					"key":              map[string]interface{}{"remoteJid": "5511988880000@s.whatsapp.net", "fromMe": true, "id": "HIST2"},
+					"message":          map[string]interface{}{"conversation": "segunda"},
+					"messageTimestamp": 1700000060,
+				},
+				map[string]interface{}{
+					"key":     map[string]interface{}{"remoteJid": "status@broadcast", "id": "HIST3"},
+					"message": map[string]interface{}{"conversation": "status"},
+				},
+			},
+			"progress": 50,
+		},
+	})
+
+	// Retry do mesmo lote pela fila: as mensagens e os contadores não se repetem
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := ProcessEvolutionWebhook(uint(inbox.ID), payload); err != nil {
+			t.Fatalf("ProcessEvolutionWebhook (attempt %d): %v", attempt+1, err)
+		}
+	}
+
+	if messages := inboxMessages(t, conn, inbox.ID); len(messages) != 2 {
+		t.Errorf("stored %d messages, want 2", len(messages))
+	}
+	historyImport, err := repository.GetHistoryImport(uint(inbox.ID))
+	if err != nil {
+		t.Fatalf("GetHistoryImport: %v", err)
+	}
+	if historyImport.Batches != 1 || historyImport.MessagesReceived != 3 || historyImport.MessagesImported != 2 || historyImport.MessagesSkipped != 1 {
+		t.Errorf("history import = %d batches, %d received, %d imported, %d skipped; want 1, 3, 2, 1",
+			historyImport.Batches, historyImport.MessagesReceived, historyImport.MessagesImported, historyImport.MessagesSkipped)
+	}
+}
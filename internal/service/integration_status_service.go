@@ -0,0 +1,186 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"strings"
+	"time"
+)
+
+// processConnectionUpdate processa eventos de conexão da instância (connection.update / Connected / LoggedOut...)
+func processConnectionUpdate(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	status, reason := parseConnectionState(webhook.Event, webhook.Data)
+	if status == "" {
+		log.Printf("[processConnectionUpdate] Ignoring connection event without recognizable state (event=%s)", webhook.Event)
+		return nil
+	}
+
+	inbox, integration, err := inboxIntegration(inboxID)
+	if err != nil {
+		return err
+	}
+
+	updates := map[string]interface{}{}
+	if status == models.IntegrationStatusConnected {
+		// Instância pareada: o QR code deixa de valer
+		updates["qr_code"] = ""
+		updates["qr_code_text"] = ""
+		updates["pairing_code"] = ""
+	}
+
+	return ApplyIntegrationStatus(integration, uint(inbox.ID), status, reason, webhook.Event, time.Now(), updates)
+}
+
+// processQRCodeUpdate guarda o QR code mais recente para que um admin possa parear a instância pela interface
+func processQRCodeUpdate(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	data := webhook.Data
+	qr, ok := data["qrcode"].(map[string]interface{})
+	if !ok {
+		qr = data
+	}
+
+	image := firstString(qr, "base64", "qrcode", "Qrcode", "QRCode")
+	code := firstString(qr, "code", "Code")
+	pairingCode := firstString(qr, "pairingCode", "PairingCode")
+	if image == "" && code == "" && pairingCode == "" {
+		return fmt.Errorf("qrcode event without QR code")
+	}
+
+	inbox, integration, err := inboxIntegration(inboxID)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{
+		"qr_code":            image,
+		"qr_code_text":       code,
+		"pairing_code":       pairingCode,
+		"qr_code_updated_at": now,
+	}
+
+	return ApplyIntegrationStatus(integration, uint(inbox.ID), models.IntegrationStatusQRCode, "", webhook.Event, now, updates)
+}
+
+// ApplyIntegrationStatus grava o status (e campos extras) da integração; quando o status muda,
+// registra a transição e dispara integration.status para a conta
+func ApplyIntegrationStatus(integration *models.Integration, inboxID uint, status, reason, event string, at time.Time, updates map[string]interface{}) error {
+	previousStatus := integration.Status
+	changed := previousStatus != status
+
+	if updates == nil {
+		updates = map[string]interface{}{}
+	}
+	if changed {
+		updates["status"] = status
+		updates["status_reason"] = reason
+		updates["status_changed_at"] = at
+	}
+	if len(updates) == 0 {
+		return nil
+	}
+
+	if err := repository.UpdateIntegrationFields(integration.ID, updates); err != nil {
+		return fmt.Errorf("failed to update integration status: %w", err)
+	}
+
+	// Um novo QR code também é notificado, mesmo sem mudança de status
+	_, qrUpdated := updates["qr_code_updated_at"]
+	if !changed && !qrUpdated {
+		return nil
+	}
+
+	if changed {
+		if err := repository.CreateIntegrationStatusEvent(&models.IntegrationStatusEvent{
+			IntegrationID:  integration.ID,
+			AccountID:      integration.AccountID,
+			PreviousStatus: previousStatus,
+			Status:         status,
+			Reason:         reason,
+			Event:          event,
+			OccurredAt:     at,
+		}); err != nil {
+			log.Printf("[ApplyIntegrationStatus] Error recording status transition: %v", err)
+		}
+		log.Printf("[ApplyIntegrationStatus] Integration %d: %s -> %s (%s)", integration.ID, previousStatus, status, reason)
+	}
+
+	updated, err := repository.GetIntegration(integration.ID, integration.AccountID)
+	if err != nil {
+		return err
+	}
+
+	DispatchIntegrationStatus(updated, previousStatus, integrationInboxIDs(integration.ID, inboxID))
+	return nil
+}
+
+// IsIntegrationDisconnected indica se a instância não consegue enviar/receber mensagens
+func IsIntegrationDisconnected(status string) bool {
+	return status == models.IntegrationStatusDisconnected || status == models.IntegrationStatusQRCode
+}
+
+// GetInboxConnectionStatus retorna a integração da inbox com seu status atual de conexão
+func GetInboxConnectionStatus(inbox *models.Inbox) (*models.Integration, error) {
+	return findInboxIntegration(inbox)
+}
+
+// parseConnectionState normaliza os estados de conexão (Evolution v2: state open/connecting/close,
+// Evolution Go: eventos Connected/Disconnected/LoggedOut)
+func parseConnectionState(event string, data map[string]interface{}) (string, string) {
+	reason := firstString(data, "statusReason", "reason", "Reason")
+	if code, ok := data["statusReason"].(float64); ok {
+		reason = fmt.Sprintf("%d", int(code))
+	}
+
+	switch event {
+	case "Connected", "PairSuccess":
+		return models.IntegrationStatusConnected, reason
+	case "Disconnected", "LoggedOut", "StreamReplaced", "TemporaryBan", "ConnectFailure", "ClientOutdated":
+		if reason == "" {
+			reason = event
+		}
+		return models.IntegrationStatusDisconnected, reason
+	}
+
+	switch strings.ToLower(firstString(data, "state", "status", "State")) {
+	case "open", "connected":
+		return models.IntegrationStatusConnected, reason
+	case "connecting":
+		return models.IntegrationStatusConnecting, reason
+	case "close", "closed", "disconnected", "refused":
+		return models.IntegrationStatusDisconnected, reason
+	}
+
+	return "", reason
+}
+
+// inboxIntegration busca a inbox e a integração que a atende
+func inboxIntegration(inboxID uint) (*models.Inbox, *models.Integration, error) {
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inbox not found: %w", err)
+	}
+
+	integration, err := findInboxIntegration(inbox)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return inbox, integration, nil
+}
+
+// integrationInboxIDs lista as inboxes afetadas pela integração, incluindo a que recebeu o evento
+func integrationInboxIDs(integrationID, inboxID uint) []uint64 {
+	ids, err := repository.ListInboxIDsByIntegration(integrationID)
+	if err != nil {
+		log.Printf("[integrationInboxIDs] Error listing inboxes of integration %d: %v", integrationID, err)
+	}
+	for _, id := range ids {
+		if id == uint64(inboxID) {
+			return ids
+		}
+	}
+	return append(ids, uint64(inboxID))
+}
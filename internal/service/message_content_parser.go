@@ -0,0 +1,189 @@
+package service
+
+import (
+	"fmt"
+	"mensager-go/internal/models"
+	"strings"
+)
+
+// structuredContent resultado da interpretação de mensagens não textuais do WhatsApp
+type structuredContent struct {
+	ContentType string
+	Content     string
+	Attributes  models.ContentAttributes
+}
+
+// parseStructuredContent interpreta extendedText, localização, contatos, enquetes e figurinhas.
+// Retorna nil quando a mensagem não é de nenhum desses tipos.
+func parseStructuredContent(messageData map[string]interface{}) *structuredContent {
+	if ext, ok := messageData["extendedTextMessage"].(map[string]interface{}); ok {
+		parsed := &structuredContent{ContentType: "text", Content: getString(ext, "text")}
+		if url := getString(ext, "matchedText"); url != "" {
+			parsed.Attributes.LinkPreview = &models.LinkPreviewAttributes{
+				URL:         url,
+				Title:       getString(ext, "title"),
+				Description: getString(ext, "description"),
+			}
+		}
+		return parsed
+	}
+
+	for _, key := range []string{"locationMessage", "liveLocationMessage"} {
+		if loc, ok := messageData[key].(map[string]interface{}); ok {
+			location := &models.LocationAttributes{
+				Latitude:  getFloat(loc, "degreesLatitude"),
+				Longitude: getFloat(loc, "degreesLongitude"),
+				Name:      getString(loc, "name"),
+				Address:   getString(loc, "address"),
+				URL:       getString(loc, "url"),
+				Live:      key == "liveLocationMessage",
+			}
+			content := location.Name
+			if content == "" {
+				content = location.Address
+			}
+			if content == "" {
+				content = "[Localização]"
+			}
+			return &structuredContent{
+				ContentType: "location",
+				Content:     content,
+				Attributes:  models.ContentAttributes{Location: location},
+			}
+		}
+	}
+
+	if contactMsg, ok := messageData["contactMessage"].(map[string]interface{}); ok {
+		card := parseContactCard(contactMsg)
+		return &structuredContent{
+			ContentType: "contact",
+			Content:     card.DisplayName,
+			Attributes:  models.ContentAttributes{Contacts: []models.ContactCardAttributes{card}},
+		}
+	}
+
+	if contactsMsg, ok := messageData["contactsArrayMessage"].(map[string]interface{}); ok {
+		var cards []models.ContactCardAttributes
+		if list, ok := contactsMsg["contacts"].([]interface{}); ok {
+			for _, item := range list {
+				if contactMsg, ok := item.(map[string]interface{}); ok {
+					cards = append(cards, parseContactCard(contactMsg))
+				}
+			}
+		}
+		content := getString(contactsMsg, "displayName")
+		if content == "" {
+			content = fmt.Sprintf("[%d contatos]", len(cards))
+		}
+		return &structuredContent{
+			ContentType: "contact",
+			Content:     content,
+			Attributes:  models.ContentAttributes{Contacts: cards},
+		}
+	}
+
+	for _, key := range []string{"pollCreationMessage", "pollCreationMessageV2", "pollCreationMessageV3"} {
+		if pollMsg, ok := messageData[key].(map[string]interface{}); ok {
+			poll := &models.PollAttributes{
+				Name:            getString(pollMsg, "name"),
+				SelectableCount: int(getFloat(pollMsg, "selectableOptionsCount")),
+				Options:         []models.PollOption{},
+			}
+			if options, ok := pollMsg["options"].([]interface{}); ok {
+				for _, item := range options {
+					if option, ok := item.(map[string]interface{}); ok {
+						poll.Options = append(poll.Options, models.PollOption{Name: getString(option, "optionName")})
+					}
+				}
+			}
+			return &structuredContent{
+				ContentType: "poll",
+				Content:     poll.Name,
+				Attributes:  models.ContentAttributes{Poll: poll},
+			}
+		}
+	}
+
+	if sticker, ok := messageData["stickerMessage"].(map[string]interface{}); ok {
+		return &structuredContent{
+			ContentType: "sticker",
+			Content:     "[Figurinha]",
+			Attributes: models.ContentAttributes{Sticker: &models.StickerAttributes{
+				Animated: getBool(sticker, "isAnimated"),
+				Width:    int(getFloat(sticker, "width")),
+				Height:   int(getFloat(sticker, "height")),
+			}},
+		}
+	}
+
+	return nil
+}
+
+// parseContactCard monta o cartão de contato a partir de um contactMessage
+func parseContactCard(contactMsg map[string]interface{}) models.ContactCardAttributes {
+	vcard := getString(contactMsg, "vcard")
+	card := parseVCard(vcard)
+	card.DisplayName = getString(contactMsg, "displayName")
+	if card.DisplayName == "" {
+		card.DisplayName = card.FullName
+	}
+	return card
+}
+
+// parseVCard extrai nome, organização, telefones e e-mails de um vCard (3.0/4.0)
+func parseVCard(vcard string) models.ContactCardAttributes {
+	card := models.ContactCardAttributes{VCard: vcard}
+
+	// Linhas dobradas (continuação começando com espaço) são concatenadas à anterior
+	unfolded := strings.NewReplacer("\r\n ", "", "\r\n\t", "", "\n ", "", "\n\t", "").Replace(vcard)
+
+	for _, line := range strings.Split(strings.ReplaceAll(unfolded, "\r\n", "\n"), "\n") {
+		sep := strings.Index(line, ":")
+		if sep <= 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[sep+1:])
+		params := strings.Split(line[:sep], ";")
+
+		// Remover prefixo de grupo (ex: item1.TEL)
+		name := strings.ToUpper(params[0])
+		if dot := strings.LastIndex(name, "."); dot >= 0 {
+			name = name[dot+1:]
+		}
+
+		switch name {
+		case "FN":
+			card.FullName = value
+		case "ORG":
+			card.Organization = strings.Trim(strings.ReplaceAll(value, ";", " "), " ")
+		case "EMAIL":
+			if value != "" {
+				card.Emails = append(card.Emails, value)
+			}
+		case "TEL":
+			phone := models.ContactCardPhone{Number: value}
+			for _, param := range params[1:] {
+				kv := strings.SplitN(param, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				switch strings.ToLower(kv[0]) {
+				case "waid":
+					phone.WaID = kv[1]
+				case "type":
+					phone.Type = strings.ToLower(kv[1])
+				}
+			}
+			card.Phones = append(card.Phones, phone)
+		}
+	}
+
+	return card
+}
+
+func getFloat(data map[string]interface{}, key string) float64 {
+	if val, ok := data[key].(float64); ok {
+		return val
+	}
+	return 0
+}
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+// processPollVote aplica um pollUpdateMessage (voto já decifrado pela Evolution) à enquete original
+func processPollVote(inboxID uint, keyData map[string]interface{}, pollUpdate map[string]interface{}) error {
+	pollKey, _ := pollUpdate["pollCreationMessageKey"].(map[string]interface{})
+	pollID := getString(pollKey, "id")
+	if pollID == "" {
+		return fmt.Errorf("poll vote without poll key")
+	}
+
+	vote, ok := pollUpdate["vote"].(map[string]interface{})
+	if !ok {
+		// Sem o voto decifrado não há como apurar (apenas encPayload)
+		log.Printf("[processPollVote] Vote for poll %s has no decrypted payload, skipping", pollID)
+		return nil
+	}
+
+	voter := "me"
+	if !getBool(keyData, "fromMe") {
+		voter = getString(keyData, "participant")
+		if voter == "" {
+			voter = getString(keyData, "remoteJid")
+		}
+	}
+
+	// A enquete é relida com lock: votos simultâneos não sobrescrevem uns aos outros
+	message, err := repository.ModifyMessageByWhatsAppID(pollID, func(message *models.Message) (map[string]interface{}, error) {
+		if message.InboxID != inboxID {
+			return nil, fmt.Errorf("message %s does not belong to inbox %d", pollID, inboxID)
+		}
+		poll := message.ContentAttributes.Poll
+		if poll == nil {
+			return nil, fmt.Errorf("message %s is not a poll", pollID)
+		}
+
+		var selected []string
+		if list, ok := vote["selectedOptions"].([]interface{}); ok {
+			for _, item := range list {
+				if value, ok := item.(string); ok {
+					if name := matchPollOption(poll.Options, value); name != "" {
+						selected = append(selected, name)
+					}
+				}
+			}
+		}
+
+		// Cada participante tem apenas o voto mais recente; lista vazia significa voto retirado
+		votes := make([]models.PollVote, 0, len(poll.Votes)+1)
+		for _, existing := range poll.Votes {
+			if existing.Voter != voter {
+				votes = append(votes, existing)
+			}
+		}
+		if len(selected) > 0 {
+			votes = append(votes, models.PollVote{
+				Voter:   voter,
+				Options: selected,
+				VotedAt: parseEventTime(pollUpdate["senderTimestampMs"]),
+			})
+		}
+		poll.Votes = votes
+		tallyPoll(poll)
+
+		return map[string]interface{}{"content_attributes": message.ContentAttributes}, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to apply vote to poll %s: %w", pollID, err)
+	}
+
+	DispatchMessageUpdated(message)
+	return nil
+}
+
+// matchPollOption resolve uma opção votada, enviada como nome ou como hash SHA-256 do nome
+// (formato usado pelo WhatsApp em selectedOptions, em base64 ou hex)
+func matchPollOption(options []models.PollOption, value string) string {
+	for _, option := range options {
+		if option.Name == value {
+			return option.Name
+		}
+
+		hash := sha256.Sum256([]byte(option.Name))
+		if value == base64.StdEncoding.EncodeToString(hash[:]) || value == hex.EncodeToString(hash[:]) {
+			return option.Name
+		}
+	}
+	return ""
+}
+
+// tallyPoll recalcula o total de votos de cada opção
+func tallyPoll(poll *models.PollAttributes) {
+	counts := make(map[string]int)
+	for _, vote := range poll.Votes {
+		for _, option := range vote.Options {
+			counts[option]++
+		}
+	}
+	for i := range poll.Options {
+		poll.Options[i].Votes = counts[poll.Options[i].Name]
+	}
+}
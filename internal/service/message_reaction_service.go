@@ -0,0 +1,122 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"time"
+)
+
+// processReaction aplica um reactionMessage recebido da Evolution à mensagem alvo
+func processReaction(inboxID uint, keyData map[string]interface{}, reaction map[string]interface{}) error {
+	targetKey, _ := reaction["key"].(map[string]interface{})
+	targetID := getString(targetKey, "id")
+	if targetID == "" {
+		return fmt.Errorf("reaction without target message key")
+	}
+
+	message, err := getInboxMessageByWhatsAppID(inboxID, targetID)
+	if err != nil {
+		return err
+	}
+
+	reactorType := models.ReactorTypeContact
+	var reactorID uint
+	if getBool(keyData, "fromMe") {
+		// Eco de uma reação enviada por um agente (ReactToMessage já a registrou com o agente)
+		if id := getString(keyData, "id"); id != "" {
+			if existing, err := repository.GetReactionByWhatsAppID(message.ID, id); err == nil {
+				log.Printf("[Reaction] Ignoring echo of reaction %s by %s %d", id, existing.ReactorType, existing.ReactorID)
+				return nil
+			}
+		}
+		// Reação feita pelo próprio número em outro dispositivo (celular), sem agente associado
+		reactorType = models.ReactorTypeSystem
+	} else {
+		// Em grupos quem reage é o participante, não o grupo
+		jid := getString(keyData, "participant")
+		if jid == "" {
+			jid = getString(keyData, "remoteJid")
+		}
+		contact, err := repository.FindOrCreateContactByPhone(message.AccountID, extractPhoneNumber(jid), jid)
+		if err != nil {
+			return fmt.Errorf("failed to find/create reactor contact: %w", err)
+		}
+		reactorID = contact.ID
+	}
+
+	var reactionID *string
+	if id := getString(keyData, "id"); id != "" {
+		reactionID = &id
+	}
+
+	at := parseEventTime(reaction["senderTimestampMs"])
+	_, err = applyReaction(message, reactorType, reactorID, getString(reaction, "text"), reactionID, at)
+	return err
+}
+
+// ReactToMessage envia a reação de um agente via Evolution API e a registra localmente.
+// Um emoji vazio remove a reação existente.
+func ReactToMessage(conversationID, messageID, userID uint, emoji string) ([]models.MessageReaction, error) {
+	message, err := repository.GetMessageByID(messageID)
+	if err != nil {
+		return nil, fmt.Errorf("message not found: %w", err)
+	}
+	if message.ConversationID != conversationID {
+		return nil, fmt.Errorf("message %d does not belong to conversation %d", messageID, conversationID)
+	}
+	if message.WhatsAppMessageID == nil || *message.WhatsAppMessageID == "" {
+		return nil, fmt.Errorf("message %d has no WhatsApp ID to react to", messageID)
+	}
+
+	target, err := resolveEvolutionTarget(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	reactionID, err := target.Service.SendReaction(SendReactionInput{
+		InstanceName: target.InstanceName,
+		Number:       target.Number,
+		MessageID:    *message.WhatsAppMessageID,
+		FromMe:       message.IsFromMe,
+		Reaction:     emoji,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to send reaction via Evolution API: %w", err)
+	}
+
+	return applyReaction(message, models.ReactorTypeUser, userID, emoji, reactionID, time.Now())
+}
+
+// applyReaction persiste (ou remove) a reação e notifica os clientes com a lista atualizada
+func applyReaction(message *models.Message, reactorType string, reactorID uint, emoji string, reactionID *string, at time.Time) ([]models.MessageReaction, error) {
+	if emoji == "" {
+		if err := repository.DeleteMessageReaction(message.ID, reactorType, reactorID); err != nil {
+			return nil, fmt.Errorf("failed to remove reaction: %w", err)
+		}
+	} else {
+		reaction := &models.MessageReaction{
+			MessageID:         message.ID,
+			AccountID:         message.AccountID,
+			ConversationID:    message.ConversationID,
+			ReactorType:       reactorType,
+			ReactorID:         reactorID,
+			Emoji:             emoji,
+			WhatsAppMessageID: reactionID,
+			ReactedAt:         at,
+		}
+		if err := repository.UpsertMessageReaction(reaction); err != nil {
+			return nil, fmt.Errorf("failed to save reaction: %w", err)
+		}
+	}
+
+	reactions, err := repository.ListReactionsByMessage(message.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list reactions: %w", err)
+	}
+
+	log.Printf("[Reaction] Message %d now has %d reactions (%s %d reacted %q)", message.ID, len(reactions), reactorType, reactorID, emoji)
+	DispatchMessageReaction(message, reactions)
+	return reactions, nil
+}
@@ -0,0 +1,99 @@
+package service
+
+import (
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+// extractQuotedStanzaID extrai o ID do WhatsApp da mensagem citada, seja do campo "quoted"
+// da Evolution ou do contextInfo de qualquer tipo de mensagem
+func extractQuotedStanzaID(data map[string]interface{}, messageData map[string]interface{}) string {
+	if quoted, ok := data["quoted"].(map[string]interface{}); ok {
+		for _, key := range []string{"stanzaID", "stanzaId"} {
+			if stanzaID := getString(quoted, key); stanzaID != "" {
+				return stanzaID
+			}
+		}
+	}
+
+	if contextInfo, ok := data["contextInfo"].(map[string]interface{}); ok {
+		if stanzaID := getString(contextInfo, "stanzaId"); stanzaID != "" {
+			return stanzaID
+		}
+	}
+
+	for _, value := range messageData {
+		inner, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if contextInfo, ok := inner["contextInfo"].(map[string]interface{}); ok {
+			if stanzaID := getString(contextInfo, "stanzaId"); stanzaID != "" {
+				return stanzaID
+			}
+		}
+	}
+
+	return ""
+}
+
+// resolveInReplyTo converte o ID do WhatsApp citado no ID interno, desde que a mensagem
+// pertença à mesma conversa
+func resolveInReplyTo(stanzaID string, conversationID uint) *uint {
+	quoted, err := repository.GetMessageByWhatsAppID(stanzaID)
+	if err != nil || quoted.ConversationID != conversationID {
+		return nil
+	}
+	return &quoted.ID
+}
+
+// AttachQuotedPreviews preenche QuotedMessage das mensagens que respondem a outra. Apenas leitura:
+// citações sem in_reply_to (gravadas antes da mensagem citada) são buscadas pelo ID do WhatsApp.
+func AttachQuotedPreviews(messages []models.Message) error {
+	var ids []uint
+	var whatsappIDs []string
+	for _, msg := range messages {
+		if msg.InReplyTo != nil {
+			ids = append(ids, *msg.InReplyTo)
+		} else if msg.QuotedMessageID != nil && *msg.QuotedMessageID != "" {
+			whatsappIDs = append(whatsappIDs, *msg.QuotedMessageID)
+		}
+	}
+	if len(ids) == 0 && len(whatsappIDs) == 0 {
+		return nil
+	}
+
+	byID, err := repository.ListMessagesByIDs(ids)
+	if err != nil {
+		return err
+	}
+	byWhatsAppID, err := repository.ListMessagesByWhatsAppIDs(whatsappIDs)
+	if err != nil {
+		return err
+	}
+
+	quotedByID := make(map[uint]*models.Message, len(byID)+len(byWhatsAppID))
+	quotedByWhatsAppID := make(map[string]*models.Message, len(byWhatsAppID))
+	for i := range byID {
+		quotedByID[byID[i].ID] = &byID[i]
+	}
+	for i := range byWhatsAppID {
+		quotedByID[byWhatsAppID[i].ID] = &byWhatsAppID[i]
+		quotedByWhatsAppID[*byWhatsAppID[i].WhatsAppMessageID] = &byWhatsAppID[i]
+	}
+
+	for i := range messages {
+		var quoted *models.Message
+		if messages[i].InReplyTo != nil {
+			quoted = quotedByID[*messages[i].InReplyTo]
+		} else if messages[i].QuotedMessageID != nil {
+			quoted = quotedByWhatsAppID[*messages[i].QuotedMessageID]
+		}
+
+		if quoted != nil && quoted.ConversationID == messages[i].ConversationID {
+			messages[i].QuotedMessage = models.NewQuotedMessagePreview(quoted)
+		}
+	}
+
+	return nil
+}
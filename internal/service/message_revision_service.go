@@ -0,0 +1,197 @@
+package service
+
+import (
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"time"
+)
+
+// Tipos de protocolMessage do WhatsApp relevantes para revogação/edição
+const (
+	protocolMessageRevoke = "REVOKE"
+	protocolMessageEdit   = "MESSAGE_EDIT"
+)
+
+// processProtocolMessage trata mensagens de protocolo (apagar para todos / editar) recebidas
+// dentro de um evento "Message". Retorna handled=true quando o evento não deve gerar nova mensagem.
+func processProtocolMessage(inboxID uint, data map[string]interface{}) (bool, error) {
+	messageData, _ := data["message"].(map[string]interface{})
+	if messageData == nil {
+		return false, nil
+	}
+
+	// Evolution Go pode encapsular edições em editedMessage.message.protocolMessage
+	if edited, ok := messageData["editedMessage"].(map[string]interface{}); ok {
+		if inner, ok := edited["message"].(map[string]interface{}); ok {
+			messageData = inner
+		}
+	}
+
+	protocol, ok := messageData["protocolMessage"].(map[string]interface{})
+	if !ok {
+		return false, nil
+	}
+
+	targetKey, _ := protocol["key"].(map[string]interface{})
+	targetID := getString(targetKey, "id")
+	if targetID == "" {
+		return true, fmt.Errorf("protocol message without target key")
+	}
+
+	at := parseEventTime(data["timestamp"])
+	if ms, ok := protocol["timestampMs"]; ok {
+		at = parseEventTime(ms)
+	}
+
+	switch normalizeProtocolType(protocol["type"]) {
+	case protocolMessageRevoke:
+		return true, RevokeMessage(inboxID, targetID, at)
+	case protocolMessageEdit:
+		edited, _ := protocol["editedMessage"].(map[string]interface{})
+		return true, EditMessage(inboxID, targetID, extractEditedText(edited), at)
+	default:
+		// Outros protocolos (ephemeral settings, history sync...) não geram mensagem visível
+		return true, nil
+	}
+}
+
+// processMessageDelete trata o evento "messages.delete" da Evolution v2
+func processMessageDelete(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	ids := extractStatusMessageIDs(webhook.Data)
+	if len(ids) == 0 {
+		return fmt.Errorf("delete event without message ID")
+	}
+	return RevokeMessage(inboxID, ids[0], time.Now())
+}
+
+// processMessageEdited trata o evento "messages.edited" da Evolution v2
+func processMessageEdited(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	if handled, err := processProtocolMessage(inboxID, webhook.Data); handled {
+		return err
+	}
+
+	ids := extractStatusMessageIDs(webhook.Data)
+	if len(ids) == 0 {
+		return fmt.Errorf("edit event without message ID")
+	}
+	messageData, _ := webhook.Data["message"].(map[string]interface{})
+	return EditMessage(inboxID, ids[0], extractEditedText(messageData), parseEventTime(webhook.Data["timestamp"]))
+}
+
+// RevokeMessage marca uma mensagem como apagada para todos, guardando o conteúdo original no histórico
+func RevokeMessage(inboxID uint, whatsappMessageID string, at time.Time) error {
+	return reviseMessage(inboxID, whatsappMessageID, models.MessageRevisionActionRevoke, at, func(message *models.Message) map[string]interface{} {
+		if message.Revoked {
+			return nil // Já revogada (evento duplicado)
+		}
+		return map[string]interface{}{
+			"revoked":   true,
+			"content":   "",
+			"caption":   nil,
+			"media_url": nil,
+		}
+	})
+}
+
+// EditMessage aplica uma edição de texto, guardando o conteúdo anterior no histórico
+func EditMessage(inboxID uint, whatsappMessageID string, newContent string, at time.Time) error {
+	return reviseMessage(inboxID, whatsappMessageID, models.MessageRevisionActionEdit, at, func(message *models.Message) map[string]interface{} {
+		if message.Revoked || newContent == "" || newContent == message.Content {
+			return nil // Nada a alterar (evento duplicado ou mensagem já apagada)
+		}
+		updates := map[string]interface{}{
+			"edited":  true,
+			"content": newContent,
+		}
+		// Em mídias o texto editado é a legenda
+		if message.Caption != nil {
+			updates["caption"] = newContent
+		}
+		return updates
+	})
+}
+
+// reviseMessage grava a revisão e as alterações calculadas por change na mesma transação, com a mensagem
+// bloqueada (um retry do webhook não duplica a revisão), e notifica os clientes após o commit
+func reviseMessage(inboxID uint, whatsappMessageID, action string, at time.Time, change func(message *models.Message) map[string]interface{}) error {
+	message, err := repository.ReviseMessageByWhatsAppID(whatsappMessageID, func(message *models.Message) (*models.MessageRevision, map[string]interface{}, error) {
+		if message.InboxID != inboxID {
+			return nil, nil, fmt.Errorf("message %s does not belong to inbox %d", whatsappMessageID, inboxID)
+		}
+		updates := change(message)
+		if len(updates) == 0 {
+			return nil, nil, nil
+		}
+		revision := &models.MessageRevision{
+			MessageID:      message.ID,
+			AccountID:      message.AccountID,
+			ConversationID: message.ConversationID,
+			Action:         action,
+			Content:        message.Content,
+			Caption:        message.Caption,
+			MediaURL:       message.MediaURL,
+			RevisedAt:      at,
+		}
+		return revision, updates, nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revise message %s: %w", whatsappMessageID, err)
+	}
+	if message == nil {
+		return nil
+	}
+
+	log.Printf("[MessageRevision] Message %d updated (revoked=%v, edited=%v)", message.ID, message.Revoked, message.Edited)
+	DispatchMessageUpdated(message)
+	return nil
+}
+
+func getInboxMessageByWhatsAppID(inboxID uint, whatsappMessageID string) (*models.Message, error) {
+	message, err := repository.GetMessageByWhatsAppID(whatsappMessageID)
+	if err != nil {
+		return nil, fmt.Errorf("message %s not found: %w", whatsappMessageID, err)
+	}
+	if message.InboxID != inboxID {
+		return nil, fmt.Errorf("message %s does not belong to inbox %d", whatsappMessageID, inboxID)
+	}
+	return message, nil
+}
+
+// normalizeProtocolType aceita o tipo do protocolMessage como nome (Evolution Go) ou número (protobuf)
+func normalizeProtocolType(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case float64:
+		switch int(v) {
+		case 0:
+			return protocolMessageRevoke
+		case 14:
+			return protocolMessageEdit
+		}
+	}
+	return ""
+}
+
+// extractEditedText extrai o novo texto de uma mensagem editada
+func extractEditedText(messageData map[string]interface{}) string {
+	if messageData == nil {
+		return ""
+	}
+	if text := getString(messageData, "conversation"); text != "" {
+		return text
+	}
+	for _, key := range []string{"extendedTextMessage", "imageMessage", "videoMessage", "documentMessage"} {
+		if inner, ok := messageData[key].(map[string]interface{}); ok {
+			if text := getString(inner, "text"); text != "" {
+				return text
+			}
+			if text := getString(inner, "caption"); text != "" {
+				return text
+			}
+		}
+	}
+	return ""
+}
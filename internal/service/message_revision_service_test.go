@@ -0,0 +1,78 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+func TestEditMessageRecordsEachRevisionOnce(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, "evolution", "whatsapp", map[string]interface{}{})
+
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), "5511977770000", "")
+	if err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), uint(contact.ID))
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	externalID := "EDIT1"
+	message := models.Message{
+		AccountID:         uint(inbox.AccountID),
+		InboxID:           uint(inbox.ID),
+		ConversationID:    uint(conversation.ID),
+		MessageType:       models.MessageTypeIncoming,
+		ContentType:       "text",
+		Content:           "original",
+		WhatsAppMessageID: &externalID,
+	}
+	if err := conn.Omit("Conversation", "Inbox", "Account", "Reactions").Create(&message).Error; err != nil {
+		t.Fatalf("create message: %v", err)
+	}
+
+	now := time.Now()
+	// Evento repetido pelo retry do webhook: uma revisão só
+	for attempt := 0; attempt < 2; attempt++ {
+		if err := EditMessage(uint(inbox.ID), externalID, "primeira edição", now); err != nil {
+			t.Fatalf("EditMessage: %v", err)
+		}
+	}
+	if err := EditMessage(uint(inbox.ID), externalID, "segunda edição", now.Add(time.Second)); err != nil {
+		t.Fatalf("EditMessage: %v", err)
+	}
+	if err := RevokeMessage(uint(inbox.ID), externalID, now.Add(2*time.Second)); err != nil {
+		t.Fatalf("RevokeMessage: %v", err)
+	}
+	// Mensagem de outra inbox não é alterada
+	if err := EditMessage(uint(inbox.ID)+1, externalID, "outra inbox", now); err == nil {
+		t.Error("edit from another inbox accepted")
+	}
+
+	revisions, err := repository.ListMessageRevisions(message.ID)
+	if err != nil {
+		t.Fatalf("ListMessageRevisions: %v", err)
+	}
+	want := []struct{ action, content string }{
+		{models.MessageRevisionActionEdit, "original"},
+		{models.MessageRevisionActionEdit, "primeira edição"},
+		{models.MessageRevisionActionRevoke, "segunda edição"},
+	}
+	if len(revisions) != len(want) {
+		t.Fatalf("revisions = %d, want %d", len(revisions), len(want))
+	}
+	for i, w := range want {
+		if revisions[i].Action != w.action || revisions[i].Content != w.content {
+			t.Errorf("revision %d = %s %q, want %s %q", i, revisions[i].Action, revisions[i].Content, w.action, w.content)
+		}
+	}
+
+	stored, err := repository.GetMessageByID(message.ID)
+	if err != nil || !stored.Revoked || stored.Content != "" {
+		t.Errorf("message = %+v, %v; want revoked without content", stored, err)
+	}
+}
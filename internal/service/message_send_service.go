@@ -34,26 +34,44 @@ func NewEvolutionSendService(baseURL, apiKey string) *EvolutionSendService {
 
 // SendTextMessageInput dados para envio de mensagem de texto
 type SendTextMessageInput struct {
-	InstanceName string `json:"instance_name"`
-	Number       string `json:"number"`
-	Text         string `json:"text"`
+	InstanceName string           `json:"instance_name"`
+	Number       string           `json:"number"`
+	Text         string           `json:"text"`
+	Quoted       *EvolutionQuoted `json:"quoted,omitempty"`        // Responder citando uma mensagem
+	MentionedJID []string         `json:"mentioned_jid,omitempty"` // Participantes mencionados (grupos)
+	MentionAll   bool             `json:"mention_all,omitempty"`
+	Delay        int              `json:"delay,omitempty"` // Tempo em "digitando..." antes do envio (ms)
 }
 
 // SendMediaMessageInput dados para envio de mensagem com mídia
 type SendMediaMessageInput struct {
-	InstanceName string `json:"instance_name"`
-	Number       string `json:"number"`
-	MediaType    string `json:"media_type"` // image, video, audio, document
-	MediaURL     string `json:"media_url"`
-	Caption      string `json:"caption,omitempty"`
-	FileName     string `json:"file_name,omitempty"`
+	InstanceName string           `json:"instance_name"`
+	Number       string           `json:"number"`
+	MediaType    string           `json:"media_type"` // image, video, audio, document
+	MediaURL     string           `json:"media_url"`
+	Caption      string           `json:"caption,omitempty"`
+	FileName     string           `json:"file_name,omitempty"`
+	Quoted       *EvolutionQuoted `json:"quoted,omitempty"`        // Responder citando uma mensagem
+	MentionedJID []string         `json:"mentioned_jid,omitempty"` // Participantes mencionados (grupos)
+	MentionAll   bool             `json:"mention_all,omitempty"`
+	Delay        int              `json:"delay,omitempty"` // Tempo em "digitando..." antes do envio (ms)
 }
 
 // EvolutionTextPayload payload para API Evolution
 type EvolutionTextPayload struct {
-	Number  string          `json:"number"`
-	Options EvolutionOption `json:"options"`
-	Text    string          `json:"text"`
+	Number  string           `json:"number"`
+	Options EvolutionOption  `json:"options"`
+	Text    string           `json:"text"`
+	Quoted  *EvolutionQuoted `json:"quoted,omitempty"`
+	// Menções em grupos: o texto deve conter "@<número>" de cada JID mencionado
+	MentionedJID []string `json:"mentionedJid,omitempty"`
+	MentionAll   bool     `json:"mentionAll,omitempty"`
+}
+
+// EvolutionQuoted referência à mensagem citada em uma resposta
+type EvolutionQuoted struct {
+	MessageID   string `json:"messageId"`
+	Participant string `json:"participant,omitempty"` // Autor da mensagem citada (obrigatório em grupos)
 }
 
 type EvolutionOption struct {
@@ -63,13 +81,17 @@ type EvolutionOption struct {
 
 // EvolutionMediaPayload payload para mídia na API Evolution
 type EvolutionMediaPayload struct {
-	Number   string          `json:"number"`
-	Options  EvolutionOption `json:"options"`
-	Type     string          `json:"type"` // image, video, audio, document
-	MediaURL string          `json:"url"`  // Evolution API espera "url" em minúsculo
-	Caption  string          `json:"caption,omitempty"`
-	FileName string          `json:"filename,omitempty"`
-	MimeType string          `json:"mimetype,omitempty"`
+	Number   string           `json:"number"`
+	Options  EvolutionOption  `json:"options"`
+	Type     string           `json:"type"` // image, video, audio, document
+	MediaURL string           `json:"url"`  // Evolution API espera "url" em minúsculo
+	Caption  string           `json:"caption,omitempty"`
+	FileName string           `json:"filename,omitempty"`
+	MimeType string           `json:"mimetype,omitempty"`
+	Quoted   *EvolutionQuoted `json:"quoted,omitempty"`
+	// Menções na legenda (grupos)
+	MentionedJID []string `json:"mentionedJid,omitempty"`
+	MentionAll   bool     `json:"mentionAll,omitempty"`
 }
 
 // SendTextMessage envia uma mensagem de texto via Evolution API
@@ -80,10 +102,13 @@ func (s *EvolutionSendService) SendTextMessage(input SendTextMessageInput) (*mod
 	payload := EvolutionTextPayload{
 		Number: input.Number,
 		Options: EvolutionOption{
-			Delay:    1200,
+			Delay:    input.Delay,
 			Presence: "composing",
 		},
-		Text: input.Text,
+		Text:         input.Text,
+		Quoted:       input.Quoted,
+		MentionedJID: input.MentionedJID,
+		MentionAll:   input.MentionAll,
 	}
 
 	body, err := json.Marshal(payload)
@@ -109,7 +134,7 @@ func (s *EvolutionSendService) SendTextMessage(input SendTextMessageInput) (*mod
 	respBody, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("evolution API error: %s - %s", resp.Status, string(respBody))
+		return nil, newProviderError("evolution", resp, respBody)
 	}
 
 	// Parse response para extrair message ID
@@ -143,13 +168,16 @@ func (s *EvolutionSendService) SendMediaMessage(input SendMediaMessageInput) (*m
 	payload := EvolutionMediaPayload{
 		Number: input.Number,
 		Options: EvolutionOption{
-			Delay:    1200,
+			Delay:    input.Delay,
 			Presence: "composing",
 		},
-		Type:     input.MediaType,
-		MediaURL: input.MediaURL,
-		Caption:  input.Caption,
-		FileName: input.FileName,
+		Type:         input.MediaType,
+		MediaURL:     input.MediaURL,
+		Caption:      input.Caption,
+		FileName:     input.FileName,
+		Quoted:       input.Quoted,
+		MentionedJID: input.MentionedJID,
+		MentionAll:   input.MentionAll,
 	}
 
 	body, err := json.Marshal(payload)
@@ -175,7 +203,7 @@ func (s *EvolutionSendService) SendMediaMessage(input SendMediaMessageInput) (*m
 	respBody, _ := io.ReadAll(resp.Body)
 
 	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
-		return nil, fmt.Errorf("evolution API error: %s - %s", resp.Status, string(respBody))
+		return nil, newProviderError("evolution", resp, respBody)
 	}
 
 	var evolutionResp map[string]interface{}
@@ -203,46 +231,249 @@ func (s *EvolutionSendService) SendMediaMessage(input SendMediaMessageInput) (*m
 	}, nil
 }
 
-// SendMessage é um wrapper conveniente que persiste a mensagem no banco
-func SendMessage(conversationID uint, content string, contentType string, mediaURL string, userID uint) (*models.Message, error) {
+// SendReactionInput dados para envio de reação a uma mensagem
+type SendReactionInput struct {
+	InstanceName string `json:"instance_name"`
+	Number       string `json:"number"`
+	MessageID    string `json:"message_id"` // ID do WhatsApp da mensagem alvo
+	FromMe       bool   `json:"from_me"`    // Se a mensagem alvo foi enviada por nós
+	Reaction     string `json:"reaction"`   // Emoji; vazio remove a reação
+}
+
+// EvolutionReactionPayload payload de reação para API Evolution
+type EvolutionReactionPayload struct {
+	Number   string `json:"number"`
+	Reaction string `json:"reaction"`
+	ID       string `json:"id"`
+	FromMe   bool   `json:"fromMe"`
+}
+
+// SendReaction envia (ou remove, com emoji vazio) uma reação via Evolution API
+func (s *EvolutionSendService) SendReaction(input SendReactionInput) (*string, error) {
+	payload := EvolutionReactionPayload{
+		Number:   input.Number,
+		Reaction: input.Reaction,
+		ID:       input.MessageID,
+		FromMe:   input.FromMe,
+	}
+
+	evolutionResp, err := s.post("/message/react", input.InstanceName, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	return extractEvolutionMessageID(evolutionResp), nil
+}
+
+// post envia um payload JSON para a Evolution API e retorna a resposta decodificada
+func (s *EvolutionSendService) post(path string, instanceName string, payload interface{}) (map[string]interface{}, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", s.baseURL+path, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("apikey", s.apiKey)
+	req.Header.Set("instanceid", instanceName)
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, _ := io.ReadAll(resp.Body)
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return nil, newProviderError("evolution", resp, respBody)
+	}
+
+	evolutionResp := map[string]interface{}{}
+	if len(respBody) > 0 {
+		if err := json.Unmarshal(respBody, &evolutionResp); err != nil {
+			return nil, fmt.Errorf("failed to parse response: %w", err)
+		}
+	}
+
+	return evolutionResp, nil
+}
+
+// extractEvolutionMessageID extrai key.id da resposta da Evolution API
+func extractEvolutionMessageID(evolutionResp map[string]interface{}) *string {
+	if key, ok := evolutionResp["key"].(map[string]interface{}); ok {
+		if id, ok := key["id"].(string); ok && id != "" {
+			return &id
+		}
+	}
+	return nil
+}
+
+// SendMessageOptions opções adicionais de envio
+type SendMessageOptions struct {
+	InReplyTo  *uint            // ID interno da mensagem respondida, enviada como citação no WhatsApp
+	Mentions   []uint           // IDs dos contatos mencionados (participantes do grupo)
+	MentionAll bool             // Mencionar todos os participantes do grupo
+	Template   *MessageTemplate // Template aprovado, enviado no lugar do texto (canais com Templates)
+}
+
+// SendMessage valida o envio pelo canal da inbox e grava a mensagem no outbox
+func SendMessage(conversationID uint, content string, contentType string, mediaURL string, userID uint, opts SendMessageOptions) (*models.Message, error) {
 	log.Printf("[SendMessage] CALLED: conversationID=%d, content=%s, contentType=%s", conversationID, content, contentType)
 
+	conversation, inbox, _, err := resolveConversationTarget(conversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := ChannelForInbox(inbox)
+	if err != nil {
+		return nil, err
+	}
+	capabilities := channel.Capabilities()
+	inReplyTo := opts.InReplyTo
+
+	if contentType == "" {
+		contentType = "text"
+	}
+	if opts.Template != nil {
+		if !capabilities.Templates {
+			return nil, fmt.Errorf("templates are %w", ErrChannelUnsupported)
+		}
+		if opts.Template.Name == "" || opts.Template.Language == "" {
+			return nil, fmt.Errorf("template name and language are required")
+		}
+		contentType = "template"
+		if content == "" {
+			content = fmt.Sprintf("[Template: %s]", opts.Template.Name)
+		}
+	}
+	if contentType != "text" && contentType != "template" && !capabilities.Media {
+		return nil, fmt.Errorf("media messages are %w", ErrChannelUnsupported)
+	}
+	if (len(opts.Mentions) > 0 || opts.MentionAll) && !capabilities.Mentions {
+		return nil, fmt.Errorf("mentions are %w", ErrChannelUnsupported)
+	}
+
+	// Resolver mensagem citada
+	var quotedMsg *models.Message
+	if inReplyTo != nil {
+		quotedMsg, err = repository.GetMessageByID(*inReplyTo)
+		if err != nil || quotedMsg.ConversationID != conversationID {
+			return nil, fmt.Errorf("in_reply_to message %d not found in conversation %d", *inReplyTo, conversationID)
+		}
+	}
+
+	// Gerar source_id único para mensagens do frontend
+	sourceID := fmt.Sprintf("frontend-%s", uuid.New().String())
+
+	message := &models.Message{
+		Content:        content,
+		AccountID:      uint(inbox.AccountID),
+		InboxID:        uint(inbox.ID),
+		ConversationID: conversationID,
+		ContentType:    contentType,
+		SenderType:     "User",
+		SenderID:       userID,
+		SourceID:       sourceID,
+		InReplyTo:      inReplyTo,
+	}
+	if mediaURL != "" {
+		message.MediaURL = &mediaURL
+	}
+	if opts.Template != nil {
+		message.ContentAttributes.Template = &models.TemplateAttributes{Name: opts.Template.Name, Language: opts.Template.Language}
+	}
+
+	// O envio pelo canal é feito pelo outbox (com retries); a mensagem volta como "pending"
+	if err := QueueOutgoingMessage(message, opts); err != nil {
+		return nil, err
+	}
+
+	if quotedMsg != nil {
+		message.QuotedMessage = models.NewQuotedMessagePreview(quotedMsg)
+	}
+
+	// Atualizar última atividade da conversa
+	now := time.Now()
+	conversation.LastActivityAt = &now
+	repository.UpdateConversation(conversation)
+
+	return message, nil
+}
+
+// sendTemplate envia um template pelo canal, quando ele oferece suporte
+func sendTemplate(channel Channel, msg *OutboundMessage) (*SendResult, error) {
+	sender, ok := channel.(templateSender)
+	if !ok {
+		return nil, fmt.Errorf("templates are %w", ErrChannelUnsupported)
+	}
+	return sender.SendTemplate(msg)
+}
+
+// resolveConversationTarget busca conversa, inbox e contato de destino de um envio
+func resolveConversationTarget(conversationID uint) (*models.Conversation, *models.Inbox, *models.Contact, error) {
 	// Buscar conversa
 	var conversation models.Conversation
 	if err := db.Instance.Preload("Inbox").Preload("Contact").First(&conversation, conversationID).Error; err != nil {
-		return nil, fmt.Errorf("conversation not found: %w", err)
+		return nil, nil, nil, fmt.Errorf("conversation not found: %w", err)
 	}
 
 	// Buscar inbox para config
 	inbox, err := repository.GetInboxByID(uint(conversation.InboxID))
 	if err != nil {
-		return nil, fmt.Errorf("inbox not found: %w", err)
-	}
-
-	// Buscar integration associada para obter config da Evolution
-	// Primeiro tenta buscar por channel_id, depois por provider evolution e account_id
-	var integration models.Integration
-	err = db.Instance.Where("id = ?", inbox.ChannelID).First(&integration).Error
-	if err != nil {
-		// Se não encontrou por channel_id, buscar integration Evolution do account
-		// Evolution API sends channel.type = "api", so we check both
-		log.Printf("[SendMessage] Integration not found by channel_id=%d, searching by provider", inbox.ChannelID)
-		err = db.Instance.Where("account_id = ? AND (provider = ? OR provider = ?)", inbox.AccountID, "evolution", "api").First(&integration).Error
-		if err != nil {
-			return nil, fmt.Errorf("integration not found for account: %w", err)
-		}
+		return nil, nil, nil, fmt.Errorf("inbox not found: %w", err)
 	}
 
-	// Buscar contato para o número
+	// Buscar contato
 	var contact models.Contact
 	if err := db.Instance.First(&contact, conversation.ContactID).Error; err != nil {
-		return nil, fmt.Errorf("contact not found: %w", err)
+		return nil, nil, nil, fmt.Errorf("contact not found: %w", err)
 	}
 
-	// Determinar número do contato
-	phoneNumber := contact.PhoneNumber
-	if phoneNumber == "" && contact.Identifier != "" {
-		phoneNumber = contact.Identifier
+	return &conversation, inbox, &contact, nil
+}
+
+// evolutionTarget reúne o necessário para enviar algo a uma conversa via Evolution API
+type evolutionTarget struct {
+	Service      *EvolutionSendService
+	InstanceName string
+	Number       string
+	Conversation models.Conversation
+	Inbox        *models.Inbox
+	Integration  models.Integration
+}
+
+// resolveEvolutionTarget monta o destino da Evolution API de uma conversa (recursos exclusivos da Evolution:
+// reações, presença, grupos)
+func resolveEvolutionTarget(conversationID uint) (*evolutionTarget, error) {
+	conversation, inbox, contact, err := resolveConversationTarget(conversationID)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireEvolutionInbox(inbox); err != nil {
+		return nil, err
+	}
+
+	return evolutionTargetFor(&OutboundMessage{Inbox: inbox, Conversation: conversation, Contact: contact})
+}
+
+// evolutionClient cliente da Evolution API configurado para a instância de uma inbox
+type evolutionClient struct {
+	Service      *EvolutionSendService
+	InstanceName string
+	Integration  models.Integration
+}
+
+// resolveEvolutionClient busca a integração da inbox e monta o cliente da Evolution API
+func resolveEvolutionClient(inbox *models.Inbox) (*evolutionClient, error) {
+	integration, err := findInboxIntegration(inbox)
+	if err != nil {
+		return nil, err
 	}
 
 	// Criar serviço de envio - extrair config do JSON
@@ -250,8 +481,6 @@ func SendMessage(conversationID uint, content string, contentType string, mediaU
 	if err := json.Unmarshal(integration.Config, &configMap); err != nil {
 		return nil, fmt.Errorf("failed to parse integration config: %w", err)
 	}
-	log.Printf("[SendMessage] Integration Config (Raw): %s", string(integration.Config))
-	log.Printf("[SendMessage] Integration Config (Map): %+v", configMap)
 
 	// Helper para buscar string de múltiplas chaves
 	getString := func(m map[string]interface{}, keys ...string) string {
@@ -271,106 +500,36 @@ func SendMessage(conversationID uint, content string, contentType string, mediaU
 	// Mas a Evolution Service espera a Base URL limpa
 	baseURL = strings.TrimSuffix(baseURL, "/")
 
-	evolutionService := NewEvolutionSendService(baseURL, apiKey)
-
-	// Formatar número para WhatsApp
-	whatsappNumber := formatWhatsAppNumber(phoneNumber)
-
-	var sentMessage *models.Message
-	var sendErr error
-
-	if contentType == "text" || contentType == "" {
-		sentMessage, sendErr = evolutionService.SendTextMessage(SendTextMessageInput{
-			InstanceName: instanceName,
-			Number:       whatsappNumber,
-			Text:         content,
-		})
-	} else {
-		// Converter URL de localhost para URL interna do Docker para Evolution API acessar
-		internalMediaURL := mediaURL
-		if strings.Contains(mediaURL, "localhost:4120") {
-			internalMediaURL = strings.Replace(mediaURL, "localhost:4120", "mensager-go-api-1:4120", 1)
-			log.Printf("[SendMessage] Converted media URL for Evolution: %s -> %s", mediaURL, internalMediaURL)
-		}
-
-		sentMessage, sendErr = evolutionService.SendMediaMessage(SendMediaMessageInput{
-			InstanceName: instanceName,
-			Number:       whatsappNumber,
-			MediaType:    contentType,
-			MediaURL:     internalMediaURL,
-			Caption:      content,
-		})
-	}
-
-	// Gerar source_id único para mensagens do frontend
-	sourceID := fmt.Sprintf("frontend-%s", uuid.New().String())
+	return &evolutionClient{
+		Service:      NewEvolutionSendService(baseURL, apiKey),
+		InstanceName: instanceName,
+		Integration:  *integration,
+	}, nil
+}
 
-	if sendErr != nil {
-		// Log detalhado do erro
-		log.Printf("[SendMessage] ERROR sending message to Evolution API: %v", sendErr)
-		log.Printf("[SendMessage] Details - ConversationID: %d, Number: %s, ContentType: %s, Instance: %s",
-			conversationID, whatsappNumber, contentType, instanceName)
-
-		// Salvar mensagem como falha
-		failedMsg := &models.Message{
-			Content:        content,
-			AccountID:      uint(inbox.AccountID),
-			InboxID:        uint(inbox.ID),
-			ConversationID: conversationID,
-			MessageType:    models.MessageTypeOutgoing,
-			ContentType:    contentType,
-			SenderType:     "User",
-			SenderID:       userID,
-			Status:         models.MessageStatusFailed,
-			SourceID:       sourceID,
-			IsFromMe:       true,
+// findInboxIntegration busca a integração que atende a inbox.
+// Primeiro tenta buscar por channel_id, depois por provider evolution e account_id
+func findInboxIntegration(inbox *models.Inbox) (*models.Integration, error) {
+	var integration models.Integration
+	err := db.Instance.Where("id = ?", inbox.ChannelID).First(&integration).Error
+	if err != nil {
+		// Se não encontrou por channel_id, buscar integration Evolution do account
+		// Evolution API sends channel.type = "api", so we check both
+		err = db.Instance.Where("account_id = ? AND (provider = ? OR provider = ?)", inbox.AccountID, "evolution", "api").First(&integration).Error
+		if err != nil {
+			return nil, fmt.Errorf("integration not found for account: %w", err)
 		}
-		repository.CreateMessage(failedMsg)
-		return nil, fmt.Errorf("failed to send message via Evolution API: %w", sendErr)
-	}
-
-	// Salvar mensagem enviada com sucesso
-	now := time.Now()
-
-	// Usar mediaURL original (para frontend) em vez de sentMessage.MediaURL (URL interna)
-	var savedMediaURL *string
-	if mediaURL != "" {
-		savedMediaURL = &mediaURL
-	} else if sentMessage.MediaURL != nil {
-		savedMediaURL = sentMessage.MediaURL
-	}
-
-	message := &models.Message{
-		Content:           content,
-		AccountID:         uint(inbox.AccountID),
-		InboxID:           uint(inbox.ID),
-		ConversationID:    conversationID,
-		MessageType:       models.MessageTypeOutgoing,
-		ContentType:       contentType,
-		SenderType:        "User",
-		SenderID:          userID,
-		Status:            models.MessageStatusSent,
-		SourceID:          sourceID,
-		IsFromMe:          true,
-		WhatsAppMessageID: sentMessage.WhatsAppMessageID,
-		MediaURL:          savedMediaURL,
-		FileName:          sentMessage.FileName,
-		Timestamp:         &now,
 	}
-
-	if err := repository.CreateMessage(message); err != nil {
-		return nil, fmt.Errorf("failed to save message: %w", err)
-	}
-
-	// Atualizar última atividade da conversa
-	conversation.LastActivityAt = &now
-	repository.UpdateConversation(&conversation)
-
-	return message, nil
+	return &integration, nil
 }
 
 // formatWhatsAppNumber formata número para formato WhatsApp
 func formatWhatsAppNumber(phone string) string {
+	// JIDs de grupo já estão no formato esperado
+	if strings.HasSuffix(phone, "@g.us") {
+		return phone
+	}
+
 	// Remove caracteres não numéricos
 	var digits string
 	for _, c := range phone {
@@ -0,0 +1,204 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// processMessageStatus processa eventos de confirmação (ack/receipt/messages.update) da Evolution API
+func processMessageStatus(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	data := webhook.Data
+
+	status := parseEvolutionStatus(data)
+	if status == "" {
+		log.Printf("[processMessageStatus] Ignoring status event without recognizable status (event=%s)", webhook.Event)
+		return nil
+	}
+
+	messageIDs := extractStatusMessageIDs(data)
+	if len(messageIDs) == 0 {
+		return fmt.Errorf("status event without message ID")
+	}
+
+	rawTime, ok := data["Timestamp"]
+	if !ok {
+		rawTime = data["datetime"]
+	}
+	at := parseEventTime(rawTime)
+
+	var unknown []string
+	for _, whatsappID := range messageIDs {
+		message, err := ApplyMessageStatus(inboxID, whatsappID, status, at)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				unknown = append(unknown, whatsappID)
+			}
+			log.Printf("[processMessageStatus] Could not apply status %s to %s: %v", status, whatsappID, err)
+			continue
+		}
+		if message != nil {
+			DispatchMessageUpdated(message)
+		}
+	}
+
+	// Confirmação que chegou antes do ID do envio ser gravado pelo outbox: a fila de webhooks tenta de novo.
+	// IDs desconhecidos sem envio em andamento no chat (mensagens do celular ou anteriores ao outbox) são descartados
+	if len(unknown) > 0 {
+		if conversationID := statusConversationID(inboxID, evolutionChatJID(data)); conversationID != 0 {
+			if pending, err := repository.GetProcessingOutboxMessage(conversationID); err == nil && pending != nil {
+				return fmt.Errorf("status for %s arrived before message %d was recorded", strings.Join(unknown, ", "), pending.ID)
+			}
+		}
+	}
+
+	return nil
+}
+
+// ApplyMessageStatus avança o status de uma mensagem identificada pelo ID do WhatsApp.
+// O status só avança (sent → delivered → read); confirmações atrasadas apenas preenchem
+// timestamps ausentes. A atualização é um único UPDATE condicional, então confirmações
+// concorrentes não regridem o status. Retorna nil quando nada mudou.
+func ApplyMessageStatus(inboxID uint, whatsappMessageID, status string, at time.Time) (*models.Message, error) {
+	changed, err := repository.AdvanceMessageStatus(inboxID, whatsappMessageID, status, at)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update message status: %w", err)
+	}
+	if !changed {
+		message, err := repository.GetMessageByWhatsAppID(whatsappMessageID)
+		if err != nil {
+			return nil, fmt.Errorf("message not found: %w", err)
+		}
+		if message.InboxID != inboxID {
+			return nil, fmt.Errorf("message %s does not belong to inbox %d", whatsappMessageID, inboxID)
+		}
+		return nil, nil
+	}
+
+	return repository.GetMessageByWhatsAppID(whatsappMessageID)
+}
+
+// statusConversationID conversa mais recente do chat de uma confirmação, sem criar contato ou conversa; 0 quando não existe
+func statusConversationID(inboxID uint, chatJID string) uint {
+	if chatJID == "" {
+		return 0
+	}
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return 0
+	}
+
+	// Mesma busca do contato das mensagens: telefone primeiro, JID para grupos e contatos sem telefone
+	var contact *models.Contact
+	if phoneNumber := extractPhoneNumber(chatJID); phoneNumber != "" && !strings.HasSuffix(chatJID, "@g.us") {
+		contact, _ = repository.GetContactByPhoneNumber(phoneNumber, uint(inbox.AccountID))
+	}
+	if contact == nil {
+		contact, _ = repository.GetContactByIdentifier(chatJID, uint(inbox.AccountID))
+	}
+	if contact == nil {
+		return 0
+	}
+
+	conversation, err := repository.FindLatestConversation(inboxID, contact.ID)
+	if err != nil {
+		return 0
+	}
+	return uint(conversation.ID)
+}
+
+// parseEvolutionStatus normaliza os diferentes formatos de status enviados pela Evolution
+// (Evolution Go: Receipt.Type, Evolution v2: status "DELIVERY_ACK"/"READ", Baileys: ack numérico)
+func parseEvolutionStatus(data map[string]interface{}) string {
+	if receiptType, ok := data["Type"].(string); ok {
+		switch strings.ToLower(receiptType) {
+		case "", "delivery", "delivered":
+			return models.MessageStatusDelivered
+		case "read", "read-self", "played", "played-self":
+			return models.MessageStatusRead
+		case "server-error":
+			return models.MessageStatusFailed
+		default:
+			return ""
+		}
+	}
+
+	if ack, ok := data["ack"].(float64); ok {
+		switch {
+		case ack < 0:
+			return models.MessageStatusFailed
+		case ack == 2:
+			return models.MessageStatusSent
+		case ack == 3:
+			return models.MessageStatusDelivered
+		case ack >= 4:
+			return models.MessageStatusRead
+		}
+		return ""
+	}
+
+	switch strings.ToUpper(getString(data, "status")) {
+	case "SERVER_ACK", "SENT":
+		return models.MessageStatusSent
+	case "DELIVERY_ACK", "DELIVERED":
+		return models.MessageStatusDelivered
+	case "READ", "PLAYED":
+		return models.MessageStatusRead
+	case "ERROR", "FAILED":
+		return models.MessageStatusFailed
+	}
+
+	return ""
+}
+
+// extractStatusMessageIDs extrai os IDs de mensagem de um evento de status
+func extractStatusMessageIDs(data map[string]interface{}) []string {
+	var ids []string
+
+	if list, ok := data["MessageIDs"].([]interface{}); ok {
+		for _, item := range list {
+			if id, ok := item.(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+		return ids
+	}
+
+	if keyData, ok := data["key"].(map[string]interface{}); ok {
+		if id := getString(keyData, "id"); id != "" {
+			return []string{id}
+		}
+	}
+
+	for _, field := range []string{"keyId", "messageId", "id"} {
+		if id := getString(data, field); id != "" {
+			return []string{id}
+		}
+	}
+
+	return ids
+}
+
+// parseEventTime converte timestamps da Evolution (RFC3339, Unix em segundos ou milissegundos)
+func parseEventTime(value interface{}) time.Time {
+	switch v := value.(type) {
+	case string:
+		if t, err := time.Parse(time.RFC3339Nano, v); err == nil && !t.IsZero() {
+			return t
+		}
+	case float64:
+		if v > 1e12 {
+			return time.UnixMilli(int64(v))
+		}
+		if v > 0 {
+			return time.Unix(int64(v), 0)
+		}
+	}
+	return time.Now()
+}
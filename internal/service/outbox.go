@@ -0,0 +1,395 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"net"
+	"net/http"
+	"net/textproto"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	defaultOutboxWorkers = 4
+	outboxMaxAttempts    = 8
+	outboxRetryBaseDelay = 2 * time.Second
+	outboxRetryMaxDelay  = 10 * time.Minute
+	outboxPollInterval   = 2 * time.Second
+	outboxLeaseDuration  = 5 * time.Minute // Renovada a cada terço enquanto o envio está em andamento
+)
+
+// Outbox entrega as mensagens de saída gravadas em outbox_messages com um pool limitado de workers.
+// A ordem por conversa é garantida na reserva (ClaimOutboxMessages): só um envio por conversa fica em andamento.
+// A reserva é um lease (locked_until): envios de um worker ou réplica interrompidos voltam à fila quando ele expira.
+type Outbox struct {
+	workers  int
+	jobs     chan models.OutboxMessage
+	wake     chan struct{}
+	inFlight int32
+}
+
+var outbox *Outbox
+
+// outboxOptions opções do envio que não ficam na mensagem (menções e template)
+type outboxOptions struct {
+	Mentions   []uint           `json:"mentions,omitempty"`
+	MentionAll bool             `json:"mention_all,omitempty"`
+	Template   *MessageTemplate `json:"template,omitempty"`
+}
+
+// StartOutbox inicia o dispatcher e os workers do outbox (OUTBOX_WORKERS, padrão 4)
+func StartOutbox() {
+	workers := defaultOutboxWorkers
+	if n, err := strconv.Atoi(os.Getenv("OUTBOX_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+
+	q := &Outbox{
+		workers: workers,
+		jobs:    make(chan models.OutboxMessage, workers),
+		wake:    make(chan struct{}, 1),
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	go q.dispatcher()
+
+	outbox = q
+	log.Printf("[Outbox] Started with %d workers", workers)
+}
+
+// QueueOutgoingMessage grava a mensagem como "pending" junto com a sua entrada no outbox e acorda a fila.
+// A entrega ao provedor é assíncrona; o resultado chega aos clientes como message.updated.
+func QueueOutgoingMessage(message *models.Message, opts SendMessageOptions) error {
+	options, err := json.Marshal(outboxOptions{
+		Mentions:   opts.Mentions,
+		MentionAll: opts.MentionAll,
+		Template:   opts.Template,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal send options: %w", err)
+	}
+
+	message.MessageType = models.MessageTypeOutgoing
+	message.Status = models.MessageStatusPending
+	message.IsFromMe = true
+	if message.InReplyTo == nil {
+		message.InReplyTo = opts.InReplyTo
+	}
+
+	entry := &models.OutboxMessage{
+		Options: datatypes.JSON(options),
+		Status:  models.OutboxStatusPending,
+	}
+	if err := repository.CreateQueuedMessage(message, entry); err != nil {
+		return fmt.Errorf("failed to queue message: %w", err)
+	}
+
+	if outbox != nil {
+		outbox.Wake()
+	}
+	return nil
+}
+
+// Wake pede ao dispatcher uma nova rodada de reserva sem esperar o intervalo de polling
+func (q *Outbox) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *Outbox) dispatcher() {
+	ticker := time.NewTicker(outboxPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		}
+		q.dispatch()
+	}
+}
+
+// dispatch reserva envios prontos até o limite de workers livres
+func (q *Outbox) dispatch() {
+	free := q.workers - int(atomic.LoadInt32(&q.inFlight))
+	if free <= 0 {
+		return
+	}
+
+	entries, err := repository.ClaimOutboxMessages(free, outboxLeaseDuration)
+	if err != nil {
+		log.Printf("[Outbox] Error claiming sends: %v", err)
+		return
+	}
+
+	for _, entry := range entries {
+		atomic.AddInt32(&q.inFlight, 1)
+		q.jobs <- entry
+	}
+}
+
+func (q *Outbox) worker() {
+	for job := range q.jobs {
+		q.process(job)
+		atomic.AddInt32(&q.inFlight, -1)
+		q.Wake()
+	}
+}
+
+// process entrega um envio e registra sucesso, nova tentativa com backoff ou falha definitiva
+func (q *Outbox) process(job models.OutboxMessage) {
+	done := make(chan struct{})
+	go keepOutboxLease(job.ID, done)
+	err := runOutboxMessage(job)
+	close(done)
+
+	// Adiado pelo limite de taxa: volta à fila no horário reservado, sem contar como tentativa
+	var throttled *sendThrottledError
+	if errors.As(err, &throttled) {
+		if err := repository.DeferOutboxMessage(job.ID, throttled.Until); err != nil {
+			log.Printf("[Outbox] Error deferring send %d: %v", job.ID, err)
+		}
+		time.AfterFunc(time.Until(throttled.Until), q.Wake)
+		return
+	}
+
+	if err == nil {
+		if err := repository.MarkOutboxMessageSent(job.ID); err != nil {
+			log.Printf("[Outbox] Error marking send %d as sent: %v", job.ID, err)
+		}
+		return
+	}
+
+	if retryableSendError(err) && job.Attempts < outboxMaxAttempts {
+		next := time.Now().Add(outboxRetryDelay(job.Attempts))
+		log.Printf("[Outbox] Message %d failed (attempt %d/%d), retrying at %s: %v", job.MessageID, job.Attempts, outboxMaxAttempts, next.Format(time.RFC3339), err)
+		if err := repository.MarkOutboxMessageFailed(job.ID, models.OutboxStatusRetry, err.Error(), &next); err != nil {
+			log.Printf("[Outbox] Error updating send %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	log.Printf("[Outbox] Message %d failed after %d attempts: %v", job.MessageID, job.Attempts, err)
+	if err := repository.MarkOutboxMessageFailed(job.ID, models.OutboxStatusDead, err.Error(), nil); err != nil {
+		log.Printf("[Outbox] Error updating send %d: %v", job.ID, err)
+	}
+	if err := repository.UpdateMessageFields(job.MessageID, map[string]interface{}{"status": models.MessageStatusFailed}); err != nil {
+		log.Printf("[Outbox] Error marking message %d as failed: %v", job.MessageID, err)
+		return
+	}
+	if message, err := repository.GetMessageByID(job.MessageID); err == nil {
+		DispatchMessageUpdated(message)
+	}
+}
+
+// keepOutboxLease renova a reserva do envio até done ser fechado
+func keepOutboxLease(id uint, done <-chan struct{}) {
+	ticker := time.NewTicker(outboxLeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if ok, err := repository.ExtendOutboxLease(id, time.Now().Add(outboxLeaseDuration)); err != nil {
+				log.Printf("[Outbox] Error extending lease of send %d: %v", id, err)
+			} else if !ok {
+				return
+			}
+		}
+	}
+}
+
+// runOutboxMessage entrega o envio, convertendo panics em erro para não derrubar o worker
+func runOutboxMessage(job models.OutboxMessage) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while sending message: %v", r)
+		}
+	}()
+
+	message, err := repository.GetMessageByID(job.MessageID)
+	if err != nil {
+		return fmt.Errorf("message %d not found: %w", job.MessageID, err)
+	}
+	// Envio já concluído antes de um reinício (mensagem atualizada, outbox não)
+	if message.Status != models.MessageStatusPending {
+		return nil
+	}
+
+	var opts outboxOptions
+	if len(job.Options) > 0 {
+		if err := json.Unmarshal(job.Options, &opts); err != nil {
+			return fmt.Errorf("invalid send options: %w", err)
+		}
+	}
+
+	result, err := deliverMessage(job.ID, message, opts)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	attributes := message.ContentAttributes
+	attributes.Mentions = result.Mentions
+	attributes.Email = result.Email
+	updates := map[string]interface{}{
+		"status":              models.MessageStatusSent,
+		"whatsapp_message_id": result.ExternalID,
+		"quoted_message_id":   result.QuotedID,
+		"is_group":            result.IsGroup,
+		"content_attributes":  attributes,
+		"timestamp":           now,
+	}
+	// Manter a URL original (para o frontend); a do canal só quando a mensagem não tinha URL
+	if message.MediaURL == nil && result.MediaURL != nil {
+		updates["media_url"] = *result.MediaURL
+	}
+	if result.FileName != nil {
+		updates["file_name"] = *result.FileName
+	}
+	if err := repository.UpdateMessageFields(message.ID, updates); err != nil {
+		// A mensagem já saiu pelo provedor: repetir o envio a duplicaria
+		log.Printf("[Outbox] Error saving sent message %d: %v", message.ID, err)
+		return nil
+	}
+
+	if sent, err := repository.GetMessageByID(message.ID); err == nil {
+		if err := repository.LinkQuotingReplies(sent); err != nil {
+			log.Printf("[Outbox] Error linking replies to message %d: %v", sent.ID, err)
+		}
+		DispatchMessageUpdated(sent)
+	}
+	return nil
+}
+
+// sendThrottledError envio adiado pelo limite de taxa da integração até Until
+type sendThrottledError struct {
+	Until time.Time
+}
+
+func (e *sendThrottledError) Error() string {
+	return fmt.Sprintf("send rate limit reached, next slot at %s", e.Until.Format(time.RFC3339))
+}
+
+// deliverMessage envia a mensagem gravada pelo canal da inbox da conversa, respeitando o limite de taxa da integração
+func deliverMessage(entryID uint, message *models.Message, opts outboxOptions) (_ *SendResult, sendErr error) {
+	conversation, inbox, contact, err := resolveConversationTarget(message.ConversationID)
+	if err != nil {
+		return nil, err
+	}
+
+	channel, err := ChannelForInbox(inbox)
+	if err != nil {
+		return nil, err
+	}
+
+	integration, err := sendIntegration(channel, inbox)
+	if err == nil {
+		now := time.Now()
+		slot, wait := outboundThrottle.admit(integration.ID, entryID, loadSendRateLimit(integration), now)
+		if wait > 0 {
+			return nil, &sendThrottledError{Until: now.Add(wait)}
+		}
+		// Envio recusado pelo provedor não consome o limite
+		defer func() {
+			if sendErr != nil {
+				outboundThrottle.refund(integration.ID, slot)
+			}
+		}()
+	}
+
+	outbound := &OutboundMessage{
+		Inbox:        inbox,
+		Conversation: conversation,
+		Contact:      contact,
+		Content:      message.Content,
+		ContentType:  message.ContentType,
+		Mentions:     opts.Mentions,
+		MentionAll:   opts.MentionAll,
+		Template:     opts.Template,
+		MessageID:    message.ID,
+	}
+	if message.MediaURL != nil {
+		outbound.MediaURL = *message.MediaURL
+	}
+	if message.FileName != nil {
+		outbound.FileName = *message.FileName
+	}
+	if message.InReplyTo != nil && channel.Capabilities().Replies {
+		if quoted, err := repository.GetMessageByID(*message.InReplyTo); err == nil {
+			outbound.ReplyTo = quoted
+		}
+	}
+
+	var result *SendResult
+	switch outbound.ContentType {
+	case "template":
+		result, err = sendTemplate(channel, outbound)
+	case "text", "":
+		result, err = channel.SendText(outbound)
+	default:
+		result, err = channel.SendMedia(outbound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to send message via %s: %w", channel.Provider(), err)
+	}
+	return result, nil
+}
+
+// sendIntegration integração cujo limite de taxa se aplica ao envio
+// (a Evolution também localiza a integração da conta quando a inbox não aponta para ela)
+func sendIntegration(channel Channel, inbox *models.Inbox) (*models.Integration, error) {
+	if _, ok := channel.(evolutionChannel); ok {
+		return findInboxIntegration(inbox)
+	}
+	return repository.GetIntegration(uint(inbox.ChannelID), uint(inbox.AccountID))
+}
+
+// retryableSendError indica falhas temporárias do provedor (rede, timeout, 429, 5xx, SMTP 4xx).
+// Erros de validação, recursos não suportados e janela de atendimento fechada são definitivos.
+func retryableSendError(err error) bool {
+	var providerErr *ProviderError
+	if errors.As(err, &providerErr) {
+		switch {
+		case providerErr.StatusCode == http.StatusRequestTimeout,
+			providerErr.StatusCode == http.StatusTooManyRequests,
+			providerErr.StatusCode >= 500:
+			return true
+		}
+		return false
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// outboxRetryDelay backoff exponencial a partir de outboxRetryBaseDelay, limitado a outboxRetryMaxDelay
+func outboxRetryDelay(attempts int) time.Duration {
+	delay := outboxRetryBaseDelay
+	for i := 1; i < attempts && delay < outboxRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > outboxRetryMaxDelay {
+		delay = outboxRetryMaxDelay
+	}
+	return delay
+}
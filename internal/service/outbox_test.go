@@ -0,0 +1,213 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+func TestOutboxRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, outboxRetryBaseDelay},
+		{1, outboxRetryBaseDelay},
+		{2, 2 * outboxRetryBaseDelay},
+		{3, 4 * outboxRetryBaseDelay},
+		{5, 16 * outboxRetryBaseDelay},
+		{9, 256 * outboxRetryBaseDelay},
+		{10, outboxRetryMaxDelay},
+		{100, outboxRetryMaxDelay},
+	}
+	for _, tt := range tests {
+		if got := outboxRetryDelay(tt.attempts); got != tt.want {
+			t.Errorf("outboxRetryDelay(%d) = %s, want %s", tt.attempts, got, tt.want)
+		}
+	}
+
+	// O atraso nunca diminui entre tentativas
+	for attempts := 1; attempts < outboxMaxAttempts; attempts++ {
+		if outboxRetryDelay(attempts+1) < outboxRetryDelay(attempts) {
+			t.Errorf("delay decreases after attempt %d", attempts)
+		}
+	}
+}
+
+func TestRetryableSendError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"rate limited", &ProviderError{StatusCode: http.StatusTooManyRequests}, true},
+		{"server error", fmt.Errorf("send: %w", &ProviderError{StatusCode: http.StatusBadGateway}), true},
+		{"timeout", &ProviderError{StatusCode: http.StatusRequestTimeout}, true},
+		{"bad request", &ProviderError{StatusCode: http.StatusBadRequest}, false},
+		{"smtp temporary", &textproto.Error{Code: 451}, true},
+		{"smtp permanent", &textproto.Error{Code: 550}, false},
+		{"window closed", ErrMessagingWindowClosed, false},
+		{"other", errors.New("invalid"), false},
+	}
+	for _, tt := range tests {
+		if got := retryableSendError(tt.err); got != tt.want {
+			t.Errorf("%s: retryableSendError = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxEchoMatches(t *testing.T) {
+	text := &models.Message{ContentType: "text", Content: "oi, tudo bem?"}
+	image := &models.Message{ContentType: "image", Content: "foto"}
+	audio := &models.Message{ContentType: "audio"}
+
+	tests := []struct {
+		name    string
+		message *models.Message
+		data    string
+		want    bool
+	}{
+		{"same text", text, `{"conversation":"oi, tudo bem?"}`, true},
+		{"text with mention tokens", text, `{"extendedTextMessage":{"text":"oi, tudo bem? @5511999990000"}}`, true},
+		{"other text", text, `{"conversation":"mensagem do celular"}`, false},
+		{"other type", text, `{"imageMessage":{"caption":"oi, tudo bem?"}}`, false},
+		{"same caption", image, `{"imageMessage":{"caption":"foto"}}`, true},
+		{"other caption", image, `{"imageMessage":{"caption":"outra"}}`, false},
+		{"audio", audio, `{"audioMessage":{"seconds":3}}`, true},
+		{"empty", text, `{}`, false},
+	}
+	for _, tt := range tests {
+		var data map[string]interface{}
+		if err := json.Unmarshal([]byte(tt.data), &data); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if got := outboxEchoMatches(tt.message, data); got != tt.want {
+			t.Errorf("%s: outboxEchoMatches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// evolutionEcho payload de uma mensagem enviada pelo número (fromMe) recebida pelo webhook
+func evolutionEcho(remoteJid, id, text string) []byte {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event": "Message",
+		"data": map[string]interface{}{
+			"key":     map[string]interface{}{"remoteJid": remoteJid, "fromMe": true, "id": id},
+			"message": map[string]interface{}{"conversation": text},
+		},
+	})
+	return payload
+}
+
+func TestEvolutionEchoDuringOutboxSend(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, "evolution", "whatsapp", map[string]interface{}{})
+
+	remoteJid := "5511955550000@s.whatsapp.net"
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), "5511955550000", remoteJid)
+	if err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), uint(contact.ID))
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	message := &models.Message{AccountID: uint(inbox.AccountID), InboxID: uint(inbox.ID), ConversationID: uint(conversation.ID),
+		Content: "oi", ContentType: "text"}
+	if err := QueueOutgoingMessage(message, SendMessageOptions{}); err != nil {
+		t.Fatalf("QueueOutgoingMessage: %v", err)
+	}
+	entries, err := repository.ClaimOutboxMessages(1, time.Minute)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ClaimOutboxMessages = %d entries, %v", len(entries), err)
+	}
+
+	// Mensagem digitada no celular durante o envio: gravada na hora, sem tocar na mensagem pendente
+	if err := ProcessEvolutionWebhook(uint(inbox.ID), evolutionEcho(remoteJid, "PHONE1", "enviada pelo celular")); err != nil {
+		t.Fatalf("ProcessEvolutionWebhook(phone message): %v", err)
+	}
+	phone, err := repository.GetMessageByWhatsAppID("PHONE1")
+	if err != nil || phone.MessageType != models.MessageTypeOutgoing || phone.ID == message.ID {
+		t.Fatalf("phone message = %+v, %v", phone, err)
+	}
+
+	// Eco do envio antes da resposta do provedor: volta à fila
+	if err := ProcessEvolutionWebhook(uint(inbox.ID), evolutionEcho(remoteJid, "SENT1", "oi")); err == nil {
+		t.Fatal("echo of the in-flight send was processed before the provider ID")
+	}
+
+	// O provedor devolve o ID: a nova tentativa do eco é ignorada
+	if err := repository.UpdateMessageFields(message.ID, map[string]interface{}{"status": models.MessageStatusSent, "whatsapp_message_id": "SENT1"}); err != nil {
+		t.Fatalf("UpdateMessageFields: %v", err)
+	}
+	if err := repository.MarkOutboxMessageSent(entries[0].ID); err != nil {
+		t.Fatalf("MarkOutboxMessageSent: %v", err)
+	}
+	if err := ProcessEvolutionWebhook(uint(inbox.ID), evolutionEcho(remoteJid, "SENT1", "oi")); err != nil {
+		t.Fatalf("ProcessEvolutionWebhook(echo retry): %v", err)
+	}
+
+	if messages := inboxMessages(t, conn, inbox.ID); len(messages) != 2 {
+		t.Errorf("stored %d messages, want the queued message and the phone message", len(messages))
+	}
+	stored, err := repository.GetMessageByID(message.ID)
+	if err != nil || stored.WhatsAppMessageID == nil || *stored.WhatsAppMessageID != "SENT1" {
+		t.Errorf("queued message = %+v, %v; want external ID SENT1", stored, err)
+	}
+}
+
+// evolutionReceipt payload de uma confirmação de entrega da Evolution
+func evolutionReceipt(remoteJid, id string) []byte {
+	payload, _ := json.Marshal(map[string]interface{}{
+		"event": "messages.update",
+		"data": map[string]interface{}{
+			"key":    map[string]interface{}{"remoteJid": remoteJid, "fromMe": true, "id": id},
+			"status": "DELIVERY_ACK",
+		},
+	})
+	return payload
+}
+
+func TestEvolutionReceiptDuringOutboxSend(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, "evolution", "whatsapp", map[string]interface{}{})
+
+	busyJid, idleJid := "5511955551111@s.whatsapp.net", "5511955552222@s.whatsapp.net"
+	for _, jid := range []string{busyJid, idleJid} {
+		contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), extractPhoneNumber(jid), jid)
+		if err != nil {
+			t.Fatalf("create contact: %v", err)
+		}
+		conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(inbox.ID), uint(contact.ID))
+		if err != nil {
+			t.Fatalf("create conversation: %v", err)
+		}
+		if jid == busyJid {
+			message := &models.Message{AccountID: uint(inbox.AccountID), InboxID: uint(inbox.ID), ConversationID: uint(conversation.ID),
+				Content: "oi", ContentType: "text"}
+			if err := QueueOutgoingMessage(message, SendMessageOptions{}); err != nil {
+				t.Fatalf("QueueOutgoingMessage: %v", err)
+			}
+		}
+	}
+	if entries, err := repository.ClaimOutboxMessages(10, time.Minute); err != nil || len(entries) != 1 {
+		t.Fatalf("ClaimOutboxMessages = %d entries, %v", len(entries), err)
+	}
+
+	// ID desconhecido em outro chat (mensagem do celular): descartado sem erro
+	if err := ProcessEvolutionWebhook(uint(inbox.ID), evolutionReceipt(idleJid, "PHONE1")); err != nil {
+		t.Errorf("receipt in a chat without in-flight sends: %v", err)
+	}
+	// ID desconhecido no chat com envio em andamento: volta à fila até o ID ser gravado
+	if err := ProcessEvolutionWebhook(uint(inbox.ID), evolutionReceipt(busyJid, "SENT1")); err == nil {
+		t.Error("receipt in the chat of the in-flight send was dropped")
+	}
+}
@@ -0,0 +1,263 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// contactTypingTimeout encerra o "digitando" do contato se a Evolution não enviar "paused"
+	contactTypingTimeout = 25 * time.Second
+	// agentPresenceInterval intervalo mínimo entre reenvios de "composing" ao WhatsApp (o estado expira em ~25s)
+	agentPresenceInterval = 10 * time.Second
+	// agentPresenceTargetTTL tempo em que o destino da Evolution de uma conversa fica em cache para o "digitando"
+	agentPresenceTargetTTL = 5 * time.Minute
+)
+
+var (
+	contactTypingMu     sync.Mutex
+	contactTypingTimers = map[string]*time.Timer{}
+
+	agentPresenceMu   sync.Mutex
+	agentPresenceSent = map[uint]time.Time{} // conversa -> último "composing" enviado
+
+	agentPresenceTargets = map[uint]agentPresenceTarget{} // conversa -> destino da Evolution (protegido por agentPresenceMu)
+)
+
+// agentPresenceTarget destino em cache do repasse de presença; target nil = canal sem presença
+type agentPresenceTarget struct {
+	target    *evolutionTarget
+	expiresAt time.Time
+}
+
+// presenceUpdate estado de presença de um participante em um chat
+type presenceUpdate struct {
+	JID   string
+	State string // composing, recording, paused, available, unavailable
+}
+
+// processPresence processa atualizações de presença (presence.update / ChatPresence) e
+// repassa "digitando" para os inscritos na conversa
+func processPresence(inboxID uint, webhook *EvolutionWebhookPayload) error {
+	data := webhook.Data
+	chat := firstString(data, "id", "Chat", "chat", "remoteJid")
+	if chat == "" {
+		return nil
+	}
+
+	var updates []presenceUpdate
+	if presences, ok := data["presences"].(map[string]interface{}); ok {
+		// Evolution v2: {"id": chat, "presences": {jid: {"lastKnownPresence": "composing"}}}
+		for jid, value := range presences {
+			if presence, ok := value.(map[string]interface{}); ok {
+				updates = append(updates, presenceUpdate{JID: jid, State: firstString(presence, "lastKnownPresence", "presence")})
+			}
+		}
+	} else {
+		// Evolution Go: {"Chat", "Sender", "State": "composing"|"paused", "Media": "audio"}
+		state := strings.ToLower(firstString(data, "State", "state", "presence"))
+		if state == "composing" && strings.EqualFold(firstString(data, "Media", "media"), "audio") {
+			state = "recording"
+		}
+		sender := firstString(data, "Sender", "participant")
+		if sender == "" {
+			sender = chat
+		}
+		updates = append(updates, presenceUpdate{JID: sender, State: state})
+	}
+
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+
+	conversation, err := findConversationForJID(inbox, chat)
+	if err != nil {
+		// Sem conversa ainda: nada a exibir
+		return nil
+	}
+
+	for _, update := range updates {
+		contact := findContactForJID(uint(inbox.AccountID), update.JID)
+		if contact == nil {
+			continue
+		}
+
+		state := strings.ToLower(update.State)
+		setContactTyping(TypingPayload{
+			ConversationID: uint(conversation.ID),
+			SenderType:     "Contact",
+			SenderID:       contact.ID,
+			SenderName:     contact.Name,
+			Recording:      state == "recording",
+		}, state == "composing" || state == "recording")
+	}
+
+	return nil
+}
+
+// setContactTyping dispara typing_on/off do contato; o typing_on expira sozinho após contactTypingTimeout
+func setContactTyping(payload TypingPayload, typing bool) {
+	key := fmt.Sprintf("%d:%d", payload.ConversationID, payload.SenderID)
+
+	contactTypingMu.Lock()
+	timer, active := contactTypingTimers[key]
+	if active {
+		timer.Stop()
+		delete(contactTypingTimers, key)
+	}
+	if typing {
+		contactTypingTimers[key] = time.AfterFunc(contactTypingTimeout, func() {
+			contactTypingMu.Lock()
+			delete(contactTypingTimers, key)
+			contactTypingMu.Unlock()
+			DispatchTyping(payload, false)
+		})
+	}
+	contactTypingMu.Unlock()
+
+	// "paused" sem "composing" anterior não precisa ser repassado
+	if typing || active {
+		DispatchTyping(payload, typing)
+	}
+}
+
+// SetAgentTyping informa que um agente está (ou parou de) digitar: avisa os demais agentes da conversa
+// e repassa a presença ao WhatsApp, reenviando "composing" no máximo a cada agentPresenceInterval
+func SetAgentTyping(conversationID uint, user *models.User, typing bool) error {
+	payload := TypingPayload{
+		ConversationID: conversationID,
+		SenderType:     "User",
+	}
+	if user != nil {
+		payload.SenderID = user.ID
+		payload.SenderName = user.Name
+	}
+	DispatchTyping(payload, typing)
+
+	if !relayAgentPresence(conversationID, typing, time.Now()) {
+		return nil
+	}
+
+	state := "paused"
+	if typing {
+		state = "composing"
+	}
+
+	target, err := agentPresenceTargetFor(conversationID)
+	if err != nil {
+		return err
+	}
+	if target == nil {
+		// Canal sem presença: o "digitando" fica restrito aos agentes
+		return nil
+	}
+
+	go func() {
+		if err := target.Service.SendPresence(target.InstanceName, target.Number, state); err != nil {
+			log.Printf("[SetAgentTyping] Error sending presence %s for conversation %d: %v", state, conversationID, err)
+		}
+	}()
+
+	return nil
+}
+
+// relayAgentPresence registra o "composing" enviado e indica se o novo estado deve ser repassado ao WhatsApp.
+// Ao registrar, descarta as conversas sem reenvio há mais de agentPresenceInterval (agente que saiu sem "paused"):
+// o mapa não cresce indefinidamente e o estado no WhatsApp expira sozinho.
+func relayAgentPresence(conversationID uint, typing bool, now time.Time) bool {
+	agentPresenceMu.Lock()
+	defer agentPresenceMu.Unlock()
+
+	lastSent, composing := agentPresenceSent[conversationID]
+	if !typing {
+		delete(agentPresenceSent, conversationID)
+		return composing
+	}
+	if composing && now.Sub(lastSent) < agentPresenceInterval {
+		return false
+	}
+
+	for id, sent := range agentPresenceSent {
+		if now.Sub(sent) >= agentPresenceInterval {
+			delete(agentPresenceSent, id)
+		}
+	}
+	agentPresenceSent[conversationID] = now
+	return true
+}
+
+// agentPresenceTargetFor destino da Evolution da conversa para o "digitando", com cache de agentPresenceTargetTTL
+// (o relay acontece a cada agentPresenceInterval enquanto o agente digita); nil quando o canal não tem presença
+func agentPresenceTargetFor(conversationID uint) (*evolutionTarget, error) {
+	now := time.Now()
+	agentPresenceMu.Lock()
+	cached, ok := agentPresenceTargets[conversationID]
+	agentPresenceMu.Unlock()
+	if ok && now.Before(cached.expiresAt) {
+		return cached.target, nil
+	}
+
+	target, err := resolveEvolutionTarget(conversationID)
+	if errors.Is(err, ErrChannelUnsupported) {
+		target, err = nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	agentPresenceMu.Lock()
+	for id, entry := range agentPresenceTargets {
+		if !now.Before(entry.expiresAt) {
+			delete(agentPresenceTargets, id)
+		}
+	}
+	agentPresenceTargets[conversationID] = agentPresenceTarget{target: target, expiresAt: now.Add(agentPresenceTargetTTL)}
+	agentPresenceMu.Unlock()
+	return target, nil
+}
+
+// SendPresence envia o estado de presença (composing/paused/recording) para um chat do WhatsApp
+func (s *EvolutionSendService) SendPresence(instanceName, number, state string) error {
+	_, err := s.post("/message/presence", instanceName, map[string]interface{}{
+		"number":  number,
+		"state":   state,
+		"isAudio": state == "recording",
+	})
+	return err
+}
+
+// findConversationForJID encontra a conversa de um chat (contato ou grupo) sem criar nada
+func findConversationForJID(inbox *models.Inbox, jid string) (*models.Conversation, error) {
+	var contactID uint
+	if strings.HasSuffix(jid, "@g.us") {
+		group, err := repository.GetGroupByJID(uint(inbox.ID), jid)
+		if err != nil {
+			return nil, err
+		}
+		contactID = group.ContactID
+	} else {
+		contact := findContactForJID(uint(inbox.AccountID), jid)
+		if contact == nil {
+			return nil, fmt.Errorf("contact not found for %s", jid)
+		}
+		contactID = contact.ID
+	}
+
+	return repository.FindLatestConversation(uint(inbox.ID), contactID)
+}
+
+// findContactForJID busca o contato de um JID pelo telefone normalizado ou pelo identifier
+func findContactForJID(accountID uint, jid string) *models.Contact {
+	contact, err := repository.FindContactByEmailOrPhoneOrIdentifier(accountID, "", extractPhoneNumber(jid), jid)
+	if err != nil || contact == nil {
+		return nil
+	}
+	return contact
+}
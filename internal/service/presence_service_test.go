@@ -0,0 +1,36 @@
+package service
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRelayAgentPresence(t *testing.T) {
+	previous := agentPresenceSent
+	agentPresenceSent = map[uint]time.Time{}
+	t.Cleanup(func() { agentPresenceSent = previous })
+
+	now := time.Now()
+	if !relayAgentPresence(1, true, now) {
+		t.Fatal("first composing not relayed")
+	}
+	if relayAgentPresence(1, true, now.Add(agentPresenceInterval/2)) {
+		t.Error("composing relayed again before the interval")
+	}
+	if !relayAgentPresence(1, true, now.Add(agentPresenceInterval)) {
+		t.Error("composing not renewed after the interval")
+	}
+	if !relayAgentPresence(1, false, now.Add(agentPresenceInterval)) {
+		t.Error("paused after composing not relayed")
+	}
+	if relayAgentPresence(1, false, now.Add(agentPresenceInterval)) {
+		t.Error("paused without composing relayed")
+	}
+
+	// Conversa abandonada sem "paused": descartada no próximo registro
+	relayAgentPresence(2, true, now)
+	relayAgentPresence(3, true, now.Add(agentPresenceInterval))
+	if _, ok := agentPresenceSent[2]; ok || len(agentPresenceSent) != 1 {
+		t.Errorf("agentPresenceSent = %v, want only conversation 3", agentPresenceSent)
+	}
+}
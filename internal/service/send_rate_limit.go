@@ -0,0 +1,278 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand/v2"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Limites padrão das integrações Evolution (números de WhatsApp); os demais canais só têm limite quando configurado
+const (
+	defaultSendRatePerSecond   = 1
+	defaultSendRatePerMinute   = 30
+	defaultTypingDelayMinMs    = 1000
+	defaultTypingDelayMaxMs    = 3000
+	maxTypingDelayMs           = 20000 // A Evolution só responde depois do atraso: abaixo do timeout do cliente HTTP (30s)
+	sendReservationMaxAge      = 5 * time.Minute
+	sendThrottleWindowDuration = time.Minute
+)
+
+// SendRateLimit limites de envio de uma integração, lidos do config
+// (rate_limit_per_second, rate_limit_per_minute, typing_delay_min_ms, typing_delay_max_ms). 0 = sem limite.
+type SendRateLimit struct {
+	PerSecond        int `json:"per_second"`
+	PerMinute        int `json:"per_minute"`
+	TypingDelayMinMs int `json:"typing_delay_min_ms"` // Tempo em "digitando..." antes do envio, sorteado entre min e max
+	TypingDelayMaxMs int `json:"typing_delay_max_ms"`
+}
+
+// loadSendRateLimit lê os limites do config da integração; integrações Evolution partem dos padrões
+// (SEND_RATE_PER_SECOND, SEND_RATE_PER_MINUTE, SEND_TYPING_DELAY_MIN_MS, SEND_TYPING_DELAY_MAX_MS)
+func loadSendRateLimit(integration *models.Integration) SendRateLimit {
+	var limit SendRateLimit
+	switch integration.Provider {
+	case "evolution", "api", "whatsapp":
+		limit = SendRateLimit{
+			PerSecond:        envInt("SEND_RATE_PER_SECOND", defaultSendRatePerSecond),
+			PerMinute:        envInt("SEND_RATE_PER_MINUTE", defaultSendRatePerMinute),
+			TypingDelayMinMs: envInt("SEND_TYPING_DELAY_MIN_MS", defaultTypingDelayMinMs),
+			TypingDelayMaxMs: envInt("SEND_TYPING_DELAY_MAX_MS", defaultTypingDelayMaxMs),
+		}
+	}
+
+	configMap := map[string]interface{}{}
+	if len(integration.Config) > 0 {
+		_ = json.Unmarshal(integration.Config, &configMap)
+	}
+	limit.PerSecond = configInt(configMap, limit.PerSecond, "rate_limit_per_second", "rateLimitPerSecond")
+	limit.PerMinute = configInt(configMap, limit.PerMinute, "rate_limit_per_minute", "rateLimitPerMinute")
+	limit.TypingDelayMinMs = configInt(configMap, limit.TypingDelayMinMs, "typing_delay_min_ms", "typingDelayMinMs")
+	limit.TypingDelayMaxMs = configInt(configMap, limit.TypingDelayMaxMs, "typing_delay_max_ms", "typingDelayMaxMs")
+	if limit.TypingDelayMaxMs > maxTypingDelayMs {
+		limit.TypingDelayMaxMs = maxTypingDelayMs
+	}
+	if limit.TypingDelayMinMs > limit.TypingDelayMaxMs {
+		limit.TypingDelayMinMs = limit.TypingDelayMaxMs
+	}
+	return limit
+}
+
+// TypingDelay sorteia o tempo em "digitando..." de um envio (ms), para não enviar em intervalos fixos
+func (l SendRateLimit) TypingDelay() int {
+	if l.TypingDelayMinMs <= 0 && l.TypingDelayMaxMs <= 0 {
+		return 0
+	}
+	return l.TypingDelayMinMs + rand.IntN(l.TypingDelayMaxMs-l.TypingDelayMinMs+1)
+}
+
+// envInt lê um inteiro não negativo do ambiente
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+		return n
+	}
+	return fallback
+}
+
+// sendThrottle agenda os envios de cada integração respeitando os limites por segundo e por minuto.
+// Cada envio reserva o próximo horário livre (ordem de chegada); como só o envio mais antigo de cada conversa
+// é elegível no outbox, as conversas se alternam nos horários em vez de uma rajada ocupar a fila inteira.
+// O estado é mantido em memória por processo: com várias réplicas cada uma aplica o limite por conta
+// própria, e a taxa efetiva da integração chega a réplicas × limite.
+type sendThrottle struct {
+	mu       sync.Mutex
+	limiters map[uint]*sendLimiter
+}
+
+// sendLimiter horários de envio de uma integração
+type sendLimiter struct {
+	slots    []time.Time        // Horários reservados no último minuto e no futuro, em ordem
+	reserved map[uint]time.Time // Envios do outbox adiados, pelo ID da entrada
+}
+
+var outboundThrottle = &sendThrottle{limiters: map[uint]*sendLimiter{}}
+
+// admit reserva um horário para o envio; retorna o horário e 0 quando ele pode sair agora, ou quanto tempo aguardar
+func (t *sendThrottle) admit(integrationID, entryID uint, limit SendRateLimit, now time.Time) (time.Time, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l := t.limiters[integrationID]
+	if l == nil {
+		l = &sendLimiter{reserved: map[uint]time.Time{}}
+		t.limiters[integrationID] = l
+	}
+	l.prune(now)
+
+	// Envio que já tinha horário reservado
+	if slot, ok := l.reserved[entryID]; ok {
+		if now.Before(slot) {
+			return slot, slot.Sub(now)
+		}
+		delete(l.reserved, entryID)
+		return slot, 0
+	}
+
+	slot := l.next(now, limit)
+	l.slots = append(l.slots, slot)
+	if !slot.After(now) {
+		return slot, 0
+	}
+	l.reserved[entryID] = slot
+	return slot, slot.Sub(now)
+}
+
+// refund devolve o horário de um envio que falhou no provedor, para não contar no limite
+func (t *sendThrottle) refund(integrationID uint, slot time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	l := t.limiters[integrationID]
+	if l == nil {
+		return
+	}
+	for i := range l.slots {
+		if l.slots[i].Equal(slot) {
+			l.slots = append(l.slots[:i], l.slots[i+1:]...)
+			return
+		}
+	}
+}
+
+// next primeiro horário a partir de now que respeita os limites, depois de todos os já reservados
+func (l *sendLimiter) next(now time.Time, limit SendRateLimit) time.Time {
+	slot := now
+	n := len(l.slots)
+	if n == 0 {
+		return slot
+	}
+	if last := l.slots[n-1]; last.After(slot) {
+		slot = last
+	}
+	if limit.PerSecond > 0 && n >= limit.PerSecond {
+		if at := l.slots[n-limit.PerSecond].Add(time.Second); at.After(slot) {
+			slot = at
+		}
+	}
+	if limit.PerMinute > 0 && n >= limit.PerMinute {
+		if at := l.slots[n-limit.PerMinute].Add(time.Minute); at.After(slot) {
+			slot = at
+		}
+	}
+	return slot
+}
+
+// prune descarta horários fora da janela de um minuto e reservas abandonadas (ex: mensagem removida)
+func (l *sendLimiter) prune(now time.Time) {
+	cutoff := now.Add(-sendThrottleWindowDuration)
+	i := 0
+	for i < len(l.slots) && !l.slots[i].After(cutoff) {
+		i++
+	}
+	l.slots = l.slots[i:]
+
+	for entryID, slot := range l.reserved {
+		if now.Sub(slot) > sendReservationMaxAge {
+			delete(l.reserved, entryID)
+		}
+	}
+}
+
+// SendThrottleState estado do limitador de envio de uma integração
+type SendThrottleState struct {
+	Throttled      bool       `json:"throttled"`        // Há envios aguardando o horário reservado
+	Waiting        int        `json:"waiting"`          // Envios adiados pelo limite
+	NextSlotAt     *time.Time `json:"next_slot_at"`     // Horário do último envio agendado, quando no futuro
+	SentLastSecond int        `json:"sent_last_second"` // Horários usados no último segundo
+	SentLastMinute int        `json:"sent_last_minute"` // Horários usados no último minuto
+}
+
+// state resumo do limitador da integração
+func (t *sendThrottle) state(integrationID uint, now time.Time) SendThrottleState {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	var state SendThrottleState
+	l := t.limiters[integrationID]
+	if l == nil {
+		return state
+	}
+	l.prune(now)
+
+	for _, slot := range l.slots {
+		if slot.After(now) {
+			continue
+		}
+		state.SentLastMinute++
+		if slot.After(now.Add(-time.Second)) {
+			state.SentLastSecond++
+		}
+	}
+	state.Waiting = len(l.reserved)
+	state.Throttled = state.Waiting > 0
+	if n := len(l.slots); n > 0 && l.slots[n-1].After(now) {
+		last := l.slots[n-1]
+		state.NextSlotAt = &last
+	}
+	return state
+}
+
+// SendQueueStatus fila de envio e limites de uma integração
+type SendQueueStatus struct {
+	IntegrationID uint                         `json:"integration_id"`
+	Limits        SendRateLimit                `json:"limits"`
+	Queue         *repository.OutboxQueueStats `json:"queue"`
+	Throttle      SendThrottleState            `json:"throttle"`
+}
+
+// GetSendQueueStatus profundidade da fila do outbox e estado do limite de taxa das inboxes da integração
+func GetSendQueueStatus(integration *models.Integration) (*SendQueueStatus, error) {
+	inboxIDs, err := sendQueueInboxIDs(integration)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inboxes: %w", err)
+	}
+
+	queue, err := repository.GetOutboxQueueStats(inboxIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count queued messages: %w", err)
+	}
+
+	return &SendQueueStatus{
+		IntegrationID: integration.ID,
+		Limits:        loadSendRateLimit(integration),
+		Queue:         queue,
+		Throttle:      outboundThrottle.state(integration.ID, time.Now()),
+	}, nil
+}
+
+// sendQueueInboxIDs inboxes cujos envios passam pelo limite da integração, incluindo as inboxes Evolution
+// sem integração própria que chegam a ela pela busca da conta (findInboxIntegration)
+func sendQueueInboxIDs(integration *models.Integration) ([]uint64, error) {
+	inboxIDs, err := repository.ListInboxIDsByIntegration(integration.ID)
+	if err != nil {
+		return nil, err
+	}
+	if integration.Provider != "evolution" && integration.Provider != "api" {
+		return inboxIDs, nil
+	}
+
+	inboxes, err := repository.ListInboxesWithoutIntegration(integration.AccountID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range inboxes {
+		channel, err := ChannelForInbox(&inboxes[i])
+		if err != nil {
+			continue
+		}
+		if fallback, err := sendIntegration(channel, &inboxes[i]); err == nil && fallback.ID == integration.ID {
+			inboxIDs = append(inboxIDs, inboxes[i].ID)
+		}
+	}
+	return inboxIDs, nil
+}
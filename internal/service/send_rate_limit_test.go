@@ -0,0 +1,104 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+func TestSendThrottleAdmit(t *testing.T) {
+	throttle := &sendThrottle{limiters: map[uint]*sendLimiter{}}
+	limit := SendRateLimit{PerSecond: 1, PerMinute: 2}
+	now := time.Now()
+
+	if _, wait := throttle.admit(1, 10, limit, now); wait != 0 {
+		t.Fatalf("first send waits %s", wait)
+	}
+	slot, wait := throttle.admit(1, 11, limit, now)
+	if wait != time.Second || !slot.Equal(now.Add(time.Second)) {
+		t.Fatalf("second send = %s after %s, want the next second", slot, wait)
+	}
+	// O envio adiado mantém o horário reservado
+	if _, wait := throttle.admit(1, 11, limit, now.Add(500*time.Millisecond)); wait != 500*time.Millisecond {
+		t.Errorf("deferred send waits %s, want 500ms", wait)
+	}
+	if _, wait := throttle.admit(1, 11, limit, now.Add(time.Second)); wait != 0 {
+		t.Errorf("deferred send waits %s at its slot", wait)
+	}
+	// Limite por minuto atingido
+	if _, wait := throttle.admit(1, 12, limit, now.Add(time.Second)); wait != time.Minute-time.Second {
+		t.Errorf("third send waits %s, want %s", wait, time.Minute-time.Second)
+	}
+	// Outra integração tem limites próprios
+	if _, wait := throttle.admit(2, 20, limit, now); wait != 0 {
+		t.Errorf("send of another integration waits %s", wait)
+	}
+}
+
+func TestSendThrottleRefund(t *testing.T) {
+	throttle := &sendThrottle{limiters: map[uint]*sendLimiter{}}
+	limit := SendRateLimit{PerMinute: 1}
+	now := time.Now()
+
+	slot, wait := throttle.admit(1, 10, limit, now)
+	if wait != 0 {
+		t.Fatalf("first send waits %s", wait)
+	}
+	// Envio que falhou no provedor devolve o horário
+	throttle.refund(1, slot)
+	if state := throttle.state(1, now); state.SentLastMinute != 0 {
+		t.Errorf("SentLastMinute after refund = %d, want 0", state.SentLastMinute)
+	}
+	if _, wait := throttle.admit(1, 11, limit, now); wait != 0 {
+		t.Errorf("send after refund waits %s", wait)
+	}
+	if _, wait := throttle.admit(1, 12, limit, now); wait == 0 {
+		t.Error("send above the limit admitted")
+	}
+
+	// Refund de integração ou horário desconhecidos não altera nada
+	throttle.refund(2, slot)
+	throttle.refund(1, now.Add(-time.Hour))
+	if state := throttle.state(1, now); state.SentLastMinute != 1 {
+		t.Errorf("SentLastMinute = %d, want 1", state.SentLastMinute)
+	}
+}
+
+func TestGetSendQueueStatusIncludesFallbackInboxes(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, "evolution", "whatsapp", map[string]interface{}{})
+
+	// Inbox Evolution cujo channel_id não aponta para uma integração: usa a integração da conta
+	fallback := models.Inbox{AccountID: inbox.AccountID, Name: "WhatsApp antigo", ChannelType: "whatsapp", ChannelID: 999999}
+	if err := conn.Create(&fallback).Error; err != nil {
+		t.Fatalf("create inbox: %v", err)
+	}
+	contact, err := repository.FindOrCreateContactByPhone(uint(inbox.AccountID), "5511966660000", "")
+	if err != nil {
+		t.Fatalf("create contact: %v", err)
+	}
+	conversation, err := repository.FindOrCreateConversation(uint(inbox.AccountID), uint(fallback.ID), uint(contact.ID))
+	if err != nil {
+		t.Fatalf("create conversation: %v", err)
+	}
+	message := &models.Message{AccountID: uint(inbox.AccountID), InboxID: uint(fallback.ID), ConversationID: uint(conversation.ID),
+		Content: "oi", ContentType: "text"}
+	if err := QueueOutgoingMessage(message, SendMessageOptions{}); err != nil {
+		t.Fatalf("QueueOutgoingMessage: %v", err)
+	}
+
+	integration := models.Integration{}
+	if err := conn.First(&integration, inbox.ChannelID).Error; err != nil {
+		t.Fatalf("load integration: %v", err)
+	}
+	status, err := GetSendQueueStatus(&integration)
+	if err != nil {
+		t.Fatalf("GetSendQueueStatus: %v", err)
+	}
+	if status.Queue.Pending != 1 {
+		t.Errorf("pending = %d, want the fallback inbox send counted", status.Queue.Pending)
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mensager-go/internal/db"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"os"
+	"strconv"
+
+	"gorm.io/datatypes"
+)
+
+// webhookSecretsConfigKey chave do config da integração com os segredos de webhook por inbox
+const webhookSecretsConfigKey = "webhook_secrets"
+
+// ErrWebhookUnauthorized indica um webhook sem credencial válida para a inbox
+var ErrWebhookUnauthorized = errors.New("invalid webhook credentials")
+
+// WebhookCredentials credenciais apresentadas por um webhook recebido
+type WebhookCredentials struct {
+	URLToken      string // ?token=
+	HeaderToken   string // X-Webhook-Token
+	InstanceToken string // instanceToken do payload da Evolution
+}
+
+// RotateInboxWebhookSecret gera um novo segredo de webhook para a inbox e o grava no config da integração.
+// Canais que registram o webhook no provedor (ex.: Telegram) recebem a nova URL antes: se o provedor recusar,
+// nada é gravado e o segredo anterior continua valendo. Depois de gravado, o anterior deixa de ser aceito.
+func RotateInboxWebhookSecret(inbox *models.Inbox) (string, error) {
+	integration, err := findInboxIntegration(inbox)
+	if err != nil {
+		return "", err
+	}
+
+	secret, err := generateWebhookSecret()
+	if err != nil {
+		return "", err
+	}
+
+	if err := InstallInboxWebhook(inbox, secret); err != nil &&
+		!errors.Is(err, ErrChannelUnsupported) && !errors.Is(err, ErrChannelNotFound) {
+		return "", fmt.Errorf("failed to install webhook: %w", err)
+	}
+
+	configMap := map[string]interface{}{}
+	if len(integration.Config) > 0 {
+		if err := json.Unmarshal(integration.Config, &configMap); err != nil {
+			return "", fmt.Errorf("failed to parse integration config: %w", err)
+		}
+	}
+
+	secrets, _ := configMap[webhookSecretsConfigKey].(map[string]interface{})
+	if secrets == nil {
+		secrets = map[string]interface{}{}
+	}
+	secrets[strconv.FormatUint(inbox.ID, 10)] = secret
+	configMap[webhookSecretsConfigKey] = secrets
+
+	configBytes, err := json.Marshal(configMap)
+	if err != nil {
+		return "", err
+	}
+	if err := db.Instance.Model(integration).Update("config", datatypes.JSON(configBytes)).Error; err != nil {
+		return "", fmt.Errorf("failed to store webhook secret: %w", err)
+	}
+
+	return secret, nil
+}
+
+// VerifyEvolutionWebhook valida as credenciais de um webhook da Evolution para a inbox.
+// Aceita o segredo da inbox via token na URL, header ou instanceToken, ou o token da instância configurado na integração.
+func VerifyEvolutionWebhook(inboxID uint, creds WebhookCredentials) error {
+	inbox, err := repository.GetInboxByID(inboxID)
+	if err != nil {
+		return fmt.Errorf("inbox not found: %w", err)
+	}
+
+	integration, err := findInboxIntegration(inbox)
+	if err != nil {
+		return err
+	}
+
+	configMap := map[string]interface{}{}
+	if len(integration.Config) > 0 {
+		if err := json.Unmarshal(integration.Config, &configMap); err != nil {
+			return fmt.Errorf("failed to parse integration config: %w", err)
+		}
+	}
+
+	secret := inboxWebhookSecret(configMap, inbox)
+	instanceToken := firstString(configMap, "instance_token", "instanceToken", "api_key", "apiKey", "token", "EvolutionAPIToken")
+
+	if secret != "" {
+		for _, candidate := range []string{creds.URLToken, creds.HeaderToken, creds.InstanceToken} {
+			if secureEqual(candidate, secret) {
+				return nil
+			}
+		}
+	}
+	if instanceToken != "" && secureEqual(creds.InstanceToken, instanceToken) {
+		return nil
+	}
+
+	// Inboxes criadas antes dos segredos por inbox: aceitas apenas se explicitamente liberado
+	if secret == "" && os.Getenv("EVOLUTION_WEBHOOK_ALLOW_UNSIGNED") == "true" {
+		return nil
+	}
+
+	return ErrWebhookUnauthorized
+}
+
+// inboxWebhookSecret lê o segredo de webhook da inbox no config da integração
+func inboxWebhookSecret(configMap map[string]interface{}, inbox *models.Inbox) string {
+	if secrets, ok := configMap[webhookSecretsConfigKey].(map[string]interface{}); ok {
+		return getString(secrets, strconv.FormatUint(inbox.ID, 10))
+	}
+	return ""
+}
+
+// InboxWebhookURL monta a URL de webhook do canal que atende a inbox, com o segredo como token
+func InboxWebhookURL(inbox *models.Inbox, secret string) string {
+	provider := "evolution"
+	if channel, err := ChannelForInbox(inbox); err == nil {
+		provider = channel.Provider()
+	}
+
+	serverURL := os.Getenv("SERVER_URL")
+	if serverURL == "" {
+		serverURL = "http://localhost:4120"
+	}
+	return fmt.Sprintf("%s/api/v1/webhooks/%s?inbox_id=%d&token=%s", serverURL, provider, inbox.ID, secret)
+}
+
+// generateWebhookSecret gera um segredo aleatório de 256 bits em hexadecimal
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// secureEqual compara tokens em tempo constante (vazio nunca confere)
+func secureEqual(candidate, expected string) bool {
+	if candidate == "" || expected == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(candidate), []byte(expected)) == 1
+}
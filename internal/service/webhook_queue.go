@@ -0,0 +1,313 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+	"os"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/datatypes"
+)
+
+const (
+	defaultWebhookWorkers = 4
+	webhookMaxAttempts    = 6
+	webhookRetryBaseDelay = 5 * time.Second
+	webhookRetryMaxDelay  = 15 * time.Minute
+	webhookPollInterval   = 5 * time.Second
+	webhookLeaseDuration  = 5 * time.Minute // Renovada a cada terço enquanto o webhook está em andamento
+
+	defaultWebhookLogRetentionDays = 7
+	webhookLogPurgeInterval        = time.Hour
+	webhookLogPurgeBatch           = 1000
+)
+
+// WebhookQueue processa os webhooks gravados em webhook_logs com um pool limitado de workers.
+// A ordem por conversa é garantida na reserva (ClaimWebhookLogs): só um webhook por ordering_key fica em andamento.
+// A reserva é um lease (locked_until): webhooks de um worker ou réplica interrompidos voltam à fila quando ele expira.
+type WebhookQueue struct {
+	workers  int
+	jobs     chan models.WebhookLog
+	wake     chan struct{}
+	inFlight int32
+}
+
+var webhookQueue *WebhookQueue
+
+// StartWebhookQueue inicia o dispatcher e os workers da fila de webhooks (WEBHOOK_WORKERS, padrão 4)
+func StartWebhookQueue() {
+	workers := defaultWebhookWorkers
+	if n, err := strconv.Atoi(os.Getenv("WEBHOOK_WORKERS")); err == nil && n > 0 {
+		workers = n
+	}
+
+	q := &WebhookQueue{
+		workers: workers,
+		jobs:    make(chan models.WebhookLog, workers),
+		wake:    make(chan struct{}, 1),
+	}
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+	go q.dispatcher()
+	go purgeWebhookLogs()
+
+	webhookQueue = q
+	log.Printf("[WebhookQueue] Started with %d workers", workers)
+}
+
+// purgeWebhookLogs apaga periodicamente os webhooks processados com sucesso há mais de
+// WEBHOOK_LOG_RETENTION_DAYS dias (padrão 7; 0 desativa). O payload bruto inclui mídia em base64.
+func purgeWebhookLogs() {
+	days := envInt("WEBHOOK_LOG_RETENTION_DAYS", defaultWebhookLogRetentionDays)
+	if days == 0 {
+		return
+	}
+	retention := time.Duration(days) * 24 * time.Hour
+
+	ticker := time.NewTicker(webhookLogPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		var total int64
+		before := time.Now().Add(-retention)
+		for {
+			n, err := repository.PurgeWebhookLogs(before, webhookLogPurgeBatch)
+			if err != nil {
+				log.Printf("[WebhookQueue] Error purging processed webhooks: %v", err)
+				break
+			}
+			total += n
+			if n < webhookLogPurgeBatch {
+				break
+			}
+		}
+		if total > 0 {
+			log.Printf("[WebhookQueue] Purged %d webhooks processed before %s", total, before.Format(time.RFC3339))
+		}
+		<-ticker.C
+	}
+}
+
+// EnqueueWebhook grava o payload bruto em webhook_logs e acorda a fila. O processamento é assíncrono.
+// Lotes de vários chats são gravados em um webhook por chat (webhookSplitter); retorna o primeiro.
+func EnqueueWebhook(inboxID uint, provider string, payload []byte) (*models.WebhookLog, error) {
+	if !json.Valid(payload) {
+		return nil, fmt.Errorf("invalid JSON payload")
+	}
+
+	channel, _ := ChannelByProvider(provider)
+	parts := [][]byte{payload}
+	if splitter, ok := channel.(webhookSplitter); ok {
+		if split := splitter.SplitWebhook(payload); len(split) > 1 {
+			parts = split
+		}
+	}
+
+	webhookLogs := make([]models.WebhookLog, 0, len(parts))
+	for _, part := range parts {
+		var event, orderingKey string
+		if router, ok := channel.(webhookRouter); ok {
+			event, orderingKey = router.RoutingInfo(inboxID, part)
+		}
+		webhookLogs = append(webhookLogs, models.WebhookLog{
+			InboxID:     &inboxID,
+			Provider:    provider,
+			Payload:     datatypes.JSON(part),
+			Status:      models.WebhookLogStatusPending,
+			Event:       event,
+			OrderingKey: orderingKey,
+		})
+	}
+	if err := repository.CreateWebhookLogs(webhookLogs); err != nil {
+		return nil, fmt.Errorf("failed to store webhook: %w", err)
+	}
+
+	if webhookQueue != nil {
+		webhookQueue.Wake()
+	}
+
+	return &webhookLogs[0], nil
+}
+
+// Wake pede ao dispatcher uma nova rodada de reserva sem esperar o intervalo de polling
+func (q *WebhookQueue) Wake() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *WebhookQueue) dispatcher() {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.wake:
+		case <-ticker.C:
+		}
+		q.dispatch()
+	}
+}
+
+// dispatch reserva webhooks prontos até o limite de workers livres
+func (q *WebhookQueue) dispatch() {
+	free := q.workers - int(atomic.LoadInt32(&q.inFlight))
+	if free <= 0 {
+		return
+	}
+
+	logs, err := repository.ClaimWebhookLogs(free, webhookLeaseDuration)
+	if err != nil {
+		log.Printf("[WebhookQueue] Error claiming webhooks: %v", err)
+		return
+	}
+
+	for _, webhookLog := range logs {
+		atomic.AddInt32(&q.inFlight, 1)
+		q.jobs <- webhookLog
+	}
+}
+
+func (q *WebhookQueue) worker() {
+	for job := range q.jobs {
+		q.process(job)
+		atomic.AddInt32(&q.inFlight, -1)
+		q.Wake()
+	}
+}
+
+// process executa um webhook e registra sucesso, nova tentativa com backoff ou dead-letter
+func (q *WebhookQueue) process(job models.WebhookLog) {
+	err := runLeasedWebhookLog(job)
+	if err == nil {
+		if err := repository.MarkWebhookLogSuccess(job.ID); err != nil {
+			log.Printf("[WebhookQueue] Error marking webhook %d as processed: %v", job.ID, err)
+		}
+		return
+	}
+
+	if job.Attempts >= webhookMaxAttempts {
+		log.Printf("[WebhookQueue] Webhook %d moved to dead-letter after %d attempts: %v", job.ID, job.Attempts, err)
+		if err := repository.MarkWebhookLogFailed(job.ID, models.WebhookLogStatusDead, err.Error(), nil); err != nil {
+			log.Printf("[WebhookQueue] Error updating webhook %d: %v", job.ID, err)
+		}
+		return
+	}
+
+	next := time.Now().Add(webhookRetryDelay(job.Attempts))
+	log.Printf("[WebhookQueue] Webhook %d failed (attempt %d/%d), retrying at %s: %v", job.ID, job.Attempts, webhookMaxAttempts, next.Format(time.RFC3339), err)
+	if err := repository.MarkWebhookLogFailed(job.ID, models.WebhookLogStatusRetry, err.Error(), &next); err != nil {
+		log.Printf("[WebhookQueue] Error updating webhook %d: %v", job.ID, err)
+	}
+}
+
+// runLeasedWebhookLog processa o webhook renovando a sua reserva até o fim do processamento
+func runLeasedWebhookLog(job models.WebhookLog) error {
+	done := make(chan struct{})
+	go keepWebhookLogLease(job.ID, done)
+	err := runWebhookLog(job)
+	close(done)
+	return err
+}
+
+// keepWebhookLogLease renova a reserva do webhook até done ser fechado
+func keepWebhookLogLease(id uint, done <-chan struct{}) {
+	ticker := time.NewTicker(webhookLeaseDuration / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if ok, err := repository.ExtendWebhookLogLease(id, time.Now().Add(webhookLeaseDuration)); err != nil {
+				log.Printf("[WebhookQueue] Error extending lease of webhook %d: %v", id, err)
+			} else if !ok {
+				return
+			}
+		}
+	}
+}
+
+// runWebhookLog processa o payload gravado, convertendo panics em erro para não derrubar o worker
+func runWebhookLog(job models.WebhookLog) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic while processing webhook: %v", r)
+		}
+	}()
+
+	if job.InboxID == nil {
+		return fmt.Errorf("webhook without inbox_id")
+	}
+
+	// Registros antigos não tinham provider: eram todos da Evolution
+	provider := job.Provider
+	if provider == "" {
+		provider = "evolution"
+	}
+
+	channel, err := ChannelByProvider(provider)
+	if err != nil {
+		return fmt.Errorf("unsupported webhook provider: %s", job.Provider)
+	}
+	return channel.ProcessWebhook(*job.InboxID, job.Payload)
+}
+
+// webhookRetryDelay backoff exponencial a partir de webhookRetryBaseDelay, limitado a webhookRetryMaxDelay
+func webhookRetryDelay(attempts int) time.Duration {
+	delay := webhookRetryBaseDelay
+	for i := 1; i < attempts && delay < webhookRetryMaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMaxDelay {
+		delay = webhookRetryMaxDelay
+	}
+	return delay
+}
+
+// ErrWebhookNotReplayable indica que o webhook já está em andamento
+var ErrWebhookNotReplayable = errors.New("webhook is already being processed")
+
+// ReplayWebhookLog reprocessa imediatamente um webhook, inclusive um já processado com sucesso
+// (as mensagens são deduplicadas pelo ID externo). A reserva é atômica, então replays
+// simultâneos (ou a própria fila) não processam o mesmo webhook duas vezes.
+func ReplayWebhookLog(webhookLog *models.WebhookLog) error {
+	claimed, err := repository.ClaimWebhookLogForReplay(webhookLog.ID, webhookLeaseDuration)
+	if err != nil {
+		return fmt.Errorf("failed to claim webhook: %w", err)
+	}
+	if !claimed {
+		return ErrWebhookNotReplayable
+	}
+
+	if err := runLeasedWebhookLog(*webhookLog); err != nil {
+		if markErr := repository.MarkWebhookLogFailed(webhookLog.ID, models.WebhookLogStatusDead, err.Error(), nil); markErr != nil {
+			log.Printf("[ReplayWebhookLog] Error updating webhook %d: %v", webhookLog.ID, markErr)
+		}
+		return err
+	}
+
+	return repository.MarkWebhookLogSuccess(webhookLog.ID)
+}
+
+// RequeueWebhookLogs devolve um intervalo de webhooks à fila para reprocessamento em ordem
+func RequeueWebhookLogs(filter repository.WebhookLogFilter) (int64, error) {
+	count, err := repository.RequeueWebhookLogs(filter)
+	if err != nil {
+		return 0, err
+	}
+
+	if count > 0 && webhookQueue != nil {
+		webhookQueue.Wake()
+	}
+	return count, nil
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"mensager-go/internal/db/dbtest"
+	"mensager-go/internal/models"
+	"mensager-go/internal/repository"
+)
+
+func TestReplayWebhookLogReprocessesSuccessfulWebhook(t *testing.T) {
+	conn := dbtest.Open(t)
+	inbox := createChannelInbox(t, conn, smsProvider, smsProvider, map[string]interface{}{"account_sid": "AC1", "auth_token": "token"})
+
+	payload, _ := json.Marshal(map[string]string{"MessageSid": "SM-replay-1", "SmsStatus": "received", "From": "+5511977776666", "Body": "oi"})
+	webhookLog, err := EnqueueWebhook(uint(inbox.ID), smsProvider, payload)
+	if err != nil {
+		t.Fatalf("EnqueueWebhook: %v", err)
+	}
+	// Processado com "sucesso" por uma versão com bug que descartou a mensagem
+	if err := repository.MarkWebhookLogSuccess(webhookLog.ID); err != nil {
+		t.Fatalf("MarkWebhookLogSuccess: %v", err)
+	}
+
+	for replay := 0; replay < 2; replay++ {
+		if err := ReplayWebhookLog(webhookLog); err != nil {
+			t.Fatalf("ReplayWebhookLog #%d: %v", replay+1, err)
+		}
+	}
+	if messages := inboxMessages(t, conn, inbox.ID); len(messages) != 1 || messages[0].Content != "oi" {
+		t.Errorf("messages = %+v, want one message from the replayed webhook", messages)
+	}
+
+	var stored models.WebhookLog
+	conn.First(&stored, webhookLog.ID)
+	if stored.Status != models.WebhookLogStatusSuccess {
+		t.Errorf("status = %q, want success", stored.Status)
+	}
+
+	// Em andamento: não pode ser reprocessado em paralelo
+	conn.Model(&models.WebhookLog{}).Where("id = ?", webhookLog.ID).Update("status", models.WebhookLogStatusProcessing)
+	if err := ReplayWebhookLog(webhookLog); !errors.Is(err, ErrWebhookNotReplayable) {
+		t.Errorf("replay of a processing webhook = %v, want ErrWebhookNotReplayable", err)
+	}
+}
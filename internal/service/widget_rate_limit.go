@@ -0,0 +1,65 @@
+package service
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Limites padrão de criação de sessões do widget por minuto
+const (
+	defaultWidgetSessionsPerIP    = 10
+	defaultWidgetSessionsPerInbox = 300
+	widgetSessionWindowDuration   = time.Minute
+)
+
+// widgetSessionLimiter conta as sessões criadas por IP e por inbox em janelas fixas de um minuto
+// (WIDGET_SESSION_RATE_PER_IP, WIDGET_SESSION_RATE_PER_INBOX; 0 = sem limite).
+// O estado é mantido em memória por processo: com várias réplicas o limite vale para cada uma.
+type widgetSessionLimiter struct {
+	mu        sync.Mutex
+	windows   map[string]*widgetSessionWindow
+	lastPrune time.Time
+}
+
+// widgetSessionWindow sessões criadas na janela iniciada em start
+type widgetSessionWindow struct {
+	start time.Time
+	count int
+}
+
+var widgetSessions = &widgetSessionLimiter{windows: map[string]*widgetSessionWindow{}}
+
+// allow registra uma criação de sessão; retorna false sem contar quando o IP ou a inbox já atingiu o limite
+func (l *widgetSessionLimiter) allow(inboxID uint, clientIP string, perIP, perInbox int, now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastPrune) > widgetSessionWindowDuration {
+		for key, window := range l.windows {
+			if now.Sub(window.start) >= widgetSessionWindowDuration {
+				delete(l.windows, key)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	ipWindow := l.window(fmt.Sprintf("ip:%d:%s", inboxID, clientIP), now)
+	inboxWindow := l.window(fmt.Sprintf("inbox:%d", inboxID), now)
+	if (perIP > 0 && ipWindow.count >= perIP) || (perInbox > 0 && inboxWindow.count >= perInbox) {
+		return false
+	}
+	ipWindow.count++
+	inboxWindow.count++
+	return true
+}
+
+// window janela atual da chave (nova quando a anterior expirou)
+func (l *widgetSessionLimiter) window(key string, now time.Time) *widgetSessionWindow {
+	window := l.windows[key]
+	if window == nil || now.Sub(window.start) >= widgetSessionWindowDuration {
+		window = &widgetSessionWindow{start: now}
+		l.windows[key] = window
+	}
+	return window
+}